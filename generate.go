@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tylertreat/httpmonitor/monitor"
+)
+
+// runGenerate implements the generate subcommand, which writes synthetic logs
+// to stdout or a file until the duration elapses or it's interrupted.
+func runGenerate(args []string) error {
+	var (
+		output   string
+		logRate  float64
+		duration time.Duration
+		opts     monitor.GenerateOpts
+		flags    = flag.NewFlagSet("generate", flag.ExitOnError)
+	)
+	flags.DurationVar(&duration, "duration", 0, "How long to generate logs for (until interrupted if 0)")
+	flags.StringVar(&output, "output", "", "Log file to append to (stdout if empty)")
+	flags.Float64Var(&logRate, "rate", 10, "Number of logs to generate per second")
+	flags.Var((*stringList)(&opts.Sections), "sections",
+		"Comma-separated sections to request, repeated to weight them, e.g. /api,/api,/pages (default /)")
+	flags.Var((*intList)(&opts.Statuses), "statuses",
+		"Comma-separated status codes to respond with, repeated to weight them, e.g. 200,200,200,500 (default 200)")
+	flags.Int64Var(&opts.MinSize, "min-size", 100, "Minimum response size in bytes")
+	flags.Int64Var(&opts.MaxSize, "max-size", 10000, "Maximum response size in bytes")
+	flags.Var((*stringList)(&opts.RemoteAddrs), "ips",
+		"Comma-separated remote IP addresses of clients (default 127.0.0.1)")
+	flags.BoolVar(&opts.Combined, "combined", false, "Generate logs in Combined Log Format")
+	flags.Int64Var(&opts.Seed, "seed", 0, "Seed for random choices (current time if 0)")
+	flags.Parse(args)
+
+	w := os.Stdout
+	if output != "" {
+		file, err := os.OpenFile(output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-c
+		cancel()
+	}()
+
+	if err := monitor.GenerateCLFContext(ctx, w, logRate, duration, opts); err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// intList is a flag.Value for a comma-separated list of ints.
+type intList []int
+
+func (l *intList) String() string {
+	values := make([]string, len(*l))
+	for i, v := range *l {
+		values[i] = strconv.Itoa(v)
+	}
+	return strings.Join(values, ",")
+}
+
+func (l *intList) Set(value string) error {
+	*l = nil
+	for _, s := range strings.Split(value, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		*l = append(*l, v)
+	}
+	return nil
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -12,56 +16,448 @@ import (
 )
 
 const (
-	defaultReportingInterval = 10 * time.Second
-	defaultAlertWindow       = 2 * time.Minute
-	defaultAlertThreshold    = 50
+	defaultReportingInterval    = 10 * time.Second
+	defaultAlertWindow          = 2 * time.Minute
+	defaultAlertThreshold       = 50
+	defaultHistRotationInterval = time.Minute
 )
 
+// buildVersion is the release version, which is set at build time with
+// -ldflags "-X main.buildVersion=...".
+var buildVersion = "dev"
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "generate" {
+		if err := runGenerate(os.Args[2:]); err != nil {
+			fmt.Printf("Failed to generate logs: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var (
-		file string
-		opts = monitor.MonitorOpts{Output: os.Stdout}
+		file       string
+		syslogAddr string
+		follow     bool
+		tui        bool
+		version    bool
+		opts       = monitor.MonitorOpts{Output: os.Stdout}
 	)
-	flag.StringVar(&file, "file", "", "Log file to read from")
+	flag.StringVar(&file, "file", "",
+		"Log file, glob pattern, or http(s):// or s3:// URL to read from, or a comma-separated list of them (use - or omit to read from piped stdin)")
+	flag.StringVar(&syslogAddr, "syslog", "",
+		"Address on which to receive RFC 5424 syslog messages containing logs over TCP and UDP instead of reading a file, e.g. :5140")
+	flag.BoolVar(&follow, "follow", true,
+		"Wait for new logs to be appended to the file (if false, exit once the end of the file is reached)")
+	flag.BoolVar(&opts.Reverse, "reverse", false,
+		"Read the file from the last line to the first to summarize recent activity quickly (requires follow=false)")
+	flag.BoolVar(&opts.SummaryOnStop, "final-summary", true,
+		"Print a final summary of the whole run when stopped, e.g. by Ctrl-C")
+	flag.DurationVar(&opts.FileWaitTimeout, "wait-for-file", 0,
+		"How long to wait for the file to be created if it doesn't exist yet (fail immediately if 0)")
+	flag.BoolVar(&tui, "tui", false, "Display a live dashboard instead of printing summaries (press q to quit)")
 	flag.UintVar(&opts.NumTopSections, "sections", 5, "Number of top sections to display")
+	flag.UintVar(&opts.SectionDepth, "section-depth", 1, "Number of path segments which make up a section")
+	flag.Var((*sectionQueryMode)(&opts.SectionQuery), "section-query",
+		"How query strings affect sections: strip (ignore them), mark (append ? if present), or params (append the names of section-query-params present)")
+	flag.Var((*stringList)(&opts.SectionQueryParams), "section-query-params",
+		"Comma-separated query parameter names to append to sections, e.g. q,page (requires section-query=params)")
+	flag.BoolVar(&opts.SectionsByMethod, "section-methods", false,
+		"Prefix sections with the request method, e.g. GET /orders and POST /orders")
+	flag.BoolVar(&opts.NormalizePathIDs, "normalize-ids", false,
+		"Replace numeric and UUID path segments with :id before counting sections and distinct paths, e.g. /users/:id/orders")
+	flag.Var((*stringList)(&opts.PathIDPatterns), "id-patterns",
+		"Comma-separated regular expressions of path segments to replace with :id instead of numbers and UUIDs (requires normalize-ids)")
+	flag.DurationVar(&opts.SectionDecayInterval, "section-decay-interval", 0,
+		"Interval at which to decay top section hits to favor recent activity (disabled if 0)")
+	flag.Float64Var(&opts.SectionDecay, "section-decay", 0.5,
+		"Factor by which previous top section hits are multiplied each section-decay-interval, within [0, 1)")
+	flag.Var((*stringList)(&opts.IgnorePatterns), "ignore",
+		"Comma-separated regular expressions of request paths to exclude from aggregations other than total requests and hits, e.g. ^/healthz$,^/metrics")
+	flag.UintVar(&opts.NumTopIPs, "ips", 5, "Number of top remote IP addresses to display")
+	flag.BoolVar(&opts.UseForwardedFor, "use-forwarded-for", false,
+		"Use the left-most X-Forwarded-For address logged after the user-agent as the client IP")
+	flag.DurationVar(&opts.DistinctIPWindow, "distinct-ip-window", 0,
+		"Window of time over which to count unique visitors, e.g. 1h (since starting if 0)")
+	flag.DurationVar(&opts.StatusWindow, "status-window", 0,
+		"Window of time over which to also count recent responses by status class, e.g. 1m (disabled if 0)")
+	flag.StringVar(&opts.GeoIPDatabase, "geoip-db", "",
+		"Path of a MaxMind country database used to track top countries (disabled if empty)")
+	flag.UintVar(&opts.NumTopCountries, "countries", 5, "Number of top countries to display (requires geoip-db)")
+	flag.UintVar(&opts.NumTopUserAgents, "user-agents", 0,
+		"Number of top user-agents to display (requires Combined Log Format)")
 	flag.Float64Var(&opts.AlertThreshold, "alert-threshold", defaultAlertThreshold,
 		"Alert whenever traffic exceeds this value on average within alert-window")
 	flag.DurationVar(&opts.AlertWindow, "alert-window", defaultAlertWindow,
 		"Alert whenever traffic exceeds alert-threshold within this window on average")
+	flag.BoolVar(&opts.AlertOnMaxHits, "alert-on-max", false,
+		"Compare alert-threshold against the highest hits/s within alert-window rather than the average")
+	flag.Float64Var(&opts.LowTrafficThreshold, "low-traffic-threshold", 0,
+		"Alert whenever traffic falls below this value on average within alert-window (disabled if 0)")
+	flag.Float64Var(&opts.ThroughputThreshold, "throughput-threshold", 0,
+		"Alert whenever throughput in bytes/s exceeds this value on average within alert-window (disabled if 0)")
+	flag.Var((*statusWatchList)(&opts.WatchedStatuses), "watch-status",
+		"Comma-separated status codes or patterns to count exactly, each with an optional alert threshold in responses/s, e.g. 429=5,5xx=10,503")
+	flag.Var((*alertRuleList)(&opts.AlertRules), "alert-rule",
+		"Additional alert rule of the form name=NAME,metric=hits|bytes|errors|status:PATTERN,above|below=THRESHOLD[,window=DURATION][,cooldown=DURATION] (may be repeated)")
+	flag.Float64Var(&opts.AnomalyFactor, "anomaly-factor", 0,
+		"Alert whenever the anomaly-quantile of response sizes or times in the current histogram-rotation-interval exceeds this multiple of the previous intervals (disabled if 0)")
+	flag.Float64Var(&opts.AnomalyQuantile, "anomaly-quantile", 99, "Quantile compared by anomaly alerts, within (0, 100]")
+	flag.DurationVar(&opts.AlertEvalInterval, "alert-eval-interval", 0,
+		"Interval at which to check traffic against alert thresholds (default twice the quantum)")
+	flag.DurationVar(&opts.AlertCooldown, "alert-cooldown", 0,
+		"Minimum time between an alert triggering and recovering to prevent flapping")
 	flag.DurationVar(&opts.ReportingInterval, "reporting-interval", defaultReportingInterval,
 		"Interval at which to report summary data")
+	flag.DurationVar(&opts.HistogramRotationInterval, "histogram-rotation-interval", defaultHistRotationInterval,
+		"Interval at which to rotate the response size and time histograms (three intervals are kept)")
+	flag.IntVar(&opts.OutputBufferSize, "output-buffer", 4096,
+		"Size in bytes of the buffer used to write summaries and alerts when output isn't a terminal (unbuffered if negative)")
+	flag.IntVar(&opts.HitsBufferSize, "hits-buffer", 1024,
+		"Number of hits buffered to absorb bursts of logs without blocking the reader (unbuffered if negative)")
+	flag.BoolVar(&opts.ReportDeltas, "report-deltas", false,
+		"Report changes in counters since the previous summary rather than totals")
+	flag.Var((*floatList)(&opts.SizeQuantiles), "size-quantiles",
+		"Comma-separated response size quantiles to report, e.g. 50,95,99.9 (default 50,99)")
+	flag.BoolVar(&opts.ClientErrorsAsFailures, "client-errors-fail", false,
+		"Count 4xx responses against the success rate in addition to 5xx")
+	flag.Var((*int64List)(&opts.SizeBuckets), "size-buckets",
+		"Comma-separated upper bounds in bytes of the response size buckets to count, e.g. 1000,10000,100000 (default 1000,10000,100000)")
+	flag.UintVar(&opts.MaxCardinality, "max-cardinality", 100,
+		"Maximum number of distinct methods, protocols, and levels to count before counting new ones as (other)")
+	flag.Float64Var(&opts.SampleRate, "sample-rate", 1,
+		"Fraction of logs to sample for aggregations other than hit counts, within (0, 1]")
+	flag.IntVar(&opts.Workers, "workers", 1, "Number of goroutines which aggregate logs in parallel")
+	flag.BoolVar(&opts.DisableDistinctIPs, "no-distinct-ips", false, "Don't count unique visitors, to reduce CPU and memory usage")
+	flag.BoolVar(&opts.DisableDistinctPaths, "no-distinct-paths", false, "Don't count unique paths, to reduce CPU and memory usage")
+	flag.BoolVar(&opts.DisableSizeHistogram, "no-size-histogram", false,
+		"Don't record the response size distribution, to reduce CPU and memory usage (incompatible with anomaly-factor)")
+	flag.BoolVar(&opts.DisableTopSections, "no-sections", false, "Don't track top sections, to reduce CPU and memory usage")
+	flag.Var((*timeValue)(&opts.StartTime), "from",
+		"Only process logs at or after this RFC 3339 time, e.g. 2024-01-02T15:04:05Z")
+	flag.Var((*timeValue)(&opts.EndTime), "until",
+		"Only process logs at or before this RFC 3339 time (stops at the first later log if follow is false)")
+	flag.Var((*malformedPolicy)(&opts.MalformedLinePolicy), "malformed",
+		"How to handle lines not in Common Log Format: skip, fail, or collect (printed when the monitor stops)")
+	flag.StringVar(&opts.TimestampLayout, "timestamp-layout", "",
+		"Go time layout of log timestamps, e.g. 2006-01-02T15:04:05Z07:00 (default Common Log Format)")
+	flag.DurationVar(&opts.Quantum, "quantum", time.Second,
+		"Granularity of time-series measurements (may not exceed the alert window)")
+	flag.StringVar(&opts.AlertTemplate, "alert-template", "",
+		"Go text/template for alert messages, e.g. 'ALERT {{.AvgHits}} > {{.Threshold}} at {{.Time}}' (default built-in message)")
+	flag.StringVar(&opts.RecoveryTemplate, "recovery-template", "",
+		"Go text/template for recovery messages (default built-in message)")
+	flag.StringVar(&opts.AlertWebhook, "alert-webhook", "", "URL to POST alerts to as JSON (disabled if empty)")
+	flag.StringVar(&opts.SlackWebhookURL, "slack-webhook", "",
+		"Slack incoming webhook URL to post alerts to (disabled if empty)")
+	flag.StringVar(&opts.SlackChannel, "slack-channel", "", "Slack channel to post alerts to (optional)")
+	flag.StringVar(&opts.SlackUsername, "slack-username", "", "Username to post Slack alerts as (optional)")
+	flag.StringVar(&opts.StatsdAddr, "statsd-addr", "",
+		"Address of a statsd server to send metrics to every reporting-interval, e.g. localhost:8125 (disabled if empty)")
+	flag.StringVar(&opts.CSVFile, "csv-file", "",
+		"Path of a file to append summary data to as CSV every reporting-interval (disabled if empty)")
+	flag.StringVar(&opts.MetricsAddr, "metrics-addr", "",
+		"Address on which to serve Prometheus metrics, e.g. :9100 (disabled if empty)")
+	flag.StringVar(&opts.APIAddr, "api-addr", "",
+		"Address on which to serve the current summary as JSON at /summary and runtime stats at /debug, e.g. :8080 (disabled if empty)")
+	flag.DurationVar(&opts.HealthStaleness, "health-staleness", 0,
+		"Report unhealthy at /healthz if no logs are read for this long while following (disabled if 0)")
+	flag.StringVar(&opts.PushgatewayURL, "pushgateway-url", "",
+		"Base URL of a Prometheus Pushgateway to push the final metrics to when stopping, e.g. http://localhost:9091 (disabled if empty)")
+	flag.StringVar(&opts.PushgatewayJob, "pushgateway-job", "httpmonitor", "Job label of metrics pushed to the Pushgateway")
+	flag.StringVar(&opts.PushgatewayInstance, "pushgateway-instance", "",
+		"Instance label of metrics pushed to the Pushgateway (optional)")
+	flag.BoolVar(&opts.Color, "color", true,
+		"Color errors and alerts when writing to a terminal (disabled if the NO_COLOR environment variable is set)")
+	flag.BoolVar(&version, "version", false, "Print the version and build information and exit")
 	flag.Parse()
+	opts.NoFollow = !follow
+
+	if version {
+		fmt.Printf("httpmonitor %s (%s %s/%s)\n", buildVersion, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+		return
+	}
 
-	if file == "" {
-		fmt.Println("Must provide --file flag")
+	if syslogAddr != "" && file != "" {
+		// The syslog reader would replace the file's reader, so one of them
+		// would be silently ignored.
+		fmt.Println("Cannot use --syslog with --file")
+		os.Exit(1)
+	}
+	if syslogAddr != "" {
+		reader, err := monitor.NewSyslogReader(syslogAddr)
+		if err != nil {
+			fmt.Printf("Failed to listen for syslog messages: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Reader = reader
+	} else if file == "-" || (file == "" && stdinIsPipe()) {
+		opts.Reader = monitor.NewStdinReader()
+	} else if file == "" {
+		fmt.Println("Must provide --file or --syslog flag or pipe logs to stdin")
 		os.Exit(1)
 	}
 
-	m, err := monitor.New(file, opts)
+	// The dashboard replaces the periodic summaries and alert messages.
+	var alerts chan monitor.Alert
+	if tui {
+		alerts = make(chan monitor.Alert, 1)
+		opts.AlertHook = alerts
+		opts.ReportingInterval = 0
+		opts.Output = ioutil.Discard
+	}
+
+	var (
+		m   *monitor.Monitor
+		err error
+	)
+	if files := strings.Split(file, ","); len(files) > 1 {
+		m, err = monitor.NewMulti(files, opts)
+	} else {
+		m, err = monitor.New(file, opts)
+	}
 	if err != nil {
 		fmt.Printf("Failed to create monitor: %v\n", err)
 		os.Exit(1)
 	}
 
+	if tui {
+		if err := runDashboard(m, alerts); err != nil {
+			fmt.Printf("Failed to run dashboard: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	handleSignals(m)
 
 	fmt.Println("Starting monitor...")
-	if err := m.Start(); err != nil {
+	err = m.Start()
+	if lines := m.MalformedLines(); len(lines) > 0 {
+		fmt.Println("Malformed lines:")
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+	if err != nil {
 		fmt.Printf("Failed to start monitor: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+// floatList is a flag.Value for a comma-separated list of floats.
+type floatList []float64
+
+func (f *floatList) String() string {
+	values := make([]string, len(*f))
+	for i, v := range *f {
+		values[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return strings.Join(values, ",")
+}
+
+func (f *floatList) Set(value string) error {
+	*f = nil
+	for _, s := range strings.Split(value, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return err
+		}
+		*f = append(*f, v)
+	}
+	return nil
+}
+
+// int64List is a flag.Value for a comma-separated list of integers.
+type int64List []int64
+
+func (l *int64List) String() string {
+	values := make([]string, len(*l))
+	for i, v := range *l {
+		values[i] = strconv.FormatInt(v, 10)
+	}
+	return strings.Join(values, ",")
+}
+
+func (l *int64List) Set(value string) error {
+	*l = nil
+	for _, s := range strings.Split(value, ",") {
+		v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, v)
+	}
+	return nil
+}
+
+// timeValue is a flag.Value for a time in RFC 3339 format.
+type timeValue time.Time
+
+func (t *timeValue) String() string {
+	if time.Time(*t).IsZero() {
+		return ""
+	}
+	return time.Time(*t).Format(time.RFC3339)
+}
+
+func (t *timeValue) Set(value string) error {
+	v, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return err
+	}
+	*t = timeValue(v)
+	return nil
+}
+
+// stringList is a flag.Value for a comma-separated list of strings.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = strings.Split(value, ",")
+	return nil
+}
+
+// malformedPolicy is a flag.Value for a monitor.MalformedLinePolicy by name.
+type malformedPolicy monitor.MalformedLinePolicy
+
+func (p *malformedPolicy) String() string {
+	return monitor.MalformedLinePolicy(*p).String()
+}
+
+func (p *malformedPolicy) Set(value string) error {
+	for _, policy := range []monitor.MalformedLinePolicy{
+		monitor.SkipMalformedLines, monitor.FailOnMalformedLines, monitor.CollectMalformedLines,
+	} {
+		if value == policy.String() {
+			*p = malformedPolicy(policy)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown policy %q", value)
+}
+
+// sectionQueryMode is a flag.Value for a monitor.SectionQueryMode by name.
+type sectionQueryMode monitor.SectionQueryMode
+
+func (m *sectionQueryMode) String() string {
+	return monitor.SectionQueryMode(*m).String()
+}
+
+func (m *sectionQueryMode) Set(value string) error {
+	for _, mode := range []monitor.SectionQueryMode{
+		monitor.StripQuery, monitor.MarkQuery, monitor.SectionQueryParams,
+	} {
+		if value == mode.String() {
+			*m = sectionQueryMode(mode)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown mode %q", value)
+}
+
+// statusWatchList is a flag.Value for a comma-separated list of watched
+// statuses, each of the form pattern[=threshold].
+type statusWatchList []monitor.StatusWatch
+
+func (s *statusWatchList) String() string {
+	values := make([]string, len(*s))
+	for i, w := range *s {
+		values[i] = w.Pattern
+		if w.Threshold > 0 {
+			values[i] += "=" + strconv.FormatFloat(w.Threshold, 'g', -1, 64)
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+func (s *statusWatchList) Set(value string) error {
+	*s = nil
+	for _, watch := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(watch), "=", 2)
+		w := monitor.StatusWatch{Pattern: parts[0]}
+		if len(parts) == 2 {
+			threshold, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil {
+				return err
+			}
+			w.Threshold = threshold
+		}
+		*s = append(*s, w)
+	}
+	return nil
+}
+
+// alertRuleList is a flag.Value for alert rules which appends a rule each time
+// the flag is set. Each rule is a comma-separated list of key=value pairs.
+type alertRuleList []monitor.AlertRule
+
+func (l *alertRuleList) String() string {
+	names := make([]string, len(*l))
+	for i, rule := range *l {
+		names[i] = rule.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func (l *alertRuleList) Set(value string) error {
+	var rule monitor.AlertRule
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid key=value pair %q", pair)
+		}
+		var err error
+		switch key, v := parts[0], parts[1]; key {
+		case "name":
+			rule.Name = v
+		case "metric":
+			rule.Metric = v
+		case "above", "below":
+			rule.Below = key == "below"
+			rule.Threshold, err = strconv.ParseFloat(v, 64)
+		case "window":
+			rule.Window, err = time.ParseDuration(v)
+		case "cooldown":
+			rule.Cooldown, err = time.ParseDuration(v)
+		default:
+			return fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	*l = append(*l, rule)
+	return nil
+}
+
+// stdinIsPipe indicates if stdin is a pipe or file rather than a terminal.
+func stdinIsPipe() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// handleSignals stops the monitor on SIGINT or SIGTERM, which causes Start to
+// return once the final summary, if enabled, has been printed.
 func handleSignals(m *monitor.Monitor) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-c
+		// Restore the default behavior so a second signal exits immediately
+		// if stopping hangs.
+		signal.Stop(c)
 		fmt.Println("Stopping monitor...")
 		if err := m.Stop(); err != nil {
 			fmt.Printf("Error stopping monitor: %v\n", err)
 			os.Exit(1)
 		}
-		os.Exit(0)
 	}()
 }
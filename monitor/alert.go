@@ -0,0 +1,207 @@
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// alertMessage is the data passed to the alert and recovery templates. The
+// Alert's fields are promoted, e.g. .AvgHits and .Time, and Threshold is the
+// threshold for the kind of alert.
+type alertMessage struct {
+	Alert
+	Window    time.Duration
+	Threshold float64
+}
+
+// parseAlertTemplate parses the given alert message template. It returns nil if
+// the text is empty. The template is executed against an empty message so that
+// references to unknown fields fail now rather than at the first alert.
+func parseAlertTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(ioutil.Discard, alertMessage{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// formatAlert returns the message for the given alert using the template, or
+// the default message if the template is nil or fails. The message doesn't
+// end in a newline.
+func formatAlert(tmpl *template.Template, msg alertMessage) string {
+	if tmpl != nil {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, msg); err == nil {
+			return strings.TrimRight(buf.String(), "\n")
+		}
+	}
+	return appendDrivers(defaultAlertMessage(msg), msg.Alert)
+}
+
+// defaultAlertMessage returns the default message for the kind of alert.
+func defaultAlertMessage(msg alertMessage) string {
+	switch {
+	case msg.Rule != "" && msg.Recovered:
+		return fmt.Sprintf("Alert rule %s recovered - %s, recovered at %s", msg.Rule, describeRuleValue(msg.Alert), msg.Time)
+	case msg.Rule != "":
+		return fmt.Sprintf("Alert rule %s generated an alert - %s, triggered at %s", msg.Rule, describeRuleValue(msg.Alert), msg.Time)
+	case msg.Anomaly != "" && msg.Recovered:
+		return fmt.Sprintf("Anomaly recovered - %s, recovered at %s", describeAnomaly(msg.Alert), msg.Time)
+	case msg.Anomaly != "":
+		return fmt.Sprintf("Anomaly generated an alert - %s, triggered at %s", describeAnomaly(msg.Alert), msg.Time)
+	case msg.Status != "" && msg.Recovered:
+		return fmt.Sprintf("Status %s recovered - responses/s = %.2f, recovered at %s", msg.Status, msg.AvgStatus, msg.Time)
+	case msg.Status != "":
+		return fmt.Sprintf("High rate of status %s generated an alert - responses/s = %.2f, triggered at %s",
+			msg.Status, msg.AvgStatus, msg.Time)
+	case msg.Errors && msg.Recovered:
+		return fmt.Sprintf("Errors recovered - errors/s = %.2f, recovered at %s", msg.AvgErrors, msg.Time)
+	case msg.Errors:
+		return fmt.Sprintf("High error rate generated an alert - errors/s = %.2f, triggered at %s", msg.AvgErrors, msg.Time)
+	case msg.LowTraffic && msg.Recovered:
+		return fmt.Sprintf("Low traffic recovered - hits = %.2f, recovered at %s", msg.AvgHits, msg.Time)
+	case msg.LowTraffic:
+		return fmt.Sprintf("Low traffic generated an alert - hits = %.2f, triggered at %s", msg.AvgHits, msg.Time)
+	case msg.Throughput && msg.Recovered:
+		return fmt.Sprintf("Throughput recovered - bytes/s = %.2f, recovered at %s", msg.AvgBytes, msg.Time)
+	case msg.Throughput:
+		return fmt.Sprintf("High throughput generated an alert - bytes/s = %.2f, triggered at %s", msg.AvgBytes, msg.Time)
+	case msg.MaxHits > 0 && msg.Recovered:
+		return fmt.Sprintf("Traffic recovered - max hits/s = %.2f, recovered at %s", msg.MaxHits, msg.Time)
+	case msg.MaxHits > 0:
+		return fmt.Sprintf("High traffic generated an alert - max hits/s = %.2f, triggered at %s", msg.MaxHits, msg.Time)
+	case msg.Recovered:
+		return fmt.Sprintf("Traffic recovered - hits = %.2f, recovered at %s", msg.AvgHits, msg.Time)
+	default:
+		return fmt.Sprintf("High traffic generated an alert - hits = %.2f, triggered at %s", msg.AvgHits, msg.Time)
+	}
+}
+
+// appendDrivers appends what's driving the traffic of the alert to its
+// message, e.g. "..., driven by /search from 10.0.0.5", if it's known.
+func appendDrivers(s string, a Alert) string {
+	switch {
+	case len(a.TopSections) > 0 && len(a.TopIPs) > 0:
+		return fmt.Sprintf("%s, driven by %s from %s", s, a.TopSections[0].Value, a.TopIPs[0].Value)
+	case len(a.TopSections) > 0:
+		return fmt.Sprintf("%s, driven by %s", s, a.TopSections[0].Value)
+	case len(a.TopIPs) > 0:
+		return fmt.Sprintf("%s, driven by requests from %s", s, a.TopIPs[0].Value)
+	default:
+		return s
+	}
+}
+
+// String returns the default message for the alert, i.e. the message printed
+// when there's no alert or recovery template, without a trailing newline.
+func (a Alert) String() string {
+	return formatAlert(nil, alertMessage{Alert: a})
+}
+
+// Kind returns the condition the alert is for, e.g. "traffic", "errors",
+// "status 429", or "rule slow-api". An alert and its recovery have the same
+// kind, and at most one alert of each kind is triggered at a time.
+func (a Alert) Kind() string {
+	switch {
+	case a.Rule != "":
+		return "rule " + a.Rule
+	case a.Anomaly != "":
+		return "anomaly " + a.Anomaly
+	case a.Status != "":
+		return "status " + a.Status
+	case a.Errors:
+		return "errors"
+	case a.LowTraffic:
+		return "low traffic"
+	case a.Throughput:
+		return "throughput"
+	default:
+		return "traffic"
+	}
+}
+
+// lowTrafficHysteresis is the fraction by which the average must exceed the
+// threshold for a low traffic alert to recover.
+const lowTrafficHysteresis = 0.2
+
+// alertState tracks whether the traffic alert is triggered and decides when it
+// should change state.
+type alertState struct {
+	threshold     float64
+	cooldown      time.Duration
+	alerted       bool
+	lastChange    time.Time
+	breachedSince time.Time
+
+	// below indicates the threshold is breached when the average falls below
+	// it rather than exceeds it. Once triggered, the average must reach
+	// recovery for the alert to recover.
+	below    bool
+	recovery float64
+}
+
+// newLowAlertState returns the state of an alert which triggers when the
+// average falls below the threshold and recovers once it exceeds the threshold
+// by lowTrafficHysteresis.
+func newLowAlertState(threshold float64, cooldown time.Duration) *alertState {
+	return &alertState{
+		threshold: threshold,
+		cooldown:  cooldown,
+		below:     true,
+		recovery:  threshold * (1 + lowTrafficHysteresis),
+	}
+}
+
+// breached indicates if the average breaches the threshold given the current
+// state.
+func (s *alertState) breached(avg float64) bool {
+	switch {
+	case !s.below:
+		return avg > s.threshold
+	case s.alerted:
+		return avg < s.recovery
+	default:
+		return avg < s.threshold
+	}
+}
+
+// evaluate updates the state given the average value, e.g. hits per second,
+// at the given time. It returns the Alert to emit and true if the alert was
+// triggered or recovered. The caller is responsible for setting the averages
+// on the Alert. The state doesn't change until the cooldown has elapsed since
+// the last change.
+func (s *alertState) evaluate(avg float64, now time.Time) (Alert, bool) {
+	breached := s.breached(avg)
+	switch {
+	case breached && s.breachedSince.IsZero():
+		s.breachedSince = now
+	case !breached && !s.alerted:
+		// Traffic dropped before an alert was triggered.
+		s.breachedSince = time.Time{}
+	}
+	if breached == s.alerted || now.Sub(s.lastChange) < s.cooldown {
+		return Alert{}, false
+	}
+
+	a := Alert{
+		Recovered: !breached,
+		Time:      now,
+		Duration:  now.Sub(s.breachedSince),
+	}
+	s.alerted = breached
+	s.lastChange = now
+	if !breached {
+		s.breachedSince = time.Time{}
+	}
+	return a, true
+}
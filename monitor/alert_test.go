@@ -0,0 +1,161 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAlertStateCooldown ensures the alert doesn't change state until the
+// cooldown has elapsed since the last change and that the alert reports how
+// long traffic exceeded the threshold.
+func TestAlertStateCooldown(t *testing.T) {
+	var (
+		s     = &alertState{threshold: 10, cooldown: 10 * time.Second}
+		start = time.Now()
+	)
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+
+	// The first trigger isn't subject to the cooldown.
+	if a, ok := s.evaluate(20, at(0)); !ok || a.Recovered {
+		t.Fatal("Expected alert triggered")
+	}
+
+	// Recovery is suppressed until the cooldown elapses.
+	if _, ok := s.evaluate(5, at(4)); ok {
+		t.Fatal("Expected recovery to be suppressed during cooldown")
+	}
+	a, ok := s.evaluate(5, at(10))
+	if !ok || !a.Recovered {
+		t.Fatal("Expected alert recovery")
+	}
+	if a.Duration != 10*time.Second {
+		t.Fatalf("Expected duration 10s, got %s", a.Duration)
+	}
+
+	// A trigger is suppressed until the cooldown elapses, but the duration
+	// reflects when traffic first exceeded the threshold.
+	if _, ok := s.evaluate(20, at(12)); ok {
+		t.Fatal("Expected trigger to be suppressed during cooldown")
+	}
+	a, ok = s.evaluate(20, at(20))
+	if !ok || a.Recovered {
+		t.Fatal("Expected alert triggered")
+	}
+	if a.Duration != 8*time.Second {
+		t.Fatalf("Expected duration 8s, got %s", a.Duration)
+	}
+
+	// Remaining triggered produces no further alerts.
+	if _, ok := s.evaluate(20, at(40)); ok {
+		t.Fatal("Unexpected alert")
+	}
+}
+
+// TestAlertStateLow ensures a low alert triggers when the average falls below
+// the threshold and only recovers once the average exceeds the threshold by the
+// hysteresis.
+func TestAlertStateLow(t *testing.T) {
+	var (
+		s     = newLowAlertState(10, 0)
+		start = time.Now()
+	)
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+
+	if _, ok := s.evaluate(15, at(0)); ok {
+		t.Fatal("Unexpected alert above the threshold")
+	}
+	a, ok := s.evaluate(2, at(1))
+	if !ok || a.Recovered {
+		t.Fatal("Expected alert triggered")
+	}
+
+	// Rising just above the threshold isn't enough to recover.
+	if _, ok := s.evaluate(11, at(2)); ok {
+		t.Fatal("Expected recovery to be suppressed within the hysteresis")
+	}
+	a, ok = s.evaluate(13, at(5))
+	if !ok || !a.Recovered {
+		t.Fatal("Expected alert recovery")
+	}
+	if a.Duration != 4*time.Second {
+		t.Fatalf("Expected duration 4s, got %s", a.Duration)
+	}
+
+	// Once recovered, dropping just below the recovery level doesn't trigger.
+	if _, ok := s.evaluate(11, at(6)); ok {
+		t.Fatal("Unexpected alert above the threshold")
+	}
+}
+
+// TestFormatAlert ensures alert messages are rendered with the template and
+// fall back to the default message when there's no template.
+func TestFormatAlert(t *testing.T) {
+	tmpl, err := parseAlertTemplate("alert", "ALERT hits={{printf \"%.1f\" .AvgHits}} threshold={{.Threshold}} window={{.Window}}\n")
+	if err != nil {
+		t.Fatalf("Error parsing template: %v", err)
+	}
+	msg := alertMessage{
+		Alert:     Alert{AvgHits: 12.34, Time: time.Now()},
+		Window:    2 * time.Minute,
+		Threshold: 10,
+	}
+	if s := formatAlert(tmpl, msg); s != "ALERT hits=12.3 threshold=10 window=2m0s" {
+		t.Fatalf("Unexpected templated message: %q", s)
+	}
+	if s := formatAlert(nil, msg); s != fmt.Sprintf("High traffic generated an alert - hits = 12.34, triggered at %s", msg.Time) {
+		t.Fatalf("Unexpected default message: %q", s)
+	}
+
+	msg.TopSections = []TopElement{{Value: "/search", Hits: 30}, {Value: "/api", Hits: 10}}
+	msg.TopIPs = []TopElement{{Value: "10.0.0.5", Hits: 25}}
+	if s := formatAlert(nil, msg); !strings.HasSuffix(s, ", driven by /search from 10.0.0.5") {
+		t.Fatalf("Expected top section and IP in default message, got %q", s)
+	}
+	msg.TopSections = nil
+	if s := formatAlert(nil, msg); !strings.HasSuffix(s, ", driven by requests from 10.0.0.5") {
+		t.Fatalf("Expected top IP in default message, got %q", s)
+	}
+
+	for _, text := range []string{"{{.AvgHits", "{{.Unknown}}"} {
+		if _, err := parseAlertTemplate("alert", text); err == nil {
+			t.Errorf("Expected error parsing template %q", text)
+		}
+	}
+}
+
+// TestAlertKind ensures an alert and its recovery have the same kind, which
+// differs for each condition, and that String returns the default message.
+func TestAlertKind(t *testing.T) {
+	kinds := make(map[string]bool)
+	for _, a := range []Alert{
+		{AvgHits: 12},
+		{MaxHits: 30},
+		{Throughput: true},
+		{LowTraffic: true},
+		{Errors: true},
+		{Status: "429"},
+		{Status: "5xx"},
+		{Anomaly: "latency"},
+		{Rule: "slow-api", Errors: true},
+		{Rule: "big-responses", Throughput: true},
+	} {
+		recovered := a
+		recovered.Recovered = true
+		if a.Kind() != recovered.Kind() {
+			t.Errorf("Expected recovery of %q to have the same kind, got %q", a.Kind(), recovered.Kind())
+		}
+		kinds[a.Kind()] = true
+		if s := a.String(); s != formatAlert(nil, alertMessage{Alert: a}) {
+			t.Errorf("Expected default message, got %q", s)
+		}
+	}
+	if len(kinds) != 9 {
+		t.Fatalf("Expected 9 kinds, got %v", kinds)
+	}
+}
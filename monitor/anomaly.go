@@ -0,0 +1,80 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+)
+
+const (
+	// sizeAnomaly and latencyAnomaly identify the distributions compared by
+	// anomaly alerts.
+	sizeAnomaly    = "size"
+	latencyAnomaly = "latency"
+
+	// minAnomalyCount is the minimum number of values the current window and
+	// the baseline must each have for their quantiles to be compared.
+	minAnomalyCount = 20
+)
+
+// splitHistograms returns copies of the values recorded in the current window
+// of the given histograms and of the values recorded in their previous
+// windows, which serve as a baseline. The histograms must have the same
+// parameters.
+func splitHistograms(hists ...*hdrhistogram.WindowedHistogram) (current, baseline *hdrhistogram.Histogram) {
+	current = hdrhistogram.Import(hists[0].Current.Export())
+	for _, hist := range hists[1:] {
+		current.Merge(hist.Current)
+	}
+	// The histograms can't be subtracted, but the counts of all windows less
+	// the counts of the current window are the counts of the previous ones.
+	all := mergeHistograms(hists...).Export()
+	counts := current.Export().Counts
+	for i := range all.Counts {
+		all.Counts[i] -= counts[i]
+	}
+	return current, hdrhistogram.Import(all)
+}
+
+// compareQuantiles returns the value at the given quantile of the current and
+// baseline histograms. It returns false if either has fewer than
+// minAnomalyCount values or the baseline quantile is zero, in which case they
+// can't be meaningfully compared.
+func compareQuantiles(q float64, current, baseline *hdrhistogram.Histogram) (int64, int64, bool) {
+	if current.TotalCount() < minAnomalyCount || baseline.TotalCount() < minAnomalyCount {
+		return 0, 0, false
+	}
+	cur, base := current.ValueAtQuantile(q), baseline.ValueAtQuantile(q)
+	if base <= 0 {
+		return 0, 0, false
+	}
+	return cur, base, true
+}
+
+// splitHists returns the current window and baseline of the response size or
+// latency histograms merged across partitions. Merging the windows modifies
+// the histograms' internal state, so this takes the write locks.
+func (c *collector) splitHists(latency bool) (current, baseline *hdrhistogram.Histogram) {
+	var hists []*hdrhistogram.WindowedHistogram
+	for _, p := range c.partitions() {
+		p.Lock()
+		defer p.Unlock()
+		if latency {
+			hists = append(hists, p.latencyHist)
+		} else {
+			hists = append(hists, p.sizeHist)
+		}
+	}
+	return splitHistograms(hists...)
+}
+
+// describeAnomaly describes the quantile and baseline of an anomaly alert for
+// messages, e.g. "response latency 1.2s is 4.00x the baseline 300ms".
+func describeAnomaly(a Alert) string {
+	if a.Anomaly == latencyAnomaly {
+		return fmt.Sprintf("response latency %s is %.2fx the baseline %s",
+			time.Duration(a.Quantile)*time.Microsecond, a.Ratio, time.Duration(a.Baseline)*time.Microsecond)
+	}
+	return fmt.Sprintf("response size %d bytes is %.2fx the baseline %d bytes", a.Quantile, a.Ratio, a.Baseline)
+}
@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/codahale/hdrhistogram"
+)
+
+// TestSplitHistograms ensures the current window is separated from the
+// previous windows, which form the baseline, across several histograms.
+func TestSplitHistograms(t *testing.T) {
+	a := hdrhistogram.NewWindowed(3, 1, 1000, 3)
+	b := hdrhistogram.NewWindowed(3, 1, 1000, 3)
+	a.Current.RecordValue(10)
+	a.Rotate()
+	a.Current.RecordValue(20)
+	a.Rotate()
+	a.Current.RecordValue(500)
+	b.Current.RecordValue(30)
+	b.Rotate()
+	b.Current.RecordValue(600)
+
+	current, baseline := splitHistograms(a, b)
+	if current.TotalCount() != 2 || current.Min() != 500 {
+		t.Fatalf("Expected 2 current values from 500, got %d from %d", current.TotalCount(), current.Min())
+	}
+	if baseline.TotalCount() != 3 || baseline.Max() != 30 {
+		t.Fatalf("Expected 3 baseline values up to 30, got %d up to %d", baseline.TotalCount(), baseline.Max())
+	}
+	if count := a.Merge().TotalCount(); count != 3 {
+		t.Fatalf("Expected the original histogram to keep 3 values, got %d", count)
+	}
+}
+
+// TestCompareQuantiles ensures quantiles are only compared once both
+// histograms have enough values and the baseline is nonzero.
+func TestCompareQuantiles(t *testing.T) {
+	current := hdrhistogram.New(1, 1000, 3)
+	baseline := hdrhistogram.New(1, 1000, 3)
+	for i := 0; i < minAnomalyCount-1; i++ {
+		current.RecordValue(400)
+		baseline.RecordValue(100)
+	}
+	if _, _, ok := compareQuantiles(99, current, baseline); ok {
+		t.Fatal("Expected too few values to compare")
+	}
+
+	current.RecordValue(400)
+	baseline.RecordValue(100)
+	cur, base, ok := compareQuantiles(99, current, baseline)
+	if !ok || cur != 400 || base != 100 {
+		t.Fatalf("Expected 400 compared to 100, got %d compared to %d (%t)", cur, base, ok)
+	}
+
+	if _, _, ok := compareQuantiles(99, current, hdrhistogram.Import(baseline.Export())); !ok {
+		t.Fatal("Expected imported baseline to be comparable")
+	}
+}
+
+// TestDescribeAnomaly ensures latency anomalies are described as durations
+// and size anomalies in bytes.
+func TestDescribeAnomaly(t *testing.T) {
+	a := Alert{Anomaly: latencyAnomaly, Quantile: 1200000, Baseline: 300000, Ratio: 4}
+	if expected, msg := "response latency 1.2s is 4.00x the baseline 300ms", describeAnomaly(a); msg != expected {
+		t.Errorf("Expected %q, got %q", expected, msg)
+	}
+	a = Alert{Anomaly: sizeAnomaly, Quantile: 3000, Baseline: 1000, Ratio: 3}
+	if expected, msg := "response size 3000 bytes is 3.00x the baseline 1000 bytes", describeAnomaly(a); msg != expected {
+		t.Errorf("Expected %q, got %q", expected, msg)
+	}
+}
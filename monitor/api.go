@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// apiServer serves the HTTP API.
+type apiServer struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+// newAPIServer creates an apiServer listening on the given address which
+// serves the API for the Monitor. It does not begin serving until start is
+// called.
+func newAPIServer(addr string, m *Monitor) (*apiServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen")
+	}
+	return &apiServer{
+		listener: listener,
+		server:   &http.Server{Handler: m.APIHandler()},
+	}, nil
+}
+
+// start serving the API until stop is called.
+func (s *apiServer) start() {
+	go s.server.Serve(s.listener)
+}
+
+// stop serving the API and close the listener.
+func (s *apiServer) stop() {
+	s.server.Close()
+	// Close the listener in case the server was never started.
+	s.listener.Close()
+}
+
+// APIHandler returns an http.Handler which serves the current summary as JSON
+// at GET /summary, the Monitor's own Stats as JSON at GET /debug, and responds
+// to GET /healthz with 200 OK if the Monitor is healthy or 503 Service
+// Unavailable and the reason if it isn't. This can be used to expose the API
+// on an existing HTTP server instead of setting APIAddr.
+func (m *Monitor) APIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/summary", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.Snapshot())
+	})
+	mux.HandleFunc("/debug", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.Stats())
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := m.Health(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok\n"))
+	})
+	return mux
+}
@@ -0,0 +1,197 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestAPIHandler ensures the summary is served as JSON and health checks
+// succeed.
+func TestAPIHandler(t *testing.T) {
+	m, err := New("", MonitorOpts{
+		AlertWindow:    testAlertWindow,
+		NumTopSections: 2,
+		NumTopIPs:      1,
+		Reader:         &logsReader{},
+		Output:         ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	for i, request := range []string{"GET /a/1 HTTP/1.1", "GET /b/1 HTTP/1.1", "GET /b/2 HTTP/1.1"} {
+		m.Ingest(Log{
+			RemoteAddr: "10.0.0.1",
+			Timestamp:  time.Now(),
+			Request:    request,
+			Status:     200 + i*150,
+			Size:       int64(100 * (i + 1)),
+		})
+	}
+	handler := m.APIHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/summary", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Expected JSON content type, got %s", ct)
+	}
+	var s struct {
+		TopSections []struct {
+			Value string `json:"value"`
+			Hits  uint64 `json:"hits"`
+		} `json:"top_sections"`
+		StatusFreq    map[string]uint64 `json:"status_freq"`
+		TotalRequests uint64            `json:"total_requests"`
+		Size          struct {
+			Count     int64            `json:"count"`
+			Max       int64            `json:"max"`
+			Quantiles map[string]int64 `json:"quantiles"`
+		} `json:"size"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+		t.Fatalf("Error decoding summary: %v", err)
+	}
+	if s.TotalRequests != 3 {
+		t.Fatalf("Expected 3 total requests, got %d", s.TotalRequests)
+	}
+	if len(s.TopSections) != 2 || s.TopSections[0].Value != "/b" || s.TopSections[0].Hits != 2 {
+		t.Fatalf("Expected /b with 2 hits first, got %+v", s.TopSections)
+	}
+	if s.StatusFreq["2xx"] != 1 || s.StatusFreq["3xx"] != 1 || s.StatusFreq["5xx"] != 1 {
+		t.Fatalf("Unexpected status frequencies %v", s.StatusFreq)
+	}
+	if s.Size.Count != 3 || s.Size.Max != 300 {
+		t.Fatalf("Expected 3 sizes up to 300, got %d up to %d", s.Size.Count, s.Size.Max)
+	}
+	if _, ok := s.Size.Quantiles["p99"]; !ok {
+		t.Fatalf("Expected p99 size, got %v", s.Size.Quantiles)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/summary", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected status 405, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok\n" {
+		t.Fatalf("Expected healthy response, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug", nil))
+	var stats Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Error decoding stats: %v", err)
+	}
+	if stats.LogsProcessed != 3 || stats.Goroutines == 0 || stats.GoVersion == "" {
+		t.Fatalf("Expected stats for 3 logs, got %+v", stats)
+	}
+}
+
+// TestAPIHandlerUnhealthy ensures health checks fail once no logs have been
+// read within HealthStaleness and succeed again once logs are read.
+func TestAPIHandlerUnhealthy(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:     testAlertWindow,
+		NumTopSections:  1,
+		HealthStaleness: 100 * time.Millisecond,
+		Output:          ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	go m.Start()
+	defer m.Stop()
+	handler := m.APIHandler()
+
+	healthz := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return rec.Code
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for healthz() != http.StatusServiceUnavailable {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected unhealthy response once logs are stale")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+	for healthz() != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected healthy response once logs are read")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestMonitorAPIAddr ensures the API is served while the Monitor runs and the
+// server is shut down when it stops.
+func TestMonitorAPIAddr(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error finding free port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	m, err := New("", MonitorOpts{
+		AlertWindow: testAlertWindow,
+		APIAddr:     addr,
+		Reader:      NewReaderFromStream(pr),
+		Output:      ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		m.Start()
+		close(done)
+	}()
+
+	var resp *http.Response
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err = http.Get("http://" + addr + "/healthz")
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Error requesting health check: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	m.Stop()
+	<-done
+	if _, err := http.Get("http://" + addr + "/healthz"); err == nil {
+		t.Fatal("Expected API server to be shut down")
+	}
+}
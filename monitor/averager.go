@@ -1,18 +1,22 @@
 package monitor
 
 import (
+	"math"
+	"sort"
 	"sync"
 	"time"
 )
 
 // windowedAverager is used to compute the average number of hits across a
-// configured window of time.
+// configured window of time. Hits may be weighted, e.g. by response size, to
+// average other quantities such as throughput.
 type windowedAverager struct {
 	mu      sync.RWMutex
-	buckets []*uint64 // use pointers to indicate lack of data points.
+	buckets []uint64 // ring buffer of hit counts, one per quantum.
 	quantum time.Duration
 	window  time.Duration
 	idx     int
+	ticks   int // number of completed quanta, capped at the window
 }
 
 // newWindowedAverager creates a new windowAverager which allows computing the
@@ -24,7 +28,7 @@ func newWindowedAverager(window, quantum time.Duration) *windowedAverager {
 	}
 	return &windowedAverager{
 		// Add 1 since we won't include the current bucket when averaging.
-		buckets: make([]*uint64, int(window/quantum)+1),
+		buckets: make([]uint64, int(window/quantum)+1),
 		quantum: quantum,
 		window:  window,
 	}
@@ -34,20 +38,33 @@ func newWindowedAverager(window, quantum time.Duration) *windowedAverager {
 // and places them into buckets until the channel is closed.
 func (w *windowedAverager) quantize(hits <-chan time.Time) {
 	stop := make(chan struct{})
+	defer close(stop)
 	go w.tick(stop)
 	for hit := range hits {
-		if hit.Before(time.Now().Add(-w.window)) {
-			continue
-		}
-		w.mu.Lock()
-		if w.buckets[w.idx] == nil {
-			x := uint64(0)
-			w.buckets[w.idx] = &x
-		}
-		*w.buckets[w.idx]++
-		w.mu.Unlock()
+		w.record(hit, 1)
+	}
+}
+
+// record adds n to the current bucket for a hit at the given time. Hits older
+// than the window are ignored. The tick loop must be running for the buckets
+// to advance.
+func (w *windowedAverager) record(hit time.Time, n uint64) {
+	if hit.Before(time.Now().Add(-w.window)) {
+		return
 	}
-	close(stop)
+	w.mu.Lock()
+	w.buckets[w.idx] += n
+	w.mu.Unlock()
+}
+
+// reset clears the hits in all buckets.
+func (w *windowedAverager) reset() {
+	w.mu.Lock()
+	for i := range w.buckets {
+		w.buckets[i] = 0
+	}
+	w.ticks = 0
+	w.mu.Unlock()
 }
 
 // tick starts a loop that updates the current bucket based on the quantum
@@ -63,29 +80,73 @@ func (w *windowedAverager) tick(stop <-chan struct{}) {
 		}
 		w.mu.Lock()
 		w.idx = (w.idx + 1) % len(w.buckets)
-		x := uint64(0)
-		w.buckets[w.idx] = &x
+		w.buckets[w.idx] = 0
+		if w.ticks < len(w.buckets)-1 {
+			w.ticks++
+		}
 		w.mu.Unlock()
 	}
 }
 
-// average returns the average hit rate for the configured window of time.
+// average returns the average hit rate for the configured window of time. The
+// current bucket is skipped since it's incomplete, and buckets which haven't
+// been filled yet, e.g. during ramp-up, have zero hits so that the average is
+// always taken over the full window.
 func (w *windowedAverager) average() float64 {
 	w.mu.RLock()
 	sum := uint64(0)
-	count := 0
 	for i, b := range w.buckets {
 		if i == w.idx {
 			// Skip the current bucket.
 			continue
 		}
-		if b != nil {
-			sum += *b
-			count++
-		}
+		sum += b
 	}
 	w.mu.RUnlock()
-	return float64(sum) / (float64(count) * w.quantum.Seconds())
+	// Guard against dividing by zero, which would produce NaN or Inf.
+	span := float64(len(w.buckets)-1) * w.quantum.Seconds()
+	if span <= 0 {
+		return 0
+	}
+	return float64(sum) / span
+}
+
+// completed returns a copy of the hits in the completed buckets, i.e. the ones
+// averaged, from oldest to newest.
+func (w *windowedAverager) completed() []uint64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	hits := make([]uint64, 0, len(w.buckets)-1)
+	for i := 1; i < len(w.buckets); i++ {
+		hits = append(hits, w.buckets[(w.idx+i)%len(w.buckets)])
+	}
+	return hits
+}
+
+// rates returns statistics of the per-second rates of the completed buckets,
+// which reveal bursts within the window that the average smooths over. Like
+// the average, buckets which haven't been filled yet count as zero.
+func (w *windowedAverager) rates() RateStats {
+	hits := w.completed()
+	sort.Slice(hits, func(i, j int) bool { return hits[i] < hits[j] })
+	perSec := func(n uint64) float64 {
+		return float64(n) / w.quantum.Seconds()
+	}
+	// Use the nearest rank so the p95 is always an observed rate.
+	rank := int(math.Ceil(0.95*float64(len(hits)))) - 1
+	return RateStats{
+		Min: perSec(hits[0]),
+		Max: perSec(hits[len(hits)-1]),
+		P95: perSec(hits[rank]),
+	}
+}
+
+// warm indicates if a full window of quanta has elapsed since the averager
+// started or was reset, i.e. if the average reflects the entire window.
+func (w *windowedAverager) warm() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.ticks >= len(w.buckets)-1
 }
 
 // latest returns the number of hits for the last quantum of time, e.g. if the
@@ -94,9 +155,5 @@ func (w *windowedAverager) latest() uint64 {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 	lastIdx := ((w.idx - 1) + len(w.buckets)) % len(w.buckets)
-	latest := w.buckets[lastIdx]
-	if latest == nil {
-		return 0
-	}
-	return *latest
+	return w.buckets[lastIdx]
 }
@@ -0,0 +1,165 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestAveragerRampUp ensures the average is taken over the full window when
+// only some of the buckets have data.
+func TestAveragerRampUp(t *testing.T) {
+	w := newWindowedAverager(4*time.Second, time.Second)
+	if avg := w.average(); avg != 0 {
+		t.Fatalf("Expected average 0 with no data, got %f", avg)
+	}
+
+	// Populate the first two buckets and advance to the third.
+	w.buckets[0] = 4
+	w.buckets[1] = 4
+	w.idx = 2
+	if avg := w.average(); avg != 2 {
+		t.Fatalf("Expected average 2, got %f", avg)
+	}
+
+	// The current bucket should not be included.
+	w.buckets[w.idx] = 100
+	if avg := w.average(); avg != 2 {
+		t.Fatalf("Expected average 2, got %f", avg)
+	}
+
+	// Once the window is full, all completed buckets are included.
+	for i := 3; i < len(w.buckets); i++ {
+		w.buckets[i] = 8
+	}
+	if avg := w.average(); avg != 6 {
+		t.Fatalf("Expected average 6, got %f", avg)
+	}
+}
+
+// TestAveragerCompleted ensures the completed buckets are returned from oldest
+// to newest without the current bucket and can't be used to modify the
+// averager.
+func TestAveragerCompleted(t *testing.T) {
+	w := newWindowedAverager(3*time.Second, time.Second)
+	w.buckets = []uint64{1, 2, 3, 4}
+	w.idx = 1
+	hits := w.completed()
+	expected := []uint64{3, 4, 1}
+	if len(hits) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, hits)
+	}
+	for i := range expected {
+		if hits[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, hits)
+		}
+	}
+
+	hits[0] = 100
+	if w.buckets[2] != 3 {
+		t.Fatalf("Expected bucket to be unchanged, got %d", w.buckets[2])
+	}
+}
+
+// TestAveragerConcurrency ensures hits can be quantized while the average and
+// latest values are read concurrently. This is intended to be run with -race.
+func TestAveragerConcurrency(t *testing.T) {
+	var (
+		w    = newWindowedAverager(time.Minute, 10*time.Millisecond)
+		hits = make(chan time.Time)
+		done = make(chan struct{})
+	)
+	go func() {
+		w.quantize(hits)
+		close(done)
+	}()
+
+	stop := make(chan struct{})
+	readersDone := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer func() { readersDone <- struct{}{} }()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				w.average()
+				w.latest()
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		hits <- time.Now()
+	}
+	close(hits)
+	<-done
+	close(stop)
+	for i := 0; i < 4; i++ {
+		<-readersDone
+	}
+	if avg := w.average(); avg <= 0 {
+		t.Fatalf("Expected positive average, got %f", avg)
+	}
+}
+
+// TestAveragerRecord ensures weighted hits are added to the current bucket and
+// hits older than the window are ignored.
+func TestAveragerRecord(t *testing.T) {
+	w := newWindowedAverager(4*time.Second, time.Second)
+	w.record(time.Now(), 100)
+	w.record(time.Now(), 20)
+	w.record(time.Now().Add(-time.Minute), 1000)
+	if w.buckets[w.idx] != 120 {
+		t.Fatalf("Expected 120 in current bucket, got %d", w.buckets[w.idx])
+	}
+}
+
+// TestAveragerEmpty ensures an empty averager has a zero average rather than
+// NaN or Inf and isn't warm until a full window of quanta has elapsed.
+func TestAveragerEmpty(t *testing.T) {
+	w := newWindowedAverager(50*time.Millisecond, 10*time.Millisecond)
+	if avg := w.average(); avg != 0 || math.IsNaN(avg) || math.IsInf(avg, 0) {
+		t.Fatalf("Expected average 0 with no data, got %f", avg)
+	}
+	if latest := w.latest(); latest != 0 {
+		t.Fatalf("Expected latest 0 with no data, got %d", latest)
+	}
+	if w.warm() {
+		t.Fatal("Expected averager not to be warm before any quanta elapsed")
+	}
+
+	stop := make(chan struct{})
+	go w.tick(stop)
+	defer close(stop)
+	deadline := time.After(5 * time.Second)
+	for !w.warm() {
+		select {
+		case <-deadline:
+			t.Fatal("Expected averager to be warm after a full window")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	w.reset()
+	if w.warm() {
+		t.Fatal("Expected averager not to be warm after reset")
+	}
+}
+
+// TestAveragerRates ensures the min, p95, and max per-second rates are taken
+// over the completed buckets only.
+func TestAveragerRates(t *testing.T) {
+	w := newWindowedAverager(2*time.Second, 100*time.Millisecond)
+	for i := range w.buckets {
+		w.buckets[i] = uint64(i + 1)
+	}
+	w.idx = len(w.buckets) - 1 // the current bucket, with the most hits
+	rates := w.rates()
+	if rates.Min != 10 || rates.P95 != 190 || rates.Max != 200 {
+		t.Fatalf("Expected min 10, p95 190, and max 200, got %+v", rates)
+	}
+}
@@ -0,0 +1,140 @@
+package monitor
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// clfNumParts is the number of components in a Common Log Format entry.
+	clfNumParts = 7
+
+	// combinedNumParts is the number of components in a Combined Log Format
+	// entry.
+	combinedNumParts = 9
+
+	// forwardedNumParts is the number of components in a Combined Log Format
+	// entry with the X-Forwarded-For header appended, as logged by nginx's
+	// default format.
+	forwardedNumParts = 10
+
+	// clfTimeLayout is the timestamp layout used by Common Log Format.
+	clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+	// clfQuoted matches a quoted field, capturing its contents. Quotes within
+	// the field, e.g. in a user-agent, are escaped with a backslash.
+	clfQuoted = `"((?:[^"\\]|\\.)*)"`
+)
+
+var (
+	// clfRegexp matches a line in Common Log Format, i.e. "host ident authuser
+	// date request status bytes". The referer and user-agent fields of
+	// Combined Log Format and a trailing X-Forwarded-For field are matched if
+	// present. Any date between the brackets is matched so that non-standard
+	// timestamp layouts can be parsed.
+	clfRegexp = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] ` + clfQuoted + ` (\d{3}|-) (\d+|-)` +
+		`(?: ` + clfQuoted + ` ` + clfQuoted + `(?: ` + clfQuoted + `)?)?`)
+
+	// combinedRegexp matches a line in Combined Log Format, i.e. "host ident
+	// authuser date request status bytes referer user-agent", optionally
+	// followed by an X-Forwarded-For field.
+	combinedRegexp = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] ` + clfQuoted + ` (\d{3}|-) (\d+|-) ` +
+		clfQuoted + ` ` + clfQuoted + `(?: ` + clfQuoted + `)?`)
+
+	// commonLogFormatParser parses lines in Common Log Format.
+	commonLogFormatParser = &clfParser{regexp: clfRegexp, numParts: clfNumParts, layout: clfTimeLayout}
+
+	// combinedLogFormatParser parses lines in Combined Log Format.
+	combinedLogFormatParser = &clfParser{regexp: combinedRegexp, numParts: combinedNumParts, layout: clfTimeLayout}
+)
+
+// clfParser is a lineParser for Common Log Format and Combined Log Format.
+type clfParser struct {
+	regexp   *regexp.Regexp
+	numParts int
+	layout   string
+}
+
+// NewCommonLogFormatReader returns a new reader for log files using Common Log
+// Format.
+func NewCommonLogFormatReader(file string) (Reader, error) {
+	return newCommonLogFormatReader(file, fileReaderOpts{})
+}
+
+// newCommonLogFormatReader returns a new reader for log files using Common Log
+// Format configured with the given options.
+func newCommonLogFormatReader(file string, opts fileReaderOpts) (Reader, error) {
+	return newFileReader(file, "Common Log Format", newCommonLogFormatParser(opts.timestampLayout), opts)
+}
+
+// newCommonLogFormatParser returns a parser for Common Log Format which parses
+// timestamps using the given layout, or the standard layout if it's empty.
+func newCommonLogFormatParser(layout string) *clfParser {
+	if layout == "" {
+		return commonLogFormatParser
+	}
+	return &clfParser{regexp: clfRegexp, numParts: clfNumParts, layout: layout}
+}
+
+// NewCombinedLogFormatReader returns a new reader for log files using Combined
+// Log Format, which extends Common Log Format with the referer and user-agent
+// fields.
+func NewCombinedLogFormatReader(file string) (Reader, error) {
+	return newFileReader(file, "Combined Log Format", combinedLogFormatParser, fileReaderOpts{})
+}
+
+// parse parses a single log line. It returns false if the line is not in Common
+// Log Format or, if the parser requires it, Combined Log Format.
+func (c *clfParser) parse(line string) (*log, bool) {
+	parts := c.regexp.FindStringSubmatch(line)
+	// Add 1 because the first part is the entire expression.
+	if len(parts) < c.numParts+1 {
+		return nil, false
+	}
+
+	l := &log{
+		remoteAddr: normalizeAddr(parts[1]),
+		identity:   parts[2],
+		userID:     parts[3],
+		request:    unescapeQuoted(parts[5]),
+	}
+
+	// Parse timestamp. If it fails, the timestamp is left as the zero time and
+	// the collector counts it as invalid.
+	l.timestamp, _ = time.Parse(c.layout, parts[4])
+
+	// Parse status code and size (don't handle errors since we'll accept zero).
+	l.status, _ = strconv.Atoi(parts[6])
+	l.size, _ = strconv.ParseInt(parts[7], 10, 64)
+
+	// Referer and user-agent are only present in Combined Log Format, and
+	// X-Forwarded-For only if it's appended.
+	if len(parts) > combinedNumParts {
+		l.referer = unescapeQuoted(parts[8])
+		l.userAgent = unescapeQuoted(parts[9])
+	}
+	if len(parts) > forwardedNumParts {
+		l.forwardedFor = unescapeQuoted(parts[10])
+	}
+
+	return l, true
+}
+
+// unescapeQuoted removes the backslashes escaping quotes and backslashes within
+// a quoted field, e.g. `\"` becomes `"`. Other escape sequences, such as
+// Apache's `\x0a`, are left as is.
+func unescapeQuoted(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
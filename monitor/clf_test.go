@@ -0,0 +1,179 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCombinedLogFormatParse ensures the referer and user-agent fields of
+// Combined Log Format are parsed and that plain Common Log Format lines are
+// only accepted by the Common Log Format reader.
+func TestCombinedLogFormatParse(t *testing.T) {
+	var (
+		common   = commonLogFormatParser
+		combined = combinedLogFormatParser
+		clfLine  = `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`
+		line     = clfLine + ` "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`
+	)
+
+	for _, r := range []*clfParser{common, combined} {
+		l, ok := r.parse(line)
+		if !ok {
+			t.Fatalf("Expected line to parse")
+		}
+		if l.referer != "http://www.example.com/start.html" {
+			t.Fatalf("Expected referer http://www.example.com/start.html, got %s", l.referer)
+		}
+		if l.userAgent != "Mozilla/4.08 [en] (Win98; I ;Nav)" {
+			t.Fatalf("Expected user-agent Mozilla/4.08 [en] (Win98; I ;Nav), got %s", l.userAgent)
+		}
+		if l.status != 200 || l.size != 2326 {
+			t.Fatalf("Expected status 200 and size 2326, got %d and %d", l.status, l.size)
+		}
+	}
+
+	l, ok := common.parse(clfLine)
+	if !ok {
+		t.Fatal("Expected Common Log Format line to parse")
+	}
+	if l.referer != "" || l.userAgent != "" {
+		t.Fatalf("Expected empty referer and user-agent, got %q and %q", l.referer, l.userAgent)
+	}
+	if _, ok := combined.parse(clfLine); ok {
+		t.Fatal("Expected Common Log Format line to be rejected by Combined Log Format reader")
+	}
+}
+
+// TestCommonLogFormatParseAddr ensures the remote address is normalized when
+// it's logged with brackets, a port, or as a forwarded address list.
+func TestCommonLogFormatParseAddr(t *testing.T) {
+	const rest = ` - - [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.0" 200 2326`
+	for addr, expected := range map[string]string{
+		"10.0.0.1:51234":         "10.0.0.1",
+		"[2001:db8::1]:443":      "2001:db8::1",
+		"2001:db8::1":            "2001:db8::1",
+		"10.0.0.1,192.168.0.1":   "10.0.0.1",
+		"[2001:db8::1],10.0.0.1": "2001:db8::1",
+	} {
+		l, ok := commonLogFormatParser.parse(addr + rest)
+		if !ok {
+			t.Fatalf("Expected line with address %s to parse", addr)
+		}
+		if l.remoteAddr != expected {
+			t.Fatalf("Expected remote address %s, got %s", expected, l.remoteAddr)
+		}
+	}
+}
+
+// TestCommonLogFormatParseTimestampLayout ensures timestamps are parsed using
+// the parser's layout and left as the zero time if they don't match it.
+func TestCommonLogFormatParseTimestampLayout(t *testing.T) {
+	p := &clfParser{regexp: clfRegexp, numParts: clfNumParts, layout: time.RFC3339}
+	l, ok := p.parse(`10.0.0.1 - - [2017-03-01T12:00:00Z] "GET /index.html HTTP/1.1" 200 512`)
+	if !ok {
+		t.Fatal("Expected line to parse")
+	}
+	expected := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+	if !l.timestamp.Equal(expected) {
+		t.Fatalf("Expected timestamp %s, got %s", expected, l.timestamp)
+	}
+
+	l, ok = p.parse(`10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 512`)
+	if !ok {
+		t.Fatal("Expected line to parse")
+	}
+	if !l.timestamp.IsZero() {
+		t.Fatalf("Expected zero timestamp, got %s", l.timestamp)
+	}
+}
+
+// TestCombinedLogFormatParseForwardedFor ensures an X-Forwarded-For field
+// appended after the user-agent is parsed and doesn't affect the user-agent.
+func TestCombinedLogFormatParseForwardedFor(t *testing.T) {
+	const line = `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.0" 200 2326 "-" "Mozilla/4.08 [en] (Win98; I ;Nav)"`
+	for _, p := range []*clfParser{commonLogFormatParser, combinedLogFormatParser} {
+		l, ok := p.parse(line + ` "203.0.113.7, 10.0.0.2"` + "\n")
+		if !ok {
+			t.Fatal("Expected line with X-Forwarded-For to parse")
+		}
+		if l.forwardedFor != "203.0.113.7, 10.0.0.2" {
+			t.Fatalf("Expected X-Forwarded-For 203.0.113.7, 10.0.0.2, got %s", l.forwardedFor)
+		}
+		if l.userAgent != "Mozilla/4.08 [en] (Win98; I ;Nav)" {
+			t.Fatalf("Expected user-agent Mozilla/4.08 [en] (Win98; I ;Nav), got %s", l.userAgent)
+		}
+
+		l, ok = p.parse(line + "\n")
+		if !ok {
+			t.Fatal("Expected line without X-Forwarded-For to parse")
+		}
+		if l.forwardedFor != "" {
+			t.Fatalf("Expected no X-Forwarded-For, got %s", l.forwardedFor)
+		}
+	}
+}
+
+// TestCommonLogFormatParseEscapedQuotes ensures quoted fields containing
+// backslash-escaped quotes are parsed and unescaped rather than the line being
+// rejected.
+func TestCommonLogFormatParseEscapedQuotes(t *testing.T) {
+	const prefix = `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] `
+	tests := []struct {
+		line      string
+		request   string
+		referer   string
+		userAgent string
+	}{
+		{
+			line:      `"GET /index.html HTTP/1.1" 200 512 "-" "Mozilla/5.0 (compatible; \"Bot\" 1.0)"`,
+			request:   "GET /index.html HTTP/1.1",
+			referer:   "-",
+			userAgent: `Mozilla/5.0 (compatible; "Bot" 1.0)`,
+		},
+		{
+			line:      `"GET /index.html HTTP/1.1" 200 512 "-" "\"quoted\" \"agent\""`,
+			request:   "GET /index.html HTTP/1.1",
+			referer:   "-",
+			userAgent: `"quoted" "agent"`,
+		},
+		{
+			line:      `"GET /search?q=\"foo\" HTTP/1.1" 200 512 "http://example.com/?q=\"bar\"" "curl/7.54.0"`,
+			request:   `GET /search?q="foo" HTTP/1.1`,
+			referer:   `http://example.com/?q="bar"`,
+			userAgent: "curl/7.54.0",
+		},
+		{
+			line:      `"GET /index.html HTTP/1.1" 200 512 "-" "agent\\" "203.0.113.7"`,
+			request:   "GET /index.html HTTP/1.1",
+			referer:   "-",
+			userAgent: `agent\`,
+		},
+		{
+			line:      `"GET /index.html HTTP/1.1" 200 512 "-" "evil\x22agent"`,
+			request:   "GET /index.html HTTP/1.1",
+			referer:   "-",
+			userAgent: `evil\x22agent`,
+		},
+	}
+
+	for _, p := range []*clfParser{commonLogFormatParser, combinedLogFormatParser} {
+		for _, tt := range tests {
+			l, ok := p.parse(prefix + tt.line)
+			if !ok {
+				t.Fatalf("Expected line %s to parse", tt.line)
+			}
+			if l.request != tt.request {
+				t.Fatalf("Expected request %s, got %s", tt.request, l.request)
+			}
+			if l.referer != tt.referer {
+				t.Fatalf("Expected referer %s, got %s", tt.referer, l.referer)
+			}
+			if l.userAgent != tt.userAgent {
+				t.Fatalf("Expected user-agent %s, got %s", tt.userAgent, l.userAgent)
+			}
+			if l.status != 200 || l.size != 512 {
+				t.Fatalf("Expected status 200 and size 512, got %d and %d", l.status, l.size)
+			}
+		}
+	}
+}
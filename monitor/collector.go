@@ -1,8 +1,16 @@
 package monitor
 
 import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
 	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/codahale/hdrhistogram"
@@ -16,6 +24,18 @@ const (
 
 	// maxRecordableSize is the maximum recordable size of a response.
 	maxRecordableSize = 1000000000000
+
+	// maxRecordableLatency is the maximum recordable response time in
+	// microseconds.
+	maxRecordableLatency = int64(time.Hour / time.Microsecond)
+
+	// noUserAgent is the user-agent under which logs without a user-agent are
+	// grouped.
+	noUserAgent = "(none)"
+
+	// numHistWindows is the number of windows kept by the response size and
+	// latency histograms.
+	numHistWindows = 3
 )
 
 // requestRegexp matches the HTTP request line, e.g. "GET /index.html HTTP/1.1".
@@ -30,120 +50,1033 @@ type statusFreq struct {
 	ServerError   uint64
 }
 
+// record counts the status code in its class, if it's valid.
+func (s *statusFreq) record(status int) {
+	switch {
+	case status >= 100 && status < 200:
+		s.Informational++
+	case status >= 200 && status < 300:
+		s.Successful++
+	case status >= 300 && status < 400:
+		s.Redirection++
+	case status >= 400 && status < 500:
+		s.ClientError++
+	case status >= 500 && status < 600:
+		s.ServerError++
+	}
+}
+
+// total returns the number of responses with a valid status code.
+func (s statusFreq) total() uint64 {
+	return s.Informational + s.Successful + s.Redirection + s.ClientError + s.ServerError
+}
+
+// successRate returns the fraction of responses which weren't server errors
+// or, if clientErrors is true, client errors. It returns 1 if there were no
+// responses.
+func (s statusFreq) successRate(clientErrors bool) float64 {
+	total := s.total()
+	if total == 0 {
+		return 1
+	}
+	failed := s.ServerError
+	if clientErrors {
+		failed += s.ClientError
+	}
+	return float64(total-failed) / float64(total)
+}
+
 // collector receives logs from a Reader and tracks summary statistics.
 type collector struct {
 	sync.RWMutex
-	topSections *boom.TopK
-	ipHll       *boom.HyperLogLog
-	count       uint64
-	sizeHist    *hdrhistogram.WindowedHistogram
-	statusFreq  statusFreq
-	averager    *windowedAverager
+	topSections       *decayingTopK
+	topSectionBytes   *weightedTopK
+	sectionDecay      time.Duration
+	recent            *recentLogs // nil unless recent logs are kept
+	topIPs            *boom.TopK
+	topUserAgents     *boom.TopK
+	topCountries      *boom.TopK
+	geoIP             *geoIPDB
+	countryCache      map[string]string
+	ipHll             *boom.HyperLogLog
+	recentIPs         *windowedHLL // nil unless distinct IPs are windowed
+	distinctRotate    time.Duration
+	pathHll           *boom.HyperLogLog // nil if distinct paths are disabled
+	count             uint64
+	malformed         uint64
+	ignored           uint64
+	invalidTimestamps uint64
+	sizeHist          *hdrhistogram.WindowedHistogram // nil if the size histogram is disabled
+	latencyHist       *hdrhistogram.WindowedHistogram
+	histRotate        time.Duration
+	sizeBounds        []int64  // ascending upper bounds of the size buckets
+	sizeCounts        []uint64 // responses in each size bucket
+	statusFreq        statusFreq
+	recentStatuses    *windowedStatusFreq // nil unless status frequencies are windowed
+	statusRotate      time.Duration
+	methodFreq        map[string]uint64
+	protocolFreq      map[string]uint64
+	levelFreq         map[string]uint64
+	averager          *windowedAverager
+	throughput        *windowedAverager
+	errors            *windowedAverager
+	watched           []*watchedStatus
+	rules             []*ruleMetric
+	depth             uint
+	maxCardinality    uint // of each frequency map, or zero if unbounded
+	sectionQuery      SectionQueryMode
+	byMethod          bool            // sections are prefixed with the method
+	queryParams       map[string]bool // parameters kept by SectionQueryParams
+	ignorePatterns    []*regexp.Regexp
+	pathIDPatterns    []*regexp.Regexp // nil unless path IDs are normalized
+	startTime         time.Time
+	endTime           time.Time
+	firstSeen         time.Time // earliest timestamp of the logs aggregated
+	lastSeen          time.Time // latest timestamp of the logs aggregated
+	stopAfterEnd      bool
+	reverse           bool // logs are read newest first
+	minLevel          int  // severity below which entries are ignored, or zero
+	hitsBufferSize    int
+	logHook           func(Log)
+	output            io.Writer // where recovered panics are reported
+	useForwardedFor   bool
+	sampleRate        float64
+	rand              *rand.Rand   // nil if every log is sampled
+	shards            []*collector // nil unless logs are aggregated by multiple workers
+	nextShard         uint32       // shard to ingest the next log into
+	lastRead          int64        // Unix nanoseconds of the last log read while running, or zero
+	started           int64        // Unix nanoseconds when the collector started while running, or zero
+	processed         uint64       // logs read or ingested
+	readErr           error        // why reading logs failed, if it did
 }
 
-// newCollector creates a collector used to receive and summarize log data.
-func newCollector(numTopSections uint, window, quantum time.Duration) *collector {
-	ipHll, _ := boom.NewDefaultHyperLogLog(0.01)
-	return &collector{
-		topSections: boom.NewTopK(0.001, 0.99, numTopSections),
-		ipHll:       ipHll,
-		sizeHist:    hdrhistogram.NewWindowed(3, 1, maxRecordableSize, 5),
-		averager:    newWindowedAverager(window, quantum),
+// newCollector creates a collector used to receive and summarize log data
+// using the given options.
+func newCollector(opts MonitorOpts) *collector {
+	c := &collector{
+		latencyHist:     hdrhistogram.NewWindowed(numHistWindows, 1, maxRecordableLatency, 3),
+		histRotate:      opts.HistogramRotationInterval,
+		sizeBounds:      opts.SizeBuckets,
+		sizeCounts:      make([]uint64, len(opts.SizeBuckets)+1),
+		methodFreq:      make(map[string]uint64),
+		protocolFreq:    make(map[string]uint64),
+		levelFreq:       make(map[string]uint64),
+		averager:        newWindowedAverager(opts.AlertWindow, opts.Quantum),
+		throughput:      newWindowedAverager(opts.AlertWindow, opts.Quantum),
+		errors:          newWindowedAverager(opts.AlertWindow, opts.Quantum),
+		depth:           opts.SectionDepth,
+		maxCardinality:  opts.MaxCardinality,
+		sectionQuery:    opts.SectionQuery,
+		byMethod:        opts.SectionsByMethod,
+		logHook:         opts.LogHook,
+		output:          opts.Output,
+		useForwardedFor: opts.UseForwardedFor,
+		startTime:       opts.StartTime,
+		endTime:         opts.EndTime,
+		reverse:         opts.Reverse,
+		minLevel:        levelSeverity(strings.ToLower(opts.MinLevel)),
+	}
+	if opts.HitsBufferSize > 0 {
+		c.hitsBufferSize = opts.HitsBufferSize
+	}
+	// Logs are assumed to be sorted, so once a log is read which is past the
+	// end of the range, or before its start if they're read in reverse, the
+	// rest can't be in it.
+	if opts.NoFollow {
+		c.stopAfterEnd = !opts.EndTime.IsZero()
+		if opts.Reverse {
+			c.stopAfterEnd = !opts.StartTime.IsZero()
+		}
+	}
+	if len(opts.SectionQueryParams) > 0 {
+		c.queryParams = make(map[string]bool, len(opts.SectionQueryParams))
+		for _, name := range opts.SectionQueryParams {
+			c.queryParams[name] = true
+		}
+	}
+	if !opts.DisableDistinctIPs {
+		c.ipHll, _ = boom.NewDefaultHyperLogLog(0.01)
+	}
+	if !opts.DisableDistinctPaths {
+		c.pathHll, _ = boom.NewDefaultHyperLogLog(0.01)
+	}
+	if !opts.DisableSizeHistogram {
+		c.sizeHist = hdrhistogram.NewWindowed(numHistWindows, 1, maxRecordableSize, 5)
+	}
+	// Only track top sections, IPs, and user-agents if requested since a TopK
+	// requires k > 0.
+	if opts.NumTopSections > 0 && !opts.DisableTopSections {
+		c.topSections = newDecayingTopK(opts.NumTopSections, opts.SectionDecay)
+		c.topSectionBytes = newWeightedTopK(opts.NumTopSections)
+		c.sectionDecay = opts.SectionDecayInterval
+	}
+	if opts.DistinctIPWindow > 0 {
+		c.recentIPs = newWindowedHLL()
+		c.distinctRotate = opts.DistinctIPWindow / numDistinctWindows
+	}
+	if opts.RecentBufferSize > 0 {
+		c.recent = newRecentLogs(opts.RecentBufferSize)
+	}
+	if opts.StatusWindow > 0 {
+		c.recentStatuses = newWindowedStatusFreq()
+		c.statusRotate = opts.StatusWindow / numStatusWindows
+	}
+	if opts.NumTopIPs > 0 {
+		c.topIPs = boom.NewTopK(0.001, 0.99, opts.NumTopIPs)
 	}
+	if opts.NumTopUserAgents > 0 {
+		c.topUserAgents = boom.NewTopK(0.001, 0.99, opts.NumTopUserAgents)
+	}
+	// The patterns were checked by validate.
+	for _, pattern := range opts.IgnorePatterns {
+		if re, err := regexp.Compile(pattern); err == nil {
+			c.ignorePatterns = append(c.ignorePatterns, re)
+		}
+	}
+	if opts.NormalizePathIDs {
+		patterns := opts.PathIDPatterns
+		if len(patterns) == 0 {
+			patterns = defaultPathIDPatterns
+		}
+		// The patterns were checked by validate.
+		for _, pattern := range patterns {
+			if re, err := compilePathIDPattern(pattern); err == nil {
+				c.pathIDPatterns = append(c.pathIDPatterns, re)
+			}
+		}
+	}
+	for _, watch := range opts.WatchedStatuses {
+		if w, err := newWatchedStatus(watch, newWindowedAverager(opts.AlertWindow, opts.Quantum)); err == nil {
+			c.watched = append(c.watched, w)
+		}
+	}
+	for _, rule := range opts.AlertRules {
+		c.rules = append(c.rules, newRuleMetric(rule, opts.Quantum))
+	}
+	if opts.SampleRate > 0 && opts.SampleRate < 1 {
+		c.sampleRate = opts.SampleRate
+		c.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	// GeoIP lookups are disabled with a warning if the database can't be
+	// opened rather than failing.
+	if opts.GeoIPDatabase != "" && opts.NumTopCountries > 0 {
+		db, err := openGeoIPDB(opts.GeoIPDatabase)
+		if err != nil {
+			fmt.Fprintf(opts.Output, "Disabling GeoIP lookups: failed to open %s: %v\n", opts.GeoIPDatabase, err)
+		} else {
+			c.geoIP = db
+			c.countryCache = make(map[string]string)
+			c.topCountries = boom.NewTopK(0.001, 0.99, opts.NumTopCountries)
+		}
+	}
+	if opts.Workers > 1 {
+		c.shards = make([]*collector, opts.Workers)
+		for i := range c.shards {
+			c.shards[i] = c.newShard(opts)
+		}
+	}
+	return c
+}
+
+// newShard creates a collector which aggregates one worker's share of the
+// logs. The averagers, recent logs, and GeoIP database are shared with the
+// given collector since they're safe for concurrent use, while everything else
+// is kept per shard and merged when summarizing.
+func (c *collector) newShard(opts MonitorOpts) *collector {
+	opts.GeoIPDatabase = ""
+	opts.IgnorePatterns = nil
+	opts.Workers = 1
+	s := newCollector(opts)
+	s.ignorePatterns = c.ignorePatterns
+	s.averager = c.averager
+	s.throughput = c.throughput
+	s.errors = c.errors
+	for i, w := range s.watched {
+		w.averager = c.watched[i].averager
+	}
+	s.rules = c.rules
+	s.recent = c.recent
+	if c.geoIP != nil {
+		s.geoIP = c.geoIP
+		s.countryCache = make(map[string]string)
+		s.topCountries = boom.NewTopK(0.001, 0.99, opts.NumTopCountries)
+	}
+	return s
+}
+
+// partitions returns the collectors which aggregate logs, i.e. the shards if
+// there are multiple workers or else the collector itself.
+func (c *collector) partitions() []*collector {
+	if len(c.shards) > 0 {
+		return c.shards
+	}
+	return []*collector{c}
 }
 
 // Start collecting logs from the Reader and performing summary statistics.
-// This runs until the reader is closed.
-func (c *collector) Start(reader reader) error {
-	logs, err := reader.Open()
+// This runs until the reader is closed or, if the collector stops after the end
+// time, a log past it is processed. If the reader stopped due to an error, it's
+// returned.
+func (c *collector) Start(reader Reader) error {
+	logs, err := openReader(reader)
 	if err != nil {
-		return errors.Wrap(err, "failed to open Reader")
+		return c.fail(errors.Wrap(err, "failed to open Reader"))
 	}
+	atomic.StoreInt64(&c.lastRead, time.Now().UnixNano())
+	defer atomic.StoreInt64(&c.lastRead, 0)
+	atomic.StoreInt64(&c.started, time.Now().UnixNano())
+	defer atomic.StoreInt64(&c.started, 0)
 
-	hits := make(chan time.Time, 1024)
-	go c.averager.quantize(hits)
+	hits := make(chan time.Time, c.hitsBufferSize)
+	quantized := make(chan struct{})
+	go func() {
+		defer close(quantized)
+		// If quantizing panics, keep draining the hits so that processing
+		// isn't blocked, at the cost of the hits average.
+		defer recoverPanic(c.output, "quantizing hits", func() {
+			for range hits {
+			}
+		})
+		c.averager.quantize(hits)
+	}()
 
-	for l := range logs {
-		c.process(l, hits)
+	stop := make(chan struct{})
+	go c.rotateHists(stop)
+	go c.decaySections(stop)
+	go c.rotateDistinct(stop)
+	go c.rotateStatuses(stop)
+	go c.throughput.tick(stop)
+	go c.errors.tick(stop)
+	for _, w := range c.watched {
+		go w.averager.tick(stop)
+	}
+	for _, r := range c.rules {
+		go r.averager.tick(stop)
 	}
 
+	var (
+		wg      sync.WaitGroup
+		done    = make(chan struct{})
+		endOnce sync.Once
+	)
+	for _, p := range c.partitions() {
+		wg.Add(1)
+		go func(p *collector) {
+			defer wg.Done()
+			for {
+				select {
+				case l, ok := <-logs:
+					if !ok {
+						return
+					}
+					atomic.StoreInt64(&c.lastRead, time.Now().UnixNano())
+					atomic.AddUint64(&c.processed, 1)
+					if !p.processSafely(l, hits) && c.stopAfterEnd {
+						endOnce.Do(func() { close(done) })
+						return
+					}
+				case <-done:
+					return
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	// Wait for the buffered hits to be recorded so that a summary taken once
+	// this returns accounts for every log which was processed.
+	close(stop)
 	close(hits)
+	<-quantized
+	select {
+	case <-done:
+		// The reader is still running, so it's left for the caller to close.
+		// Its remaining logs are discarded until then so that it isn't left
+		// blocked sending, e.g. a partial line when it's closed.
+		go func() {
+			for range logs {
+			}
+		}()
+		return nil
+	default:
+	}
+	return c.fail(errors.Wrap(reader.Err(), "failed to read logs"))
+}
+
+// fail records the error, if any, which caused reading logs to fail so that
+// it's reported by health, and returns it.
+func (c *collector) fail(err error) error {
+	if err != nil {
+		c.Lock()
+		c.readErr = err
+		c.Unlock()
+	}
+	return err
+}
+
+// health returns the error which caused reading logs to fail, if any, or an
+// error if the collector is running and no logs have been read within the
+// given staleness as of now. Staleness isn't checked if it's zero.
+func (c *collector) health(staleness time.Duration, now time.Time) error {
+	c.RLock()
+	err := c.readErr
+	c.RUnlock()
+	if err != nil {
+		return err
+	}
+	lastRead := atomic.LoadInt64(&c.lastRead)
+	if staleness <= 0 || lastRead == 0 {
+		return nil
+	}
+	if idle := now.Sub(time.Unix(0, lastRead)); idle > staleness {
+		return errors.Errorf("no logs read in %s", idle.Round(time.Millisecond))
+	}
 	return nil
 }
 
-// process a single log.
-func (c *collector) process(l *log, hits chan<- time.Time) {
+// rotateHists starts a loop that rotates the response size and latency
+// histograms on the configured interval until the given channel is closed.
+// This ensures the histograms reflect a consistent span of time regardless of
+// traffic volume.
+func (c *collector) rotateHists(stop <-chan struct{}) {
+	// Don't rotate if the interval is zero.
+	if c.histRotate <= 0 {
+		return
+	}
+	t := time.NewTicker(c.histRotate)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-stop:
+			return
+		}
+		for _, p := range c.partitions() {
+			p.Lock()
+			if p.sizeHist != nil {
+				p.sizeHist.Rotate()
+			}
+			p.latencyHist.Rotate()
+			p.Unlock()
+		}
+	}
+}
+
+// rotateDistinct starts a loop that rotates the windowed distinct IP counts
+// until the given channel is closed so that they reflect recent visitors.
+func (c *collector) rotateDistinct(stop <-chan struct{}) {
+	// Don't rotate if distinct IPs aren't windowed.
+	if c.recentIPs == nil || c.distinctRotate <= 0 {
+		return
+	}
+	t := time.NewTicker(c.distinctRotate)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-stop:
+			return
+		}
+		for _, p := range c.partitions() {
+			p.Lock()
+			p.recentIPs.rotate()
+			p.Unlock()
+		}
+	}
+}
+
+// rotateStatuses starts a loop that rotates the windowed status frequencies on
+// the configured interval until the given channel is closed.
+func (c *collector) rotateStatuses(stop <-chan struct{}) {
+	// Don't rotate if status frequencies aren't windowed.
+	if c.recentStatuses == nil || c.statusRotate <= 0 {
+		return
+	}
+	t := time.NewTicker(c.statusRotate)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-stop:
+			return
+		}
+		for _, p := range c.partitions() {
+			p.Lock()
+			p.recentStatuses.rotate()
+			p.Unlock()
+		}
+	}
+}
+
+// reset clears all summary statistics while leaving the collector running.
+// Hits which were sent to the averager before the reset but not yet recorded
+// may be counted after it.
+func (c *collector) reset() {
+	for _, p := range c.partitions() {
+		p.resetStats()
+	}
+	c.averager.reset()
+	c.throughput.reset()
+	c.errors.reset()
+	for _, w := range c.watched {
+		w.averager.reset()
+	}
+	for _, r := range c.rules {
+		r.averager.reset()
+	}
+	if c.recent != nil {
+		c.recent.reset()
+	}
+}
+
+// resetStats clears the statistics aggregated by this collector, excluding
+// the averagers which may be shared with other shards.
+func (c *collector) resetStats() {
 	c.Lock()
-	c.count++
-	hits <- l.timestamp
-	c.processRequest(l.request)
-	c.processIP(l.remoteAddr)
-	c.processSize(l.size)
-	c.processStatus(l.status)
-	c.Unlock()
+	defer c.Unlock()
+	if c.ipHll != nil {
+		c.ipHll.Reset()
+	}
+	if c.pathHll != nil {
+		c.pathHll.Reset()
+	}
+	if c.recentIPs != nil {
+		c.recentIPs.reset()
+	}
+	if c.topSections != nil {
+		c.topSections.reset()
+		c.topSectionBytes.reset()
+	}
+	if c.topIPs != nil {
+		c.topIPs.Reset()
+	}
+	if c.topUserAgents != nil {
+		c.topUserAgents.Reset()
+	}
+	if c.topCountries != nil {
+		c.topCountries.Reset()
+	}
+	if c.sizeHist != nil {
+		c.sizeHist = hdrhistogram.NewWindowed(numHistWindows, 1, maxRecordableSize, 5)
+	}
+	c.latencyHist = hdrhistogram.NewWindowed(numHistWindows, 1, maxRecordableLatency, 3)
+	c.statusFreq = statusFreq{}
+	if c.recentStatuses != nil {
+		c.recentStatuses.reset()
+	}
+	c.sizeCounts = make([]uint64, len(c.sizeBounds)+1)
+	c.methodFreq = make(map[string]uint64)
+	c.protocolFreq = make(map[string]uint64)
+	c.levelFreq = make(map[string]uint64)
+	c.firstSeen = time.Time{}
+	c.lastSeen = time.Time{}
+	c.count = 0
+	c.malformed = 0
+	c.ignored = 0
+	c.invalidTimestamps = 0
+	for _, w := range c.watched {
+		w.count = 0
+	}
+}
+
+// decaySections starts a loop that rotates the top sections on the configured
+// interval until the given channel is closed so that they reflect recent
+// activity.
+func (c *collector) decaySections(stop <-chan struct{}) {
+	// Don't decay if disabled or sections aren't tracked.
+	if c.sectionDecay <= 0 || c.topSections == nil {
+		return
+	}
+	t := time.NewTicker(c.sectionDecay)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-stop:
+			return
+		}
+		for _, p := range c.partitions() {
+			p.Lock()
+			p.topSections.rotate()
+			p.Unlock()
+		}
+	}
+}
+
+// process a single log. Logs outside the configured time range are skipped,
+// and false is returned if the log is past the end time, or before the start
+// time if logs are read in reverse. Otherwise, the count and hits are always
+// recorded, but the remaining aggregations are only performed if the log isn't
+// ignored and, with the exception of watched statuses, is sampled. Error log
+// entries are only counted by level since they aren't HTTP requests, and logs
+// below the minimum level are skipped.
+func (c *collector) process(l *log, hits chan<- time.Time) bool {
+	inRange, aggregated := c.aggregate(l, hits)
+
+	if !aggregated || (c.logHook == nil && c.recent == nil) {
+		return inRange
+	}
+	exported := l.export()
+	if c.recent != nil {
+		c.recent.add(exported)
+	}
+	// Call the hook without holding the lock so that it may do slow work or
+	// take a snapshot.
+	if c.logHook != nil {
+		c.logHook(exported)
+	}
+	return inRange
+}
+
+// processSafely is like process but recovers from a panic while processing the
+// log, e.g. due to an unexpected edge case in an untrusted log file, by
+// reporting it and skipping the log rather than crashing the process.
+func (c *collector) processSafely(l *log, hits chan<- time.Time) (inRange bool) {
+	inRange = true
+	defer recoverPanic(c.output, "processing log", nil)
+	return c.process(l, hits)
+}
+
+// recoverPanic is deferred by goroutines which handle untrusted input to
+// recover from a panic rather than crash the process. The panic is reported to
+// w, if it's not nil, with what the goroutine was doing, and then onPanic, if
+// not nil, is called.
+func recoverPanic(w io.Writer, doing string, onPanic func()) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if w != nil {
+		fmt.Fprintf(w, "Recovered from panic while %s: %v\n%s", doing, r, debug.Stack())
+	}
+	if onPanic != nil {
+		onPanic()
+	}
+}
+
+// aggregate updates the summary data with the log entry while holding the
+// lock. It returns false for inRange if the log is past the end time, or before
+// the start time if logs are read in reverse, and false for aggregated if the
+// log is outside of the time range.
+func (c *collector) aggregate(l *log, hits chan<- time.Time) (inRange, aggregated bool) {
+	// Unlock in a defer so a panic doesn't leave the collector locked.
+	c.Lock()
+	defer c.Unlock()
+	invalidTimestamp := l.timestamp.IsZero()
+	if invalidTimestamp {
+		// The timestamp is missing or couldn't be parsed, so count it and use
+		// the current time rather than dropping the hit, unless logs are
+		// filtered by time since it can't be placed in the range.
+		c.invalidTimestamps++
+		if !c.startTime.IsZero() || !c.endTime.IsZero() {
+			return true, false
+		}
+		l.timestamp = time.Now()
+	}
+	if !c.startTime.IsZero() && l.timestamp.Before(c.startTime) {
+		return !c.reverse, false
+	}
+	if !c.endTime.IsZero() && l.timestamp.After(c.endTime) {
+		return c.reverse, false
+	}
+	if severity := levelSeverity(l.level); severity > 0 && severity < c.minLevel {
+		return true, false
+	}
+	// The span only covers the logs' own timestamps.
+	if !invalidTimestamp {
+		c.recordSeen(l.timestamp)
+	}
+	if l.level != "" {
+		c.processLevel(l.timestamp, l.level)
+	}
+	// Error log entries have a level but aren't requests, so they're only
+	// counted by level.
+	if l.level == "" || l.request != "" {
+		c.count++
+		hits <- l.timestamp
+		c.recordRules(MetricHits, l.timestamp, 1)
+		if c.ignore(l.request) {
+			c.ignored++
+		} else {
+			c.processWatchedStatus(l.timestamp, l.status)
+			if c.sample() {
+				ip := c.clientIP(l)
+				if section := c.processRequest(l.request); section != "" && l.size > 0 {
+					c.topSectionBytes.Add(section, uint64(l.size))
+				}
+				c.processIP(ip)
+				c.processCountry(ip)
+				c.processUserAgent(l.userAgent)
+				c.processSize(l.timestamp, l.size)
+				c.processResponseTime(l.responseTime)
+				c.processStatus(l.status)
+			}
+		}
+	}
+	return true, true
+}
+
+// recordSeen updates the span of the logs' timestamps with the given timestamp.
+func (c *collector) recordSeen(timestamp time.Time) {
+	if c.firstSeen.IsZero() || timestamp.Before(c.firstSeen) {
+		c.firstSeen = timestamp
+	}
+	if timestamp.After(c.lastSeen) {
+		c.lastSeen = timestamp
+	}
+}
+
+// ingest processes a log entry which was passed in directly rather than read
+// from a Reader, spreading entries across the shards if logs are aggregated by
+// multiple workers. The hit is recorded immediately instead of being queued.
+// It returns false if the log is past the end time.
+func (c *collector) ingest(l *log) bool {
+	p := c
+	if len(c.shards) > 0 {
+		p = c.shards[(atomic.AddUint32(&c.nextShard, 1)-1)%uint32(len(c.shards))]
+	}
+	atomic.AddUint64(&c.processed, 1)
+	hits := make(chan time.Time, 1)
+	inRange := p.process(l, hits)
+	select {
+	case hit := <-hits:
+		c.averager.record(hit, 1)
+	default:
+	}
+	return inRange
+}
+
+// ignore indicates if the path of the request matches one of the ignore
+// patterns. Malformed requests are never ignored.
+func (c *collector) ignore(request string) bool {
+	if len(c.ignorePatterns) == 0 {
+		return false
+	}
+	parts := requestRegexp.FindStringSubmatch(request)
+	if len(parts) != numRequestParts+1 {
+		return false
+	}
+	for _, re := range c.ignorePatterns {
+		if re.MatchString(parts[2]) {
+			return true
+		}
+	}
+	return false
+}
+
+// otherKey is the key under which values are counted once a frequency map has
+// reached the cardinality cap.
+const otherKey = "(other)"
+
+// countCapped increments the frequency of the value unless the map already
+// has the maximum number of distinct values, in which case a new value is
+// counted under otherKey instead.
+func (c *collector) countCapped(freq map[string]uint64, value string) {
+	if _, ok := freq[value]; !ok && c.maxCardinality > 0 && uint(len(freq)) >= c.maxCardinality {
+		value = otherKey
+	}
+	freq[value]++
+}
+
+// sample indicates if the next log should be aggregated based on the sample
+// rate.
+func (c *collector) sample() bool {
+	return c.rand == nil || c.rand.Float64() < c.sampleRate
+}
+
+// processLevel updates summary data pertaining to the level of a log entry.
+func (c *collector) processLevel(timestamp time.Time, level string) {
+	c.countCapped(c.levelFreq, level)
+	if isErrorLevel(level) {
+		c.errors.record(timestamp, 1)
+		c.recordRules(MetricErrors, timestamp, 1)
+	}
+}
+
+// clientIP returns the address of the client which made the request. This is
+// the remote address unless the collector is configured to use the left-most
+// X-Forwarded-For address and the log has one.
+func (c *collector) clientIP(l *log) string {
+	if c.useForwardedFor && l.forwardedFor != "" && l.forwardedFor != "-" {
+		if ip := normalizeAddr(l.forwardedFor); ip != "" {
+			return ip
+		}
+	}
+	return l.remoteAddr
 }
 
 // processIP updates summary data pertaining to the remote IP address.
 func (c *collector) processIP(ip string) {
-	// Count distinct.
-	c.ipHll.Add([]byte(ip))
+	// Count distinct, both overall and recently if configured.
+	if c.ipHll != nil {
+		c.ipHll.Add([]byte(ip))
+	}
+	if c.recentIPs != nil {
+		c.recentIPs.Add([]byte(ip))
+	}
+
+	// Track the most frequent.
+	if c.topIPs != nil {
+		c.topIPs.Add([]byte(ip))
+	}
+}
+
+// processCountry updates summary data pertaining to the country of the remote
+// IP address. Countries are cached by address so that the database is only
+// searched once per address. Addresses which can't be located are grouped
+// together.
+func (c *collector) processCountry(addr string) {
+	if c.geoIP == nil {
+		return
+	}
+	country, ok := c.countryCache[addr]
+	if !ok {
+		country = unknownCountry
+		if ip := net.ParseIP(addr); ip != nil {
+			if code, err := c.geoIP.country(ip); err == nil && code != "" {
+				country = code
+			}
+		}
+		if len(c.countryCache) >= maxGeoIPCacheSize {
+			c.countryCache = make(map[string]string)
+		}
+		c.countryCache[addr] = country
+	}
+	c.topCountries.Add([]byte(country))
+}
+
+// processUserAgent updates summary data pertaining to the user-agent. Logs
+// without a user-agent are grouped together.
+func (c *collector) processUserAgent(userAgent string) {
+	if c.topUserAgents == nil {
+		return
+	}
+	if userAgent == "" || userAgent == "-" {
+		userAgent = noUserAgent
+	}
+	c.topUserAgents.Add([]byte(userAgent))
 }
 
 // processSize updates summary data pertaining to the response size.
-func (c *collector) processSize(size int64) {
-	c.sizeHist.Current.RecordValue(int64(size))
-	if c.count%100000 == 0 {
-		c.sizeHist.Rotate()
+func (c *collector) processSize(timestamp time.Time, size int64) {
+	if c.sizeHist != nil {
+		c.sizeHist.Current.RecordValue(int64(size))
+	}
+	c.sizeCounts[sort.Search(len(c.sizeBounds), func(i int) bool { return size < c.sizeBounds[i] })]++
+	if size > 0 {
+		// Scale sampled sizes so that throughput estimates the total.
+		if c.rand != nil {
+			size = int64(float64(size) / c.sampleRate)
+		}
+		c.throughput.record(timestamp, uint64(size))
+		c.recordRules(MetricBytes, timestamp, uint64(size))
+	}
+}
+
+// processResponseTime updates summary data pertaining to the response time.
+// Zero response times are skipped since they indicate the reader doesn't
+// supply response times.
+func (c *collector) processResponseTime(responseTime time.Duration) {
+	if responseTime <= 0 {
+		return
 	}
+	c.latencyHist.Current.RecordValue(int64(responseTime / time.Microsecond))
 }
 
 // processStatus updates summary data pertaining to the request status.
 func (c *collector) processStatus(status int) {
-	switch {
-	case status >= 100 && status < 200:
-		c.statusFreq.Informational++
-	case status >= 200 && status < 300:
-		c.statusFreq.Successful++
-	case status >= 300 && status < 400:
-		c.statusFreq.Redirection++
-	case status >= 400 && status < 500:
-		c.statusFreq.ClientError++
-	case status >= 500 && status < 600:
-		c.statusFreq.ServerError++
+	c.statusFreq.record(status)
+	if c.recentStatuses != nil {
+		c.recentStatuses.record(status)
 	}
 }
 
-// processRequest updates summary data pertaining to the request line.
-func (c *collector) processRequest(request string) {
-	if !requestRegexp.MatchString(request) {
-		// Malformed request, skip it.
-		return
+// processWatchedStatus updates the counts and averages of the watched
+// statuses, and the averages of the alert rules, matching the status. This
+// isn't subject to sampling so that the counts are exact.
+func (c *collector) processWatchedStatus(timestamp time.Time, status int) {
+	for _, w := range c.watched {
+		if w.matches(status) {
+			w.count++
+			w.averager.record(timestamp, 1)
+		}
+	}
+	for _, r := range c.rules {
+		if r.status != nil && r.status.matches(status) {
+			r.averager.record(timestamp, 1)
+		}
 	}
+}
+
+// processRequest updates summary data pertaining to the request line. It
+// returns the request's section if top sections are tracked or else an empty
+// string.
+func (c *collector) processRequest(request string) string {
 	parts := requestRegexp.FindStringSubmatch(request)
 	// Add 1 because the first part is the entire expression.
 	if len(parts) != numRequestParts+1 {
-		// Malformed request, skip it.
-		return
+		// Malformed request, count and skip it.
+		c.malformed++
+		return ""
+	}
+
+	// Summarize method and protocol.
+	c.countCapped(c.methodFreq, parts[1])
+	c.countCapped(c.protocolFreq, strings.TrimSpace(parts[4]))
+
+	// Count distinct paths.
+	path := c.normalizePathIDs(parts[2])
+	if c.pathHll != nil {
+		c.pathHll.Add([]byte(path))
 	}
 
 	// Summarize section. A section is defined as being what's before the
-	// second '/' in a URL, i.e. the section for "/pages/create" is "/pages".
-	section := sectionFromDocument(parts[2])
+	// second '/' in a URL, i.e. the section for "/pages/create" is "/pages",
+	// or deeper if configured, optionally prefixed with the method.
+	if c.topSections == nil {
+		return ""
+	}
+	section := c.sectionQuerySuffix(sectionFromDocument(path, c.depth), parts[3])
+	if c.byMethod {
+		section = parts[1] + " " + section
+	}
 	c.topSections.Add([]byte(section))
+	return section
+}
+
+// pathIDPlaceholder replaces path segments which are IDs.
+const pathIDPlaceholder = ":id"
+
+// defaultPathIDPatterns match decimal numbers and UUIDs.
+var defaultPathIDPatterns = []string{
+	`[0-9]+`,
+	`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+// compilePathIDPattern compiles the given path ID pattern so that it only
+// matches entire path segments.
+func compilePathIDPattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
+
+// normalizePathIDs returns the given path with each segment matching one of
+// the path ID patterns replaced by ":id", e.g. "/users/:id/orders/:id" for
+// "/users/12345/orders/9".
+func (c *collector) normalizePathIDs(path string) string {
+	if len(c.pathIDPatterns) == 0 {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	normalized := false
+	for i, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		for _, re := range c.pathIDPatterns {
+			if re.MatchString(segment) {
+				segments[i] = pathIDPlaceholder
+				normalized = true
+				break
+			}
+		}
+	}
+	if !normalized {
+		return path
+	}
+	return strings.Join(segments, "/")
+}
+
+// SectionQueryMode controls how the query string of a request affects its
+// section.
+type SectionQueryMode int
+
+const (
+	// StripQuery ignores the query string, e.g. the section for
+	// "/search/all?q=go" is "/search".
+	StripQuery SectionQueryMode = iota
+
+	// MarkQuery appends "?" to the sections of requests with a query string,
+	// e.g. the section for "/search/all?q=go" is "/search?", so they're counted
+	// separately from requests without one.
+	MarkQuery
+
+	// SectionQueryParams appends the names of the query parameters in
+	// MonitorOpts.SectionQueryParams which the request has, sorted, e.g. the
+	// section for "/search/all?page=2&q=go&utm=x" with the parameters q and page
+	// is "/search?page&q". Other parameters and the values are ignored.
+	SectionQueryParams
+)
+
+// String returns the name of the mode, e.g. "strip".
+func (m SectionQueryMode) String() string {
+	switch m {
+	case StripQuery:
+		return "strip"
+	case MarkQuery:
+		return "mark"
+	case SectionQueryParams:
+		return "params"
+	default:
+		return fmt.Sprintf("SectionQueryMode(%d)", int(m))
+	}
 }
 
-// sectionFromDocument gets the section from a full document URL.
-func sectionFromDocument(document string) string {
+// sectionQuerySuffix returns the section with a suffix describing the query
+// string, which includes the leading '?', according to the section query mode.
+func (c *collector) sectionQuerySuffix(section, query string) string {
+	if query == "" {
+		return section
+	}
+	switch c.sectionQuery {
+	case MarkQuery:
+		return section + "?"
+	case SectionQueryParams:
+		var names []string
+		for _, param := range strings.FieldsFunc(query, func(r rune) bool { return r == '?' || r == '&' }) {
+			name := strings.SplitN(param, "=", 2)[0]
+			if c.queryParams[name] {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return section
+		}
+		sort.Strings(names)
+		return section + "?" + strings.Join(uniqueStrings(names), "&")
+	default:
+		return section
+	}
+}
+
+// uniqueStrings removes adjacent duplicates from the sorted strings in place.
+func uniqueStrings(sorted []string) []string {
+	unique := sorted[:0]
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
+
+// sectionFromDocument gets the section from a full document URL. The depth is
+// the number of path segments which make up the section, e.g. with a depth of
+// 2, the section for "/api/v2/users" is "/api/v2". Documents at the root, such
+// as "/index.html", are in the "/" section. If the document has fewer path
+// segments than the depth, the full path without a trailing slash is used.
+func sectionFromDocument(document string, depth uint) string {
 	slashIndexes := []int{}
 	for i, c := range document {
 		if c == '/' {
 			slashIndexes = append(slashIndexes, i)
 		}
 	}
-	switch len(slashIndexes) {
-	case 0, 1:
+	switch {
+	case len(slashIndexes) < 2:
 		return "/"
+	case uint(len(slashIndexes)) > depth:
+		return document[:slashIndexes[depth]]
 	default:
-		return document[:slashIndexes[1]]
+		return strings.TrimSuffix(document, "/")
 	}
 }
@@ -0,0 +1,466 @@
+package monitor
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TestSectionFromDocument ensures sections are extracted from document URLs at
+// the configured depth.
+func TestSectionFromDocument(t *testing.T) {
+	for _, tc := range []struct {
+		document string
+		depth    uint
+		expected string
+	}{
+		{"/", 1, "/"},
+		{"/index.html", 1, "/"},
+		{"/pages/create", 1, "/pages"},
+		{"/pages/", 1, "/pages"},
+		{"/api/v2/users", 1, "/api"},
+		{"/api/v2/users", 2, "/api/v2"},
+		{"/api/v2/orders", 2, "/api/v2"},
+		{"/api/v2/", 2, "/api/v2"},
+		{"/api/v2", 2, "/api/v2"},
+		{"/api/v2/users/1", 3, "/api/v2/users"},
+		{"/api/v2", 3, "/api/v2"},
+		{"/index.html", 3, "/"},
+	} {
+		if section := sectionFromDocument(tc.document, tc.depth); section != tc.expected {
+			t.Errorf("Expected section %s for %s at depth %d, got %s", tc.expected, tc.document, tc.depth, section)
+		}
+	}
+}
+
+// TestProcessRequestSectionQuery ensures query strings are stripped, marked,
+// or reduced to the configured parameter names according to the mode.
+func TestProcessRequestSectionQuery(t *testing.T) {
+	requests := []string{
+		"GET /search/all?q=go&page=2&utm=x HTTP/1.1",
+		"GET /search/all?page=3&q=rust&q=c HTTP/1.1",
+		"GET /search/all?utm=y HTTP/1.1",
+		"GET /search/all HTTP/1.1",
+	}
+	for mode, expected := range map[SectionQueryMode]map[string]uint64{
+		StripQuery:         {"/search": 4},
+		MarkQuery:          {"/search?": 3, "/search": 1},
+		SectionQueryParams: {"/search?page&q": 2, "/search": 2},
+	} {
+		opts := MonitorOpts{AlertWindow: time.Second, Quantum: time.Second, NumTopSections: 5, SectionDepth: 1, SectionQuery: mode}
+		if mode == SectionQueryParams {
+			opts.SectionQueryParams = []string{"q", "page"}
+		}
+		c := newCollector(opts)
+		for _, request := range requests {
+			c.processRequest(request)
+		}
+		sections := make(map[string]uint64)
+		for _, e := range c.topSections.Elements() {
+			sections[string(e.Data)] = e.Freq
+		}
+		if !reflect.DeepEqual(sections, expected) {
+			t.Errorf("Expected sections %v in %s mode, got %v", expected, mode, sections)
+		}
+	}
+}
+
+// TestProcessRequestNormalizePathIDs ensures path segments matching the path
+// ID patterns are replaced before sections and distinct paths are counted.
+func TestProcessRequestNormalizePathIDs(t *testing.T) {
+	requests := []string{
+		"GET /users/12345/orders/9 HTTP/1.1",
+		"GET /users/67890/orders/3 HTTP/1.1",
+		"GET /users/3f2b8c1e-9d4a-4e6f-8b7c-2a1d0e9f8c7b/orders/1?q=12 HTTP/1.1",
+		"GET /users/me/orders/2 HTTP/1.1",
+	}
+	for _, tc := range []struct {
+		patterns []string
+		expected map[string]uint64
+		distinct uint64
+	}{
+		{nil, map[string]uint64{"/users/:id/orders/:id": 3, "/users/me/orders/:id": 1}, 2},
+		{[]string{"me", "[0-4]"}, map[string]uint64{
+			"/users/12345/orders/9": 1, "/users/67890/orders/:id": 1,
+			"/users/3f2b8c1e-9d4a-4e6f-8b7c-2a1d0e9f8c7b/orders/:id": 1, "/users/:id/orders/:id": 1}, 4},
+	} {
+		c := newCollector(MonitorOpts{AlertWindow: time.Second, Quantum: time.Second, NumTopSections: 5,
+			SectionDepth: 4, NormalizePathIDs: true, PathIDPatterns: tc.patterns})
+		for _, request := range requests {
+			c.processRequest(request)
+		}
+		sections := make(map[string]uint64)
+		for _, e := range c.topSections.Elements() {
+			sections[string(e.Data)] = e.Freq
+		}
+		if !reflect.DeepEqual(sections, tc.expected) {
+			t.Errorf("Expected sections %v with patterns %v, got %v", tc.expected, tc.patterns, sections)
+		}
+		if distinct := c.pathHll.Count(); distinct != tc.distinct {
+			t.Errorf("Expected %d distinct paths with patterns %v, got %d", tc.distinct, tc.patterns, distinct)
+		}
+	}
+}
+
+// TestProcessRequestSectionsByMethod ensures sections are prefixed with the
+// method, after the query is applied, only if configured.
+func TestProcessRequestSectionsByMethod(t *testing.T) {
+	requests := []string{
+		"GET /orders/1 HTTP/1.1",
+		"GET /orders/list?page=2 HTTP/1.1",
+		"POST /orders/new HTTP/1.1",
+		"DELETE /users/1 HTTP/1.1",
+	}
+	for byMethod, expected := range map[bool]map[string]uint64{
+		false: {"/orders?": 1, "/orders": 2, "/users": 1},
+		true:  {"GET /orders?": 1, "GET /orders": 1, "POST /orders": 1, "DELETE /users": 1},
+	} {
+		c := newCollector(MonitorOpts{AlertWindow: time.Second, Quantum: time.Second, NumTopSections: 5,
+			SectionDepth: 1, SectionQuery: MarkQuery, SectionsByMethod: byMethod})
+		for _, request := range requests {
+			c.processRequest(request)
+		}
+		sections := make(map[string]uint64)
+		for _, e := range c.topSections.Elements() {
+			sections[string(e.Data)] = e.Freq
+		}
+		if !reflect.DeepEqual(sections, expected) {
+			t.Errorf("Expected sections %v by method %t, got %v", expected, byMethod, sections)
+		}
+	}
+}
+
+// TestProcessSectionBytes ensures sections are ranked by the response bytes
+// they served separately from their hits.
+func TestProcessSectionBytes(t *testing.T) {
+	c := newCollector(MonitorOpts{AlertWindow: time.Second, Quantum: time.Second, NumTopSections: 2, SectionDepth: 1})
+	hits := make(chan time.Time, 10)
+	for _, l := range []*log{
+		{request: "GET /pages/a HTTP/1.1", status: 200, size: 100},
+		{request: "GET /pages/b HTTP/1.1", status: 200, size: 100},
+		{request: "GET /pages/c HTTP/1.1", status: 200, size: 100},
+		{request: "GET /videos/a HTTP/1.1", status: 200, size: 5000},
+		{request: "GET /api/a HTTP/1.1", status: 200, size: 200},
+		{request: "GET /api/b HTTP/1.1", status: 304, size: 0},
+	} {
+		l.timestamp = time.Now()
+		c.process(l, hits)
+	}
+
+	sections := make(map[string]uint64)
+	for _, e := range c.topSectionBytes.Elements() {
+		sections[string(e.Data)] = e.Freq
+	}
+	expected := map[string]uint64{"/videos": 5000, "/pages": 300}
+	if !reflect.DeepEqual(sections, expected) {
+		t.Fatalf("Expected section bytes %v, got %v", expected, sections)
+	}
+}
+
+// TestProcessRequestMaxCardinality ensures methods and protocols beyond the
+// cardinality cap are counted under (other) while known values still count.
+func TestProcessRequestMaxCardinality(t *testing.T) {
+	c := newCollector(MonitorOpts{AlertWindow: time.Second, Quantum: time.Second, MaxCardinality: 2})
+	for i := 0; i < 100; i++ {
+		c.processRequest(fmt.Sprintf("M%d /pages HTTP/1.%d", i, i))
+	}
+	c.processRequest("M0 /pages HTTP/1.1")
+	expected := map[string]uint64{"M0": 2, "M1": 1, otherKey: 98}
+	if !reflect.DeepEqual(c.methodFreq, expected) {
+		t.Fatalf("Expected methods %v, got %v", expected, c.methodFreq)
+	}
+	if len(c.protocolFreq) != 3 || c.protocolFreq[otherKey] != 98 {
+		t.Fatalf("Expected 2 protocols and 98 others, got %v", c.protocolFreq)
+	}
+}
+
+// TestProcessUserAgent ensures logs without a user-agent are grouped under a
+// single bucket.
+func TestProcessUserAgent(t *testing.T) {
+	c := newCollector(MonitorOpts{AlertWindow: time.Second, Quantum: time.Second, NumTopUserAgents: 2})
+	for _, userAgent := range []string{"", "-", "-", "curl/7.54.0"} {
+		c.processUserAgent(userAgent)
+	}
+	elements := c.topUserAgents.Elements()
+	if len(elements) != 2 {
+		t.Fatalf("Expected 2 user-agents, got %d", len(elements))
+	}
+	top := elements[len(elements)-1]
+	if string(top.Data) != noUserAgent || top.Freq != 3 {
+		t.Fatalf("Expected %s with 3 hits, got %s with %d", noUserAgent, top.Data, top.Freq)
+	}
+}
+
+// TestProcessSampleRate ensures every log is counted but only a fraction of
+// them are aggregated when sampling.
+func TestProcessSampleRate(t *testing.T) {
+	c := newCollector(MonitorOpts{AlertWindow: time.Second, Quantum: time.Second, SampleRate: 0.5})
+	hits := make(chan time.Time, 1000)
+	for i := 0; i < 1000; i++ {
+		c.process(&log{timestamp: time.Now(), request: "GET / HTTP/1.1", status: 200}, hits)
+	}
+	if c.count != 1000 {
+		t.Fatalf("Expected count 1000, got %d", c.count)
+	}
+	if len(hits) != 1000 {
+		t.Fatalf("Expected 1000 hits, got %d", len(hits))
+	}
+	if sampled := c.statusFreq.Successful; sampled < 350 || sampled > 650 {
+		t.Fatalf("Expected roughly 500 sampled logs, got %d", sampled)
+	}
+}
+
+// TestClientIP ensures the left-most X-Forwarded-For address is used as the
+// client IP only when configured and present.
+func TestClientIP(t *testing.T) {
+	l := &log{remoteAddr: "10.0.0.1", forwardedFor: "203.0.113.7, 10.0.0.2"}
+	c := newCollector(MonitorOpts{AlertWindow: time.Second, Quantum: time.Second})
+	if ip := c.clientIP(l); ip != "10.0.0.1" {
+		t.Fatalf("Expected remote address by default, got %s", ip)
+	}
+
+	c = newCollector(MonitorOpts{AlertWindow: time.Second, Quantum: time.Second, UseForwardedFor: true})
+	if ip := c.clientIP(l); ip != "203.0.113.7" {
+		t.Fatalf("Expected left-most forwarded address, got %s", ip)
+	}
+	for _, forwardedFor := range []string{"", "-"} {
+		l.forwardedFor = forwardedFor
+		if ip := c.clientIP(l); ip != "10.0.0.1" {
+			t.Fatalf("Expected remote address without forwarded address %q, got %s", forwardedFor, ip)
+		}
+	}
+}
+
+// TestProcessIgnorePatterns ensures requests whose path matches an ignore
+// pattern are counted but excluded from the other aggregations.
+func TestProcessIgnorePatterns(t *testing.T) {
+	c := newCollector(MonitorOpts{
+		AlertWindow:    time.Second,
+		Quantum:        time.Second,
+		NumTopSections: 2,
+		SectionDepth:   1,
+		IgnorePatterns: []string{"^/healthz$", "^/metrics"},
+	})
+	hits := make(chan time.Time, 10)
+	for _, request := range []string{
+		"GET /healthz HTTP/1.1",
+		"GET /healthz?full=1 HTTP/1.1",
+		"GET /metrics/prometheus HTTP/1.1",
+		"GET /healthz/deep HTTP/1.1",
+		"GET /pages/create HTTP/1.1",
+	} {
+		c.process(&log{timestamp: time.Now(), remoteAddr: "::1", request: request, status: 200, size: 10}, hits)
+	}
+	if c.count != 5 || len(hits) != 5 {
+		t.Fatalf("Expected 5 requests and hits, got %d and %d", c.count, len(hits))
+	}
+	if c.ignored != 3 {
+		t.Fatalf("Expected 3 ignored requests, got %d", c.ignored)
+	}
+	if c.statusFreq.Successful != 2 {
+		t.Fatalf("Expected 2 successful responses, got %d", c.statusFreq.Successful)
+	}
+	if n := c.sizeHist.Current.TotalCount(); n != 2 {
+		t.Fatalf("Expected 2 sizes, got %d", n)
+	}
+	for _, e := range c.topSections.Elements() {
+		if string(e.Data) != "/healthz" && string(e.Data) != "/pages" {
+			t.Fatalf("Expected only /healthz and /pages sections, got %s", e.Data)
+		}
+	}
+}
+
+// TestProcessTimeRange ensures logs outside the time range, or without a valid
+// timestamp, are skipped and logs past the end time are reported.
+func TestProcessTimeRange(t *testing.T) {
+	start := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	c := newCollector(MonitorOpts{
+		AlertWindow: time.Second,
+		Quantum:     time.Second,
+		StartTime:   start,
+		EndTime:     start.Add(time.Hour),
+	})
+	hits := make(chan time.Time, 10)
+	for _, tc := range []struct {
+		timestamp time.Time
+		inRange   bool
+	}{
+		{start.Add(-time.Second), true},
+		{start, true},
+		{start.Add(30 * time.Minute), true},
+		{time.Time{}, true},
+		{start.Add(time.Hour), true},
+		{start.Add(time.Hour + time.Second), false},
+	} {
+		if inRange := c.process(&log{timestamp: tc.timestamp, status: 200}, hits); inRange != tc.inRange {
+			t.Errorf("Expected %t processing log at %s, got %t", tc.inRange, tc.timestamp, inRange)
+		}
+	}
+	if c.count != 3 || len(hits) != 3 {
+		t.Fatalf("Expected 3 requests and hits in range, got %d and %d", c.count, len(hits))
+	}
+	if c.invalidTimestamps != 1 {
+		t.Fatalf("Expected 1 invalid timestamp, got %d", c.invalidTimestamps)
+	}
+}
+
+// TestCollectorStopAfterEnd ensures that once a log past the end time stops
+// the collector, the reader's remaining logs are received until it stops so
+// that it isn't left blocked.
+func TestCollectorStopAfterEnd(t *testing.T) {
+	end := time.Now().Add(-time.Hour)
+	c := newCollector(MonitorOpts{AlertWindow: time.Second, Quantum: time.Second, EndTime: end, NoFollow: true})
+	r := newFlushingReader(&log{timestamp: end.Add(time.Second), status: 200})
+	if err := c.Start(r); err != nil {
+		t.Fatalf("Error collecting logs: %v", err)
+	}
+	r.Close()
+	select {
+	case <-r.stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected reader to stop")
+	}
+}
+
+// TestCollectorDrain ensures every hit has been recorded by the averager once
+// Start returns.
+func TestCollectorDrain(t *testing.T) {
+	const numLogs = 20000
+	logs := make([]*log, numLogs)
+	for i := range logs {
+		logs[i] = &log{timestamp: time.Now(), status: 200}
+	}
+	c := newCollector(MonitorOpts{AlertWindow: time.Minute, Quantum: time.Second, HitsBufferSize: defaultHitsBufferSize})
+	if err := c.Start(&logsReader{logs: logs}); err != nil {
+		t.Fatalf("Error collecting logs: %v", err)
+	}
+	c.averager.mu.RLock()
+	var hits uint64
+	for _, b := range c.averager.buckets {
+		hits += b
+	}
+	c.averager.mu.RUnlock()
+	if hits != numLogs || c.count != numLogs {
+		t.Fatalf("Expected %d hits and requests, got %d and %d", numLogs, hits, c.count)
+	}
+}
+
+// logsReader is a Reader which reads the given logs and stops.
+// TestCollectorHealth ensures the collector is unhealthy if reading logs
+// failed or, when staleness is checked, no logs were read recently while
+// running.
+func TestCollectorHealth(t *testing.T) {
+	c := newCollector(MonitorOpts{AlertWindow: time.Minute, Quantum: time.Second, SectionDepth: 1})
+	now := time.Now()
+	if err := c.health(time.Second, now); err != nil {
+		t.Fatalf("Expected healthy before starting, got %v", err)
+	}
+
+	c.lastRead = now.Add(-2 * time.Second).UnixNano()
+	if err := c.health(time.Second, now); err == nil {
+		t.Fatal("Expected unhealthy when no logs were read within staleness")
+	}
+	if err := c.health(3*time.Second, now); err != nil {
+		t.Fatalf("Expected healthy within staleness, got %v", err)
+	}
+	if err := c.health(0, now); err != nil {
+		t.Fatalf("Expected healthy when staleness isn't checked, got %v", err)
+	}
+
+	c.fail(errors.New("boom"))
+	if err := c.health(0, now); err == nil || err.Error() != "boom" {
+		t.Fatalf("Expected read error, got %v", err)
+	}
+}
+
+type logsReader struct {
+	logs []*log
+}
+
+func (r *logsReader) open() (<-chan *log, error) {
+	logs := make(chan *log, 1024)
+	go func() {
+		for _, l := range r.logs {
+			logs <- l
+		}
+		close(logs)
+	}()
+	return logs, nil
+}
+
+func (r *logsReader) Open() (<-chan *Log, error) { return exportLogs(r.open()) }
+
+func (r *logsReader) Close() error { return nil }
+
+func (r *logsReader) Err() error { return nil }
+
+// benchmarkCollector measures the throughput of aggregating b.N logs with
+// the given number of workers and hits buffer size.
+func benchmarkCollector(b *testing.B, workers, hitsBufferSize int) {
+	logs := make([]*log, b.N)
+	now := time.Now()
+	for i := range logs {
+		logs[i] = &log{
+			timestamp:  now,
+			remoteAddr: fmt.Sprintf("10.0.%d.%d", i/256%256, i%256),
+			request:    fmt.Sprintf("GET /section%d/page%d HTTP/1.1", i%20, i%1000),
+			status:     200,
+			size:       int64(i % 5000),
+		}
+	}
+	c := newCollector(MonitorOpts{
+		AlertWindow:    time.Minute,
+		Quantum:        time.Second,
+		NumTopSections: 5,
+		SectionDepth:   1,
+		NumTopIPs:      5,
+		Workers:        workers,
+		HitsBufferSize: hitsBufferSize,
+	})
+	b.ResetTimer()
+	if err := c.Start(&logsReader{logs: logs}); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkCollector measures the throughput of aggregating logs with
+// different numbers of workers.
+func BenchmarkCollector(b *testing.B) {
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			benchmarkCollector(b, workers, defaultHitsBufferSize)
+		})
+	}
+}
+
+// BenchmarkCollectorHitsBuffer measures the throughput of aggregating logs
+// with different hits buffer sizes, where -1 is unbuffered, to help tune
+// HitsBufferSize. Multiple workers contend for the buffer as they would under
+// bursty ingestion.
+func BenchmarkCollectorHitsBuffer(b *testing.B) {
+	for _, size := range []int{-1, 16, 256, 1024, 16384} {
+		for _, workers := range []int{1, 4} {
+			b.Run(fmt.Sprintf("size=%d/workers=%d", size, workers), func(b *testing.B) {
+				benchmarkCollector(b, workers, size)
+			})
+		}
+	}
+}
+
+// TestStatusFreqSuccessRate ensures server errors, and optionally client
+// errors, count against the success rate.
+func TestStatusFreqSuccessRate(t *testing.T) {
+	s := statusFreq{Successful: 6, Redirection: 1, ClientError: 2, ServerError: 1}
+	if rate := s.successRate(false); rate != 0.9 {
+		t.Fatalf("Expected success rate 0.9, got %g", rate)
+	}
+	if rate := s.successRate(true); rate != 0.7 {
+		t.Fatalf("Expected success rate 0.7 with client errors, got %g", rate)
+	}
+	if rate := (statusFreq{}).successRate(true); rate != 1 {
+		t.Fatalf("Expected success rate 1 without responses, got %g", rate)
+	}
+}
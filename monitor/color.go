@@ -0,0 +1,39 @@
+package monitor
+
+import (
+	"io"
+	"os"
+)
+
+// ANSI escape codes used to color terminal output.
+const (
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorGreen  = "\x1b[32m"
+	colorReset  = "\x1b[0m"
+)
+
+// colorize wraps the string in the given ANSI color if enabled.
+func colorize(s, color string, enabled bool) string {
+	if !enabled {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// useColor indicates if output written to w may be colored, i.e. if it's a
+// terminal and the NO_COLOR environment variable isn't set to a non-empty
+// value.
+func useColor(w io.Writer) bool {
+	return os.Getenv("NO_COLOR") == "" && isTerminal(w)
+}
+
+// isTerminal indicates if w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,41 @@
+package monitor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TestColorize ensures strings are only wrapped in escape codes if enabled.
+func TestColorize(t *testing.T) {
+	if s := colorize("alert", colorRed, false); s != "alert" {
+		t.Fatalf("Expected uncolored string, got %q", s)
+	}
+	if s := colorize("alert", colorRed, true); s != "\x1b[31malert\x1b[0m" {
+		t.Fatalf("Expected red string, got %q", s)
+	}
+}
+
+// TestUseColor ensures color is disabled for writers which aren't terminals
+// and when NO_COLOR is set.
+func TestUseColor(t *testing.T) {
+	if useColor(&bytes.Buffer{}) || useColor(ioutil.Discard) {
+		t.Fatal("Expected no color for a buffer")
+	}
+	file, err := ioutil.TempFile("", "output")
+	if err != nil {
+		t.Fatalf("Error creating file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	if useColor(file) {
+		t.Fatal("Expected no color for a regular file")
+	}
+
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+	if useColor(os.Stdout) {
+		t.Fatal("Expected no color with NO_COLOR set")
+	}
+}
@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// csvHeader is the header row of the CSV summary export.
+var csvHeader = []string{
+	"timestamp",
+	"hits_per_second",
+	"avg_hits",
+	"distinct_ips",
+	"status_1xx",
+	"status_2xx",
+	"status_3xx",
+	"status_4xx",
+	"status_5xx",
+}
+
+// csvExporter appends summaries as rows to a CSV file.
+type csvExporter struct {
+	file   *os.File
+	writer *csv.Writer
+	header bool
+}
+
+// newCSVExporter creates a csvExporter which appends to the file at the given
+// path, creating it if it doesn't exist. The header is only written if the
+// file is empty.
+func newCSVExporter(path string) (*csvExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &csvExporter{
+		file:   file,
+		writer: csv.NewWriter(file),
+		header: info.Size() > 0,
+	}, nil
+}
+
+// write appends the summary as a row, preceded by the header if it hasn't
+// been written yet. The row is flushed to the file before returning.
+func (c *csvExporter) write(s *Summary) error {
+	if !c.header {
+		if err := c.writer.Write(csvHeader); err != nil {
+			return errors.Wrap(err, "failed to write CSV header")
+		}
+		c.header = true
+	}
+	// Distinct IPs are left empty if they're disabled.
+	distinctIPs := strconv.FormatUint(s.DistinctIPs, 10)
+	if s.DistinctIPsDisabled {
+		distinctIPs = ""
+	}
+	row := []string{
+		s.Timestamp.Format(time.RFC3339),
+		strconv.FormatUint(s.HitsPerSecond, 10),
+		strconv.FormatFloat(s.AvgHits, 'f', 2, 64),
+		distinctIPs,
+		strconv.FormatUint(s.StatusFreq.Informational, 10),
+		strconv.FormatUint(s.StatusFreq.Successful, 10),
+		strconv.FormatUint(s.StatusFreq.Redirection, 10),
+		strconv.FormatUint(s.StatusFreq.ClientError, 10),
+		strconv.FormatUint(s.StatusFreq.ServerError, 10),
+	}
+	if err := c.writer.Write(row); err != nil {
+		return errors.Wrap(err, "failed to write CSV row")
+	}
+	c.writer.Flush()
+	return errors.Wrap(c.writer.Error(), "failed to flush CSV row")
+}
+
+// close closes the CSV file.
+func (c *csvExporter) close() error {
+	return c.file.Close()
+}
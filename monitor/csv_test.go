@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestCSVExporter ensures the header is written once and each summary is
+// appended as a row, including when the file is reopened.
+func TestCSVExporter(t *testing.T) {
+	file, err := ioutil.TempFile("", "summary_csv")
+	if err != nil {
+		t.Fatalf("Error creating CSV file: %v", err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	summary := &Summary{
+		Timestamp:     time.Date(2018, time.March, 1, 12, 0, 0, 0, time.UTC),
+		HitsPerSecond: 3,
+		AvgHits:       1.5,
+		DistinctIPs:   2,
+		StatusFreq:    statusFreq{Successful: 10, ClientError: 1},
+	}
+	for i := 0; i < 2; i++ {
+		c, err := newCSVExporter(file.Name())
+		if err != nil {
+			t.Fatalf("Error creating CSV exporter: %v", err)
+		}
+		if err := c.write(summary); err != nil {
+			t.Fatalf("Error writing CSV row: %v", err)
+		}
+		if err := c.close(); err != nil {
+			t.Fatalf("Error closing CSV exporter: %v", err)
+		}
+	}
+
+	f, err := os.Open(file.Name())
+	if err != nil {
+		t.Fatalf("Error opening CSV file: %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Error reading CSV file: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected header and 2 rows, got %d records", len(records))
+	}
+	if records[0][0] != "timestamp" {
+		t.Fatalf("Expected header row, got %v", records[0])
+	}
+	expected := []string{"2018-03-01T12:00:00Z", "3", "1.50", "2", "0", "10", "0", "1", "0"}
+	for i, row := range records[1:] {
+		for j, v := range expected {
+			if row[j] != v {
+				t.Fatalf("Expected row %d to be %v, got %v", i, expected, row)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package monitor
+
+import (
+	"math"
+
+	"github.com/tylertreat/BoomFilters"
+)
+
+// decayingTopK tracks the top-k most frequent elements with a bias towards
+// recent activity. Elements are counted by a TopK for the current interval.
+// When it's rotated, the current top-k are merged into the scores carried over
+// from previous intervals, which are first multiplied by the decay factor, and
+// the TopK is reset. If it's never rotated, it behaves like a plain TopK.
+type decayingTopK struct {
+	current *boom.TopK
+	k       uint
+	decay   float64
+	scores  map[string]float64
+}
+
+// newDecayingTopK returns a decayingTopK which tracks the k most frequent
+// elements and multiplies previous scores by the given decay factor on each
+// rotation.
+func newDecayingTopK(k uint, decay float64) *decayingTopK {
+	return &decayingTopK{
+		current: boom.NewTopK(0.001, 0.99, k),
+		k:       k,
+		decay:   decay,
+		scores:  make(map[string]float64),
+	}
+}
+
+// Add counts the given element in the current interval.
+func (d *decayingTopK) Add(data []byte) {
+	d.current.Add(data)
+}
+
+// Elements returns the top-k elements from lowest to highest score, where the
+// score is the decayed score from previous intervals plus the frequency in the
+// current interval, rounded to the nearest integer.
+func (d *decayingTopK) Elements() []*boom.Element {
+	if len(d.scores) == 0 {
+		return d.current.Elements()
+	}
+	return topScores(d.merge(), d.k)
+}
+
+// reset clears all scores and the current interval.
+func (d *decayingTopK) reset() {
+	d.scores = make(map[string]float64)
+	d.current.Reset()
+}
+
+// rotate decays the scores from previous intervals, merges in the current
+// interval, and starts a new interval. Only the top-k scores are kept, and
+// scores which have decayed to nothing are dropped.
+func (d *decayingTopK) rotate() {
+	for data := range d.scores {
+		d.scores[data] *= d.decay
+	}
+	scores := d.merge()
+	d.scores = make(map[string]float64, len(scores))
+	for _, e := range topScores(scores, d.k) {
+		if e.Freq > 0 {
+			d.scores[string(e.Data)] = scores[string(e.Data)]
+		}
+	}
+	d.current.Reset()
+}
+
+// merge returns the scores from previous intervals plus the frequencies in the
+// current interval.
+func (d *decayingTopK) merge() map[string]float64 {
+	scores := make(map[string]float64, len(d.scores)+int(d.k))
+	for data, score := range d.scores {
+		scores[data] = score
+	}
+	for _, e := range d.current.Elements() {
+		scores[string(e.Data)] += float64(e.Freq)
+	}
+	return scores
+}
+
+// topScores returns the k highest scores as elements ordered as by
+// sortElements.
+func topScores(scores map[string]float64, k uint) []*boom.Element {
+	elements := make([]*boom.Element, 0, len(scores))
+	for data, score := range scores {
+		elements = append(elements, &boom.Element{Data: []byte(data), Freq: uint64(math.Round(score))})
+	}
+	sortElements(elements)
+	if uint(len(elements)) > k {
+		elements = elements[uint(len(elements))-k:]
+	}
+	return elements
+}
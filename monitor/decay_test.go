@@ -0,0 +1,44 @@
+package monitor
+
+import "testing"
+
+// TestDecayingTopK ensures previous intervals are decayed on rotation so that
+// recently frequent elements overtake formerly frequent ones.
+func TestDecayingTopK(t *testing.T) {
+	d := newDecayingTopK(2, 0.5)
+	for i := 0; i < 8; i++ {
+		d.Add([]byte("/old"))
+	}
+	d.Add([]byte("/new"))
+	d.rotate()
+
+	// /old has 8 hits and /new has 1 after the first interval.
+	elements := d.Elements()
+	if len(elements) != 2 || string(elements[1].Data) != "/old" || elements[1].Freq != 8 {
+		t.Fatalf("Expected /old with 8 hits on top, got %v", elements)
+	}
+
+	for i := 0; i < 6; i++ {
+		d.Add([]byte("/new"))
+	}
+	d.rotate()
+
+	// /old decays to 4 while /new has 0.5 + 6.
+	elements = d.Elements()
+	if len(elements) != 2 {
+		t.Fatalf("Expected 2 elements, got %d", len(elements))
+	}
+	top, next := elements[1], elements[0]
+	if string(top.Data) != "/new" || top.Freq != 7 {
+		t.Fatalf("Expected /new with 7 hits on top, got %s with %d", top.Data, top.Freq)
+	}
+	if string(next.Data) != "/old" || next.Freq != 4 {
+		t.Fatalf("Expected /old with 4 hits, got %s with %d", next.Data, next.Freq)
+	}
+
+	// Scores are combined with hits in the current interval.
+	d.Add([]byte("/old"))
+	if elements := d.Elements(); string(elements[0].Data) != "/old" || elements[0].Freq != 5 {
+		t.Fatalf("Expected /old with 5 hits, got %v", elements)
+	}
+}
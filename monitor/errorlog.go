@@ -0,0 +1,84 @@
+package monitor
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// apacheErrorTimeLayout is the timestamp layout used by the Apache error log.
+// Apache 2.4 includes microseconds, which time.Parse accepts after the seconds
+// even though the layout doesn't include them.
+const apacheErrorTimeLayout = "Mon Jan _2 15:04:05 2006"
+
+// apacheErrorRegexp matches a line in the Apache error log, i.e. "[date]
+// [module:level] [pid N:tid N] [client addr] message" for Apache 2.4 or
+// "[date] [level] [client addr] message" for Apache 2.2. The module, pid, and
+// client are optional.
+var apacheErrorRegexp = regexp.MustCompile(`^\[([^\]]+)\] \[(?:[^:\]]*:)?(\w+)\](?: \[pid [^\]]*\])?(?: \[client ([^\]]+)\])?`)
+
+// levelSeverities ranks log levels from least to most severe. The Apache error
+// log levels are included along with common aliases logged by other servers.
+// Apache's trace1 to trace8 levels are ranked as trace.
+var levelSeverities = map[string]int{
+	"trace":     1,
+	"debug":     2,
+	"info":      3,
+	"notice":    4,
+	"warn":      5,
+	"warning":   5,
+	"error":     6,
+	"err":       6,
+	"crit":      7,
+	"critical":  7,
+	"fatal":     7,
+	"alert":     8,
+	"emerg":     9,
+	"emergency": 9,
+	"panic":     9,
+}
+
+// levelSeverity returns the rank of the given lowercase log level in
+// levelSeverities, or zero if the level is unknown.
+func levelSeverity(level string) int {
+	if strings.HasPrefix(level, "trace") {
+		level = "trace"
+	}
+	return levelSeverities[level]
+}
+
+// isErrorLevel indicates if the given log level is at least as severe as
+// "error", i.e. it counts towards the ErrorThreshold.
+func isErrorLevel(level string) bool {
+	return levelSeverity(level) >= levelSeverities["error"]
+}
+
+// apacheErrorParser is a lineParser for the Apache error log.
+type apacheErrorParser struct{}
+
+// NewApacheErrorLogReader returns a new reader for Apache error log files.
+// Each entry's timestamp, level, and client address, if any, are parsed. Error
+// log entries aren't HTTP requests, so they're counted by level rather than
+// as hits. Timestamps are interpreted in the local time zone since the error
+// log doesn't include the offset.
+func NewApacheErrorLogReader(file string) (Reader, error) {
+	return newFileReader(file, "Apache error log format", apacheErrorParser{}, fileReaderOpts{})
+}
+
+// parse parses a single log line. It returns false if the line is not in the
+// Apache error log format.
+func (apacheErrorParser) parse(line string) (*log, bool) {
+	parts := apacheErrorRegexp.FindStringSubmatch(line)
+	if len(parts) != 4 {
+		return nil, false
+	}
+	timestamp, err := time.ParseInLocation(apacheErrorTimeLayout, parts[1], time.Local)
+	if err != nil {
+		return nil, false
+	}
+	return &log{
+		timestamp:  timestamp,
+		level:      strings.ToLower(parts[2]),
+		remoteAddr: normalizeAddr(parts[3]),
+	}, true
+}
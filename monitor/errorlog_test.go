@@ -0,0 +1,110 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+// TestApacheErrorParse ensures the timestamp, level, and client are parsed
+// from Apache 2.4 and 2.2 error log entries.
+func TestApacheErrorParse(t *testing.T) {
+	var p apacheErrorParser
+	for _, tc := range []struct {
+		line   string
+		level  string
+		client string
+	}{
+		{"[Wed Oct 11 14:32:52.123456 2000] [core:error] [pid 35708:tid 4328636416] [client 72.15.99.187:54321] File does not exist: /favicon.ico\n", "error", "72.15.99.187"},
+		{"[Wed Oct 11 14:32:52 2000] [warn] [client 127.0.0.1] Directory index forbidden\n", "warn", "127.0.0.1"},
+		{"[Wed Oct 11 14:32:52.000001 2000] [mpm_event:notice] [pid 1:tid 2] AH00489: Apache configured\n", "notice", ""},
+	} {
+		l, ok := p.parse(tc.line)
+		if !ok {
+			t.Fatalf("Expected %q to parse", tc.line)
+		}
+		if l.level != tc.level {
+			t.Errorf("Expected level %s, got %s", tc.level, l.level)
+		}
+		if l.remoteAddr != tc.client {
+			t.Errorf("Expected client %s, got %s", tc.client, l.remoteAddr)
+		}
+		expected := time.Date(2000, time.October, 11, 14, 32, 52, 0, time.Local)
+		if l.timestamp.Truncate(time.Second) != expected {
+			t.Errorf("Expected timestamp %s, got %s", expected, l.timestamp)
+		}
+	}
+
+	for _, line := range []string{
+		"127.0.0.1 - - [11/Oct/2000:14:32:52 -0700] \"GET / HTTP/1.1\" 200 10\n",
+		"[not a date] [error] message\n",
+	} {
+		if _, ok := p.parse(line); ok {
+			t.Errorf("Expected %q to be rejected", line)
+		}
+	}
+}
+
+// TestProcessLevel ensures error log entries are counted by level rather than
+// as hits.
+func TestProcessLevel(t *testing.T) {
+	c := newCollector(MonitorOpts{AlertWindow: time.Second, Quantum: time.Second})
+	hits := make(chan time.Time, 3)
+	for _, level := range []string{"error", "warn", "error"} {
+		c.process(&log{timestamp: time.Now(), level: level}, hits)
+	}
+	if c.count != 0 || len(hits) != 0 {
+		t.Fatalf("Expected no hits, got count %d and %d hits", c.count, len(hits))
+	}
+	if c.levelFreq["error"] != 2 || c.levelFreq["warn"] != 1 {
+		t.Fatalf("Expected 2 errors and 1 warning, got %v", c.levelFreq)
+	}
+	if c.errors.buckets[c.errors.idx] != 2 {
+		t.Fatalf("Expected 2 error-level entries recorded, got %d", c.errors.buckets[c.errors.idx])
+	}
+}
+
+// TestLevelSeverity ensures levels and their aliases are ranked by severity
+// and unknown levels aren't ranked.
+func TestLevelSeverity(t *testing.T) {
+	for _, levels := range [][2]string{
+		{"trace4", "debug"}, {"debug", "info"}, {"info", "notice"}, {"notice", "warning"},
+		{"warn", "err"}, {"error", "fatal"}, {"crit", "alert"}, {"alert", "emerg"},
+	} {
+		if levelSeverity(levels[0]) >= levelSeverity(levels[1]) {
+			t.Errorf("Expected %s to be less severe than %s", levels[0], levels[1])
+		}
+	}
+	if levelSeverity("loud") != 0 {
+		t.Fatalf("Expected unknown level to have no severity, got %d", levelSeverity("loud"))
+	}
+	if !isErrorLevel("fatal") || isErrorLevel("warning") {
+		t.Fatal("Expected fatal but not warning to be an error level")
+	}
+}
+
+// TestProcessMinLevel ensures requests with a level count as hits and by
+// level, and entries below the minimum level are ignored entirely.
+func TestProcessMinLevel(t *testing.T) {
+	c := newCollector(MonitorOpts{AlertWindow: time.Second, Quantum: time.Second, MinLevel: "WARN"})
+	hits := make(chan time.Time, 5)
+	for _, l := range []*log{
+		{request: "GET /a HTTP/1.1", status: 200, level: "info"},
+		{request: "GET /a HTTP/1.1", status: 200, level: "warn"},
+		{request: "GET /b HTTP/1.1", status: 500, level: "error"},
+		{request: "GET /c HTTP/1.1", status: 200},
+		{level: "debug"},
+		{level: "crit"},
+	} {
+		l.timestamp = time.Now()
+		c.process(l, hits)
+	}
+	if c.count != 3 || len(hits) != 3 {
+		t.Fatalf("Expected 3 hits, got count %d and %d hits", c.count, len(hits))
+	}
+	if len(c.levelFreq) != 3 || c.levelFreq["warn"] != 1 || c.levelFreq["error"] != 1 || c.levelFreq["crit"] != 1 {
+		t.Fatalf("Expected 1 each of warn, error, and crit, got %v", c.levelFreq)
+	}
+	if c.statusFreq.Successful != 2 {
+		t.Fatalf("Expected 2 successful requests, got %d", c.statusFreq.Successful)
+	}
+}
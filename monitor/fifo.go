@@ -0,0 +1,137 @@
+package monitor
+
+import (
+	"bufio"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fifoReader implements the Reader interface for named pipes. Unlike a regular
+// file, a pipe has no size to watch, so it's read with blocking reads instead.
+// Each line is parsed by a lineParser.
+type fifoReader struct {
+	lineReader
+	file      string
+	opts      fileReaderOpts
+	opened    int32
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newFIFOReader returns a new fifoReader which parses lines from the named pipe
+// at the given path in the given format using the given lineParser and
+// configured with the given options.
+func newFIFOReader(file, format string, parser lineParser, opts fileReaderOpts) *fifoReader {
+	return &fifoReader{
+		lineReader: newLineReader(file, format, parser),
+		file:       file,
+		opts:       opts,
+		done:       make(chan struct{}),
+	}
+}
+
+// isFIFO indicates if the file at the given path is a named pipe.
+func isFIFO(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// open begins reading log entries from the pipe and places them on the
+// channel. Opening the pipe blocks until a writer opens it, so this is done in
+// the background. Once all writers close the pipe, it's reopened to wait for
+// the next writer until Close is called. If the reader is configured not to
+// follow the file, the channel is instead closed once all writers close the
+// pipe.
+func (f *fifoReader) open() (<-chan *log, error) {
+	atomic.StoreInt32(&f.opened, 1)
+	go f.read()
+	return f.logs, nil
+}
+
+// Open implements the Reader interface.
+func (f *fifoReader) Open() (<-chan *Log, error) {
+	return exportLogs(f.open())
+}
+
+// Close stops the reader. Calling Close more than once has no effect.
+func (f *fifoReader) Close() error {
+	f.closeOnce.Do(func() {
+		close(f.close)
+		if atomic.LoadInt32(&f.opened) == 0 {
+			return
+		}
+		// The reader may be blocked opening the pipe until there's a writer,
+		// so briefly open it for writing until the reader stops.
+		for {
+			if w, err := os.OpenFile(f.file, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+				w.Close()
+			}
+			select {
+			case <-f.done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	})
+	return nil
+}
+
+// read is a long-running loop that opens the pipe, reads and parses log
+// entries from it until all writers close it, and places them on the channel.
+// It runs until Close is called, an error occurs, or, if the reader isn't
+// following the file, the writers close the pipe, at which point the channel is
+// closed.
+func (f *fifoReader) read() {
+	defer close(f.done)
+	defer close(f.logs)
+	defer f.failOnPanic()
+	for {
+		// Opening the pipe blocks until there's a writer.
+		file, err := os.Open(f.file)
+		if err != nil {
+			f.err = errors.Wrapf(err, "failed to open pipe %s", f.file)
+			return
+		}
+		if f.closed() {
+			file.Close()
+			return
+		}
+
+		// Close the pipe if the reader is closed to interrupt a blocked read.
+		stop := make(chan struct{})
+		go func() {
+			select {
+			case <-f.close:
+				file.Close()
+			case <-stop:
+			}
+		}()
+		ok := f.drain(bufio.NewReader(file), "")
+		close(stop)
+		file.Close()
+
+		if f.closed() {
+			// A read interrupted by Close isn't an error.
+			f.err = nil
+			return
+		}
+		if !ok || f.opts.noFollow {
+			return
+		}
+	}
+}
+
+// closed indicates if Close has been called.
+func (f *fifoReader) closed() bool {
+	select {
+	case <-f.close:
+		return true
+	default:
+		return false
+	}
+}
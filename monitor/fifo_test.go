@@ -0,0 +1,132 @@
+//go:build !windows
+
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// makeTestFIFO creates a named pipe in a temp dir and returns its path and a
+// function to remove it.
+func makeTestFIFO(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "httpmonitor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	path := filepath.Join(dir, "access_log")
+	if err := syscall.Mkfifo(path, 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Error creating named pipe: %v", err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+// TestFIFOReaderFollow ensures a named pipe is reopened for the next writer
+// once a writer closes it.
+func TestFIFOReaderFollow(t *testing.T) {
+	path, cleanup := makeTestFIFO(t)
+	defer cleanup()
+
+	logs, r := openTestReader(t, path)
+	if _, ok := r.(*fifoReader); !ok {
+		t.Fatalf("Expected fifoReader, got %T", r)
+	}
+	writeLogs(t, path, 2, os.O_WRONLY)
+	expectLogs(t, logs, 2)
+	writeLogs(t, path, 1, os.O_WRONLY)
+	expectLogs(t, logs, 1)
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("Error closing reader: %v", err)
+	}
+	select {
+	case _, ok := <-logs:
+		if ok {
+			t.Fatal("Expected channel to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected channel to be closed")
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+// TestFIFOReaderNoFollow ensures the channel is closed once the writer closes
+// the named pipe if the reader isn't following it.
+func TestFIFOReaderNoFollow(t *testing.T) {
+	path, cleanup := makeTestFIFO(t)
+	defer cleanup()
+
+	r, err := newCommonLogFormatReader(path, fileReaderOpts{noFollow: true})
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	defer r.Close()
+	logs, err := openReader(r)
+	if err != nil {
+		t.Fatalf("Error opening reader: %v", err)
+	}
+	writeLogs(t, path, 3, os.O_WRONLY)
+
+	count := 0
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-logs:
+			if !ok {
+				if count != 3 {
+					t.Fatalf("Expected 3 logs, got %d", count)
+				}
+				return
+			}
+			count++
+		case <-timeout:
+			t.Fatalf("Expected channel to be closed after 3 logs, got %d", count)
+		}
+	}
+}
+
+// TestFIFOReaderCloseWithoutWriter ensures closing the reader stops it while
+// it's waiting for a writer.
+func TestFIFOReaderCloseWithoutWriter(t *testing.T) {
+	path, cleanup := makeTestFIFO(t)
+	defer cleanup()
+
+	logs, r := openTestReader(t, path)
+	done := make(chan error)
+	go func() { done <- r.Close() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Error closing reader: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Close to return")
+	}
+	if _, ok := <-logs; ok {
+		t.Fatal("Expected channel to be closed")
+	}
+}
+
+// TestFIFOReaderCloseTwice ensures closing the reader more than once has no
+// effect, whether or not it was opened.
+func TestFIFOReaderCloseTwice(t *testing.T) {
+	path, cleanup := makeTestFIFO(t)
+	defer cleanup()
+
+	_, opened := openTestReader(t, path)
+	unopened := newFIFOReader(path, "Common Log Format", commonLogFormatParser, fileReaderOpts{})
+	for _, r := range []Reader{opened, unopened} {
+		for i := 0; i < 2; i++ {
+			if err := r.Close(); err != nil {
+				t.Fatalf("Error closing reader: %v", err)
+			}
+		}
+	}
+}
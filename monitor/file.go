@@ -0,0 +1,375 @@
+package monitor
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// fileReaderOpts contains options for configuring a fileReader. The zero value
+// provides the default behavior.
+type fileReaderOpts struct {
+	// noFollow causes the reader to stop once it reaches the end of the file
+	// rather than waiting for new log entries to be appended.
+	noFollow bool
+
+	// reverse causes the reader to read the file from the last line to the
+	// first. It only applies if noFollow is set and the file isn't
+	// compressed.
+	reverse bool
+
+	// timestampLayout, if set, is the layout used by the parser to parse
+	// timestamps instead of the format's standard layout. It's applied by the
+	// reader constructors rather than the fileReader itself.
+	timestampLayout string
+
+	// waitTimeout, if positive, is how long to wait for the file to be
+	// created if it doesn't exist yet when the reader is opened. If zero, a
+	// missing file is an error.
+	waitTimeout time.Duration
+}
+
+// fileReader implements the Reader interface for actively written to log
+// files. Each line of the file is parsed by a lineParser.
+type fileReader struct {
+	lineReader
+	file      string
+	opts      fileReaderOpts
+	watcher   *fsnotify.Watcher
+	closeOnce sync.Once
+}
+
+// newFileReader returns a new fileReader which parses lines from the given file
+// in the given format using the given lineParser and configured with the given
+// options. If the file is a named pipe, it's read without being watched.
+func newFileReader(file, format string, parser lineParser, opts fileReaderOpts) (Reader, error) {
+	if isFIFO(file) {
+		return newFIFOReader(file, format, parser, opts), nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create file watcher")
+	}
+	// If the file doesn't exist yet and the reader is configured to wait for
+	// it, its parent directory is watched once the reader is opened instead.
+	if err := watcher.Add(file); err != nil && !(os.IsNotExist(err) && opts.waitTimeout > 0) {
+		watcher.Close()
+		return nil, errors.Wrap(err, "failed to add file watch")
+	}
+	return &fileReader{
+		lineReader: newLineReader(file, format, parser),
+		file:       file,
+		opts:       opts,
+		watcher:    watcher,
+	}, nil
+}
+
+// open begins reading log entries from the file starting at the beginning and
+// places them on the channel. If the reader reaches the end of the file, it
+// will wait for new log entries to be appended until Close is called. If the
+// reader is configured not to follow the file or the file is gzip-compressed,
+// it's read to the end and then the channel is closed. A compressed file is
+// never followed since it cannot be appended to. If the file doesn't exist and
+// the reader is configured to wait for it, reading begins once it's created.
+// If it isn't created within the timeout, the channel is closed and Err returns
+// the reason. If the reader is configured to read in reverse, the file is read
+// from the end to the beginning instead, which fails if it's compressed.
+func (f *fileReader) open() (<-chan *log, error) {
+	file, err := os.Open(f.file)
+	if os.IsNotExist(err) && f.opts.waitTimeout > 0 {
+		go f.openOnCreate()
+		return f.logs, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open file")
+	}
+	if err := f.start(file); err != nil {
+		return nil, err
+	}
+	return f.logs, nil
+}
+
+// Open implements the Reader interface.
+func (f *fileReader) Open() (<-chan *Log, error) {
+	return exportLogs(f.open())
+}
+
+// openOnCreate waits for the file to be created and then starts reading it. If
+// the file isn't created within the timeout, the reader is closed, or an error
+// occurs, the channel is closed.
+func (f *fileReader) openOnCreate() {
+	file, err := f.waitForFile(f.opts.waitTimeout)
+	if err == nil && file != nil {
+		err = f.start(file)
+		if err == nil {
+			return
+		}
+	}
+	f.err = errors.Wrapf(err, "failed to wait for file %s", f.file)
+	close(f.logs)
+}
+
+// start begins reading log entries from the given open file in the background.
+// The file is closed if an error is returned.
+func (f *fileReader) start(file *os.File) error {
+	compressed, err := isGzip(file)
+	if err != nil {
+		file.Close()
+		return errors.Wrap(err, "failed to detect file compression")
+	}
+	if compressed && f.opts.noFollow && f.opts.reverse {
+		file.Close()
+		return errors.New("compressed files can't be read in reverse")
+	}
+	if compressed {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return errors.Wrap(err, "failed to create gzip reader")
+		}
+		go func() {
+			defer file.Close()
+			f.readToEOF(gz)
+		}()
+		return nil
+	}
+	if f.opts.noFollow && f.opts.reverse {
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return errors.Wrap(err, "failed to get file size")
+		}
+		go func() {
+			defer file.Close()
+			f.readReverse(file, info.Size())
+		}()
+		return nil
+	}
+	if f.opts.noFollow {
+		go func() {
+			defer file.Close()
+			f.readToEOF(file)
+		}()
+		return nil
+	}
+	go f.read(file)
+	return nil
+}
+
+// Close stops the reader. Calling Close more than once has no effect.
+func (f *fileReader) Close() error {
+	var err error
+	f.closeOnce.Do(func() {
+		if werr := f.watcher.Close(); werr != nil {
+			err = errors.Wrap(werr, "failed to close file watcher")
+		}
+		close(f.close)
+	})
+	return err
+}
+
+// read is a long-running loop that reads and parses log entries from the file
+// and places them on the channel. It starts by parsing the current contents of
+// the file, then once it reaches the end of the file, it waits for new logs to
+// be written. A partial line at the end of the file is buffered until the rest
+// of it is written. If the file is rotated, the remainder of the old file is
+// read before the new file is opened and read from the start. If the file is
+// truncated, it's read again from the start. It runs until Close is called or
+// an error occurs, at which point the channel is closed.
+func (f *fileReader) read(file *os.File) {
+	reader := bufio.NewReader(file)
+	defer func() { file.Close() }()
+	defer close(f.logs)
+	defer f.failOnPanic()
+	var (
+		rotated = false
+		partial = ""
+	)
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			// Buffer the partial line, if any, until the rest is written.
+			partial += line
+			if rotated {
+				// The file was rotated, so wait for the new one.
+				newFile, err := f.waitForFile(0)
+				if err != nil {
+					f.err = errors.Wrapf(err, "failed to reopen file %s", f.file)
+					return
+				}
+				if newFile == nil {
+					return
+				}
+				// Read anything written to the old file before the new one
+				// was created, then switch to the new one.
+				if !f.drain(reader, partial) {
+					newFile.Close()
+					return
+				}
+				partial = ""
+				file.Close()
+				file = newFile
+				reader.Reset(file)
+				rotated = false
+				continue
+			}
+
+			// If we reach EOF, wait for new logs to be written.
+			op, ok, err := f.waitForLogs()
+			if err != nil {
+				f.err = errors.Wrapf(err, "failed to watch file %s", f.file)
+				return
+			}
+			if !ok {
+				f.flush(partial)
+				return
+			}
+			if op&(fsnotify.Rename|fsnotify.Remove|fsnotify.Create) != 0 {
+				rotated = isRotated(f.file, file)
+			} else if isTruncated(file) {
+				if _, err := file.Seek(0, io.SeekStart); err != nil {
+					f.err = errors.Wrapf(err, "failed to seek truncated file %s", f.file)
+					return
+				}
+				reader.Reset(file)
+				partial = ""
+			}
+			// The file was written, so try reading again.
+			continue
+		}
+		if err != nil {
+			f.err = errors.Wrapf(err, "failed to read from file %s", f.file)
+			return
+		}
+
+		line = partial + line
+		partial = ""
+		if !f.emit(line) {
+			return
+		}
+	}
+}
+
+// waitForLogs blocks until the log file is updated or the reader is closed. It
+// returns the operation performed on the file and true if the file was updated
+// or false if the reader was closed. An error is returned if the file watcher
+// failed.
+func (f *fileReader) waitForLogs() (fsnotify.Op, bool, error) {
+	for {
+		select {
+		case event, ok := <-f.watcher.Events:
+			if !ok {
+				return 0, false, nil
+			}
+			// The parent directory may be watched due to rotation, so ignore
+			// events for other files.
+			if filepath.Clean(event.Name) != filepath.Clean(f.file) {
+				continue
+			}
+			return event.Op, true, nil
+		case err, ok := <-f.watcher.Errors:
+			if ok {
+				return 0, false, err
+			}
+			return 0, false, nil
+		case <-f.close:
+			return 0, false, nil
+		}
+	}
+}
+
+// waitForFile blocks until the log file exists and then opens it and begins
+// watching it. This is done by watching the file's parent directory. It
+// returns nil if the reader was closed before the file was created. If timeout
+// is positive, an error is returned if the file isn't created within it.
+func (f *fileReader) waitForFile(timeout time.Duration) (*os.File, error) {
+	if err := f.watcher.Add(filepath.Dir(f.file)); err != nil {
+		return nil, errors.Wrap(err, "failed to add directory watch")
+	}
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		// Check for the file after watching the directory so that its
+		// creation isn't missed.
+		file, err := os.Open(f.file)
+		if err == nil {
+			if err := f.watcher.Add(f.file); err != nil {
+				file.Close()
+				return nil, errors.Wrap(err, "failed to add file watch")
+			}
+			return file, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, "failed to open file")
+		}
+
+		select {
+		case _, ok := <-f.watcher.Events:
+			if !ok {
+				return nil, nil
+			}
+		case err, ok := <-f.watcher.Errors:
+			if ok {
+				return nil, err
+			}
+			return nil, nil
+		case <-deadline:
+			return nil, errors.Errorf("file not created within %s", timeout)
+		case <-f.close:
+			return nil, nil
+		}
+	}
+}
+
+// isGzip indicates if the given file is gzip-compressed by checking for the
+// gzip magic header. The file is left positioned at the start.
+func isGzip(file *os.File) (bool, error) {
+	header := make([]byte, 2)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return n == 2 && header[0] == 0x1f && header[1] == 0x8b, nil
+}
+
+// isRotated indicates if the given path no longer refers to the given open
+// file, i.e. because it was renamed or removed.
+func isRotated(path string, file *os.File) bool {
+	openInfo, err := file.Stat()
+	if err != nil {
+		return true
+	}
+	pathInfo, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(openInfo, pathInfo)
+}
+
+// isTruncated indicates if the given open file has shrunk below the current
+// read offset. This assumes any buffered data has already been read.
+func isTruncated(file *os.File) bool {
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Size() < offset
+}
@@ -0,0 +1,341 @@
+package monitor
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestFileReaderRotation ensures the reader continues reading from a newly
+// created file after the original file is renamed.
+func TestFileReaderRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpmonitor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access_log")
+	writeLogs(t, path, 2, os.O_CREATE|os.O_WRONLY)
+
+	logs, r := openTestReader(t, path)
+	defer r.Close()
+	expectLogs(t, logs, 2)
+
+	// Rotate the file.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("Error renaming log file: %v", err)
+	}
+	writeLogs(t, path+".1", 1, os.O_APPEND|os.O_WRONLY)
+	writeLogs(t, path, 3, os.O_CREATE|os.O_WRONLY)
+
+	// The tail of the old file and the new file should be read.
+	expectLogs(t, logs, 4)
+}
+
+// TestFileReaderRotationPartialLine ensures a partial line at the end of the
+// original file is completed by anything written to it after it's renamed,
+// before the reader switches to the new file.
+func TestFileReaderRotationPartialLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpmonitor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access_log")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer file.Close()
+	line := fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700"))
+
+	logs, r := openTestReader(t, path)
+	defer r.Close()
+	file.WriteString(line[:20])
+	expectLogs(t, logs, 0)
+
+	// Rotate the file and finish the line in the old one.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("Error renaming log file: %v", err)
+	}
+	file.WriteString(line[20:])
+	writeLogs(t, path, 1, os.O_CREATE|os.O_WRONLY)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case l := <-logs:
+			if l.status != 200 {
+				t.Fatalf("Expected complete log, got %+v", l)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected 2 logs, got %d", i)
+		}
+	}
+	expectLogs(t, logs, 0)
+}
+
+// TestFileReaderCloseTwice ensures closing the reader more than once has no
+// effect.
+func TestFileReaderCloseTwice(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	logs, r := openTestReader(t, file.Name())
+	for i := 0; i < 2; i++ {
+		if err := r.Close(); err != nil {
+			t.Fatalf("Error closing reader: %v", err)
+		}
+	}
+	if _, ok := <-logs; ok {
+		t.Fatal("Expected channel to be closed")
+	}
+}
+
+// TestFileReaderTruncation ensures the reader starts reading from the beginning
+// of the file after it's truncated.
+func TestFileReaderTruncation(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+	writeLogs(t, file.Name(), 3, os.O_APPEND|os.O_WRONLY)
+
+	logs, r := openTestReader(t, file.Name())
+	defer r.Close()
+	expectLogs(t, logs, 3)
+
+	writeLogs(t, file.Name(), 1, os.O_TRUNC|os.O_WRONLY)
+	expectLogs(t, logs, 1)
+}
+
+// openTestReader opens a Common Log Format reader on the given file.
+func openTestReader(t *testing.T, path string) (<-chan *log, Reader) {
+	r, err := NewCommonLogFormatReader(path)
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	logs, err := openReader(r)
+	if err != nil {
+		t.Fatalf("Error opening reader: %v", err)
+	}
+	return logs, r
+}
+
+// writeLogs writes n dummy logs to the file at the given path opened with the
+// given flags.
+func writeLogs(t *testing.T, path string, n int, flag int) {
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		t.Fatalf("Error opening log file: %v", err)
+	}
+	defer file.Close()
+	for i := 0; i < n; i++ {
+		if _, err := fmt.Fprintf(file, dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")); err != nil {
+			t.Fatalf("Error writing log file: %v", err)
+		}
+	}
+}
+
+// expectLogs waits to receive n logs from the channel and then ensures no
+// more are received.
+func expectLogs(t *testing.T, logs <-chan *log, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-logs:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected %d logs, got %d", n, i)
+		}
+	}
+	select {
+	case <-logs:
+		t.Fatalf("Expected %d logs, got more", n)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestFileReaderPartialLine ensures a line written without its trailing newline is
+// buffered until the rest of it is written and flushed when the reader is
+// closed.
+func TestFileReaderPartialLine(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	line := fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700"))
+
+	logs, r := openTestReader(t, file.Name())
+	file.WriteString(line[:20])
+	expectLogs(t, logs, 0)
+	file.WriteString(line[20:])
+	expectLogs(t, logs, 1)
+
+	// Write a line without a newline which should be flushed on close.
+	file.WriteString(line[:len(line)-1])
+	expectLogs(t, logs, 0)
+	if err := r.Close(); err != nil {
+		t.Fatalf("Error closing reader: %v", err)
+	}
+	if l, ok := <-logs; !ok || l.status != 200 {
+		t.Fatal("Expected partial line to be flushed")
+	}
+	if _, ok := <-logs; ok {
+		t.Fatal("Expected channel to be closed")
+	}
+}
+
+// TestFileReaderMalformedPartialLine ensures a malformed partial line flushed
+// when the reader is closed is handled according to the malformed line policy.
+func TestFileReaderMalformedPartialLine(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	file.WriteString("garbage")
+
+	for _, policy := range []MalformedLinePolicy{CollectMalformedLines, FailOnMalformedLines} {
+		r, err := NewCommonLogFormatReader(file.Name())
+		if err != nil {
+			t.Fatalf("Error creating reader: %v", err)
+		}
+		r.(malformedLineHandler).setMalformedLinePolicy(policy)
+		logs, err := openReader(r)
+		if err != nil {
+			t.Fatalf("Error opening reader: %v", err)
+		}
+		expectLogs(t, logs, 0)
+		if err := r.Close(); err != nil {
+			t.Fatalf("Error closing reader: %v", err)
+		}
+		if l, ok := <-logs; ok {
+			t.Fatalf("Expected channel to be closed, got %+v", l)
+		}
+		if skipped := r.(skipCounter).Skipped(); skipped != 1 {
+			t.Errorf("Expected 1 skipped line with policy %s, got %d", policy, skipped)
+		}
+		switch policy {
+		case CollectMalformedLines:
+			if lines := r.(malformedLineHandler).MalformedLines(); !reflect.DeepEqual(lines, []string{"garbage"}) {
+				t.Errorf("Expected malformed line to be collected, got %q", lines)
+			}
+		case FailOnMalformedLines:
+			if r.Err() == nil {
+				t.Error("Expected error for malformed line")
+			}
+		}
+	}
+}
+
+// TestFileReaderGzip ensures a gzip-compressed file is read to the end and the
+// channel is then closed.
+func TestFileReaderGzip(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log.gz")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	gz := gzip.NewWriter(file)
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(gz, dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700"))
+	}
+	gz.Close()
+	file.Close()
+
+	logs, r := openTestReader(t, file.Name())
+	defer r.Close()
+	for i := 0; i < 3; i++ {
+		select {
+		case _, ok := <-logs:
+			if !ok {
+				t.Fatalf("Expected 3 logs, got %d", i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected 3 logs, got %d", i)
+		}
+	}
+	select {
+	case _, ok := <-logs:
+		if ok {
+			t.Fatal("Expected channel to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected channel to be closed")
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+// TestFileReaderWaitForFile ensures the reader begins reading a file once it's
+// created if it doesn't exist when the reader is opened.
+func TestFileReaderWaitForFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpmonitor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access_log")
+
+	r, err := newCommonLogFormatReader(path, fileReaderOpts{waitTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	defer r.Close()
+	logs, err := openReader(r)
+	if err != nil {
+		t.Fatalf("Error opening reader: %v", err)
+	}
+
+	writeLogs(t, path, 2, os.O_CREATE|os.O_WRONLY)
+	expectLogs(t, logs, 2)
+}
+
+// TestFileReaderWaitForFileTimeout ensures the reader stops with an error if
+// the file isn't created within the timeout.
+func TestFileReaderWaitForFileTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpmonitor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access_log")
+
+	if _, err := newCommonLogFormatReader(path, fileReaderOpts{}); err == nil {
+		t.Fatal("Expected error creating reader for missing file without timeout")
+	}
+
+	r, err := newCommonLogFormatReader(path, fileReaderOpts{waitTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	defer r.Close()
+	logs, err := openReader(r)
+	if err != nil {
+		t.Fatalf("Error opening reader: %v", err)
+	}
+	select {
+	case _, ok := <-logs:
+		if ok {
+			t.Fatal("Expected channel to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected channel to be closed")
+	}
+	if err := r.Err(); err == nil {
+		t.Fatal("Expected timeout error")
+	}
+}
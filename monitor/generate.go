@@ -0,0 +1,128 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// clfEscaper escapes quotes and backslashes within a quoted log field.
+var clfEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// GenerateOpts configures the synthetic logs written by GenerateCLF. Each log
+// picks its section, status, remote address, and user-agent uniformly at
+// random from the given values, so repeating a value weights it, e.g.
+// Statuses of 200, 200, 200, 500 produces 25% server errors.
+type GenerateOpts struct {
+	// Sections are the sections requested, e.g. "/pages". Defaults to "/".
+	Sections []string
+
+	// Statuses are the status codes of the responses. Defaults to 200.
+	Statuses []int
+
+	// MinSize and MaxSize bound the response sizes in bytes, which are
+	// uniformly distributed between them inclusively. Both default to zero.
+	MinSize int64
+	MaxSize int64
+
+	// RemoteAddrs are the addresses of the clients. Defaults to 127.0.0.1.
+	RemoteAddrs []string
+
+	// Combined writes logs in Combined Log Format rather than Common Log
+	// Format.
+	Combined bool
+
+	// UserAgents are the user-agents of the clients in Combined Log Format.
+	// Defaults to "httpmonitor".
+	UserAgents []string
+
+	// Seed seeds the random choices so the generated logs are repeatable
+	// apart from their timestamps. If zero, the current time is used.
+	Seed int64
+}
+
+// GenerateCLF writes synthetic logs in Common Log Format, or Combined Log
+// Format if opts.Combined is set, to w at the given rate of logs per second for
+// the given duration, which is useful for demonstrating the monitor and
+// reproducing alerts. Logs are timestamped when they're written.
+func GenerateCLF(w io.Writer, rate float64, duration time.Duration, opts GenerateOpts) error {
+	return GenerateCLFContext(context.Background(), w, rate, duration, opts)
+}
+
+// GenerateCLFContext is like GenerateCLF but returns the context's error if
+// it's done before the duration has elapsed. If the duration is zero, logs are
+// generated until the context is done.
+func GenerateCLFContext(ctx context.Context, w io.Writer, logsPerSec float64, duration time.Duration,
+	opts GenerateOpts) error {
+
+	switch {
+	case logsPerSec <= 0:
+		return errors.Errorf("rate %g must be positive", logsPerSec)
+	case duration < 0:
+		return errors.Errorf("duration %s may not be negative", duration)
+	case opts.MinSize < 0 || opts.MaxSize < 0:
+		return errors.New("sizes may not be negative")
+	case opts.MaxSize < opts.MinSize:
+		return errors.Errorf("max size %d may not be less than min size %d", opts.MaxSize, opts.MinSize)
+	}
+	if len(opts.Sections) == 0 {
+		opts.Sections = []string{"/"}
+	}
+	if len(opts.Statuses) == 0 {
+		opts.Statuses = []int{200}
+	}
+	if len(opts.RemoteAddrs) == 0 {
+		opts.RemoteAddrs = []string{"127.0.0.1"}
+	}
+	if len(opts.UserAgents) == 0 {
+		opts.UserAgents = []string{"httpmonitor"}
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	genCtx := ctx
+	if duration > 0 {
+		var cancel context.CancelFunc
+		genCtx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+
+	var (
+		rnd     = rand.New(rand.NewSource(opts.Seed))
+		limiter = rate.NewLimiter(rate.Limit(logsPerSec), 1)
+	)
+	for {
+		// Wait fails early if the next log would be written after the
+		// deadline, so wait out the rest of the duration before returning.
+		if err := limiter.Wait(genCtx); err != nil {
+			<-genCtx.Done()
+			return ctx.Err()
+		}
+		if _, err := io.WriteString(w, generateLog(rnd, opts, time.Now())); err != nil {
+			return errors.Wrap(err, "failed to write log")
+		}
+	}
+}
+
+// generateLog returns a random log line, including the trailing newline, with
+// the given timestamp.
+func generateLog(rnd *rand.Rand, opts GenerateOpts, timestamp time.Time) string {
+	var (
+		section = strings.TrimSuffix(opts.Sections[rnd.Intn(len(opts.Sections))], "/")
+		request = fmt.Sprintf("GET %s/page%d.html HTTP/1.1", section, rnd.Intn(10))
+		size    = opts.MinSize + rnd.Int63n(opts.MaxSize-opts.MinSize+1)
+		line    = fmt.Sprintf(`%s - - [%s] "%s" %d %d`, opts.RemoteAddrs[rnd.Intn(len(opts.RemoteAddrs))],
+			timestamp.Format(clfTimeLayout), clfEscaper.Replace(request), opts.Statuses[rnd.Intn(len(opts.Statuses))], size)
+	)
+	if opts.Combined {
+		line += fmt.Sprintf(` "-" "%s"`, clfEscaper.Replace(opts.UserAgents[rnd.Intn(len(opts.UserAgents))]))
+	}
+	return line + "\n"
+}
@@ -0,0 +1,90 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGenerateCLF ensures generated logs parse in Common Log Format and use
+// the configured sections, statuses, and sizes.
+func TestGenerateCLF(t *testing.T) {
+	var buf bytes.Buffer
+	opts := GenerateOpts{
+		Sections: []string{"/api", "/pages/"},
+		Statuses: []int{200, 503},
+		MinSize:  100,
+		MaxSize:  200,
+		Seed:     1,
+	}
+	if err := GenerateCLF(&buf, 200, 100*time.Millisecond, opts); err != nil {
+		t.Fatalf("Error generating logs: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) < 5 || len(lines) > 30 {
+		t.Fatalf("Expected about 20 logs, got %d", len(lines))
+	}
+	for _, line := range lines {
+		l, ok := commonLogFormatParser.parse(line)
+		if !ok {
+			t.Fatalf("Expected log in Common Log Format, got %q", line)
+		}
+		if section := sectionFromDocument(strings.Fields(l.request)[1], 1); section != "/api" && section != "/pages" {
+			t.Fatalf("Expected section /api or /pages, got %s", section)
+		}
+		if l.status != 200 && l.status != 503 {
+			t.Fatalf("Expected status 200 or 503, got %d", l.status)
+		}
+		if l.size < 100 || l.size > 200 {
+			t.Fatalf("Expected size within [100, 200], got %d", l.size)
+		}
+		if time.Since(l.timestamp) > time.Minute {
+			t.Fatalf("Expected current timestamp, got %s", l.timestamp)
+		}
+	}
+}
+
+// TestGenerateCLFCombined ensures generated logs parse in Combined Log Format
+// with escaped user-agents.
+func TestGenerateCLFCombined(t *testing.T) {
+	var buf bytes.Buffer
+	opts := GenerateOpts{Combined: true, UserAgents: []string{`curl "quoted"`}}
+	if err := GenerateCLF(&buf, 100, 20*time.Millisecond, opts); err != nil {
+		t.Fatalf("Error generating logs: %v", err)
+	}
+	line := strings.SplitN(buf.String(), "\n", 2)[0]
+	l, ok := combinedLogFormatParser.parse(line)
+	if !ok {
+		t.Fatalf("Expected log in Combined Log Format, got %q", line)
+	}
+	if l.userAgent != `curl "quoted"` {
+		t.Fatalf("Expected user-agent curl \"quoted\", got %q", l.userAgent)
+	}
+}
+
+// TestGenerateCLFContext ensures generation stops when the context is done.
+func TestGenerateCLFContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var buf bytes.Buffer
+	if err := GenerateCLFContext(ctx, &buf, 100, 0, GenerateOpts{}); err != context.DeadlineExceeded {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	if buf.Len() == 0 {
+		t.Fatal("Expected logs to be generated")
+	}
+}
+
+// TestGenerateCLFInvalidOpts ensures invalid rates and sizes are rejected.
+func TestGenerateCLFInvalidOpts(t *testing.T) {
+	var buf bytes.Buffer
+	if err := GenerateCLF(&buf, 0, time.Second, GenerateOpts{}); err == nil {
+		t.Fatal("Expected error for zero rate")
+	}
+	if err := GenerateCLF(&buf, 1, time.Second, GenerateOpts{MinSize: 10, MaxSize: 5}); err == nil {
+		t.Fatal("Expected error for max size less than min size")
+	}
+}
@@ -0,0 +1,355 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// unknownCountry is the country under which logs whose remote address
+	// can't be located are grouped.
+	unknownCountry = "(unknown)"
+
+	// maxGeoIPCacheSize is the maximum number of addresses whose country is
+	// cached. The cache is cleared once it's full.
+	maxGeoIPCacheSize = 100000
+
+	// mmdbDataSectionSeparatorSize is the number of zero bytes between the
+	// search tree and data section of a MaxMind DB file.
+	mmdbDataSectionSeparatorSize = 16
+
+	// mmdbMaxDepth is the maximum nesting of maps, arrays, and pointers
+	// decoded from a MaxMind DB file, so that a corrupt file, e.g. with a
+	// pointer which references itself, fails to decode rather than
+	// overflowing the stack.
+	mmdbMaxDepth = 512
+)
+
+// mmdbMetadataStart marks the start of the metadata section of a MaxMind DB
+// file.
+var mmdbMetadataStart = []byte("\xab\xcd\xefMaxMind.com")
+
+// MaxMind DB data field types.
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// geoIPDB is a minimal reader for MaxMind DB files, such as GeoLite2-Country,
+// which supports looking up the country of an IP address. See
+// https://maxmind.github.io/MaxMind-DB/ for the format.
+type geoIPDB struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+// openGeoIPDB reads the MaxMind DB file at the given path into memory.
+func openGeoIPDB(path string) (*geoIPDB, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	start := bytes.LastIndex(buf, mmdbMetadataStart)
+	if start < 0 {
+		return nil, errors.New("invalid MaxMind DB: metadata not found")
+	}
+	metadata := buf[start+len(mmdbMetadataStart):]
+	value, err := decodeMMDB(metadata, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid MaxMind DB metadata")
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid MaxMind DB metadata")
+	}
+	nodeCount, _ := fields["node_count"].(uint64)
+	recordSize, _ := fields["record_size"].(uint64)
+	ipVersion, _ := fields["ip_version"].(uint64)
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return nil, errors.Errorf("unsupported MaxMind DB record size %d", recordSize)
+	}
+	if ipVersion != 4 && ipVersion != 6 {
+		return nil, errors.Errorf("unsupported MaxMind DB IP version %d", ipVersion)
+	}
+	treeSize := nodeCount * recordSize / 4
+	if treeSize+mmdbDataSectionSeparatorSize > uint64(start) {
+		return nil, errors.New("invalid MaxMind DB: search tree exceeds file size")
+	}
+
+	db := &geoIPDB{
+		tree:       buf[:treeSize],
+		data:       buf[treeSize+mmdbDataSectionSeparatorSize : start],
+		nodeCount:  uint(nodeCount),
+		recordSize: uint(recordSize),
+		ipVersion:  uint(ipVersion),
+	}
+	// IPv4 addresses are stored as IPv4-mapped IPv6 addresses in IPv6
+	// databases, so find the node for the first 96 zero bits.
+	if db.ipVersion == 6 {
+		for i := 0; i < 96 && db.ipv4Start < db.nodeCount; i++ {
+			db.ipv4Start = db.readNode(db.ipv4Start, 0)
+		}
+	}
+	return db, nil
+}
+
+// country returns the ISO code of the country of the given IP address, or an
+// empty string if it isn't in the database.
+func (db *geoIPDB) country(ip net.IP) (string, error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		node = db.ipv4Start
+	} else if db.ipVersion == 4 {
+		return "", nil
+	}
+
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = db.readNode(node, bit)
+	}
+	switch {
+	case node == db.nodeCount:
+		return "", nil
+	case node < db.nodeCount:
+		return "", errors.New("invalid MaxMind DB: search tree too deep")
+	case node < db.nodeCount+mmdbDataSectionSeparatorSize:
+		return "", errors.New("invalid MaxMind DB: record points into the data section separator")
+	}
+	offset := node - db.nodeCount - mmdbDataSectionSeparatorSize
+	if offset >= uint(len(db.data)) {
+		return "", errors.New("invalid MaxMind DB: record points past the data section")
+	}
+
+	value, err := decodeMMDB(db.data, offset)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid MaxMind DB record")
+	}
+	record, _ := value.(map[string]interface{})
+	for _, key := range []string{"country", "registered_country"} {
+		country, _ := record[key].(map[string]interface{})
+		if code, ok := country["iso_code"].(string); ok {
+			return code, nil
+		}
+	}
+	return "", nil
+}
+
+// readNode returns the left (bit 0) or right (bit 1) record of the given node
+// in the search tree.
+func (db *geoIPDB) readNode(node, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		b := db.tree[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(db.tree[node*8+bit*4:]))
+	}
+}
+
+// mmdbDecoder decodes MaxMind DB data fields from a section of the file.
+type mmdbDecoder struct {
+	section []byte
+	offset  uint
+	depth   uint // of the field being decoded, including pointers followed
+}
+
+// decodeMMDB decodes the MaxMind DB data field at the given offset of the
+// section.
+func decodeMMDB(section []byte, offset uint) (interface{}, error) {
+	d := &mmdbDecoder{section: section, offset: offset}
+	return d.decode()
+}
+
+// read returns the next n bytes of the section.
+func (d *mmdbDecoder) read(n uint) ([]byte, error) {
+	if d.offset+n > uint(len(d.section)) {
+		return nil, errors.New("unexpected end of data")
+	}
+	b := d.section[d.offset : d.offset+n]
+	d.offset += n
+	return b, nil
+}
+
+// remaining returns the number of bytes of the section after the offset.
+func (d *mmdbDecoder) remaining() uint {
+	return uint(len(d.section)) - d.offset
+}
+
+// decode decodes the next data field. Strings are decoded as string, unsigned
+// integers as uint64, maps as map[string]interface{}, and arrays as
+// []interface{}.
+func (d *mmdbDecoder) decode() (interface{}, error) {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > mmdbMaxDepth {
+		return nil, errors.New("exceeded maximum data structure depth")
+	}
+	b, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	ctrl := b[0]
+	typ := uint(ctrl >> 5)
+	if typ == mmdbPointer {
+		return d.decodePointer(ctrl)
+	}
+	if typ == mmdbExtended {
+		b, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		typ = 7 + uint(b[0])
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		b, err := d.read(size - 28)
+		if err != nil {
+			return nil, err
+		}
+		switch size {
+		case 29:
+			size = 29 + uint(b[0])
+		case 30:
+			size = 285 + (uint(b[0])<<8 | uint(b[1]))
+		default:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+	}
+
+	switch typ {
+	case mmdbMap:
+		// Each entry takes at least two bytes, so a larger size is corrupt.
+		// Checking it bounds the allocation by the size of the file.
+		if size > d.remaining()/2 {
+			return nil, errors.New("map size exceeds the data")
+		}
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, errors.New("map key is not a string")
+			}
+			if m[k], err = d.decode(); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case mmdbArray:
+		// Each element takes at least a byte.
+		if size > d.remaining() {
+			return nil, errors.New("array size exceeds the data")
+		}
+		a := make([]interface{}, size)
+		for i := range a {
+			if a[i], err = d.decode(); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	case mmdbBool:
+		return size != 0, nil
+	}
+
+	if b, err = d.read(size); err != nil {
+		return nil, err
+	}
+	switch typ {
+	case mmdbString:
+		return string(b), nil
+	case mmdbBytes:
+		return b, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, errors.New("invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, errors.New("invalid float size")
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbUint128:
+		if size > 8 {
+			// Values which don't fit in 64 bits are left as bytes.
+			return b, nil
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, nil
+	case mmdbInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int32(v), nil
+	default:
+		return nil, errors.Errorf("unsupported data type %d", typ)
+	}
+}
+
+// decodePointer decodes the field referenced by a pointer with the given
+// control byte. Decoding continues after the pointer rather than the field it
+// references. The referenced field counts towards the depth, so pointers which
+// form a cycle fail to decode.
+func (d *mmdbDecoder) decodePointer(ctrl byte) (interface{}, error) {
+	size := uint(ctrl>>3) & 0x3
+	b, err := d.read(size + 1)
+	if err != nil {
+		return nil, err
+	}
+	var pointer uint
+	if size < 3 {
+		pointer = uint(ctrl & 0x7)
+	}
+	for _, c := range b {
+		pointer = pointer<<8 | uint(c)
+	}
+	switch size {
+	case 1:
+		pointer += 2048
+	case 2:
+		pointer += 526336
+	}
+	if pointer >= uint(len(d.section)) {
+		return nil, errors.New("pointer past the end of data")
+	}
+	referenced := &mmdbDecoder{section: d.section, offset: pointer, depth: d.depth}
+	return referenced.decode()
+}
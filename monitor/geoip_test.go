@@ -0,0 +1,187 @@
+package monitor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+// encodeMMDBString encodes a MaxMind DB string field.
+func encodeMMDBString(s string) []byte {
+	return append([]byte{mmdbString<<5 | byte(len(s))}, s...)
+}
+
+// encodeMMDBUint encodes a MaxMind DB uint16 or uint32 field.
+func encodeMMDBUint(typ byte, v uint32) []byte {
+	return []byte{typ<<5 | 4, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+// encodeMMDBMap encodes a MaxMind DB map field from alternating encoded keys
+// and values.
+func encodeMMDBMap(fields ...[]byte) []byte {
+	b := []byte{mmdbMap<<5 | byte(len(fields)/2)}
+	for _, field := range fields {
+		b = append(b, field...)
+	}
+	return b
+}
+
+// writeTestGeoIPDB writes a MaxMind DB with two nodes in which 0.0.0.0/2 is
+// in the US, 64.0.0.0/2 isn't in the database, and 128.0.0.0/1 is registered
+// to the US via a pointer to the first record's ISO code.
+func writeTestGeoIPDB(t *testing.T) string {
+	const nodeCount = 2
+	var (
+		us      = encodeMMDBMap(encodeMMDBString("country"), encodeMMDBMap(encodeMMDBString("iso_code"), encodeMMDBString("US")))
+		usCode  = bytes.Index(us, encodeMMDBString("US"))
+		pointer = []byte{mmdbPointer << 5, byte(usCode)}
+		reg     = encodeMMDBMap(encodeMMDBString("registered_country"), encodeMMDBMap(encodeMMDBString("iso_code"), pointer))
+		data    = append(append([]byte{}, us...), reg...)
+		record  = func(offset int) []byte {
+			v := nodeCount + mmdbDataSectionSeparatorSize + offset
+			return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+		}
+	)
+
+	var db []byte
+	// Node 0: left is node 1, right is the registered country record.
+	db = append(db, 0, 0, 1)
+	db = append(db, record(len(us))...)
+	// Node 1: left is the country record, right is not found.
+	db = append(db, record(0)...)
+	db = append(db, 0, 0, nodeCount)
+	db = append(db, make([]byte, mmdbDataSectionSeparatorSize)...)
+	db = append(db, data...)
+	db = append(db, mmdbMetadataStart...)
+	db = append(db, encodeMMDBMap(
+		encodeMMDBString("node_count"), encodeMMDBUint(mmdbUint32, nodeCount),
+		encodeMMDBString("record_size"), encodeMMDBUint(mmdbUint16, 24),
+		encodeMMDBString("ip_version"), encodeMMDBUint(mmdbUint16, 4),
+	)...)
+
+	file, err := ioutil.TempFile("", "geoip")
+	if err != nil {
+		t.Fatalf("Error creating GeoIP database: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(db); err != nil {
+		t.Fatalf("Error writing GeoIP database: %v", err)
+	}
+	return file.Name()
+}
+
+// TestGeoIPDBCountry ensures countries are looked up from a MaxMind DB.
+func TestGeoIPDBCountry(t *testing.T) {
+	path := writeTestGeoIPDB(t)
+	defer os.Remove(path)
+	db, err := openGeoIPDB(path)
+	if err != nil {
+		t.Fatalf("Error opening GeoIP database: %v", err)
+	}
+
+	for addr, expected := range map[string]string{
+		"10.0.0.1":    "US",
+		"64.0.0.1":    "",
+		"200.0.0.1":   "US",
+		"2001:db8::1": "",
+	} {
+		country, err := db.country(net.ParseIP(addr))
+		if err != nil {
+			t.Fatalf("Error looking up %s: %v", addr, err)
+		}
+		if country != expected {
+			t.Fatalf("Expected country %q for %s, got %q", expected, addr, country)
+		}
+	}
+
+	if _, err := openGeoIPDB(os.DevNull); err == nil {
+		t.Fatal("Expected error for invalid database")
+	}
+}
+
+// TestGeoIPDBCorrupt ensures corrupt databases fail lookups rather than
+// crashing, including pointers which form a cycle and search tree records
+// which don't point into the data section.
+func TestGeoIPDBCorrupt(t *testing.T) {
+	// A pointer to itself.
+	if _, err := decodeMMDB([]byte{mmdbPointer << 5, 0}, 0); err == nil {
+		t.Fatal("Expected error decoding self-referencing pointer")
+	}
+	// A pointer past the end of the data.
+	if _, err := decodeMMDB([]byte{mmdbPointer << 5, 10}, 0); err == nil {
+		t.Fatal("Expected error decoding pointer past the end")
+	}
+	// A map and an array whose sizes, the largest possible, exceed the data.
+	if _, err := decodeMMDB([]byte{mmdbMap<<5 | 31, 0xff, 0xff, 0xff, 0, 0}, 0); err == nil || !strings.Contains(err.Error(), "size") {
+		t.Fatalf("Expected size error decoding oversized map, got %v", err)
+	}
+	if _, err := decodeMMDB([]byte{mmdbExtended<<5 | 31, mmdbArray - 7, 0xff, 0xff, 0xff, 0}, 0); err == nil || !strings.Contains(err.Error(), "size") {
+		t.Fatalf("Expected size error decoding oversized array, got %v", err)
+	}
+	// Maps nested more deeply than the limit.
+	var nested []byte
+	for i := 0; i <= mmdbMaxDepth; i++ {
+		nested = append(nested, encodeMMDBMap()[0]|1)
+		nested = append(nested, encodeMMDBString("a")...)
+	}
+	nested = append(nested, encodeMMDBString("b")...)
+	if _, err := decodeMMDB(nested, 0); err == nil || !strings.Contains(err.Error(), "depth") {
+		t.Fatalf("Expected depth error decoding deeply nested maps, got %v", err)
+	}
+
+	// Node 0: left points into the separator, right past the data section.
+	db := &geoIPDB{
+		tree:       []byte{0, 0, 1 + 1, 0, 0, 1 + mmdbDataSectionSeparatorSize + 10},
+		data:       encodeMMDBString("US"),
+		nodeCount:  1,
+		recordSize: 24,
+		ipVersion:  4,
+	}
+	for _, addr := range []string{"10.0.0.1", "200.0.0.1"} {
+		if _, err := db.country(net.ParseIP(addr)); err == nil {
+			t.Fatalf("Expected error looking up %s", addr)
+		}
+	}
+}
+
+// TestProcessCountry ensures top countries are tracked and that addresses
+// which can't be located are grouped together.
+func TestProcessCountry(t *testing.T) {
+	path := writeTestGeoIPDB(t)
+	defer os.Remove(path)
+	c := newCollector(MonitorOpts{
+		AlertWindow:     1,
+		Quantum:         1,
+		GeoIPDatabase:   path,
+		NumTopCountries: 2,
+	})
+	for _, addr := range []string{"10.0.0.1", "200.0.0.1", "64.0.0.1", "-"} {
+		c.processCountry(addr)
+	}
+	elements := c.topCountries.Elements()
+	if len(elements) != 2 {
+		t.Fatalf("Expected 2 countries, got %d", len(elements))
+	}
+	for _, e := range elements {
+		if (string(e.Data) != "US" && string(e.Data) != unknownCountry) || e.Freq != 2 {
+			t.Fatalf("Expected US and %s with 2 hits each, got %s with %d", unknownCountry, e.Data, e.Freq)
+		}
+	}
+
+	// A missing database disables lookups rather than failing.
+	var output bytes.Buffer
+	c = newCollector(MonitorOpts{
+		AlertWindow:     1,
+		Quantum:         1,
+		GeoIPDatabase:   path + ".missing",
+		NumTopCountries: 2,
+		Output:          &output,
+	})
+	c.processCountry("10.0.0.1")
+	if c.topCountries != nil || output.Len() == 0 {
+		t.Fatal("Expected GeoIP lookups to be disabled with a warning")
+	}
+}
@@ -0,0 +1,211 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// globReader implements the Reader interface for all of the log files matching
+// a glob pattern, including those created after it's opened. The logs from
+// each file are fanned in by a multiReader.
+type globReader struct {
+	*multiReader
+	pattern string
+	opts    fileReaderOpts
+	watcher *fsnotify.Watcher // nil unless following
+	stopped chan struct{}     // closed once watch returns
+
+	mu       sync.Mutex
+	files    map[string]os.FileInfo // files which are being read
+	watching bool
+	closed   bool
+}
+
+// isGlob indicates if the given log source is a glob pattern rather than a
+// single file.
+func isGlob(source string) bool {
+	return strings.ContainsAny(source, "*?[")
+}
+
+// newGlobReader returns a new globReader which reads the log files in Common
+// Log Format matching the given pattern, e.g. /var/log/nginx/access.*.log,
+// configured with the given options. Only the last element of the pattern may
+// contain wildcards, since only the directory containing the matching files is
+// watched. Unless the reader is configured not to follow the files, files which
+// are created in the directory and match the pattern are read from the start
+// as they're created.
+func newGlobReader(pattern string, opts fileReaderOpts) (*globReader, error) {
+	pattern = filepath.Clean(pattern)
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, errors.Wrapf(err, "invalid glob pattern %s", pattern)
+	}
+	dir := filepath.Dir(pattern)
+	if isGlob(dir) {
+		return nil, errors.Errorf("glob pattern %s may only contain wildcards in its last element", pattern)
+	}
+
+	g := &globReader{
+		multiReader: newMultiReader(),
+		pattern:     pattern,
+		opts:        opts,
+		files:       make(map[string]os.FileInfo),
+	}
+	if !opts.noFollow {
+		// Watch the directory before globbing so that files created in the
+		// meantime aren't missed.
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create directory watcher")
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, errors.Wrap(err, "failed to add directory watch")
+		}
+		g.watcher = watcher
+		g.stopped = make(chan struct{})
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		g.Close()
+		return nil, errors.Wrapf(err, "invalid glob pattern %s", pattern)
+	}
+	for _, file := range matches {
+		reader, info, err := g.newFileReader(file)
+		if err != nil {
+			g.Close()
+			return nil, errors.Wrapf(err, "failed to create log file reader for %s", file)
+		}
+		if reader != nil {
+			g.readers = append(g.readers, reader)
+			g.files[file] = info
+		}
+	}
+	return g, nil
+}
+
+// newFileReader returns a reader for the given file along with the file's info.
+// It returns a nil reader if the file is a directory or is already being read,
+// e.g. because it was renamed to a matching name by rotation.
+func (g *globReader) newFileReader(file string) (Reader, os.FileInfo, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		return nil, nil, nil
+	}
+	for _, read := range g.files {
+		if os.SameFile(info, read) {
+			return nil, nil, nil
+		}
+	}
+	reader, err := newCommonLogFormatReader(file, g.opts)
+	return reader, info, err
+}
+
+// open opens the readers for each of the files which matched the pattern when
+// the globReader was created and places their logs on the channel. Unless the
+// reader is configured not to follow the files, readers for files created
+// later are added until Close is called. The channel is closed once all of the
+// readers have stopped.
+func (g *globReader) open() (<-chan *log, error) {
+	g.mu.Lock()
+	if g.watcher != nil && !g.closed {
+		// Hold the channel open while new files are being watched for.
+		g.watching = true
+		g.running.Add(1)
+		go g.watch()
+	}
+	g.mu.Unlock()
+	return g.multiReader.open()
+}
+
+// Open implements the Reader interface.
+func (g *globReader) Open() (<-chan *Log, error) {
+	return exportLogs(g.open())
+}
+
+// watch is a long-running loop which adds readers for files matching the
+// pattern as they're created. It runs until the reader is closed or the
+// directory watcher fails.
+func (g *globReader) watch() {
+	defer close(g.stopped)
+	defer g.running.Done()
+	defer g.watcher.Close()
+	for {
+		select {
+		case event, ok := <-g.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Create == 0 {
+				continue
+			}
+			if err := g.addFile(filepath.Clean(event.Name)); err != nil {
+				g.fail(errors.Wrapf(err, "failed to read new log file %s", event.Name))
+				return
+			}
+		case err, ok := <-g.watcher.Errors:
+			if ok {
+				g.fail(errors.Wrapf(err, "failed to watch directory of %s", g.pattern))
+			}
+			return
+		case <-g.done:
+			return
+		}
+	}
+}
+
+// addFile begins reading the given file if it matches the pattern and isn't
+// already being read. A file which was removed before it could be read is
+// ignored.
+func (g *globReader) addFile(file string) error {
+	if matched, _ := filepath.Match(g.pattern, file); !matched {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.files[file]; ok {
+		// The file was recreated, e.g. by rotation, which its reader
+		// handles.
+		return nil
+	}
+	reader, info, err := g.newFileReader(file)
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil
+	}
+	if err != nil || reader == nil {
+		return err
+	}
+	g.files[file] = info
+	return g.add(reader)
+}
+
+// Close stops the directory watcher and all of the readers. Calling Close more
+// than once has no effect.
+func (g *globReader) Close() error {
+	err := g.multiReader.Close()
+	if g.watcher == nil {
+		return err
+	}
+	g.mu.Lock()
+	g.closed = true
+	watching := g.watching
+	g.mu.Unlock()
+	if watching {
+		// Closing the readers stops the watch loop, which closes the
+		// watcher.
+		<-g.stopped
+		return err
+	}
+	if werr := g.watcher.Close(); werr != nil && err == nil {
+		err = errors.Wrap(werr, "failed to close directory watcher")
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestGlobReader ensures logs are read from the files matching the pattern,
+// including files created after the reader is opened, but not from other files
+// or from a matching file renamed from one already being read.
+func TestGlobReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpmonitor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeLogs(t, filepath.Join(dir, "access.1.log"), 2, os.O_CREATE|os.O_WRONLY)
+	writeLogs(t, filepath.Join(dir, "access.2.log"), 1, os.O_CREATE|os.O_WRONLY)
+	writeLogs(t, filepath.Join(dir, "error.log"), 4, os.O_CREATE|os.O_WRONLY)
+
+	r, err := newGlobReader(filepath.Join(dir, "access.*.log"), fileReaderOpts{})
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	logs, err := openReader(r)
+	if err != nil {
+		t.Fatalf("Error opening reader: %v", err)
+	}
+	expectLogs(t, logs, 3)
+
+	// New matching files are read from the start and existing ones are still
+	// followed.
+	writeLogs(t, filepath.Join(dir, "access.3.log"), 2, os.O_CREATE|os.O_WRONLY)
+	expectLogs(t, logs, 2)
+	writeLogs(t, filepath.Join(dir, "access.1.log"), 1, os.O_APPEND|os.O_WRONLY)
+	writeLogs(t, filepath.Join(dir, "other.log"), 1, os.O_CREATE|os.O_WRONLY)
+	expectLogs(t, logs, 1)
+
+	// Renaming a file which is being read to a matching name doesn't read it
+	// again.
+	if err := os.Rename(filepath.Join(dir, "access.2.log"), filepath.Join(dir, "access.4.log")); err != nil {
+		t.Fatalf("Error renaming log file: %v", err)
+	}
+	expectLogs(t, logs, 0)
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("Error closing reader: %v", err)
+	}
+	select {
+	case _, ok := <-logs:
+		if ok {
+			t.Fatal("Expected no logs after closing")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected channel to be closed")
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+// TestGlobReaderNoFollow ensures only the files matching the pattern when the
+// reader is created are read to the end when it isn't following.
+func TestGlobReaderNoFollow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpmonitor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeLogs(t, filepath.Join(dir, "access.1.log"), 2, os.O_CREATE|os.O_WRONLY)
+	writeLogs(t, filepath.Join(dir, "access.2.log"), 3, os.O_CREATE|os.O_WRONLY)
+
+	m, err := New(filepath.Join(dir, "access.*.log"), MonitorOpts{
+		AlertWindow:    testAlertWindow,
+		NumTopSections: 1,
+		NoFollow:       true,
+		Output:         ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	writeLogs(t, filepath.Join(dir, "access.3.log"), 1, os.O_CREATE|os.O_WRONLY)
+	if err := m.Start(); err != nil {
+		t.Fatalf("Error running Monitor: %v", err)
+	}
+	if s := m.Snapshot(); s.TotalRequests != 5 {
+		t.Fatalf("Expected 5 requests, got %d", s.TotalRequests)
+	}
+}
+
+// TestGlobReaderInvalidPattern ensures patterns which are malformed or have
+// wildcards in their directory are rejected.
+func TestGlobReaderInvalidPattern(t *testing.T) {
+	for _, pattern := range []string{"/var/log/[access.log", "/var/*/access.log"} {
+		if _, err := newGlobReader(pattern, fileReaderOpts{}); err == nil {
+			t.Errorf("Expected error for pattern %s", pattern)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package monitor
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// haproxyTimeLayout is the layout of the accept date in the HAProxy HTTP log
+// format. HAProxy includes milliseconds, which time.Parse accepts after the
+// seconds even though the layout doesn't include them.
+const haproxyTimeLayout = "02/Jan/2006:15:04:05"
+
+// haproxyRegexp matches an entry in the HAProxy HTTP log format, i.e.
+// "client_ip:port [accept_date] frontend backend/server Tq/Tw/Tc/Tr/Tt status
+// bytes ... "request"", optionally preceded by a syslog header. It captures
+// the client IP, accept date, total time, status, bytes, and request. The
+// termination state, connection counts, queues, and captured headers between
+// the bytes and the request are skipped. The total time and bytes are
+// prefixed with a + if HAProxy logged the request before it completed. The
+// request's closing quote is optional since HAProxy truncates long requests.
+var haproxyRegexp = regexp.MustCompile(`(?:^|\s)(\S+):\d+ \[([^\]]+)\] \S+ \S+ -?\d+/-?\d+/-?\d+/-?\d+/\+?(-?\d+) (-?\d+) \+?(\d+) .* "([^"\n]*)`)
+
+// haproxyParser is a lineParser for the HAProxy HTTP log format.
+type haproxyParser struct{}
+
+// NewHAProxyReader returns a new reader for log files in the HAProxy HTTP log
+// format, e.g.:
+//
+//	10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 {1wt.eu} {} "GET /index.html HTTP/1.1"
+//
+// Lines may be prefixed with a syslog header, as they are when HAProxy logs
+// to syslog. The client IP, status, bytes, request, and total time, i.e. Tt,
+// or Ta in HAProxy 1.7 and later, are parsed, with the total time as the
+// response time. Timestamps are interpreted in the local time zone since
+// HAProxy doesn't log the offset.
+func NewHAProxyReader(file string) (Reader, error) {
+	return newFileReader(file, "HAProxy HTTP log format", haproxyParser{}, fileReaderOpts{})
+}
+
+// parse parses a single log line. It returns false if the line is not in the
+// HAProxy HTTP log format.
+func (haproxyParser) parse(line string) (*log, bool) {
+	parts := haproxyRegexp.FindStringSubmatch(line)
+	if len(parts) != 7 {
+		return nil, false
+	}
+	l := &log{
+		remoteAddr: normalizeAddr(parts[1]),
+		request:    strings.TrimSpace(parts[6]),
+	}
+
+	// If the timestamp can't be parsed, it's left as the zero time and the
+	// collector counts it as invalid.
+	l.timestamp, _ = time.ParseInLocation(haproxyTimeLayout, parts[2], time.Local)
+
+	// The total time and status are -1 if the connection was aborted before
+	// they were known, in which case they're left as zero.
+	if ms, err := strconv.ParseInt(parts[3], 10, 64); err == nil && ms > 0 {
+		l.responseTime = time.Duration(ms) * time.Millisecond
+	}
+	if status, err := strconv.Atoi(parts[4]); err == nil && status > 0 {
+		l.status = status
+	}
+	l.size, _ = strconv.ParseInt(parts[5], 10, 64)
+	return l, true
+}
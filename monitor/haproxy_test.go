@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestHAProxyParse ensures the client IP, timestamp, status, bytes, request,
+// and total time are parsed from HAProxy HTTP log entries, with or without a
+// syslog header, and that other lines are rejected.
+func TestHAProxyParse(t *testing.T) {
+	var p haproxyParser
+	for _, tc := range []struct {
+		line         string
+		client       string
+		status       int
+		size         int64
+		request      string
+		responseTime time.Duration
+	}{
+		{
+			line:         "10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 {1wt.eu} {} \"GET /index.html HTTP/1.1\"\n",
+			client:       "10.0.1.2",
+			status:       200,
+			size:         2750,
+			request:      "GET /index.html HTTP/1.1",
+			responseTime: 109 * time.Millisecond,
+		},
+		{
+			line:         "Feb  6 12:14:14 localhost haproxy[14389]: 2001:db8::1:40012 [06/Feb/2009:12:14:14.655] http-in~ api/srv2 0/0/1/-1/+5 503 +212 - - SC-- 2/2/0/0/3 0/0 \"POST /api/users HTTP/1.1\"\n",
+			client:       "2001:db8::1",
+			status:       503,
+			size:         212,
+			request:      "POST /api/users HTTP/1.1",
+			responseTime: 5 * time.Millisecond,
+		},
+		{
+			line:    "10.0.1.3:1024 [06/Feb/2009:12:14:14.655] http-in http-in/<NOSRV> -1/-1/-1/-1/-1 -1 0 - - CR-- 1/1/0/0/0 0/0 \"<BADREQ>\n",
+			client:  "10.0.1.3",
+			request: "<BADREQ>",
+		},
+	} {
+		l, ok := p.parse(tc.line)
+		if !ok {
+			t.Fatalf("Expected %q to parse", tc.line)
+		}
+		if l.remoteAddr != tc.client {
+			t.Errorf("Expected client %s, got %s", tc.client, l.remoteAddr)
+		}
+		if l.status != tc.status || l.size != tc.size {
+			t.Errorf("Expected status %d and size %d, got %d and %d", tc.status, tc.size, l.status, l.size)
+		}
+		if l.request != tc.request {
+			t.Errorf("Expected request %q, got %q", tc.request, l.request)
+		}
+		if l.responseTime != tc.responseTime {
+			t.Errorf("Expected response time %s, got %s", tc.responseTime, l.responseTime)
+		}
+		expected := time.Date(2009, time.February, 6, 12, 14, 14, 655000000, time.Local)
+		if !l.timestamp.Equal(expected) {
+			t.Errorf("Expected timestamp %s, got %s", expected, l.timestamp)
+		}
+	}
+
+	for _, line := range []string{
+		"127.0.0.1 - - [11/Oct/2000:14:32:52 -0700] \"GET / HTTP/1.1\" 200 10\n",
+		"10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69 200 2750 - - ---- \"GET / HTTP/1.1\"\n",
+		"10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ----\n",
+	} {
+		if _, ok := p.parse(line); ok {
+			t.Errorf("Expected %q to be rejected", line)
+		}
+	}
+}
+
+// TestMonitorHAProxy ensures HAProxy logs are collected and their total times
+// are recorded in the latency histogram.
+func TestMonitorHAProxy(t *testing.T) {
+	file, err := ioutil.TempFile("", "haproxy_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	now := time.Now().Format("02/Jan/2006:15:04:05.000")
+	fmt.Fprintf(file, "10.0.0.1:4000 [%s] fe be/s1 0/0/1/20/25 200 10 - - ---- 1/1/0/0/0 0/0 \"GET /pages/a HTTP/1.1\"\n", now)
+	fmt.Fprintf(file, "10.0.0.1:4001 [%s] fe be/s1 0/0/1/\n", now)
+	fmt.Fprintf(file, "10.0.0.2:4002 [%s] fe be/s2 0/0/1/90/100 503 20 - - ---- 1/1/0/0/0 0/0 \"POST /api HTTP/1.1\"\n", now)
+
+	reader, err := NewHAProxyReader(file.Name())
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	m, err := New("", MonitorOpts{
+		AlertWindow:         testAlertWindow,
+		NumTopSections:      2,
+		MalformedLinePolicy: CollectMalformedLines,
+		Reader:              reader,
+		Output:              ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	go func() {
+		time.Sleep(time.Second)
+		m.Stop()
+	}()
+	m.Start()
+
+	s := m.Snapshot()
+	if s.TotalRequests != 2 || s.StatusFreq.Successful != 1 || s.StatusFreq.ServerError != 1 {
+		t.Fatalf("Expected 1 successful and 1 failed request, got %d requests with %+v", s.TotalRequests, s.StatusFreq)
+	}
+	if s.LatencyHist.TotalCount() != 2 || s.LatencyHist.Max() < 99000 {
+		t.Fatalf("Expected 2 latencies up to 100ms, got %d up to %dus", s.LatencyHist.TotalCount(), s.LatencyHist.Max())
+	}
+	if lines := m.MalformedLines(); len(lines) != 1 {
+		t.Fatalf("Expected 1 malformed line, got %q", lines)
+	}
+}
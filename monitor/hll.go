@@ -0,0 +1,53 @@
+package monitor
+
+import (
+	"github.com/tylertreat/BoomFilters"
+)
+
+// numDistinctWindows is the number of HyperLogLogs a windowedHLL rotates
+// through. The estimate spans between (n-1)/n of the window and the full
+// window depending on when the last rotation was.
+const numDistinctWindows = 6
+
+// windowedHLL estimates the number of distinct elements added within a moving
+// window of time. Elements are added to the current HyperLogLog, and the
+// estimate merges all of them. Rotating resets the oldest and makes it the
+// current one, so it should be done every window / numDistinctWindows.
+type windowedHLL struct {
+	sketches []*boom.HyperLogLog
+	idx      int
+}
+
+// newWindowedHLL creates a windowedHLL with numDistinctWindows empty
+// HyperLogLogs.
+func newWindowedHLL() *windowedHLL {
+	w := &windowedHLL{sketches: make([]*boom.HyperLogLog, numDistinctWindows)}
+	for i := range w.sketches {
+		w.sketches[i], _ = boom.NewDefaultHyperLogLog(0.01)
+	}
+	return w
+}
+
+// Add adds the element to the current HyperLogLog.
+func (w *windowedHLL) Add(data []byte) {
+	w.sketches[w.idx].Add(data)
+}
+
+// Count returns the estimated number of distinct elements added within the
+// window.
+func (w *windowedHLL) Count() uint64 {
+	return mergeCount(w.sketches...)
+}
+
+// rotate resets the oldest HyperLogLog and makes it the current one.
+func (w *windowedHLL) rotate() {
+	w.idx = (w.idx + 1) % len(w.sketches)
+	w.sketches[w.idx].Reset()
+}
+
+// reset clears all of the HyperLogLogs.
+func (w *windowedHLL) reset() {
+	for _, hll := range w.sketches {
+		hll.Reset()
+	}
+}
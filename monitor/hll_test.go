@@ -0,0 +1,40 @@
+package monitor
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestWindowedHLL ensures elements are counted until they've been rotated out
+// of every HyperLogLog in the window.
+func TestWindowedHLL(t *testing.T) {
+	w := newWindowedHLL()
+	for i := 0; i < 10; i++ {
+		w.Add([]byte(fmt.Sprintf("%d.0.0.10", i)))
+	}
+	w.rotate()
+	for i := 5; i < 15; i++ {
+		w.Add([]byte(fmt.Sprintf("%d.0.0.10", i)))
+	}
+	if count := w.Count(); count != 15 {
+		t.Fatalf("Expected 15 distinct elements, got %d", count)
+	}
+
+	// The first elements expire once their HyperLogLog is rotated back in.
+	for i := 1; i < numDistinctWindows; i++ {
+		w.rotate()
+	}
+	if count := w.Count(); count != 10 {
+		t.Fatalf("Expected 10 distinct elements, got %d", count)
+	}
+	w.rotate()
+	if count := w.Count(); count != 0 {
+		t.Fatalf("Expected no distinct elements, got %d", count)
+	}
+
+	w.Add([]byte("1.0.0.10"))
+	w.reset()
+	if count := w.Count(); count != 0 {
+		t.Fatalf("Expected no distinct elements after reset, got %d", count)
+	}
+}
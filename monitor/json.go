@@ -0,0 +1,84 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// defaultJSONFieldMap maps the JSON keys of a typical nginx JSON access log to
+// log fields.
+var defaultJSONFieldMap = map[string]string{
+	"remote_addr":          "remoteAddr",
+	"remote_user":          "userID",
+	"time_local":           "timestamp",
+	"request":              "request",
+	"status":               "status",
+	"body_bytes_sent":      "size",
+	"http_referer":         "referer",
+	"http_user_agent":      "userAgent",
+	"http_x_forwarded_for": "forwardedFor",
+	"request_time":         "responseTime",
+}
+
+// jsonParser is a lineParser for logs consisting of one JSON object per line.
+type jsonParser struct {
+	fieldMap map[string]string
+}
+
+// NewJSONReader returns a new reader for log files consisting of one JSON
+// object per line. The fieldMap maps JSON keys to log fields, which are
+// remoteAddr, identity, userID, timestamp, request, status, size, referer,
+// userAgent, forwardedFor, responseTime, and level. JSON keys which aren't in
+// the fieldMap are ignored. If fieldMap is nil, the keys of a typical nginx
+// JSON access log are used, i.e. remote_addr, remote_user, time_local,
+// request, status, body_bytes_sent, http_referer, http_user_agent, and
+// request_time. Lines which are not valid JSON are counted and skipped.
+func NewJSONReader(file string, fieldMap map[string]string) (Reader, error) {
+	if fieldMap == nil {
+		fieldMap = defaultJSONFieldMap
+	}
+	for key, field := range fieldMap {
+		if _, ok := logFieldSetters[field]; !ok {
+			return nil, errors.Errorf("unknown log field %q for JSON key %q", field, key)
+		}
+	}
+	return newFileReader(file, "JSON format", &jsonParser{fieldMap: fieldMap}, fileReaderOpts{})
+}
+
+// parse parses a single log line. It returns false if the line is not a valid
+// JSON object or a mapped value could not be parsed.
+func (j *jsonParser) parse(line string) (*log, bool) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		return nil, false
+	}
+
+	l := new(log)
+	for key, field := range j.fieldMap {
+		value, ok := obj[key]
+		if !ok || value == nil {
+			continue
+		}
+		if err := logFieldSetters[field](l, jsonString(value)); err != nil {
+			return nil, false
+		}
+	}
+	return l, true
+}
+
+// jsonString returns the string representation of a decoded JSON value. This
+// allows numeric fields to be logged as either JSON numbers or strings.
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
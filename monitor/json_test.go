@@ -0,0 +1,43 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+// TestJSONParse ensures JSON log lines are mapped onto log fields and that
+// malformed lines are rejected.
+func TestJSONParse(t *testing.T) {
+	p := &jsonParser{fieldMap: defaultJSONFieldMap}
+	l, ok := p.parse(`{"remote_addr": "10.0.0.1", "time_local": "10/Oct/2000:13:55:36 -0700", ` +
+		`"request": "GET /pages/create HTTP/1.1", "status": "404", "body_bytes_sent": 512, "request_time": "0.250", "extra": true}`)
+	if !ok {
+		t.Fatal("Expected line to parse")
+	}
+	if l.remoteAddr != "10.0.0.1" {
+		t.Fatalf("Expected remote address 10.0.0.1, got %s", l.remoteAddr)
+	}
+	if l.request != "GET /pages/create HTTP/1.1" {
+		t.Fatalf("Expected request GET /pages/create HTTP/1.1, got %s", l.request)
+	}
+	if l.status != 404 || l.size != 512 {
+		t.Fatalf("Expected status 404 and size 512, got %d and %d", l.status, l.size)
+	}
+	if l.responseTime != 250*time.Millisecond {
+		t.Fatalf("Expected response time 250ms, got %s", l.responseTime)
+	}
+	expected := time.Date(2000, time.October, 10, 20, 55, 36, 0, time.UTC)
+	if !l.timestamp.Equal(expected) {
+		t.Fatalf("Expected timestamp %s, got %s", expected, l.timestamp)
+	}
+
+	for _, line := range []string{`{"remote_addr": "10.0.0.1"`, `not json`, `{"status": "abc"}`} {
+		if _, ok := p.parse(line); ok {
+			t.Fatalf("Expected line %q to be rejected", line)
+		}
+	}
+
+	if _, err := NewJSONReader("", map[string]string{"ip": "address"}); err == nil {
+		t.Fatal("Expected error for unknown log field")
+	}
+}
@@ -0,0 +1,189 @@
+package monitor
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// logfmtMethod, logfmtPath, and logfmtProtocol are pseudo log fields which
+	// logfmt keys can be mapped to. They're combined into the request field.
+	logfmtMethod   = "method"
+	logfmtPath     = "path"
+	logfmtProtocol = "protocol"
+
+	// logfmtDefaultProtocol is the protocol used for the request if the
+	// protocol isn't logged.
+	logfmtDefaultProtocol = "HTTP/1.1"
+)
+
+// defaultLogfmtKeyMap maps the keys of a typical logfmt access log to log
+// fields.
+var defaultLogfmtKeyMap = map[string]string{
+	"ip":         "remoteAddr",
+	"user":       "userID",
+	"time":       "timestamp",
+	"method":     logfmtMethod,
+	"path":       logfmtPath,
+	"proto":      logfmtProtocol,
+	"status":     "status",
+	"bytes":      "size",
+	"referer":    "referer",
+	"user_agent": "userAgent",
+	"duration":   "responseTime",
+}
+
+// logfmtParser is a lineParser for logs consisting of logfmt key=value pairs.
+type logfmtParser struct {
+	keyMap map[string]string
+}
+
+// NewLogfmtReader returns a new reader for log files in logfmt, i.e. space
+// separated key=value pairs such as:
+//
+//	method=GET path=/x status=200 bytes=512 ip=1.2.3.4
+//
+// Values may be quoted, in which case they're unquoted like Go string literals,
+// e.g. user_agent="curl \"7.64\"". The keyMap maps logfmt keys to log fields,
+// which are those accepted by NewJSONReader as well as method, path, and
+// protocol, which are combined into the request. Keys which aren't in the
+// keyMap are ignored. If keyMap is nil, ip, user, time, method, path, proto,
+// status, bytes, referer, user_agent, and duration are used. Lines without a
+// status and either a request or a method and path are malformed.
+func NewLogfmtReader(file string, keyMap map[string]string) (Reader, error) {
+	if keyMap == nil {
+		keyMap = defaultLogfmtKeyMap
+	}
+	mapped := make(map[string]bool, len(keyMap))
+	for key, field := range keyMap {
+		switch field {
+		case logfmtMethod, logfmtPath, logfmtProtocol:
+		default:
+			if _, ok := logFieldSetters[field]; !ok {
+				return nil, errors.Errorf("unknown log field %q for logfmt key %q", field, key)
+			}
+		}
+		mapped[field] = true
+	}
+	switch {
+	case !mapped["status"]:
+		return nil, errors.New("no logfmt key is mapped to status")
+	case !mapped["request"] && !(mapped[logfmtMethod] && mapped[logfmtPath]):
+		return nil, errors.New("no logfmt keys are mapped to request or to method and path")
+	}
+	return newFileReader(file, "logfmt", &logfmtParser{keyMap: keyMap}, fileReaderOpts{})
+}
+
+// parse parses a single log line. It returns false if the line isn't valid
+// logfmt, a mapped value could not be parsed, or a required key is missing.
+func (p *logfmtParser) parse(line string) (*log, bool) {
+	pairs, ok := parseLogfmt(line)
+	if !ok {
+		return nil, false
+	}
+
+	var (
+		l                      = new(log)
+		method, path, protocol string
+	)
+	for key, value := range pairs {
+		field, ok := p.keyMap[key]
+		if !ok || value == "" {
+			continue
+		}
+		switch field {
+		case logfmtMethod:
+			method = value
+		case logfmtPath:
+			path = value
+		case logfmtProtocol:
+			protocol = value
+		default:
+			if err := logFieldSetters[field](l, value); err != nil {
+				return nil, false
+			}
+		}
+	}
+
+	if l.request == "" {
+		l.request = joinRequest(method, path, protocol)
+	}
+	if l.request == "" || l.status == 0 {
+		return nil, false
+	}
+	return l, true
+}
+
+// joinRequest returns the request line for the given method, path, and
+// protocol, which defaults to HTTP/1.1 if it's empty. It returns an empty
+// string if the method or path is empty.
+func joinRequest(method, path, protocol string) string {
+	if method == "" || path == "" {
+		return ""
+	}
+	if protocol == "" {
+		protocol = logfmtDefaultProtocol
+	}
+	return method + " " + path + " " + protocol
+}
+
+// parseLogfmt returns the key/value pairs of a logfmt line. Keys without a
+// value have an empty value. It returns false if a key is empty or a quoted
+// value isn't terminated or has an invalid escape sequence.
+func parseLogfmt(line string) (map[string]string, bool) {
+	pairs := make(map[string]string)
+	i := 0
+	for {
+		for i < len(line) && isLogfmtSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return pairs, true
+		}
+
+		start := i
+		for i < len(line) && line[i] != '=' && !isLogfmtSpace(line[i]) {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			return nil, false
+		}
+		if i == len(line) || line[i] != '=' {
+			pairs[key] = ""
+			continue
+		}
+		i++
+
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for ; end < len(line) && line[end] != '"'; end++ {
+				if line[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(line) {
+				return nil, false
+			}
+			value, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				return nil, false
+			}
+			pairs[key] = value
+			i = end + 1
+			continue
+		}
+
+		start = i
+		for i < len(line) && !isLogfmtSpace(line[i]) {
+			i++
+		}
+		pairs[key] = line[start:i]
+	}
+}
+
+// isLogfmtSpace indicates if the byte separates logfmt pairs.
+func isLogfmtSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
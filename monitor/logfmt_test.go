@@ -0,0 +1,116 @@
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestLogfmtParse ensures logfmt lines, including quoted values with escaped
+// characters, are mapped onto log fields and that malformed lines are
+// rejected.
+func TestLogfmtParse(t *testing.T) {
+	p := &logfmtParser{keyMap: defaultLogfmtKeyMap}
+	l, ok := p.parse(`time=2000-10-10T20:55:36Z method=GET path=/pages/create status=404 bytes=512 ` +
+		`ip=10.0.0.1 duration=0.250 user_agent="curl \"7.64\"\tbeta" debug extra="a b"` + "\n")
+	if !ok {
+		t.Fatal("Expected line to parse")
+	}
+	if l.remoteAddr != "10.0.0.1" {
+		t.Fatalf("Expected remote address 10.0.0.1, got %s", l.remoteAddr)
+	}
+	if l.request != "GET /pages/create HTTP/1.1" {
+		t.Fatalf("Expected request GET /pages/create HTTP/1.1, got %s", l.request)
+	}
+	if l.status != 404 || l.size != 512 {
+		t.Fatalf("Expected status 404 and size 512, got %d and %d", l.status, l.size)
+	}
+	if l.responseTime != 250*time.Millisecond {
+		t.Fatalf("Expected response time 250ms, got %s", l.responseTime)
+	}
+	if l.userAgent != "curl \"7.64\"\tbeta" {
+		t.Fatalf("Expected unescaped user-agent, got %q", l.userAgent)
+	}
+	expected := time.Date(2000, time.October, 10, 20, 55, 36, 0, time.UTC)
+	if !l.timestamp.Equal(expected) {
+		t.Fatalf("Expected timestamp %s, got %s", expected, l.timestamp)
+	}
+
+	for _, line := range []string{
+		`method=GET path=/x`,                      // missing status
+		`status=200 bytes=12`,                     // missing request
+		`method=GET path=/x status=abc`,           // invalid status
+		`method=GET path=/x status=200 ua="curl`,  // unterminated quote
+		`method=GET path=/x status=200 ua="\q"`,   // invalid escape
+		`method=GET path=/x status=200 =orphaned`, // empty key
+	} {
+		if _, ok := p.parse(line); ok {
+			t.Fatalf("Expected line %q to be rejected", line)
+		}
+	}
+
+	custom := &logfmtParser{keyMap: map[string]string{"req": "request", "code": "status"}}
+	if l, ok := custom.parse(`req="POST /api HTTP/2.0" code=201`); !ok || l.request != "POST /api HTTP/2.0" || l.status != 201 {
+		t.Fatalf("Expected request POST /api HTTP/2.0 with status 201, got %+v", l)
+	}
+}
+
+// TestNewLogfmtReader ensures key maps with unknown fields or without the
+// required fields are rejected.
+func TestNewLogfmtReader(t *testing.T) {
+	for _, keyMap := range []map[string]string{
+		{"ip": "address", "status": "status", "req": "request"},
+		{"req": "request"},
+		{"status": "status", "path": "path"},
+	} {
+		if _, err := NewLogfmtReader("", keyMap); err == nil {
+			t.Fatalf("Expected error for key map %v", keyMap)
+		}
+	}
+}
+
+// TestMonitorLogfmt ensures a Monitor collects logs read in logfmt and applies
+// the malformed line policy to lines missing required keys.
+func TestMonitorLogfmt(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	now := time.Now().Format(time.RFC3339)
+	fmt.Fprintf(file, "time=%s method=GET path=/pages/a status=200 bytes=10 ip=10.0.0.1\n", now)
+	fmt.Fprintf(file, "time=%s method=GET path=/pages/b bytes=10 ip=10.0.0.1\n", now)
+	fmt.Fprintf(file, "time=%s method=POST path=/api status=503 bytes=20 ip=10.0.0.2\n", now)
+
+	reader, err := NewLogfmtReader(file.Name(), nil)
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	m, err := New("", MonitorOpts{
+		AlertWindow:         testAlertWindow,
+		NumTopSections:      2,
+		MalformedLinePolicy: CollectMalformedLines,
+		NoFollow:            true,
+		Reader:              reader,
+		Output:              ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	go func() {
+		time.Sleep(time.Second)
+		m.Stop()
+	}()
+	m.Start()
+
+	s := m.Snapshot()
+	if s.TotalRequests != 2 || s.StatusFreq.Successful != 1 || s.StatusFreq.ServerError != 1 {
+		t.Fatalf("Expected 1 successful and 1 failed request, got %d requests with %+v", s.TotalRequests, s.StatusFreq)
+	}
+	if lines := m.MalformedLines(); len(lines) != 1 {
+		t.Fatalf("Expected 1 malformed line, got %q", lines)
+	}
+}
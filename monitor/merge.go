@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"sort"
+
+	"github.com/codahale/hdrhistogram"
+	"github.com/tylertreat/BoomFilters"
+)
+
+// mergeElements merges the top-k elements of TopKs which each counted a share
+// of the same logs by summing their frequencies and returns the k most
+// frequent ordered as by sortElements. An element's frequency is
+// underestimated if it isn't among the top-k of every share, but since logs
+// are spread evenly across workers, the most frequent elements are in all of
+// them. A single list is copied, since TopK keeps updating its elements after
+// they're returned, and sorted.
+func mergeElements(k uint, lists ...[]*boom.Element) []*boom.Element {
+	if len(lists) == 1 {
+		elements := make([]*boom.Element, len(lists[0]))
+		for i, e := range lists[0] {
+			elements[i] = &boom.Element{Data: e.Data, Freq: e.Freq}
+		}
+		sortElements(elements)
+		return elements
+	}
+	scores := make(map[string]float64)
+	for _, elements := range lists {
+		for _, e := range elements {
+			scores[string(e.Data)] += float64(e.Freq)
+		}
+	}
+	return topScores(scores, k)
+}
+
+// sortElements sorts top-k elements in place from lowest to highest frequency.
+// Elements with equal frequencies are ordered by descending data, so reading
+// the list backwards, as the summary does, lists the most frequent elements
+// first and ties alphabetically. TopK orders ties arbitrarily, which would make
+// the summary unstable between runs.
+func sortElements(elements []*boom.Element) {
+	sort.Slice(elements, func(i, j int) bool {
+		if elements[i].Freq != elements[j].Freq {
+			return elements[i].Freq < elements[j].Freq
+		}
+		return string(elements[i].Data) > string(elements[j].Data)
+	})
+}
+
+// mergeCount returns the estimated number of distinct elements added to any
+// of the given HyperLogLogs, which must have the same precision.
+func mergeCount(hlls ...*boom.HyperLogLog) uint64 {
+	if len(hlls) == 1 {
+		return hlls[0].Count()
+	}
+	merged, _ := boom.NewDefaultHyperLogLog(0.01)
+	for _, hll := range hlls {
+		merged.Merge(hll)
+	}
+	return merged.Count()
+}
+
+// mergeHistograms returns a copy of the values recorded in all windows of the
+// given histograms.
+func mergeHistograms(hists ...*hdrhistogram.WindowedHistogram) *hdrhistogram.Histogram {
+	merged := hdrhistogram.Import(hists[0].Merge().Export())
+	for _, hist := range hists[1:] {
+		merged.Merge(hist.Merge())
+	}
+	return merged
+}
+
+// mergeFreqs returns the sum of the given frequencies.
+func mergeFreqs(freqs ...map[string]uint64) map[string]uint64 {
+	merged := make(map[string]uint64)
+	for _, f := range freqs {
+		for key, freq := range f {
+			merged[key] += freq
+		}
+	}
+	return merged
+}
+
+// add returns the sum of the status frequencies.
+func (s statusFreq) add(o statusFreq) statusFreq {
+	return statusFreq{
+		Informational: s.Informational + o.Informational,
+		Successful:    s.Successful + o.Successful,
+		Redirection:   s.Redirection + o.Redirection,
+		ClientError:   s.ClientError + o.ClientError,
+		ServerError:   s.ServerError + o.ServerError,
+	}
+}
@@ -0,0 +1,108 @@
+package monitor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/codahale/hdrhistogram"
+	"github.com/tylertreat/BoomFilters"
+)
+
+// TestMergeElements ensures the frequencies of elements from several TopKs are
+// summed and only the top-k are returned in ascending order.
+func TestMergeElements(t *testing.T) {
+	a := boom.NewTopK(0.001, 0.99, 2)
+	b := boom.NewTopK(0.001, 0.99, 2)
+	for _, data := range []string{"/a", "/a", "/a", "/b", "/b"} {
+		a.Add([]byte(data))
+	}
+	for _, data := range []string{"/a", "/a", "/b", "/b", "/c"} {
+		b.Add([]byte(data))
+	}
+
+	merged := mergeElements(2, a.Elements(), b.Elements())
+	if len(merged) != 2 {
+		t.Fatalf("Expected 2 elements, got %d", len(merged))
+	}
+	if string(merged[0].Data) != "/b" || merged[0].Freq != 4 {
+		t.Errorf("Expected /b with 4 hits, got %s with %d", merged[0].Data, merged[0].Freq)
+	}
+	if string(merged[1].Data) != "/a" || merged[1].Freq != 5 {
+		t.Errorf("Expected /a with 5 hits, got %s with %d", merged[1].Data, merged[1].Freq)
+	}
+
+	if single := a.Elements(); len(mergeElements(2, single)) != len(single) {
+		t.Errorf("Expected a single list to be returned as is")
+	}
+}
+
+// TestSortElements ensures elements are sorted by ascending frequency with
+// ties in reverse alphabetical order regardless of the order TopK returns.
+func TestSortElements(t *testing.T) {
+	topk := boom.NewTopK(0.001, 0.99, 5)
+	for _, data := range []string{"/d", "/b", "/e", "/a", "/c", "/a", "/c", "/e", "/e"} {
+		topk.Add([]byte(data))
+	}
+
+	elements := mergeElements(5, topk.Elements())
+	expected := []string{"/d", "/b", "/c", "/a", "/e"}
+	for i, e := range elements {
+		if string(e.Data) != expected[i] {
+			t.Fatalf("Expected order %v, got %s at %d", expected, e.Data, i)
+		}
+	}
+}
+
+// TestMergeCount ensures merging HyperLogLogs which each saw part of the same
+// elements gives the same estimate as a single HyperLogLog which saw all of
+// them.
+func TestMergeCount(t *testing.T) {
+	all, _ := boom.NewDefaultHyperLogLog(0.01)
+	shards := make([]*boom.HyperLogLog, 4)
+	for i := range shards {
+		shards[i], _ = boom.NewDefaultHyperLogLog(0.01)
+	}
+	for i := 0; i < 10000; i++ {
+		// Elements are repeated across shards.
+		data := []byte(fmt.Sprintf("10.0.%d.%d", i/256%20, i%256))
+		all.Add(data)
+		shards[i%len(shards)].Add(data)
+	}
+
+	if expected, count := all.Count(), mergeCount(shards...); count != expected {
+		t.Fatalf("Expected merged count %d, got %d", expected, count)
+	}
+	if count := shards[0].Count(); mergeCount(shards[0]) != count {
+		t.Fatalf("Expected count %d for a single HyperLogLog", count)
+	}
+}
+
+// TestMergeHistograms ensures merged histograms contain the values recorded in
+// every window of each histogram without modifying them.
+func TestMergeHistograms(t *testing.T) {
+	a := hdrhistogram.NewWindowed(2, 1, 1000, 3)
+	b := hdrhistogram.NewWindowed(2, 1, 1000, 3)
+	a.Current.RecordValue(10)
+	a.Rotate()
+	a.Current.RecordValue(20)
+	b.Current.RecordValue(30)
+
+	merged := mergeHistograms(a, b)
+	if merged.TotalCount() != 3 {
+		t.Fatalf("Expected 3 values, got %d", merged.TotalCount())
+	}
+	if merged.Max() != 30 {
+		t.Fatalf("Expected max 30, got %d", merged.Max())
+	}
+	if count := a.Merge().TotalCount(); count != 2 {
+		t.Fatalf("Expected the original histogram to keep 2 values, got %d", count)
+	}
+}
+
+// TestMergeFreqs ensures frequencies are summed by key.
+func TestMergeFreqs(t *testing.T) {
+	merged := mergeFreqs(map[string]uint64{"GET": 2, "POST": 1}, map[string]uint64{"GET": 3})
+	if merged["GET"] != 5 || merged["POST"] != 1 {
+		t.Fatalf("Expected 5 GET and 1 POST, got %v", merged)
+	}
+}
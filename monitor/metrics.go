@@ -0,0 +1,152 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// metricsNamespace prefixes the names of all exported metrics.
+const metricsNamespace = "httpmonitor"
+
+// metricsQuantiles are the response size quantiles exported as metrics.
+var metricsQuantiles = []float64{50, 90, 99}
+
+// metricsServer serves metrics over HTTP.
+type metricsServer struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+// newMetricsServer creates a metricsServer listening on the given address
+// which serves metrics for the Monitor at /metrics. It does not begin serving
+// until start is called.
+func newMetricsServer(addr string, m *Monitor) (*metricsServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen")
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.MetricsHandler())
+	return &metricsServer{
+		listener: listener,
+		server:   &http.Server{Handler: mux},
+	}, nil
+}
+
+// start serving metrics until stop is called.
+func (s *metricsServer) start() {
+	go s.server.Serve(s.listener)
+}
+
+// stop serving metrics and close the listener.
+func (s *metricsServer) stop() {
+	s.server.Close()
+	// Close the listener in case the server was never started.
+	s.listener.Close()
+}
+
+// MetricsHandler returns an http.Handler which serves the current traffic data
+// in the Prometheus text exposition format. This can be used to expose
+// metrics on an existing HTTP server instead of setting MetricsAddr.
+func (m *Monitor) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, m.Snapshot())
+	})
+}
+
+// writeMetrics writes the summary data in the Prometheus text exposition
+// format.
+func writeMetrics(w io.Writer, s *Summary) error {
+	buf := bufio.NewWriter(w)
+	writeMetric(buf, "hits_per_second", "gauge", "Number of hits in the last second.", "", float64(s.HitsPerSecond))
+	writeMetric(buf, "hits_average", "gauge", "Average hits per second over the alert window.", "", s.AvgHits)
+	writeMetric(buf, "bytes_per_second", "gauge", "Number of response bytes in the last second.", "",
+		float64(s.BytesPerSecond))
+	writeMetric(buf, "bytes_average", "gauge", "Average response bytes per second over the alert window.", "",
+		s.AvgBytes)
+	if !s.DistinctIPsDisabled {
+		writeMetric(buf, "distinct_ips", "gauge", "Estimated number of distinct remote IP addresses.", "",
+			float64(s.DistinctIPs))
+	}
+	if !s.DistinctPathsDisabled {
+		writeMetric(buf, "distinct_paths", "gauge", "Estimated number of distinct request paths.", "",
+			float64(s.DistinctPaths))
+	}
+	writeMetric(buf, "skipped_lines_total", "counter", "Number of log lines skipped because they could not be parsed.", "",
+		float64(s.SkippedLines))
+	writeMetric(buf, "invalid_timestamps_total", "counter", "Number of logs with a missing or unparseable timestamp.", "",
+		float64(s.InvalidTimestamps))
+	writeMetric(buf, "malformed_requests_total", "counter", "Number of logs with a malformed request line.", "",
+		float64(s.MalformedRequests))
+	writeMetric(buf, "ignored_requests_total", "counter", "Number of logs whose request path matched an ignore pattern.", "",
+		float64(s.IgnoredRequests))
+
+	writeMetric(buf, "success_ratio", "gauge", "Fraction of responses which weren't errors.", "", s.SuccessRate)
+
+	writeMetricHeader(buf, "responses_total", "counter", "Number of responses by status class.")
+	for _, class := range []struct {
+		label string
+		count uint64
+	}{
+		{"1xx", s.StatusFreq.Informational},
+		{"2xx", s.StatusFreq.Successful},
+		{"3xx", s.StatusFreq.Redirection},
+		{"4xx", s.StatusFreq.ClientError},
+		{"5xx", s.StatusFreq.ServerError},
+	} {
+		writeSample(buf, "responses_total", fmt.Sprintf(`class="%s"`, class.label), float64(class.count))
+	}
+
+	if s.SizeHist != nil {
+		writeMetricHeader(buf, "response_size_bytes", "summary", "Size of responses in bytes.")
+		for _, q := range metricsQuantiles {
+			writeSample(buf, "response_size_bytes", fmt.Sprintf(`quantile="%g"`, q/100),
+				float64(s.SizeHist.ValueAtQuantile(q)))
+		}
+		count := s.SizeHist.TotalCount()
+		writeSample(buf, "response_size_bytes_sum", "", s.SizeHist.Mean()*float64(count))
+		writeSample(buf, "response_size_bytes_count", "", float64(count))
+	}
+
+	// Response times are only available from some readers.
+	if s.LatencyHist != nil && s.LatencyHist.TotalCount() > 0 {
+		writeMetricHeader(buf, "response_time_seconds", "summary", "Time taken to serve requests in seconds.")
+		for _, q := range metricsQuantiles {
+			writeSample(buf, "response_time_seconds", fmt.Sprintf(`quantile="%g"`, q/100),
+				microseconds(s.LatencyHist.ValueAtQuantile(q)).Seconds())
+		}
+		count := s.LatencyHist.TotalCount()
+		writeSample(buf, "response_time_seconds_sum", "",
+			s.LatencyHist.Mean()*float64(count)*time.Microsecond.Seconds())
+		writeSample(buf, "response_time_seconds_count", "", float64(count))
+	}
+	return buf.Flush()
+}
+
+// writeMetric writes a metric with a single sample.
+func writeMetric(w io.Writer, name, typ, help, labels string, value float64) {
+	writeMetricHeader(w, name, typ, help)
+	writeSample(w, name, labels, value)
+}
+
+// writeMetricHeader writes the HELP and TYPE lines for a metric.
+func writeMetricHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s_%s %s\n", metricsNamespace, name, help)
+	fmt.Fprintf(w, "# TYPE %s_%s %s\n", metricsNamespace, name, typ)
+}
+
+// writeSample writes a single metric sample with the given labels, which may
+// be empty.
+func writeSample(w io.Writer, name, labels string, value float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_%s%s %g\n", metricsNamespace, name, labels, value)
+}
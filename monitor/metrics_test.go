@@ -0,0 +1,44 @@
+package monitor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/codahale/hdrhistogram"
+)
+
+// TestWriteMetrics ensures summary data is written in the Prometheus text
+// exposition format.
+func TestWriteMetrics(t *testing.T) {
+	s := &Summary{
+		DistinctIPs:   7,
+		HitsPerSecond: 3,
+		AvgHits:       1.5,
+		StatusFreq:    statusFreq{Successful: 10, ServerError: 2},
+		SizeHist:      hdrhistogram.New(1, maxRecordableSize, 5),
+	}
+	s.SizeHist.RecordValue(100)
+	s.SizeHist.RecordValue(300)
+
+	var buf bytes.Buffer
+	if err := writeMetrics(&buf, s); err != nil {
+		t.Fatalf("Error writing metrics: %v", err)
+	}
+	metrics := buf.String()
+	for _, expected := range []string{
+		"# TYPE httpmonitor_hits_per_second gauge\nhttpmonitor_hits_per_second 3\n",
+		"httpmonitor_hits_average 1.5\n",
+		"httpmonitor_distinct_ips 7\n",
+		"# TYPE httpmonitor_responses_total counter\n",
+		`httpmonitor_responses_total{class="2xx"} 10` + "\n",
+		`httpmonitor_responses_total{class="5xx"} 2` + "\n",
+		`httpmonitor_response_size_bytes{quantile="0.99"} 300` + "\n",
+		"httpmonitor_response_size_bytes_sum 400\n",
+		"httpmonitor_response_size_bytes_count 2\n",
+	} {
+		if !strings.Contains(metrics, expected) {
+			t.Fatalf("Expected metrics to contain %q, got:\n%s", expected, metrics)
+		}
+	}
+}
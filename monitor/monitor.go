@@ -4,152 +4,1472 @@
 package monitor
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/codahale/hdrhistogram"
 	"github.com/pkg/errors"
+	"github.com/tylertreat/BoomFilters"
 )
 
-// quantum is the granularity of time-series measurements.
-const quantum = time.Second
+const (
+	// defaultQuantum is the default granularity of time-series measurements.
+	defaultQuantum = time.Second
+
+	// defaultNumTopCountries is the default number of top countries tracked
+	// when a GeoIP database is configured.
+	defaultNumTopCountries = 5
+
+	// defaultHistogramRotationInterval is the default interval at which the
+	// response size and latency histograms are rotated.
+	defaultHistogramRotationInterval = time.Minute
+
+	// defaultAnomalyQuantile is the default quantile compared by anomaly
+	// alerts.
+	defaultAnomalyQuantile = 99
+
+	// defaultMaxCardinality is the default maximum number of distinct values
+	// counted by each frequency map, e.g. of methods.
+	defaultMaxCardinality = 100
+
+	// defaultHitsBufferSize is the default number of hits buffered between
+	// aggregating logs and averaging the hits.
+	defaultHitsBufferSize = 1024
+
+	// defaultPushgatewayJob is the default job label of metrics pushed to a
+	// Pushgateway.
+	defaultPushgatewayJob = "httpmonitor"
+)
 
 // Alert is used to emit traffic alert notifications.
 type Alert struct {
-	Recovered bool
-	AvgHits   float64
-	Time      time.Time
+	Recovered bool      `json:"recovered"`
+	AvgHits   float64   `json:"avg_hits"`
+	Time      time.Time `json:"time"`
+
+	// Duration is how long traffic has exceeded the threshold. For a
+	// recovery, this is how long the high traffic condition lasted.
+	Duration time.Duration `json:"duration"`
+
+	// Throughput indicates the alert is for throughput exceeding the
+	// ThroughputThreshold rather than hits exceeding the AlertThreshold.
+	// AvgBytes is the average throughput in bytes per second over the alert
+	// window and is only set for throughput alerts.
+	Throughput bool    `json:"throughput"`
+	AvgBytes   float64 `json:"avg_bytes,omitempty"`
+
+	// Errors indicates the alert is for error log entries exceeding the
+	// ErrorThreshold. AvgErrors is the average number of error-level entries
+	// per second over the alert window and is only set for error alerts.
+	Errors    bool    `json:"errors,omitempty"`
+	AvgErrors float64 `json:"avg_errors,omitempty"`
+
+	// Status is the pattern of the watched status the alert is for, e.g.
+	// "429", if any. AvgStatus is the average number of responses per second
+	// matching the pattern over the alert window and is only set for watched
+	// status alerts.
+	Status    string  `json:"status,omitempty"`
+	AvgStatus float64 `json:"avg_status,omitempty"`
+
+	// Anomaly is the distribution the alert is for, "size" or "latency", if
+	// it's for the AnomalyQuantile of the current histogram window exceeding
+	// AnomalyFactor times the baseline. Quantile is the value of the quantile
+	// in the current window, in bytes or microseconds, Baseline is its value
+	// in the baseline, and Ratio is between the two. These are only set for
+	// anomaly alerts.
+	Anomaly  string  `json:"anomaly,omitempty"`
+	Quantile int64   `json:"quantile,omitempty"`
+	Baseline int64   `json:"baseline,omitempty"`
+	Ratio    float64 `json:"ratio,omitempty"`
+
+	// MaxHits is the highest hits/s of any quantum within the alert window.
+	// It's only set for traffic alerts if AlertOnMaxHits is set, in which case
+	// it's what exceeded the AlertThreshold rather than AvgHits.
+	MaxHits float64 `json:"max_hits,omitempty"`
+
+	// LowTraffic indicates the alert is for hits falling below the
+	// LowTrafficThreshold rather than exceeding the AlertThreshold.
+	LowTraffic bool `json:"low_traffic,omitempty"`
+
+	// Rule is the name of the AlertRule which emitted the alert, if any. The
+	// metric's average is set in the field for the kind of metric, e.g.
+	// AvgErrors for MetricErrors.
+	Rule string `json:"rule,omitempty"`
+
+	// TopSections and TopIPs are the most frequent sections and remote IP
+	// addresses, from most to least frequent, when a high traffic alert was
+	// triggered, which show what's driving the traffic. They're only set for
+	// triggered high traffic alerts and if top sections or IPs are tracked.
+	TopSections []TopElement `json:"top_sections,omitempty"`
+	TopIPs      []TopElement `json:"top_ips,omitempty"`
+}
+
+// TopElement is one of the most frequent values of a top-k list, e.g. a
+// section, and its hits.
+type TopElement struct {
+	Value string `json:"value"`
+	Hits  uint64 `json:"hits"`
+}
+
+// topElements returns the given top-k elements, which are ordered from lowest
+// to highest frequency, from most to least frequent.
+func topElements(elements []*boom.Element) []TopElement {
+	if len(elements) == 0 {
+		return nil
+	}
+	top := make([]TopElement, 0, len(elements))
+	for i := len(elements) - 1; i >= 0; i-- {
+		top = append(top, TopElement{Value: string(elements[i].Data), Hits: elements[i].Freq})
+	}
+	return top
 }
 
 // MonitorOpts contains options for configuring a Monitor.
 type MonitorOpts struct {
-	NumTopSections    uint
+	NumTopSections   uint
+	NumTopIPs        uint
+	NumTopUserAgents uint
+
+	// GeoIPDatabase, if set, is the path of a MaxMind DB file, such as
+	// GeoLite2-Country, used to locate remote IP addresses so that the
+	// NumTopCountries most frequent countries are tracked. If the database
+	// can't be opened, a warning is written to Output and countries aren't
+	// tracked. NumTopCountries defaults to 5 if GeoIPDatabase is set.
+	GeoIPDatabase     string
+	NumTopCountries   uint
 	AlertWindow       time.Duration
 	AlertThreshold    float64
 	AlertHook         chan<- Alert
 	ReportingInterval time.Duration
 	Output            io.Writer
+
+	// LogHook, if set, is called with each log entry once it has been
+	// collected. It's called synchronously, so a slow hook backpressures the
+	// reader and delays collection of subsequent logs.
+	LogHook func(Log)
+
+	// Reader, if set, is used to read logs instead of a Common Log Format
+	// reader on the file passed to New.
+	Reader Reader
+
+	// HistogramRotationInterval is the interval at which the response size
+	// and latency histograms are rotated. The histograms keep three windows,
+	// so their statistics reflect roughly the last three intervals. Defaults
+	// to one minute.
+	HistogramRotationInterval time.Duration
+
+	// UseForwardedFor causes the client IP address used for distinct and top
+	// IPs and countries to be taken from the X-Forwarded-For field, if the log
+	// has one, rather than the remote address, e.g. when behind a load
+	// balancer. If the field has multiple addresses, the left-most, i.e. the
+	// original client, is used. The field is read from a quoted field after
+	// the user-agent in Combined Log Format, as in nginx's default format, the
+	// cs(X-Forwarded-For) field in W3C format, or the field mapped to
+	// "forwardedFor" in JSON logs.
+	UseForwardedFor bool
+
+	// SectionDepth is the number of path segments which make up a section,
+	// e.g. with a depth of 2, the section for "/api/v2/users" is "/api/v2".
+	// Defaults to 1.
+	SectionDepth uint
+
+	// MaxCardinality is the maximum number of distinct values counted by the
+	// frequency maps, e.g. of methods, protocols, and levels, to bound the
+	// memory used by crafted or buggy logs with many distinct values. Once a
+	// map is full, new values are counted under "(other)". The cap applies to
+	// each worker's maps, so merged summaries may show up to Workers times as
+	// many values. Defaults to 100.
+	MaxCardinality uint
+
+	// SectionQuery controls whether requests' query strings distinguish their
+	// sections: StripQuery ignores them, MarkQuery appends "?" if there is
+	// one, and SectionQueryParams appends the names of the parameters in
+	// SectionQueryParams which are present. Defaults to StripQuery.
+	SectionQuery SectionQueryMode
+
+	// SectionQueryParams are the query parameter names appended to sections
+	// if SectionQuery is SectionQueryParams, e.g. "q" so that searches are
+	// distinguished from browsing a listing.
+	SectionQueryParams []string
+
+	// NormalizePathIDs replaces the segments of request paths which are IDs
+	// with ":id" before they're counted as distinct paths and sections, e.g.
+	// "/users/12345/orders/9" is counted as "/users/:id/orders/:id". This
+	// gives a route-level view of APIs whose paths contain IDs.
+	NormalizePathIDs bool
+
+	// PathIDPatterns are regular expressions which a path segment must match
+	// in its entirety to be normalized by NormalizePathIDs. Defaults to
+	// decimal numbers and UUIDs.
+	PathIDPatterns []string
+
+	// SectionsByMethod prefixes sections with the request method, e.g.
+	// "GET /orders" and "POST /orders", so that the top sections distinguish
+	// reads from writes of the same endpoint. Defaults to false, i.e. sections
+	// are counted regardless of method.
+	SectionsByMethod bool
+
+	// SectionDecayInterval, if positive, is the interval at which the top
+	// sections are decayed so that they reflect recent activity rather than
+	// the entire run, e.g. the ReportingInterval. On each interval, the
+	// previous section hits are multiplied by SectionDecay and the hits from
+	// the interval are added. If zero, sections are counted over the entire
+	// run.
+	SectionDecayInterval time.Duration
+
+	// SectionDecay is the factor, within [0, 1), by which previous section
+	// hits are multiplied on each SectionDecayInterval. Zero means only the
+	// last complete interval and the current one are reflected.
+	SectionDecay float64
+
+	// NoFollow causes the Monitor to write a final summary and stop once it
+	// reaches the end of the file passed to New rather than waiting for new
+	// logs to be appended.
+	NoFollow bool
+
+	// Reverse causes the file passed to New to be read from the last line to
+	// the first, so that summaries of the most recent activity in a large
+	// file are available quickly. It requires NoFollow and only applies to
+	// uncompressed files; URLs and named pipes are still read from the start,
+	// and it has no effect if Reader is set. Since logs are then assumed to be
+	// sorted newest first, the Monitor stops once it processes a log before
+	// StartTime rather than after EndTime.
+	Reverse bool
+
+	// SummaryOnStop causes a final summary of the whole run to be written to
+	// Output when the Monitor is stopped, e.g. by Stop or by canceling the
+	// context passed to StartContext, in addition to the periodic summaries.
+	// If NoFollow is set, the final summary is written regardless.
+	SummaryOnStop bool
+
+	// FileWaitTimeout, if positive, is how long to wait for the file passed
+	// to New to be created if it doesn't exist yet, e.g. because the web
+	// server hasn't written its first log. If the file isn't created in time,
+	// Start returns an error. If zero, a missing file causes New to fail. It
+	// has no effect if Reader is set.
+	FileWaitTimeout time.Duration
+
+	// AlertTemplate and RecoveryTemplate, if set, are text/template templates
+	// for the messages written to Output when an alert triggers or recovers.
+	// They're executed with the Alert's fields, e.g. {{.AvgHits}}, {{.Time}},
+	// and {{.Throughput}}, as well as {{.Window}}, the AlertWindow, and
+	// {{.Threshold}}, the threshold for the kind of alert. If unset, the
+	// default messages are used.
+	AlertTemplate    string
+	RecoveryTemplate string
+
+	// AlertWebhook, if set, is a URL to which each Alert is POSTed as JSON.
+	// Failed deliveries are retried with backoff in the background so they
+	// don't delay alert evaluation. Alerts are still sent to AlertHook.
+	AlertWebhook string
+
+	// SlackWebhookURL, if set, is a Slack incoming webhook URL to which each
+	// Alert is posted as a message. SlackChannel and SlackUsername optionally
+	// override the webhook's default channel and username. Like AlertWebhook,
+	// failed deliveries are retried in the background and don't affect
+	// monitoring.
+	SlackWebhookURL string
+	SlackChannel    string
+	SlackUsername   string
+
+	// MetricsAddr, if set, is the address on which to serve metrics in the
+	// Prometheus text exposition format at /metrics.
+	MetricsAddr string
+
+	// APIAddr, if set, is the address on which to serve the HTTP API, which
+	// returns the current Summary as JSON at GET /summary and the Monitor's
+	// own Stats at GET /debug, and responds to health checks at GET /healthz
+	// according to Health. The server is shut down when the Monitor stops.
+	APIAddr string
+
+	// HealthStaleness, if positive, is how long the Monitor may go without
+	// reading a log before Health reports it as unhealthy, e.g. because the
+	// file stopped being watched. It should exceed the longest expected lull
+	// in traffic. It has no effect if NoFollow is set.
+	HealthStaleness time.Duration
+
+	// PushgatewayURL, if set, is the base URL of a Prometheus Pushgateway,
+	// e.g. http://localhost:9091, to which the final metrics are pushed when
+	// the Monitor stops, including once the end of the file is reached if
+	// NoFollow is set. This suits batch runs where there's nothing to scrape.
+	// The metrics replace those in the group identified by PushgatewayJob and
+	// PushgatewayInstance. Failures to push are written to Output.
+	PushgatewayURL string
+
+	// PushgatewayJob is the job label of the pushed metrics. Defaults to
+	// "httpmonitor".
+	PushgatewayJob string
+
+	// PushgatewayInstance, if set, is the instance label of the pushed
+	// metrics.
+	PushgatewayInstance string
+
+	// AlertOnMaxHits causes the AlertThreshold to be compared against the
+	// highest hits/s of any quantum within the alert window rather than the
+	// average, so that short spikes trigger the alert even if they don't
+	// raise the average much. The low traffic alert still uses the average.
+	AlertOnMaxHits bool
+
+	// LowTrafficThreshold, if positive, is the average number of hits per
+	// second over the alert window below which a low traffic Alert is
+	// triggered, e.g. because a frontend is down. Like other alerts, it isn't
+	// evaluated until a full window has been collected, so startup doesn't
+	// trigger it. To avoid flapping, it only recovers once the average exceeds
+	// the threshold by 20%, and it's subject to the same AlertCooldown.
+	// Defaults to zero, i.e. disabled.
+	LowTrafficThreshold float64
+
+	// ThroughputThreshold, if positive, is the average throughput in bytes per
+	// second over the alert window above which a throughput Alert is
+	// triggered. It recovers like the hits alert and is subject to the same
+	// AlertCooldown. Defaults to zero, i.e. disabled.
+	ThroughputThreshold float64
+
+	// WatchedStatuses are status codes or patterns, e.g. "429" or "5xx", for
+	// which exact counts are kept regardless of SampleRate and, if a threshold
+	// is set, a separate Alert is triggered when matching responses exceed it.
+	WatchedStatuses []StatusWatch
+
+	// ErrorThreshold, if positive, is the average number of error log entries
+	// per second at the error level or above, i.e. error, crit, alert, or
+	// emerg, over the alert window above which an error Alert is triggered.
+	// This requires a Reader for error logs, e.g. NewApacheErrorLogReader.
+	// Defaults to zero, i.e. disabled.
+	ErrorThreshold float64
+
+	// MinLevel, if set, is the log level, e.g. "warn", below which entries are
+	// ignored entirely, i.e. they don't count towards hits or any other
+	// statistic. Levels are ranked from trace, debug, info, notice, warn,
+	// error, crit, alert, to emerg, and common aliases such as warning and
+	// fatal are accepted. Entries without a level or with an unrecognized
+	// one are kept. This requires a Reader whose format includes a level,
+	// e.g. an error log or a JSON, logfmt, or regexp reader with a field
+	// mapped to level. Defaults to empty, i.e. nothing is filtered.
+	MinLevel string
+
+	// AlertRules are additional alerts, each on the average of a metric over
+	// its own window with its own threshold and cooldown. They're evaluated
+	// independently of each other and of the alerts configured above, and
+	// the Alerts they emit are tagged with the rule's name.
+	AlertRules []AlertRule
+
+	// AlertCooldown is the minimum time between alert state changes. A
+	// triggered alert won't recover, and a recovered alert won't trigger
+	// again, until at least this long has elapsed since the last change. This
+	// prevents flapping when traffic hovers around the threshold. Defaults to
+	// zero, i.e. no cooldown.
+	AlertCooldown time.Duration
+
+	// SizeQuantiles are the quantiles of the response size reported in the
+	// summary, e.g. 99.9 for the p99.9 response size. Each must be within
+	// (0, 100]. They're reported in ascending order. Defaults to 50 and 99.
+	SizeQuantiles []float64
+
+	// ClientErrorsAsFailures causes 4xx responses to count against the
+	// summary's SuccessRate in addition to 5xx responses. By default, client
+	// errors are considered successful since they're usually caused by
+	// clients rather than the service.
+	ClientErrorsAsFailures bool
+
+	// SizeBuckets are the upper bounds in bytes of the ranges of response
+	// sizes for which responses are counted, e.g. 1000 for responses under
+	// 1KB. A final bucket counts responses at least as large as the largest
+	// bound. Each must be positive and they must be distinct. Defaults to
+	// 1000, 10000, and 100000.
+	SizeBuckets []int64
+
+	// TimestampLayout, if set, is the layout used to parse log timestamps, as
+	// accepted by time.Parse, instead of the standard Common Log Format
+	// layout. Logs whose timestamp can't be parsed are counted as invalid and
+	// treated as if they occurred when they were read. It has no effect if
+	// Reader is set.
+	TimestampLayout string
+
+	// MalformedLinePolicy controls how lines which aren't in the expected
+	// format are handled: skipped, collected for inspection with
+	// MalformedLines, or treated as an error which stops the Monitor. It
+	// applies to the readers in this package, including a Reader set in
+	// Reader. Defaults to SkipMalformedLines.
+	MalformedLinePolicy MalformedLinePolicy
+
+	// SampleRate is the fraction of logs, within (0, 1], which are sampled
+	// for the more expensive aggregations at very high volumes. The hit
+	// counts and rates, skipped lines, and invalid timestamps are exact. All
+	// other stats, including top-k lists, distinct counts, status and method
+	// frequencies, malformed requests, and response size and latency
+	// distributions, only reflect the sampled logs. Throughput is scaled to
+	// estimate the total. Defaults to 1, which samples every log.
+	SampleRate float64
+
+	// AnomalyFactor, if positive, enables anomaly alerts, which trigger when
+	// the AnomalyQuantile of response sizes, or of response times if the
+	// Reader supplies them, in the current histogram window exceeds this
+	// multiple of the same quantile in the previous windows. Since the windows
+	// rotate every HistogramRotationInterval, the baseline moves more slowly
+	// than the current window, so this catches gradual degradation which
+	// static thresholds miss. Quantiles aren't compared until the current
+	// window and the baseline each have a minimum number of values. Must be
+	// greater than 1.
+	AnomalyFactor float64
+
+	// AnomalyQuantile is the quantile, within (0, 100], compared by anomaly
+	// alerts. Defaults to 99.
+	AnomalyQuantile float64
+
+	// DistinctIPWindow, if positive, causes Summary.DistinctIPs to estimate
+	// the distinct IP addresses seen within roughly this window of time
+	// rather than since the Monitor started, so that it reflects current
+	// visitors. The window is divided into several intervals which are
+	// rotated out as they expire, so the estimate spans at least 5/6 of the
+	// window. The count since the Monitor started is still available as
+	// Summary.TotalDistinctIPs.
+	DistinctIPWindow time.Duration
+
+	// StatusWindow, if positive, causes Summary.RecentStatusFreq to count the
+	// responses by status class within roughly this window of time, so that
+	// it reflects whether errors are happening now. Like DistinctIPWindow,
+	// the window is divided into several intervals which are rotated out as
+	// they expire. Summary.StatusFreq still counts them since the Monitor
+	// started.
+	StatusWindow time.Duration
+
+	// Color causes server error counts in summaries to be shown in red,
+	// client error counts in yellow, and alerts in red or, once recovered,
+	// green using ANSI escape codes. It only takes effect if Output is a
+	// terminal and the NO_COLOR environment variable isn't set, so that
+	// escape codes aren't written to files.
+	Color bool
+
+	// StartTime and EndTime, if set, restrict the logs which are processed to
+	// those whose timestamp is within the inclusive range, e.g. to analyze an
+	// incident in an archived log. Logs outside the range are skipped
+	// entirely, as are logs whose timestamp is invalid since they can't be
+	// placed in the range. If NoFollow is set, logs are assumed to be sorted
+	// by time, so the Monitor stops once it processes a log past EndTime
+	// rather than reading the rest of the file.
+	StartTime time.Time
+	EndTime   time.Time
+
+	// IgnorePatterns are regular expressions matched against request paths,
+	// excluding the query string. Matching requests, such as health checks,
+	// still count towards the total requests and the hit rate, and so towards
+	// the hit alert, but are otherwise excluded from all aggregations,
+	// including top-k lists, distinct counts, throughput, and status
+	// frequencies. They're counted in Summary.IgnoredRequests.
+	IgnorePatterns []string
+
+	// Workers is the number of goroutines which aggregate logs in parallel.
+	// Each worker aggregates its share of the logs into its own sketches,
+	// histograms, and counters, which are merged when a summary is taken, so
+	// that workers don't contend on a single lock. Hit counts, distinct
+	// counts, and distributions are unaffected by merging, but a top-k
+	// element's frequency may be underestimated if it isn't among the top-k
+	// of every worker. Logs may be aggregated out of order. Defaults to 1.
+	Workers int
+
+	// ReportDeltas causes the periodic summaries to show how the counters,
+	// such as total requests, distinct IPs, and status frequencies, changed
+	// since the previous summary rather than their totals. Rates, top-k lists,
+	// and response size and latency distributions are still shown as
+	// absolute values. The first summary shows totals. See
+	// Summary.DeltaString.
+	ReportDeltas bool
+
+	// CSVFile, if set, is the path of a file to which each summary is
+	// appended as a CSV row every ReportingInterval. The row contains the
+	// timestamp, hits/s, average hits, distinct IPs, and status counts. A
+	// header row is written if the file is new or empty.
+	CSVFile string
+
+	// StatsdAddr, if set, is the address of a statsd or DogStatsD server to
+	// which summary data is sent over UDP every ReportingInterval. Metrics
+	// are tagged with the log file name in DogStatsD format. Failures to send
+	// are written to Output and don't affect monitoring.
+	StatsdAddr string
+
+	// AlertEvalInterval is how often the averages are checked against the
+	// alert thresholds. Defaults to twice the Quantum.
+	AlertEvalInterval time.Duration
+
+	// Quantum is the granularity of time-series measurements, i.e. the size
+	// of the buckets used to average hits over the alert window. Smaller
+	// quanta give finer resolution at the cost of memory. AlertWindow may not
+	// be less than Quantum. Defaults to one second.
+	Quantum time.Duration
+
+	// DisableDistinctIPs, DisableDistinctPaths, DisableSizeHistogram, and
+	// DisableTopSections skip the corresponding aggregations to reduce CPU
+	// and memory usage on busy logs. Disabled aggregations are left zero in
+	// the Summary and omitted when it's formatted. The size histogram is
+	// required for anomaly alerts, and distinct IPs for DistinctIPWindow.
+	DisableDistinctIPs   bool
+	DisableDistinctPaths bool
+	DisableSizeHistogram bool
+	DisableTopSections   bool
+
+	// RecentBufferSize, if positive, is the number of the most recently
+	// collected logs kept for Monitor.RecentLogs, e.g. to see a sample of the
+	// traffic which caused an alert. Logs are kept whether or not they're
+	// ignored or sampled, but not if they're outside of the time range.
+	RecentBufferSize uint
+
+	// OutputBufferSize is the size in bytes of the buffer used to write to
+	// Output, which is flushed after each summary and alert and when the
+	// Monitor stops so that messages are written at once rather than line by
+	// line. Output isn't buffered if OutputBufferSize is negative or Output
+	// is ioutil.Discard or a terminal, where messages should appear as soon
+	// as they're written. Defaults to 4096.
+	OutputBufferSize int
+
+	// HitsBufferSize is the number of hits buffered between aggregating logs
+	// and averaging them. A larger buffer absorbs bursts of logs without
+	// blocking the reader, at the cost of memory, while a smaller one suits
+	// steady, low traffic. Hits aren't buffered if HitsBufferSize is negative.
+	// Defaults to 1024.
+	HitsBufferSize int
+}
+
+// validate returns an error describing the first invalid option, if any. It
+// should be called once defaults have been applied.
+func (o MonitorOpts) validate() error {
+	switch {
+	case o.Quantum <= 0:
+		return errors.Errorf("quantum %s must be positive", o.Quantum)
+	case o.AlertWindow < o.Quantum:
+		return errors.Errorf("alert window %s may not be less than quantum %s", o.AlertWindow, o.Quantum)
+	case o.AlertThreshold < 0:
+		return errors.Errorf("alert threshold %g may not be negative", o.AlertThreshold)
+	case o.LowTrafficThreshold < 0:
+		return errors.Errorf("low traffic threshold %g may not be negative", o.LowTrafficThreshold)
+	case o.ThroughputThreshold < 0:
+		return errors.Errorf("throughput threshold %g may not be negative", o.ThroughputThreshold)
+	case o.ErrorThreshold < 0:
+		return errors.Errorf("error threshold %g may not be negative", o.ErrorThreshold)
+	case o.AlertEvalInterval <= 0:
+		return errors.Errorf("alert evaluation interval %s must be positive", o.AlertEvalInterval)
+	case o.AlertCooldown < 0:
+		return errors.Errorf("alert cooldown %s may not be negative", o.AlertCooldown)
+	case o.SectionDecayInterval < 0:
+		return errors.Errorf("section decay interval %s may not be negative", o.SectionDecayInterval)
+	case o.SectionDecay < 0 || o.SectionDecay >= 1:
+		return errors.Errorf("section decay %g must be within [0, 1)", o.SectionDecay)
+	case o.FileWaitTimeout < 0:
+		return errors.Errorf("file wait timeout %s may not be negative", o.FileWaitTimeout)
+	case o.Reverse && !o.NoFollow:
+		return errors.New("files can only be read in reverse if they aren't followed")
+	case o.HealthStaleness < 0:
+		return errors.Errorf("health staleness %s may not be negative", o.HealthStaleness)
+	case o.ReportingInterval < 0:
+		return errors.Errorf("reporting interval %s may not be negative", o.ReportingInterval)
+	case o.AnomalyFactor < 0 || (o.AnomalyFactor > 0 && o.AnomalyFactor <= 1):
+		return errors.Errorf("anomaly factor %g must be greater than 1", o.AnomalyFactor)
+	case o.AnomalyQuantile <= 0 || o.AnomalyQuantile > 100:
+		return errors.Errorf("anomaly quantile %g must be within (0, 100]", o.AnomalyQuantile)
+	case !o.StartTime.IsZero() && !o.EndTime.IsZero() && o.EndTime.Before(o.StartTime):
+		return errors.Errorf("end time %s may not be before start time %s", o.EndTime, o.StartTime)
+	case o.DistinctIPWindow < 0:
+		return errors.Errorf("distinct IP window %s may not be negative", o.DistinctIPWindow)
+	case o.DistinctIPWindow > 0 && o.DisableDistinctIPs:
+		return errors.New("distinct IP window requires distinct IPs to be counted")
+	case o.AnomalyFactor > 0 && o.DisableSizeHistogram:
+		return errors.New("anomaly alerts require the response size histogram")
+	case o.StatusWindow < 0:
+		return errors.Errorf("status window %s may not be negative", o.StatusWindow)
+	case o.MinLevel != "" && levelSeverity(strings.ToLower(o.MinLevel)) == 0:
+		return errors.Errorf("unknown minimum log level %q", o.MinLevel)
+	case o.MalformedLinePolicy < SkipMalformedLines || o.MalformedLinePolicy > CollectMalformedLines:
+		return errors.Errorf("unknown malformed line policy %s", o.MalformedLinePolicy)
+	case o.SectionQuery < StripQuery || o.SectionQuery > SectionQueryParams:
+		return errors.Errorf("unknown section query mode %s", o.SectionQuery)
+	case o.SectionQuery == SectionQueryParams && len(o.SectionQueryParams) == 0:
+		return errors.New("section query params are required by the params section query mode")
+	case o.SectionQuery != SectionQueryParams && len(o.SectionQueryParams) > 0:
+		return errors.Errorf("section query params require the params section query mode, not %s", o.SectionQuery)
+	case !o.NormalizePathIDs && len(o.PathIDPatterns) > 0:
+		return errors.New("path ID patterns require path IDs to be normalized")
+	case o.Workers <= 0:
+		return errors.Errorf("workers %d must be positive", o.Workers)
+	}
+	if o.SampleRate <= 0 || o.SampleRate > 1 {
+		return errors.Errorf("sample rate %g must be within (0, 1]", o.SampleRate)
+	}
+	if _, err := parseAlertTemplate("alert", o.AlertTemplate); err != nil {
+		return errors.Wrap(err, "invalid alert template")
+	}
+	if _, err := parseAlertTemplate("recovery", o.RecoveryTemplate); err != nil {
+		return errors.Wrap(err, "invalid recovery template")
+	}
+	if o.PushgatewayURL != "" {
+		if u, err := url.Parse(o.PushgatewayURL); err != nil || u.Host == "" {
+			return errors.Errorf("invalid Pushgateway URL %q", o.PushgatewayURL)
+		}
+	}
+	for _, pattern := range o.IgnorePatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return errors.Wrapf(err, "invalid ignore pattern %q", pattern)
+		}
+	}
+	for _, pattern := range o.PathIDPatterns {
+		if _, err := compilePathIDPattern(pattern); err != nil {
+			return errors.Wrapf(err, "invalid path ID pattern %q", pattern)
+		}
+	}
+	for _, q := range o.SizeQuantiles {
+		if q <= 0 || q > 100 {
+			return errors.Errorf("size quantile %g must be within (0, 100]", q)
+		}
+	}
+	bounds := make(map[int64]bool, len(o.SizeBuckets))
+	for _, bound := range o.SizeBuckets {
+		if bound <= 0 {
+			return errors.Errorf("size bucket %d must be positive", bound)
+		}
+		if bounds[bound] {
+			return errors.Errorf("duplicate size bucket %d", bound)
+		}
+		bounds[bound] = true
+	}
+	for _, watch := range o.WatchedStatuses {
+		if _, _, err := parseStatusPattern(watch.Pattern); err != nil {
+			return err
+		}
+		if watch.Threshold < 0 {
+			return errors.Errorf("threshold %g for status %s may not be negative", watch.Threshold, watch.Pattern)
+		}
+	}
+	names := make(map[string]bool, len(o.AlertRules))
+	for i, rule := range o.AlertRules {
+		if err := rule.validate(o.Quantum); err != nil {
+			return errors.Wrapf(err, "invalid alert rule %d", i)
+		}
+		if names[rule.Name] {
+			return errors.Errorf("duplicate alert rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return nil
+}
+
+// fileReaderOpts returns the options for the file readers created for the
+// Monitor.
+func (o MonitorOpts) fileReaderOpts() fileReaderOpts {
+	return fileReaderOpts{
+		noFollow:        o.NoFollow,
+		reverse:         o.Reverse,
+		timestampLayout: o.TimestampLayout,
+		waitTimeout:     o.FileWaitTimeout,
+	}
 }
 
 // Monitor reads, parses, and collects HTTP traffic data from a configured log
 // file. It also provides alerting functionality.
 type Monitor struct {
 	*collector
-	reader reader
-	opts   MonitorOpts
-	close  chan struct{}
+	file         string
+	reader       Reader
+	opts         MonitorOpts
+	metrics      *metricsServer
+	api          *apiServer
+	webhook      *webhook
+	slack        *webhook
+	statsd       *statsdClient
+	csv          *csvExporter
+	pushgateway  *pushgateway
+	buffered     *bufferedOutput // nil unless Output is buffered
+	feed         *summaryFeed    // publishes reported summaries to Summaries
+	color        bool
+	alertTmpl    *template.Template
+	recoveryTmpl *template.Template
+	close        chan struct{}
+	stopOnce     sync.Once
+
+	// mu guards the fields above against being replaced by Restart while a
+	// snapshot is taken or the Monitor is stopped.
+	mu sync.RWMutex
+
+	// running tracks the goroutines of the current run so that Restart can
+	// wait for them to exit.
+	running sync.WaitGroup
 }
 
 // New creates a new Monitor that collects data from the given HTTP log file in
-// Common Log Format.
+// Common Log Format. The file may also be a URL supported by NewURLReader, in
+// which case the logs are read until the end of the response, or a glob
+// pattern such as /var/log/nginx/access.*.log, in which case every matching
+// file is read, including those created later unless NoFollow is set. Only
+// the last element of a pattern may contain wildcards. If opts.Reader is set,
+// it's used to read logs instead and file is ignored.
 func New(file string, opts MonitorOpts) (*Monitor, error) {
+	m := &Monitor{file: file}
+	if err := m.init(opts); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// init creates the reader, collector, and alert sinks for the Monitor using
+// the given options. The Monitor is left unchanged if this fails.
+func (m *Monitor) init(opts MonitorOpts) error {
 	if opts.Output == nil {
 		opts.Output = os.Stdout
 	}
-	reader, err := NewCommonLogFormatReader(file)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create log file reader")
+	if opts.SectionDepth == 0 {
+		opts.SectionDepth = 1
+	}
+	if opts.HistogramRotationInterval == 0 {
+		opts.HistogramRotationInterval = defaultHistogramRotationInterval
+	}
+	if opts.Quantum == 0 {
+		opts.Quantum = defaultQuantum
+	}
+	if opts.GeoIPDatabase != "" && opts.NumTopCountries == 0 {
+		opts.NumTopCountries = defaultNumTopCountries
+	}
+	if opts.AlertEvalInterval == 0 {
+		opts.AlertEvalInterval = opts.Quantum * 2
+	}
+	if len(opts.SizeQuantiles) == 0 {
+		opts.SizeQuantiles = defaultSizeQuantiles
+	}
+	if len(opts.SizeBuckets) == 0 {
+		opts.SizeBuckets = defaultSizeBuckets
+	}
+	if opts.SampleRate == 0 {
+		opts.SampleRate = 1
+	}
+	if opts.Workers == 0 {
+		opts.Workers = 1
+	}
+	if opts.MaxCardinality == 0 {
+		opts.MaxCardinality = defaultMaxCardinality
+	}
+	if opts.AnomalyQuantile == 0 {
+		opts.AnomalyQuantile = defaultAnomalyQuantile
+	}
+	if opts.PushgatewayJob == "" {
+		opts.PushgatewayJob = defaultPushgatewayJob
+	}
+	if opts.OutputBufferSize == 0 {
+		opts.OutputBufferSize = defaultOutputBufferSize
+	}
+	if opts.HitsBufferSize == 0 {
+		opts.HitsBufferSize = defaultHitsBufferSize
+	}
+	rules := make([]AlertRule, len(opts.AlertRules))
+	for i, rule := range opts.AlertRules {
+		if rule.Window == 0 {
+			rule.Window = opts.AlertWindow
+		}
+		rules[i] = rule
+	}
+	opts.AlertRules = rules
+	if err := opts.validate(); err != nil {
+		if opts.Reader != nil {
+			opts.Reader.Close()
+		}
+		return errors.Wrap(err, "invalid options")
+	}
+	quantiles := make([]float64, len(opts.SizeQuantiles))
+	copy(quantiles, opts.SizeQuantiles)
+	sort.Float64s(quantiles)
+	opts.SizeQuantiles = quantiles
+	buckets := make([]int64, len(opts.SizeBuckets))
+	copy(buckets, opts.SizeBuckets)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	opts.SizeBuckets = buckets
+	reader := opts.Reader
+	if reader == nil {
+		var err error
+		reader, err = newSourceReader(m.file, opts.fileReaderOpts())
+		if err != nil {
+			return errors.Wrap(err, "failed to create log file reader")
+		}
+	}
+	if h, ok := reader.(malformedLineHandler); ok {
+		h.setMalformedLinePolicy(opts.MalformedLinePolicy)
+	}
+	var metrics *metricsServer
+	if opts.MetricsAddr != "" {
+		var err error
+		metrics, err = newMetricsServer(opts.MetricsAddr, m)
+		if err != nil {
+			reader.Close()
+			return errors.Wrap(err, "failed to create metrics server")
+		}
+	}
+	var statsd *statsdClient
+	if opts.StatsdAddr != "" {
+		var tags []string
+		if m.file != "" {
+			tags = append(tags, "file:"+m.file)
+		}
+		var err error
+		statsd, err = newStatsdClient(opts.StatsdAddr, tags...)
+		if err != nil {
+			reader.Close()
+			if metrics != nil {
+				metrics.stop()
+			}
+			return errors.Wrap(err, "failed to create statsd client")
+		}
+	}
+	var csv *csvExporter
+	if opts.CSVFile != "" {
+		var err error
+		csv, err = newCSVExporter(opts.CSVFile)
+		if err != nil {
+			reader.Close()
+			if metrics != nil {
+				metrics.stop()
+			}
+			if statsd != nil {
+				statsd.close()
+			}
+			return errors.Wrap(err, "failed to open CSV file")
+		}
+	}
+	var api *apiServer
+	if opts.APIAddr != "" {
+		var err error
+		api, err = newAPIServer(opts.APIAddr, m)
+		if err != nil {
+			reader.Close()
+			if metrics != nil {
+				metrics.stop()
+			}
+			if statsd != nil {
+				statsd.close()
+			}
+			if csv != nil {
+				csv.close()
+			}
+			return errors.Wrap(err, "failed to create API server")
+		}
+	}
+
+	// Whether to color and buffer output depends on the underlying writer.
+	m.color = opts.Color && useColor(opts.Output)
+	m.buffered = nil
+	if opts.OutputBufferSize > 0 {
+		m.buffered = newBufferedOutput(opts.Output, opts.OutputBufferSize)
+		if m.buffered != nil {
+			opts.Output = m.buffered
+		}
+	}
+	m.collector = newCollector(opts)
+	m.reader = reader
+	m.opts = opts
+	m.metrics = metrics
+	m.api = api
+	m.statsd = statsd
+	m.csv = csv
+	// The templates were checked by validate, so parsing can't fail.
+	m.alertTmpl, _ = parseAlertTemplate("alert", opts.AlertTemplate)
+	m.recoveryTmpl, _ = parseAlertTemplate("recovery", opts.RecoveryTemplate)
+	m.pushgateway = nil
+	if opts.PushgatewayURL != "" {
+		m.pushgateway = newPushgateway(opts.PushgatewayURL, opts.PushgatewayJob, opts.PushgatewayInstance)
 	}
-	collector := newCollector(opts.NumTopSections, opts.AlertWindow, quantum)
-	return &Monitor{
-		collector: collector,
-		reader:    reader,
-		opts:      opts,
-		close:     make(chan struct{}),
-	}, nil
+	m.webhook = nil
+	if opts.AlertWebhook != "" {
+		m.webhook = newWebhook(opts.AlertWebhook)
+	}
+	m.slack = nil
+	if opts.SlackWebhookURL != "" {
+		m.slack = newWebhook(opts.SlackWebhookURL)
+	}
+	m.close = make(chan struct{})
+	m.stopOnce = sync.Once{}
+	m.feed = new(summaryFeed)
+	return nil
 }
 
 // Start collecting data, alerting, and writing summary data until the Monitor
-// is closed. This is a blocking call.
+// is closed or, if NoFollow is set, the end of the file is reached. This is a
+// blocking call. If the Monitor stops because reading logs failed, the error
+// is returned.
 func (m *Monitor) Start() error {
-	go m.report()
-	go m.alert()
+	return m.StartContext(context.Background())
+}
+
+// StartContext is like Start but also stops the Monitor when the given context
+// is canceled, in which case the context's error is returned.
+func (m *Monitor) StartContext(ctx context.Context) error {
+	m.running.Add(3)
+	defer m.running.Done()
+	if m.metrics != nil {
+		m.metrics.start()
+	}
+	if m.api != nil {
+		m.api.start()
+	}
+	go m.report(ctx)
+	go m.alert(ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.Stop()
+		case <-m.close:
+		}
+	}()
 	err := m.collector.Start(m.reader)
+	if err == nil && (m.opts.NoFollow || m.opts.SummaryOnStop) {
+		s := m.summary()
+		s.color = m.color
+		fmt.Fprintln(m.opts.Output, s)
+	}
 	m.Stop()
-	return errors.Wrap(err, "failed to start collector")
+	if m.pushgateway != nil {
+		if err := m.pushgateway.push(m.summary()); err != nil {
+			fmt.Fprintf(m.opts.Output, "Failed to push metrics to Pushgateway: %v\n", err)
+		}
+	}
+	m.flush()
+	if err != nil {
+		return errors.Wrap(err, "failed to start collector")
+	}
+	return ctx.Err()
 }
 
 // report prints summary data on the configured interval until the Monitor is
-// closed.
-func (m *Monitor) report() {
+// closed or the context is canceled.
+func (m *Monitor) report(ctx context.Context) {
+	defer m.running.Done()
 	// Don't report if the interval is zero.
 	if m.opts.ReportingInterval <= 0 {
 		return
 	}
 	t := time.NewTicker(m.opts.ReportingInterval)
 	defer t.Stop()
+	var prev *Summary
 	for {
 		select {
 		case <-t.C:
 		case <-m.close:
 			return
+		case <-ctx.Done():
+			return
+		}
+		s := m.summary()
+		s.color = m.color
+		if m.opts.ReportDeltas {
+			fmt.Fprintln(m.opts.Output, s.DeltaString(prev))
+			prev = s
+		} else {
+			fmt.Fprintln(m.opts.Output, s)
+		}
+		if m.statsd != nil {
+			if err := m.statsd.send(s); err != nil {
+				fmt.Fprintf(m.opts.Output, "Failed to send metrics to statsd: %v\n", err)
+			}
+		}
+		if m.csv != nil {
+			if err := m.csv.write(s); err != nil {
+				fmt.Fprintf(m.opts.Output, "Failed to export summary to CSV: %v\n", err)
+			}
 		}
-		fmt.Fprintln(m.opts.Output, m.summary())
+		m.feed.publish(s)
+		m.flush()
 	}
 }
 
 // alert writes a message when traffic exceeds the alert threshold on average
 // within the alert window. When traffic drops back below the threshold, it
-// writes a recovered message. It does this until the Monitor is closed.
-func (m *Monitor) alert() {
+// writes a recovered message. It does this until the Monitor is closed or the
+// context is canceled.
+func (m *Monitor) alert(ctx context.Context) {
+	defer m.running.Done()
 	var (
-		t       = time.NewTicker(quantum * 2)
-		alerted = false
+		t          = time.NewTicker(m.opts.AlertEvalInterval)
+		hits       = &alertState{threshold: m.opts.AlertThreshold, cooldown: m.opts.AlertCooldown}
+		lowHits    *alertState
+		throughput *alertState
+		errs       *alertState
+		sizes      *alertState
+		latencies  *alertState
 	)
 	defer t.Stop()
+	if m.opts.LowTrafficThreshold > 0 {
+		lowHits = newLowAlertState(m.opts.LowTrafficThreshold, m.opts.AlertCooldown)
+	}
+	if m.opts.ThroughputThreshold > 0 {
+		throughput = &alertState{threshold: m.opts.ThroughputThreshold, cooldown: m.opts.AlertCooldown}
+	}
+	if m.opts.ErrorThreshold > 0 {
+		errs = &alertState{threshold: m.opts.ErrorThreshold, cooldown: m.opts.AlertCooldown}
+	}
+	if m.opts.AnomalyFactor > 0 {
+		sizes = &alertState{threshold: m.opts.AnomalyFactor, cooldown: m.opts.AlertCooldown}
+		latencies = &alertState{threshold: m.opts.AnomalyFactor, cooldown: m.opts.AlertCooldown}
+	}
+	statuses := make([]*alertState, len(m.watched))
+	for i, w := range m.watched {
+		if w.Threshold > 0 {
+			statuses[i] = &alertState{threshold: w.Threshold, cooldown: m.opts.AlertCooldown}
+		}
+	}
+	rules := make([]*alertState, len(m.rules))
+	for i, r := range m.rules {
+		rules[i] = r.newAlertState()
+	}
 	for {
 		select {
 		case <-t.C:
 		case <-m.close:
 			return
+		case <-ctx.Done():
+			return
+		}
+		now := time.Now()
+		m.evaluateRules(rules, now)
+		// Alerts aren't evaluated until a full window of data has been
+		// collected to avoid spurious alerts during startup. The averagers
+		// advance together, so the hits averager stands in for all of them.
+		if !m.averager.warm() {
+			continue
+		}
+		avgHits := m.averager.average()
+		hitsValue, maxHits := avgHits, 0.0
+		if m.opts.AlertOnMaxHits {
+			maxHits = m.averager.rates().Max
+			hitsValue = maxHits
+		}
+		if a, ok := hits.evaluate(hitsValue, now); ok {
+			a.AvgHits = avgHits
+			a.MaxHits = maxHits
+			if !a.Recovered {
+				m.addContext(&a)
+			}
+			m.printAlert(a, m.opts.AlertThreshold)
+			m.notify(a)
+		}
+		if lowHits != nil {
+			if a, ok := lowHits.evaluate(avgHits, now); ok {
+				a.LowTraffic = true
+				a.AvgHits = avgHits
+				m.printAlert(a, m.opts.LowTrafficThreshold)
+				m.notify(a)
+			}
+		}
+		if throughput != nil {
+			avgBytes := m.throughput.average()
+			if a, ok := throughput.evaluate(avgBytes, now); ok {
+				a.Throughput = true
+				a.AvgHits = avgHits
+				a.AvgBytes = avgBytes
+				m.printAlert(a, m.opts.ThroughputThreshold)
+				m.notify(a)
+			}
+		}
+		if errs != nil {
+			avgErrors := m.errors.average()
+			if a, ok := errs.evaluate(avgErrors, now); ok {
+				a.Errors = true
+				a.AvgHits = avgHits
+				a.AvgErrors = avgErrors
+				m.printAlert(a, m.opts.ErrorThreshold)
+				m.notify(a)
+			}
 		}
-		var (
-			avg = m.averager.average()
-			now = time.Now()
-		)
-		if avg > m.opts.AlertThreshold && !alerted {
-			fmt.Fprintf(m.opts.Output, "High traffic generated an alert - hits = %.2f, triggered at %s\n",
-				avg, now)
-			alerted = true
-			select {
-			case m.opts.AlertHook <- Alert{AvgHits: avg, Time: now}:
-			default:
+		for i, w := range m.watched {
+			if statuses[i] == nil {
+				continue
 			}
-		} else if avg <= m.opts.AlertThreshold && alerted {
-			fmt.Fprintf(m.opts.Output, "Traffic recovered - hits = %.2f, recovered at %s\n", avg, now)
-			alerted = false
-			select {
-			case m.opts.AlertHook <- Alert{Recovered: true, AvgHits: avg, Time: now}:
-			default:
+			avgStatus := w.averager.average()
+			if a, ok := statuses[i].evaluate(avgStatus, now); ok {
+				a.Status = w.Pattern
+				a.AvgHits = avgHits
+				a.AvgStatus = avgStatus
+				m.printAlert(a, w.Threshold)
+				m.notify(a)
 			}
 		}
+		if sizes != nil {
+			m.evaluateAnomaly(sizes, sizeAnomaly, avgHits, now)
+			m.evaluateAnomaly(latencies, latencyAnomaly, avgHits, now)
+		}
+	}
+}
+
+// addContext sets the top sections and IPs of the alert from a snapshot taken
+// when it's triggered.
+func (m *Monitor) addContext(a *Alert) {
+	s := m.Snapshot()
+	a.TopSections = topElements(s.TopSections)
+	a.TopIPs = topElements(s.TopIPs)
+}
+
+// evaluateRules evaluates each alert rule whose window has been filled against
+// its average, emitting an alert for each rule whose state changes.
+func (m *Monitor) evaluateRules(states []*alertState, now time.Time) {
+	for i, r := range m.rules {
+		if !r.averager.warm() {
+			continue
+		}
+		avg := r.averager.average()
+		if a, ok := states[i].evaluate(avg, now); ok {
+			a.AvgHits = m.averager.average()
+			r.alert(&a, avg)
+			m.printAlert(a, r.Threshold)
+			m.notify(a)
+		}
+	}
+}
+
+// evaluateAnomaly compares the configured quantile of the current window of
+// the response size or latency histograms against the baseline and emits an
+// alert if the state changes. Evaluation is skipped, leaving the state as is,
+// if there are too few values to compare.
+func (m *Monitor) evaluateAnomaly(state *alertState, kind string, avgHits float64, now time.Time) {
+	current, baseline := m.splitHists(kind == latencyAnomaly)
+	quantile, base, ok := compareQuantiles(m.opts.AnomalyQuantile, current, baseline)
+	if !ok {
+		return
+	}
+	ratio := float64(quantile) / float64(base)
+	if a, ok := state.evaluate(ratio, now); ok {
+		a.Anomaly = kind
+		a.AvgHits = avgHits
+		a.Quantile = quantile
+		a.Baseline = base
+		a.Ratio = ratio
+		m.printAlert(a, m.opts.AnomalyFactor)
+		m.notify(a)
+	}
+}
+
+// printAlert writes the message for the given alert, which was triggered or
+// recovered against the given threshold, to Output using the configured
+// template, if any.
+func (m *Monitor) printAlert(a Alert, threshold float64) {
+	tmpl := m.alertTmpl
+	if a.Recovered {
+		tmpl = m.recoveryTmpl
+	}
+	msg := alertMessage{Alert: a, Window: m.opts.AlertWindow, Threshold: threshold}
+	color := colorRed
+	if a.Recovered {
+		color = colorGreen
+	}
+	fmt.Fprintln(m.opts.Output, colorize(formatAlert(tmpl, msg), color, m.color))
+	m.flush()
+}
+
+// flush writes the buffered output, if any. Output is flushed after each
+// message, e.g. a summary or an alert, so that messages are written at once.
+func (m *Monitor) flush() {
+	if m.buffered != nil {
+		m.buffered.Flush()
+	}
+}
+
+// notify delivers the alert to the alert hook, if it's ready to receive, and
+// the alert webhook and Slack, if configured. Webhook delivery happens in the
+// background so that a slow endpoint doesn't block alert evaluation.
+func (m *Monitor) notify(a Alert) {
+	select {
+	case m.opts.AlertHook <- a:
+	default:
+	}
+	if m.webhook != nil {
+		m.running.Add(1)
+		go m.deliver(m.webhook, "webhook", a)
+	}
+	if m.slack != nil {
+		m.running.Add(1)
+		go m.deliver(m.slack, "Slack", newSlackMessage(a, m.opts.SlackChannel, m.opts.SlackUsername))
+	}
+}
+
+// deliver sends the payload to the webhook, writing a message to the output if
+// delivery fails.
+func (m *Monitor) deliver(w *webhook, name string, payload interface{}) {
+	defer m.running.Done()
+	if err := w.send(payload, m.close); err != nil {
+		fmt.Fprintf(m.opts.Output, "Failed to deliver alert to %s: %v\n", name, err)
+		m.flush()
 	}
 }
 
 // Stop the Monitor. Once the Monitor has been stopped, it cannot be started
-// again.
+// again except with Restart. Calling Stop more than once has no effect. Logs
+// which were processed before stopping, including their hits, are reflected
+// in Snapshot once Start returns.
 func (m *Monitor) Stop() error {
-	if err := m.reader.Close(); err != nil {
-		return errors.Wrap(err, "failed to close log reader")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var err error
+	m.stopOnce.Do(func() {
+		close(m.close)
+		if m.metrics != nil {
+			m.metrics.stop()
+		}
+		if m.api != nil {
+			m.api.stop()
+		}
+		if m.statsd != nil {
+			m.statsd.close()
+		}
+		if m.csv != nil {
+			m.csv.close()
+		}
+		m.feed.close()
+		err = errors.Wrap(m.reader.Close(), "failed to close log reader")
+	})
+	m.flush()
+	return err
+}
+
+// Summaries returns a channel which receives the summary reported every
+// ReportingInterval, alongside writing it to Output, so that summaries can be
+// consumed programmatically, e.g. stored or displayed elsewhere. Nothing is
+// received if ReportingInterval is zero. The channel only buffers the latest
+// summary, so one which isn't received before the next is reported is
+// skipped. The summaries are shared by every channel and mustn't be
+// modified. The channel is closed when the Monitor stops, or immediately if
+// it has already stopped, and Summaries must be called again after Restart.
+func (m *Monitor) Summaries() <-chan *Summary {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.feed.subscribe()
+}
+
+// Snapshot returns a point-in-time snapshot of the traffic data. It's safe to
+// call concurrently with the Monitor collecting data.
+func (m *Monitor) Snapshot() *Summary {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.summary()
+}
+
+// Health returns an error if reading logs failed or, while the Monitor is
+// running and following logs, no logs have been read within HealthStaleness.
+// It returns nil otherwise, including before the Monitor is started. This is
+// suitable for liveness probes, e.g. via GET /healthz.
+func (m *Monitor) Health() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	staleness := m.opts.HealthStaleness
+	if m.opts.NoFollow {
+		staleness = 0
+	}
+	return m.collector.health(staleness, time.Now())
+}
+
+// HitBuckets returns the number of hits in each quantum of the alert window
+// from oldest to newest, e.g. the hits in each of the last 120 seconds with
+// the default quantum and a two-minute window. These are the samples averaged
+// for the hit alert, so the quantum in progress isn't included. This is
+// useful to correlate an unexpected alert with the underlying traffic. The
+// returned slice is a copy.
+func (m *Monitor) HitBuckets() []uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.averager.completed()
+}
+
+// Ingest processes the log entry as if it had been read by the Monitor's
+// reader, applying the same filtering, sampling, and aggregation. This allows
+// logs which were parsed elsewhere, e.g. a large dataset loaded for a
+// benchmark, to be collected without a file. It's safe to call concurrently
+// and whether or not the Monitor is started. It returns false if the log is
+// past the end time.
+func (m *Monitor) Ingest(l Log) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.collector.ingest(importLog(l))
+}
+
+// MalformedLines returns the most recent lines, up to 100 per file, which
+// weren't in the expected format, oldest first. They're only kept if
+// MalformedLinePolicy is CollectMalformedLines and the Reader supports it.
+func (m *Monitor) MalformedLines() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if h, ok := m.reader.(malformedLineHandler); ok {
+		return h.MalformedLines()
 	}
-	close(m.close)
 	return nil
 }
 
+// RecentLogs returns the most recently collected logs, up to
+// RecentBufferSize, oldest first. With multiple workers, they're ordered by
+// when they were aggregated. It returns nil if RecentBufferSize is zero. The
+// returned slice is a copy.
+func (m *Monitor) RecentLogs() []Log {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.recent == nil {
+		return nil
+	}
+	return m.recent.list()
+}
+
+// Reset clears the accumulated statistics, including distinct counts, top-k
+// lists, histograms, frequencies, the total count, the hit and throughput
+// averages, and the recent logs, without stopping the Monitor. This is useful
+// to establish a new baseline, e.g. after a deploy. Logs which are being
+// collected during the reset may be counted in the new window. Since the
+// averages start over, an active alert may recover.
+func (m *Monitor) Reset() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.collector.reset()
+	if m.statsd != nil {
+		m.statsd.reset()
+	}
+}
+
+// Restart stops the Monitor, if it's running, and starts it again with the
+// given options. The reader, collected data, and alert state are recreated, so
+// no statistics carry over from before the restart. Logs are read from the
+// file passed to New unless opts.Reader is set, in which case it must be a
+// new Reader since the previous one is closed when the Monitor stops. Like
+// Start, this blocks until the Monitor is stopped. If the Monitor can't be
+// recreated with the given options, it remains stopped and the error is
+// returned.
+func (m *Monitor) Restart(opts MonitorOpts) error {
+	m.Stop()
+	m.running.Wait()
+
+	m.mu.Lock()
+	err := m.init(opts)
+	m.mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "failed to restart Monitor")
+	}
+	return m.Start()
+}
+
 // summary returns a point-in-time snapshot of the data.
 func (m *Monitor) summary() *Summary {
 	s := &Summary{Timestamp: time.Now()}
-	m.RLock()
-	defer m.RUnlock()
-
-	s.TopSections = m.topSections.Elements()
-	s.DistinctIPs = m.ipHll.Count()
-	s.SizeHist = hdrhistogram.Import(m.sizeHist.Merge().Export())
-	s.StatusFreq = m.statusFreq
-	s.HitsPerSecond = m.averager.latest()
+	// With multiple workers, each shard's aggregations are merged.
+	var (
+		sections, ips, userAgents, countries   [][]*boom.Element
+		sectionBytes                           [][]*boom.Element
+		ipHlls, pathHlls, recentIPHlls         []*boom.HyperLogLog
+		sizeHists, latencyHists                []*hdrhistogram.WindowedHistogram
+		methodFreqs, protocolFreqs, levelFreqs []map[string]uint64
+	)
+	if len(m.watched) > 0 {
+		s.WatchedStatuses = make(map[string]uint64, len(m.watched))
+	}
+	s.SizeBuckets = newSizeBuckets(m.sizeBounds)
+	for _, p := range m.partitions() {
+		p.RLock()
+		defer p.RUnlock()
+		if p.topSections != nil {
+			sections = append(sections, p.topSections.Elements())
+			sectionBytes = append(sectionBytes, p.topSectionBytes.Elements())
+		}
+		if p.topIPs != nil {
+			ips = append(ips, p.topIPs.Elements())
+		}
+		if p.topUserAgents != nil {
+			userAgents = append(userAgents, p.topUserAgents.Elements())
+		}
+		if p.topCountries != nil {
+			countries = append(countries, p.topCountries.Elements())
+		}
+		if p.ipHll != nil {
+			ipHlls = append(ipHlls, p.ipHll)
+		}
+		if p.recentIPs != nil {
+			recentIPHlls = append(recentIPHlls, p.recentIPs.sketches...)
+		}
+		if p.pathHll != nil {
+			pathHlls = append(pathHlls, p.pathHll)
+		}
+		if p.sizeHist != nil {
+			sizeHists = append(sizeHists, p.sizeHist)
+		}
+		latencyHists = append(latencyHists, p.latencyHist)
+		methodFreqs = append(methodFreqs, p.methodFreq)
+		protocolFreqs = append(protocolFreqs, p.protocolFreq)
+		levelFreqs = append(levelFreqs, p.levelFreq)
+		s.StatusFreq = s.StatusFreq.add(p.statusFreq)
+		if p.recentStatuses != nil {
+			s.RecentStatusFreq = s.RecentStatusFreq.add(p.recentStatuses.sum())
+		}
+		for i, n := range p.sizeCounts {
+			s.SizeBuckets[i].Count += n
+		}
+		for _, w := range p.watched {
+			s.WatchedStatuses[w.Pattern] += w.count
+		}
+		s.TotalRequests += p.count
+		s.MalformedRequests += p.malformed
+		s.IgnoredRequests += p.ignored
+		s.InvalidTimestamps += p.invalidTimestamps
+		if !p.firstSeen.IsZero() && (s.FirstSeen.IsZero() || p.firstSeen.Before(s.FirstSeen)) {
+			s.FirstSeen = p.firstSeen
+		}
+		if p.lastSeen.After(s.LastSeen) {
+			s.LastSeen = p.lastSeen
+		}
+	}
+
+	if len(sections) > 0 {
+		s.TopSections = mergeElements(m.opts.NumTopSections, sections...)
+		s.TopSectionsByBytes = mergeElements(m.opts.NumTopSections, sectionBytes...)
+	}
+	if len(ips) > 0 {
+		s.TopIPs = mergeElements(m.opts.NumTopIPs, ips...)
+	}
+	if len(userAgents) > 0 {
+		s.TopUserAgents = mergeElements(m.opts.NumTopUserAgents, userAgents...)
+	}
+	if len(countries) > 0 {
+		s.TopCountries = mergeElements(m.opts.NumTopCountries, countries...)
+	}
+	if len(ipHlls) > 0 {
+		s.TotalDistinctIPs = mergeCount(ipHlls...)
+		s.DistinctIPs = s.TotalDistinctIPs
+	}
+	if len(recentIPHlls) > 0 {
+		s.DistinctIPs = mergeCount(recentIPHlls...)
+		s.DistinctIPWindow = m.opts.DistinctIPWindow
+	}
+	if m.opts.StatusWindow > 0 {
+		s.StatusWindow = m.opts.StatusWindow
+	}
+	if len(pathHlls) > 0 {
+		s.DistinctPaths = mergeCount(pathHlls...)
+	}
+	if len(sizeHists) > 0 {
+		s.SizeHist = mergeHistograms(sizeHists...)
+	}
+	s.DistinctIPsDisabled = m.opts.DisableDistinctIPs
+	s.DistinctPathsDisabled = m.opts.DisableDistinctPaths
+	s.SizeHistDisabled = m.opts.DisableSizeHistogram
+	s.TopSectionsDisabled = m.opts.DisableTopSections
+	s.SizeQuantiles = m.opts.SizeQuantiles
+	s.SuccessRate = s.StatusFreq.successRate(m.opts.ClientErrorsAsFailures)
+	s.LatencyHist = mergeHistograms(latencyHists...)
+	s.MethodFreq = mergeFreqs(methodFreqs...)
+	s.ProtocolFreq = mergeFreqs(protocolFreqs...)
+	s.LevelFreq = mergeFreqs(levelFreqs...)
+	s.AvgErrors = m.errors.average()
+	// The latest bucket spans one quantum, so scale it to a per-second rate.
+	s.HitsPerSecond = uint64(float64(m.averager.latest()) / m.opts.Quantum.Seconds())
 	s.AvgHits = m.averager.average()
+	s.HitRate = m.averager.rates()
+	s.BytesPerSecond = uint64(float64(m.throughput.latest()) / m.opts.Quantum.Seconds())
+	s.AvgBytes = m.throughput.average()
 	s.Window = m.opts.AlertWindow
+	s.SampleRate = m.opts.SampleRate
+	if sc, ok := m.reader.(skipCounter); ok {
+		s.SkippedLines = sc.Skipped()
+	}
 	return s
 }
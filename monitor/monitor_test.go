@@ -1,13 +1,19 @@
 package monitor
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"golang.org/x/time/rate"
 )
 
@@ -78,6 +84,12 @@ func TestMonitorAlerting(t *testing.T) {
 		if a.AvgHits <= testAlertThreshold {
 			t.Fatalf("Expected avg greater than %f, got %f", testAlertThreshold, a.AvgHits)
 		}
+		if len(a.TopSections) != 1 || a.TopSections[0].Value != "/customers" || a.TopSections[0].Hits == 0 {
+			t.Fatalf("Expected top section /customers, got %+v", a.TopSections)
+		}
+		if len(a.TopIPs) != 0 {
+			t.Fatalf("Expected no top IPs, got %+v", a.TopIPs)
+		}
 	case <-time.After(5 * time.Second):
 		t.Fatal("Expected alert triggered")
 	}
@@ -91,11 +103,1627 @@ func TestMonitorAlerting(t *testing.T) {
 		if a.AvgHits > testAlertThreshold {
 			t.Fatalf("Expected avg less than or equal to %f, got %f", testAlertThreshold, a.AvgHits)
 		}
+		if len(a.TopSections) != 0 {
+			t.Fatalf("Expected no top sections for recovery, got %+v", a.TopSections)
+		}
 	case <-time.After(5 * time.Second):
 		t.Fatal("Expected alert recovery")
 	}
 }
 
+// TestMonitorThroughputAlert ensures a throughput alert is triggered when the
+// average bytes per second exceeds the throughput threshold.
+func TestMonitorThroughputAlert(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	alerts := make(chan Alert, 1)
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:         500 * time.Millisecond,
+		AlertThreshold:      1000,
+		ThroughputThreshold: 100000,
+		AlertHook:           alerts,
+		Quantum:             100 * time.Millisecond,
+		Output:              ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	go m.Start()
+	defer m.Stop()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			file.WriteString(fmt.Sprintf("::1 - - [%s] \"GET /video.mp4 HTTP/1.1\" 200 100000\n",
+				time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+		}
+	}()
+
+	select {
+	case a := <-alerts:
+		if !a.Throughput || a.Recovered {
+			t.Fatalf("Expected throughput alert triggered, got %+v", a)
+		}
+		if a.AvgBytes <= 100000 {
+			t.Fatalf("Expected avg bytes greater than 100000, got %f", a.AvgBytes)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected throughput alert triggered")
+	}
+}
+
+// TestMonitorLowTrafficAlert ensures a low traffic alert is triggered once a
+// full window has passed without traffic, but not before.
+func TestMonitorLowTrafficAlert(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	alerts := make(chan Alert, 1)
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:         500 * time.Millisecond,
+		AlertThreshold:      1000,
+		LowTrafficThreshold: 1,
+		AlertHook:           alerts,
+		Quantum:             100 * time.Millisecond,
+		Output:              ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	start := time.Now()
+	go m.Start()
+	defer m.Stop()
+
+	select {
+	case a := <-alerts:
+		if !a.LowTraffic || a.Recovered {
+			t.Fatalf("Expected low traffic alert triggered, got %+v", a)
+		}
+		if a.AvgHits >= 1 {
+			t.Fatalf("Expected avg hits less than 1, got %f", a.AvgHits)
+		}
+		if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+			t.Fatalf("Expected alert after the window, got it after %s", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected low traffic alert triggered")
+	}
+}
+
+// TestMonitorAlertOnMaxHits ensures a short burst triggers the traffic alert
+// when it's compared against the window's max hits/s even though the average
+// stays below the threshold.
+func TestMonitorAlertOnMaxHits(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	alerts := make(chan Alert, 1)
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:    2 * time.Second,
+		AlertThreshold: 100,
+		AlertOnMaxHits: true,
+		AlertHook:      alerts,
+		Quantum:        100 * time.Millisecond,
+		Output:         ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	go m.Start()
+	defer m.Stop()
+
+	// Wait for the window to fill before the burst so it isn't aged out
+	// before the alert is evaluated.
+	time.Sleep(2100 * time.Millisecond)
+	now := time.Now().Format("02/Jan/2006:15:04:05 -0700")
+	file.WriteString(strings.Repeat(fmt.Sprintf(dummyLog, now), 30))
+
+	select {
+	case a := <-alerts:
+		if a.Recovered || a.MaxHits < 100 || a.AvgHits >= 100 {
+			t.Fatalf("Expected alert triggered by max hits with a low average, got %+v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected alert triggered")
+	}
+	if s := m.Snapshot(); s.HitRate.Max < 100 || s.HitRate.Min != 0 {
+		t.Fatalf("Expected max hits/s at least 100 and min 0, got %+v", s.HitRate)
+	}
+}
+
+// TestMonitorAlertRules ensures alert rules are evaluated independently over
+// their own windows and their alerts are tagged with the rule's name.
+func TestMonitorAlertRules(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	alerts := make(chan Alert, 10)
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:    time.Hour,
+		AlertThreshold: 1000,
+		AlertHook:      alerts,
+		Quantum:        100 * time.Millisecond,
+		AlertRules: []AlertRule{
+			{Name: "server-errors", Metric: StatusMetric("5xx"), Threshold: 10, Window: 1500 * time.Millisecond},
+			{Name: "quiet", Metric: MetricErrors, Below: true, Threshold: 1, Window: 2 * time.Second},
+		},
+		Output: ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	go m.Start()
+	defer m.Stop()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			file.WriteString(fmt.Sprintf("::1 - - [%s] \"GET /index.html HTTP/1.1\" 503 100\n",
+				time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+		}
+	}()
+
+	// The hits alert never triggers since its window is an hour, while both
+	// rules trigger once their own windows are filled. The windows exceed a
+	// second since log timestamps are truncated to the second.
+	triggered := make(map[string]Alert)
+	deadline := time.After(5 * time.Second)
+	for len(triggered) < 2 {
+		select {
+		case a := <-alerts:
+			if a.Rule == "" || a.Recovered {
+				t.Fatalf("Expected rule alert triggered, got %+v", a)
+			}
+			triggered[a.Rule] = a
+		case <-deadline:
+			t.Fatalf("Expected both rules triggered, got %v", triggered)
+		}
+	}
+	if a := triggered["server-errors"]; a.Status != "5xx" || a.AvgStatus <= 10 {
+		t.Fatalf("Expected 5xx average greater than 10, got %+v", a)
+	}
+	if a := triggered["quiet"]; !a.Errors || a.AvgErrors != 0 {
+		t.Fatalf("Expected no errors, got %+v", a)
+	}
+}
+
+// TestMonitorErrorAlert ensures an error alert is triggered when error-level
+// entries in an error log exceed the error threshold.
+func TestMonitorErrorAlert(t *testing.T) {
+	file, err := ioutil.TempFile("", "error_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	reader, err := NewApacheErrorLogReader(file.Name())
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	alerts := make(chan Alert, 1)
+	m, err := New("", MonitorOpts{
+		AlertWindow:    500 * time.Millisecond,
+		ErrorThreshold: 10,
+		AlertHook:      alerts,
+		Quantum:        100 * time.Millisecond,
+		Output:         ioutil.Discard,
+		Reader:         reader,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	go m.Start()
+	defer m.Stop()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			now := time.Now().Format("Mon Jan 02 15:04:05.000000 2006")
+			file.WriteString(fmt.Sprintf("[%s] [core:warn] [pid 1:tid 2] Slow request\n", now))
+			file.WriteString(fmt.Sprintf("[%s] [core:error] [pid 1:tid 2] [client ::1:80] Failure\n", now))
+			file.WriteString(fmt.Sprintf("[%s] [core:crit] [pid 1:tid 2] [client ::1:80] Failure\n", now))
+		}
+	}()
+
+	select {
+	case a := <-alerts:
+		if !a.Errors || a.Recovered {
+			t.Fatalf("Expected error alert triggered, got %+v", a)
+		}
+		if a.AvgErrors <= 10 {
+			t.Fatalf("Expected avg errors greater than 10, got %f", a.AvgErrors)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected error alert triggered")
+	}
+	if s := m.Snapshot(); s.LevelFreq["warn"] == 0 || s.TotalRequests != 0 {
+		t.Fatalf("Expected warnings and no requests, got %v and %d", s.LevelFreq, s.TotalRequests)
+	}
+}
+
+// TestMonitorStatusAlert ensures an alert is triggered for a watched status
+// whose rate exceeds its threshold and that exact counts are kept for each
+// watched status.
+func TestMonitorStatusAlert(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	alerts := make(chan Alert, 1)
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:    500 * time.Millisecond,
+		AlertThreshold: 1000,
+		WatchedStatuses: []StatusWatch{
+			{Pattern: "429", Threshold: 10},
+			{Pattern: "5xx"},
+		},
+		AlertHook: alerts,
+		Quantum:   100 * time.Millisecond,
+		Output:    ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	go m.Start()
+	defer m.Stop()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			now := time.Now().Format("02/Jan/2006:15:04:05 -0700")
+			file.WriteString(fmt.Sprintf("::1 - - [%s] \"GET /api HTTP/1.1\" 429 0\n", now))
+			file.WriteString(fmt.Sprintf("::1 - - [%s] \"GET /api HTTP/1.1\" 200 10\n", now))
+		}
+	}()
+
+	select {
+	case a := <-alerts:
+		if a.Status != "429" || a.Recovered {
+			t.Fatalf("Expected status 429 alert triggered, got %+v", a)
+		}
+		if a.AvgStatus <= 10 {
+			t.Fatalf("Expected avg status greater than 10, got %f", a.AvgStatus)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected status 429 alert triggered")
+	}
+	s := m.Snapshot()
+	if s.WatchedStatuses["429"] == 0 || s.WatchedStatuses["5xx"] != 0 {
+		t.Fatalf("Expected 429s and no 5xxs, got %v", s.WatchedStatuses)
+	}
+}
+
+// TestMonitorAnomalyAlert ensures an anomaly alert is triggered when the
+// quantile of response sizes in the current window exceeds the configured
+// multiple of the baseline and recovers once it no longer does.
+func TestMonitorAnomalyAlert(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	alerts := make(chan Alert, 1)
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:   testAlertWindow,
+		AnomalyFactor: 2,
+		AlertHook:     alerts,
+		Output:        ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	defer m.Stop()
+
+	state := &alertState{threshold: m.opts.AnomalyFactor}
+	record := func(size int64) {
+		for i := 0; i < minAnomalyCount; i++ {
+			m.sizeHist.Current.RecordValue(size)
+		}
+	}
+	record(1000)
+	m.sizeHist.Rotate()
+	record(3000)
+	m.evaluateAnomaly(state, sizeAnomaly, 0, time.Now())
+	select {
+	case a := <-alerts:
+		if a.Recovered || a.Anomaly != sizeAnomaly || a.Quantile != 3000 || a.Baseline != 1000 || a.Ratio != 3 {
+			t.Fatalf("Expected size anomaly of 3000 over 1000, got %+v", a)
+		}
+	default:
+		t.Fatal("Expected anomaly alert")
+	}
+
+	// Latencies haven't been recorded, so they aren't compared.
+	m.evaluateAnomaly(&alertState{threshold: m.opts.AnomalyFactor}, latencyAnomaly, 0, time.Now())
+	select {
+	case a := <-alerts:
+		t.Fatalf("Expected no latency anomaly alert, got %+v", a)
+	default:
+	}
+
+	m.sizeHist.Rotate()
+	record(1500)
+	m.evaluateAnomaly(state, sizeAnomaly, 0, time.Now())
+	select {
+	case a := <-alerts:
+		if !a.Recovered || a.Anomaly != sizeAnomaly {
+			t.Fatalf("Expected size anomaly recovery, got %+v", a)
+		}
+	default:
+		t.Fatal("Expected anomaly recovery")
+	}
+}
+
+// TestMonitorSnapshot ensures Snapshot reflects the logs which have been
+// collected.
+func TestMonitorSnapshot(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	for i := 0; i < 3; i++ {
+		file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+	}
+	file.WriteString("not a log\n")
+	file.WriteString(fmt.Sprintf("::1 - - [%s] \"-\" 400 0\n", time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:    testAlertWindow,
+		NumTopSections: 1,
+		NumTopIPs:      1,
+		Output:         ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	go m.Start()
+	defer m.Stop()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		s := m.Snapshot()
+		if s.StatusFreq.Successful == 3 && s.StatusFreq.ClientError == 1 {
+			if len(s.TopSections) != 1 || string(s.TopSections[0].Data) != "/customers" {
+				t.Fatalf("Expected top section /customers, got %v", s.TopSections)
+			}
+			if len(s.TopIPs) != 1 || string(s.TopIPs[0].Data) != "::1" {
+				t.Fatalf("Expected top IP ::1, got %v", s.TopIPs)
+			}
+			if s.DistinctPaths != 1 {
+				t.Fatalf("Expected 1 distinct path, got %d", s.DistinctPaths)
+			}
+			if s.MethodFreq["GET"] != 3 {
+				t.Fatalf("Expected 3 GET requests, got %d", s.MethodFreq["GET"])
+			}
+			if s.ProtocolFreq["HTTP/1.1"] != 3 {
+				t.Fatalf("Expected 3 HTTP/1.1 requests, got %d", s.ProtocolFreq["HTTP/1.1"])
+			}
+			if s.SkippedLines != 1 {
+				t.Fatalf("Expected 1 skipped line, got %d", s.SkippedLines)
+			}
+			if s.MalformedRequests != 1 {
+				t.Fatalf("Expected 1 malformed request, got %d", s.MalformedRequests)
+			}
+			if s.TotalRequests != 4 {
+				t.Fatalf("Expected 4 total requests, got %d", s.TotalRequests)
+			}
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("Expected 3 successful responses, got %d", s.StatusFreq.Successful)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// TestMonitorDrain ensures every log read before the Monitor stops is counted
+// and its hit recorded by the time Start returns, both when stopped and when
+// the end of the file is reached.
+func TestMonitorDrain(t *testing.T) {
+	const numLogs = 5000
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	for i := 0; i < numLogs; i++ {
+		file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+	}
+
+	recordedHits := func(m *Monitor) uint64 {
+		m.averager.mu.RLock()
+		defer m.averager.mu.RUnlock()
+		var sum uint64
+		for _, b := range m.averager.buckets {
+			sum += b
+		}
+		return sum
+	}
+
+	for _, noFollow := range []bool{true, false} {
+		var processed int32
+		m, err := New(file.Name(), MonitorOpts{
+			AlertWindow: time.Minute,
+			NoFollow:    noFollow,
+			LogHook:     func(Log) { atomic.AddInt32(&processed, 1) },
+			Output:      ioutil.Discard,
+		})
+		if err != nil {
+			t.Fatalf("Error creating Monitor: %v", err)
+		}
+		done := make(chan error)
+		go func() { done <- m.Start() }()
+		if !noFollow {
+			deadline := time.After(5 * time.Second)
+			for atomic.LoadInt32(&processed) < numLogs {
+				select {
+				case <-deadline:
+					t.Fatalf("Expected %d logs to be processed, got %d", numLogs, atomic.LoadInt32(&processed))
+				case <-time.After(time.Millisecond):
+				}
+			}
+			m.Stop()
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("Error running Monitor: %v", err)
+		}
+
+		if total := m.Snapshot().TotalRequests; total != numLogs {
+			t.Fatalf("Expected %d total requests (no follow %t), got %d", numLogs, noFollow, total)
+		}
+		if hits := recordedHits(m); hits != numLogs {
+			t.Fatalf("Expected %d recorded hits (no follow %t), got %d", numLogs, noFollow, hits)
+		}
+	}
+}
+
+// TestMonitorNoFollow ensures Start returns once the end of the file is
+// reached and a final summary is written when NoFollow is set.
+func TestMonitorNoFollow(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	for i := 0; i < 3; i++ {
+		file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+	}
+	file.Close()
+
+	var output bytes.Buffer
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:    testAlertWindow,
+		NumTopSections: 1,
+		NoFollow:       true,
+		Output:         &output,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- m.Start() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Error running Monitor: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Monitor to stop at end of file")
+	}
+
+	if s := m.Snapshot(); s.StatusFreq.Successful != 3 {
+		t.Fatalf("Expected 3 successful responses, got %d", s.StatusFreq.Successful)
+	}
+	if !strings.Contains(output.String(), "SUMMARY") {
+		t.Fatalf("Expected final summary, got %q", output.String())
+	}
+}
+
+// TestMonitorTimeRange ensures only logs within the time range are counted and
+// the Monitor stops at the first log past the end time when not following.
+func TestMonitorTimeRange(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	start := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	for i := -2; i < 1000; i++ {
+		file.WriteString(fmt.Sprintf(dummyLog, start.Add(time.Duration(i)*time.Minute).Format("02/Jan/2006:15:04:05 -0700")))
+	}
+
+	var processed int32
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow: testAlertWindow,
+		StartTime:   start,
+		EndTime:     start.Add(4 * time.Minute),
+		NoFollow:    true,
+		LogHook:     func(Log) { atomic.AddInt32(&processed, 1) },
+		Output:      ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("Error running Monitor: %v", err)
+	}
+	if s := m.Snapshot(); s.TotalRequests != 5 {
+		t.Fatalf("Expected 5 requests in range, got %d", s.TotalRequests)
+	}
+	if n := atomic.LoadInt32(&processed); n != 5 {
+		t.Fatalf("Expected 5 logs to be processed, got %d", n)
+	}
+}
+
+// TestMonitorReverseTimeRange ensures that when reading in reverse, only logs
+// within the time range are counted and the Monitor stops at the first log
+// before the start time rather than reading the rest of the file.
+func TestMonitorReverseTimeRange(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	// Reading the malformed first line would fail the Monitor.
+	file.WriteString("not a log\n")
+	start := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	for i := -2; i < 10; i++ {
+		file.WriteString(fmt.Sprintf(dummyLog, start.Add(time.Duration(i)*time.Minute).Format("02/Jan/2006:15:04:05 -0700")))
+	}
+
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:         testAlertWindow,
+		StartTime:           start,
+		EndTime:             start.Add(4 * time.Minute),
+		NoFollow:            true,
+		Reverse:             true,
+		MalformedLinePolicy: FailOnMalformedLines,
+		Output:              ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("Error running Monitor: %v", err)
+	}
+	if s := m.Snapshot(); s.TotalRequests != 5 {
+		t.Fatalf("Expected 5 requests in range, got %d", s.TotalRequests)
+	}
+}
+
+// TestMonitorMalformedLinePolicy ensures malformed lines are collected for
+// inspection or stop the Monitor according to the policy.
+func TestMonitorMalformedLinePolicy(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	now := time.Now().Format("02/Jan/2006:15:04:05 -0700")
+	file.WriteString(fmt.Sprintf(dummyLog, now) + "not a log\n" + fmt.Sprintf(dummyLog, now))
+
+	run := func(policy MalformedLinePolicy) (*Monitor, error) {
+		m, err := New(file.Name(), MonitorOpts{
+			AlertWindow:         testAlertWindow,
+			NoFollow:            true,
+			MalformedLinePolicy: policy,
+			Output:              ioutil.Discard,
+		})
+		if err != nil {
+			t.Fatalf("Error creating Monitor: %v", err)
+		}
+		return m, m.Start()
+	}
+
+	m, err := run(CollectMalformedLines)
+	if err != nil {
+		t.Fatalf("Error running Monitor: %v", err)
+	}
+	if lines := m.MalformedLines(); len(lines) != 1 || lines[0] != "not a log" {
+		t.Fatalf("Expected malformed line \"not a log\", got %q", lines)
+	}
+	if s := m.Snapshot(); s.TotalRequests != 2 || s.SkippedLines != 1 {
+		t.Fatalf("Expected 2 requests and 1 skipped line, got %d and %d", s.TotalRequests, s.SkippedLines)
+	}
+
+	m, err = run(FailOnMalformedLines)
+	if err == nil || !strings.Contains(err.Error(), "not a log") {
+		t.Fatalf("Expected error for malformed line, got %v", err)
+	}
+	if s := m.Snapshot(); s.TotalRequests != 1 {
+		t.Fatalf("Expected 1 request before the malformed line, got %d", s.TotalRequests)
+	}
+	if lines := m.MalformedLines(); len(lines) != 0 {
+		t.Fatalf("Expected no malformed lines collected, got %q", lines)
+	}
+}
+
+// TestMonitorTimestampLayout ensures timestamps are parsed using the
+// configured layout and that logs with invalid timestamps are counted.
+func TestMonitorTimestampLayout(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	for i := 0; i < 2; i++ {
+		file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format(time.RFC3339)))
+	}
+	file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+	file.Close()
+
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:     testAlertWindow,
+		TimestampLayout: time.RFC3339,
+		NoFollow:        true,
+		Output:          ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("Error running Monitor: %v", err)
+	}
+	s := m.Snapshot()
+	if s.StatusFreq.Successful != 3 {
+		t.Fatalf("Expected 3 successful responses, got %d", s.StatusFreq.Successful)
+	}
+	if s.InvalidTimestamps != 1 {
+		t.Fatalf("Expected 1 invalid timestamp, got %d", s.InvalidTimestamps)
+	}
+}
+
+// TestMonitorLogHook ensures the log hook is called with each collected log.
+func TestMonitorLogHook(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	for i := 0; i < 3; i++ {
+		file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+	}
+	file.Close()
+
+	var (
+		logs []Log
+		m    *Monitor
+	)
+	m, err = New(file.Name(), MonitorOpts{
+		AlertWindow: testAlertWindow,
+		NoFollow:    true,
+		Output:      ioutil.Discard,
+		LogHook: func(l Log) {
+			// Snapshot takes the collector lock, so this would deadlock if
+			// the hook were called while holding it.
+			m.Snapshot()
+			logs = append(logs, l)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("Error running Monitor: %v", err)
+	}
+	if len(logs) != 3 {
+		t.Fatalf("Expected 3 logs, got %d", len(logs))
+	}
+	if logs[0].Request != "GET /customers/directory.html HTTP/1.1" || logs[0].Status != 200 || logs[0].Size != 17 {
+		t.Fatalf("Expected GET /customers/directory.html with status 200 and size 17, got %+v", logs[0])
+	}
+}
+
+// TestMonitorStartContext ensures StartContext returns when the context is
+// canceled.
+func TestMonitorStartContext(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:    testAlertWindow,
+		NumTopSections: 1,
+		Output:         ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.StartContext(ctx) }()
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Monitor to stop when context is canceled")
+	}
+}
+
+// TestMonitorSummaryOnStop ensures a final summary including the logs collected
+// so far is written when a following Monitor is stopped and SummaryOnStop is
+// set.
+func TestMonitorSummaryOnStop(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	var output bytes.Buffer
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:    testAlertWindow,
+		NumTopSections: 1,
+		SummaryOnStop:  true,
+		Output:         &output,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- m.Start() }()
+	for i := 0; i < 3; i++ {
+		file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Snapshot().TotalRequests < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected logs to be collected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := m.Stop(); err != nil {
+		t.Fatalf("Error stopping Monitor: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Error running Monitor: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Monitor to stop")
+	}
+	if !strings.Contains(output.String(), "SUMMARY") || !strings.Contains(output.String(), "Total requests:\t\t3") {
+		t.Fatalf("Expected final summary with 3 requests, got %q", output.String())
+	}
+}
+
+// TestMonitorRestart ensures a stopped Monitor can be restarted and that
+// collected data doesn't carry over.
+func TestMonitorRestart(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	for i := 0; i < 3; i++ {
+		file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+	}
+
+	opts := MonitorOpts{
+		AlertWindow:    testAlertWindow,
+		NumTopSections: 1,
+		NoFollow:       true,
+		Output:         ioutil.Discard,
+	}
+	m, err := New(file.Name(), opts)
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("Error running Monitor: %v", err)
+	}
+	if s := m.Snapshot(); s.StatusFreq.Successful != 3 {
+		t.Fatalf("Expected 3 successful responses, got %d", s.StatusFreq.Successful)
+	}
+
+	file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+	opts.NumTopIPs = 1
+	if err := m.Restart(opts); err != nil {
+		t.Fatalf("Error restarting Monitor: %v", err)
+	}
+	s := m.Snapshot()
+	if s.StatusFreq.Successful != 4 {
+		t.Fatalf("Expected 4 successful responses, got %d", s.StatusFreq.Successful)
+	}
+	if len(s.TopIPs) != 1 {
+		t.Fatalf("Expected 1 top IP, got %d", len(s.TopIPs))
+	}
+
+	opts.Quantum = time.Hour
+	if err := m.Restart(opts); err == nil {
+		t.Fatal("Expected error for invalid options")
+	}
+}
+
+// TestMonitorReset ensures Reset clears the collected data while the Monitor
+// keeps collecting new logs.
+func TestMonitorReset(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	for i := 0; i < 3; i++ {
+		file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+	}
+
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:    testAlertWindow,
+		NumTopSections: 1,
+		NumTopIPs:      1,
+		Output:         ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	go m.Start()
+	defer m.Stop()
+
+	waitFor := func(successful uint64) *Summary {
+		deadline := time.After(5 * time.Second)
+		for {
+			s := m.Snapshot()
+			if s.StatusFreq.Successful == successful {
+				return s
+			}
+			select {
+			case <-deadline:
+				t.Fatalf("Expected %d successful responses, got %d", successful, s.StatusFreq.Successful)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+	waitFor(3)
+
+	m.Reset()
+	s := m.Snapshot()
+	if s.TotalRequests != 0 || s.DistinctIPs != 0 || len(s.TopSections) != 0 || len(s.TopIPs) != 0 {
+		t.Fatalf("Expected empty summary after reset, got %+v", s)
+	}
+	if s.SizeHist.TotalCount() != 0 {
+		t.Fatalf("Expected empty size histogram after reset, got %d", s.SizeHist.TotalCount())
+	}
+
+	file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+	if s := waitFor(1); s.TotalRequests != 1 || len(s.TopSections) != 1 {
+		t.Fatalf("Expected 1 request in top section after reset, got %d in %v", s.TotalRequests, s.TopSections)
+	}
+}
+
+// TestMonitorWorkers ensures the summary merged from multiple workers matches
+// the summary from a single worker.
+func TestMonitorWorkers(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	now := time.Now().Format("02/Jan/2006:15:04:05 -0700")
+	sections := []string{"/a", "/a", "/a", "/a", "/b", "/b", "/b", "/c", "/c", "/d"}
+	for i := 0; i < 2000; i++ {
+		file.WriteString(fmt.Sprintf("10.0.%d.%d - - [%s] \"GET %s/%d HTTP/1.1\" %d %d\n",
+			i%7, i%97, now, sections[i%len(sections)], i%50, 200+i%3*100, i))
+	}
+
+	summarize := func(workers int) *Summary {
+		m, err := New(file.Name(), MonitorOpts{
+			AlertWindow:    testAlertWindow,
+			NumTopSections: 2,
+			NumTopIPs:      3,
+			NoFollow:       true,
+			Workers:        workers,
+			Output:         ioutil.Discard,
+		})
+		if err != nil {
+			t.Fatalf("Error creating Monitor: %v", err)
+		}
+		if err := m.Start(); err != nil {
+			t.Fatalf("Error running Monitor: %v", err)
+		}
+		return m.Snapshot()
+	}
+	expected, s := summarize(1), summarize(4)
+
+	if s.TotalRequests != 2000 || s.TotalRequests != expected.TotalRequests {
+		t.Fatalf("Expected 2000 total requests, got %d", s.TotalRequests)
+	}
+	if s.StatusFreq != expected.StatusFreq {
+		t.Fatalf("Expected status frequencies %+v, got %+v", expected.StatusFreq, s.StatusFreq)
+	}
+	if s.MethodFreq["GET"] != 2000 {
+		t.Fatalf("Expected 2000 GET requests, got %d", s.MethodFreq["GET"])
+	}
+	if s.DistinctIPs != expected.DistinctIPs || s.DistinctPaths != expected.DistinctPaths {
+		t.Fatalf("Expected %d distinct IPs and %d distinct paths, got %d and %d",
+			expected.DistinctIPs, expected.DistinctPaths, s.DistinctIPs, s.DistinctPaths)
+	}
+	if s.SizeHist.TotalCount() != 2000 || s.SizeHist.Max() != expected.SizeHist.Max() {
+		t.Fatalf("Expected 2000 sizes up to %d, got %d up to %d",
+			expected.SizeHist.Max(), s.SizeHist.TotalCount(), s.SizeHist.Max())
+	}
+	if len(s.TopSections) != 2 {
+		t.Fatalf("Expected 2 top sections, got %v", s.TopSections)
+	}
+	for i, e := range s.TopSections {
+		if string(e.Data) != string(expected.TopSections[i].Data) || e.Freq != expected.TopSections[i].Freq {
+			t.Errorf("Expected top section %s with %d hits, got %s with %d",
+				expected.TopSections[i].Data, expected.TopSections[i].Freq, e.Data, e.Freq)
+		}
+	}
+	if top := s.TopSections[1]; string(top.Data) != "/a" || top.Freq != 800 {
+		t.Fatalf("Expected /a with 800 hits, got %s with %d", top.Data, top.Freq)
+	}
+}
+
+// TestMonitorIngest ensures logs passed to Ingest are aggregated as if they had
+// been read, without starting the Monitor.
+func TestMonitorIngest(t *testing.T) {
+	for _, workers := range []int{1, 3} {
+		m, err := New("", MonitorOpts{
+			AlertWindow:    testAlertWindow,
+			NumTopSections: 1,
+			NumTopIPs:      1,
+			Workers:        workers,
+			EndTime:        time.Now().Add(time.Hour),
+			Reader:         &logsReader{},
+			Output:         ioutil.Discard,
+		})
+		if err != nil {
+			t.Fatalf("Error creating Monitor: %v", err)
+		}
+		for i := 0; i < 30; i++ {
+			if !m.Ingest(Log{
+				RemoteAddr: "10.0.0.1:51234",
+				Timestamp:  time.Now(),
+				Request:    "GET /pages/index.html HTTP/1.1",
+				Status:     200,
+				Size:       100,
+			}) {
+				t.Fatal("Expected log to be in range")
+			}
+		}
+		if m.Ingest(Log{Timestamp: time.Now().Add(2 * time.Hour), Status: 200}) {
+			t.Fatal("Expected log past the end time to be out of range")
+		}
+
+		s := m.Snapshot()
+		if s.TotalRequests != 30 || s.StatusFreq.Successful != 30 {
+			t.Fatalf("Expected 30 successful requests, got %d and %d", s.TotalRequests, s.StatusFreq.Successful)
+		}
+		if len(s.TopSections) != 1 || string(s.TopSections[0].Data) != "/pages" || s.TopSections[0].Freq != 30 {
+			t.Fatalf("Expected /pages with 30 hits, got %v", s.TopSections)
+		}
+		if len(s.TopIPs) != 1 || string(s.TopIPs[0].Data) != "10.0.0.1" {
+			t.Fatalf("Expected top IP 10.0.0.1, got %v", s.TopIPs)
+		}
+		if s.SizeHist.TotalCount() != 30 {
+			t.Fatalf("Expected 30 sizes, got %d", s.SizeHist.TotalCount())
+		}
+		if hits := m.averager.buckets[m.averager.idx]; hits != 30 {
+			t.Fatalf("Expected 30 hits, got %d", hits)
+		}
+	}
+}
+
+// TestMonitorRecoversProcessPanic ensures a panic while processing a log is
+// reported and the log skipped without stopping the Monitor.
+func TestMonitorRecoversProcessPanic(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	now := time.Now().Format("02/Jan/2006:15:04:05 -0700")
+	file.WriteString(strings.Repeat(fmt.Sprintf(dummyLog, now), 3))
+
+	var (
+		output bytes.Buffer
+		calls  int32
+	)
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow: testAlertWindow,
+		NoFollow:    true,
+		LogHook: func(Log) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				panic("unexpected log")
+			}
+		},
+		Output: &output,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("Error running Monitor: %v", err)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 3 {
+		t.Fatalf("Expected all 3 logs to be processed, got %d", calls)
+	}
+	if s := m.Snapshot(); s.TotalRequests != 3 {
+		t.Fatalf("Expected 3 requests, got %d", s.TotalRequests)
+	}
+	if !strings.Contains(output.String(), "Recovered from panic while processing log: unexpected log") {
+		t.Fatalf("Expected the panic to be reported, got:\n%s", output.String())
+	}
+}
+
+// TestMonitorSuccessRate ensures client errors only count against the
+// summary's success rate if ClientErrorsAsFailures is set.
+func TestMonitorSuccessRate(t *testing.T) {
+	for _, clientErrors := range []bool{false, true} {
+		m, err := New("", MonitorOpts{
+			AlertWindow:            testAlertWindow,
+			NumTopSections:         1,
+			NumTopIPs:              1,
+			ClientErrorsAsFailures: clientErrors,
+			Reader:                 &logsReader{},
+			Output:                 ioutil.Discard,
+		})
+		if err != nil {
+			t.Fatalf("Error creating Monitor: %v", err)
+		}
+		for _, status := range []int{200, 200, 404, 500} {
+			m.Ingest(Log{Timestamp: time.Now(), Request: "GET /pages HTTP/1.1", Status: status})
+		}
+
+		expected := 0.75
+		if clientErrors {
+			expected = 0.5
+		}
+		if rate := m.Snapshot().SuccessRate; rate != expected {
+			t.Fatalf("Expected success rate %g with client errors %t, got %g", expected, clientErrors, rate)
+		}
+	}
+}
+
+// TestMonitorStatusWindow ensures the recent status frequencies are merged
+// across workers alongside the totals and cleared by a reset.
+func TestMonitorStatusWindow(t *testing.T) {
+	m, err := New("", MonitorOpts{
+		AlertWindow:    testAlertWindow,
+		NumTopSections: 1,
+		StatusWindow:   time.Minute,
+		Workers:        2,
+		Reader:         &logsReader{},
+		Output:         ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	for _, status := range []int{200, 200, 404, 500} {
+		m.Ingest(Log{Timestamp: time.Now(), Request: "GET /pages HTTP/1.1", Status: status})
+	}
+
+	expected := statusFreq{Successful: 2, ClientError: 1, ServerError: 1}
+	s := m.Snapshot()
+	if s.RecentStatusFreq != expected || s.StatusFreq != expected || s.StatusWindow != time.Minute {
+		t.Fatalf("Expected recent and total statuses %+v over 1m, got %+v and %+v over %s",
+			expected, s.RecentStatusFreq, s.StatusFreq, s.StatusWindow)
+	}
+
+	m.Reset()
+	if s := m.Snapshot(); s.RecentStatusFreq != (statusFreq{}) {
+		t.Fatalf("Expected no recent statuses after reset, got %+v", s.RecentStatusFreq)
+	}
+}
+
+// TestMonitorDistinctIPWindow ensures the windowed distinct IP count decreases
+// once a cohort of IPs stops appearing, while the total since the Monitor
+// started doesn't.
+func TestMonitorDistinctIPWindow(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:      testAlertWindow,
+		DistinctIPWindow: 60 * time.Millisecond,
+		Output:           ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	go m.Start()
+	defer m.Stop()
+	ingest := func(first, last int) {
+		for i := first; i < last; i++ {
+			m.Ingest(Log{Timestamp: time.Now(), RemoteAddr: fmt.Sprintf("%d.0.0.10", i),
+				Request: "GET /pages HTTP/1.1", Status: 200})
+		}
+	}
+
+	ingest(0, 10)
+	if s := m.Snapshot(); s.DistinctIPs != 10 || s.TotalDistinctIPs != 10 {
+		t.Fatalf("Expected 10 recent and total distinct IPs, got %d and %d", s.DistinctIPs, s.TotalDistinctIPs)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Snapshot().DistinctIPs > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the first cohort of IPs to age out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ingest(10, 15)
+	if s := m.Snapshot(); s.DistinctIPs != 5 || s.TotalDistinctIPs != 15 {
+		t.Fatalf("Expected 5 recent and 15 total distinct IPs, got %d and %d", s.DistinctIPs, s.TotalDistinctIPs)
+	}
+}
+
+// TestMonitorDisabledAggregations ensures disabled aggregations are skipped
+// and omitted from the summary while the others are still aggregated.
+func TestMonitorDisabledAggregations(t *testing.T) {
+	m, err := New("", MonitorOpts{
+		AlertWindow:          testAlertWindow,
+		NumTopSections:       1,
+		Workers:              2,
+		Reader:               &logsReader{},
+		Output:               ioutil.Discard,
+		DisableDistinctIPs:   true,
+		DisableDistinctPaths: true,
+		DisableSizeHistogram: true,
+		DisableTopSections:   true,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		m.Ingest(Log{Timestamp: time.Now(), RemoteAddr: "127.0.0.1", Request: "GET /pages HTTP/1.1",
+			Status: 200, Size: 512})
+	}
+
+	s := m.Snapshot()
+	switch {
+	case s.TotalRequests != 4 || s.StatusFreq.Successful != 4:
+		t.Fatalf("Expected 4 successful requests, got %d and %+v", s.TotalRequests, s.StatusFreq)
+	case s.DistinctIPs != 0 || s.DistinctPaths != 0 || s.SizeHist != nil || len(s.TopSections) != 0:
+		t.Fatalf("Expected no distinct counts, size histogram, or sections, got %+v", s)
+	case !s.DistinctIPsDisabled || !s.DistinctPathsDisabled || !s.SizeHistDisabled || !s.TopSectionsDisabled:
+		t.Fatalf("Expected aggregations to be marked disabled, got %+v", s)
+	}
+
+	str := s.String()
+	for _, omitted := range []string{"SECTION", "Unique visitors", "Unique paths", "response size"} {
+		if strings.Contains(str, omitted) {
+			t.Errorf("Expected %q to be omitted, got:\n%s", omitted, str)
+		}
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Error marshaling summary: %v", err)
+	}
+	for _, omitted := range []string{`"distinct_ips"`, `"distinct_paths"`, `"size"`} {
+		if bytes.Contains(data, []byte(omitted)) {
+			t.Errorf("Expected %s to be omitted, got %s", omitted, data)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeMetrics(&buf, s); err != nil {
+		t.Fatalf("Error writing metrics: %v", err)
+	}
+	if strings.Contains(buf.String(), "distinct_ips") || strings.Contains(buf.String(), "response_size_bytes") {
+		t.Errorf("Expected disabled metrics to be omitted, got:\n%s", buf.String())
+	}
+}
+
+// TestMonitorRecentLogs ensures the most recently collected logs are kept,
+// including those which aren't sampled, but not those outside of the time
+// range, and that none are kept by default.
+func TestMonitorRecentLogs(t *testing.T) {
+	now := time.Now()
+	m, err := New("", MonitorOpts{
+		AlertWindow:      testAlertWindow,
+		NumTopSections:   1,
+		Workers:          2,
+		SampleRate:       0.01,
+		StartTime:        now.Add(-time.Hour),
+		Reader:           &logsReader{},
+		Output:           ioutil.Discard,
+		RecentBufferSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	m.Ingest(Log{Timestamp: now.Add(-2 * time.Hour), Request: "GET /old HTTP/1.1", Status: 200})
+	for _, path := range []string{"/a", "/b", "/c"} {
+		m.Ingest(Log{Timestamp: now, Request: "GET " + path + " HTTP/1.1", Status: 200})
+	}
+	m.Ingest(Log{Timestamp: now.Add(-2 * time.Hour), Request: "GET /old HTTP/1.1", Status: 200})
+
+	logs := m.RecentLogs()
+	if len(logs) != 2 || logs[0].Request != "GET /b HTTP/1.1" || logs[1].Request != "GET /c HTTP/1.1" {
+		t.Fatalf("Expected /b and /c, got %+v", logs)
+	}
+	m.Reset()
+	if logs := m.RecentLogs(); len(logs) != 0 {
+		t.Fatalf("Expected no logs after reset, got %+v", logs)
+	}
+
+	m, err = New("", MonitorOpts{AlertWindow: testAlertWindow, Reader: &logsReader{}, Output: ioutil.Discard})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	m.Ingest(Log{Timestamp: now, Request: "GET /a HTTP/1.1", Status: 200})
+	if logs := m.RecentLogs(); logs != nil {
+		t.Fatalf("Expected no logs by default, got %+v", logs)
+	}
+}
+
+// TestMonitorFirstLastSeen ensures the span of the collected logs' timestamps
+// is tracked regardless of the order they're collected in, excluding logs
+// with invalid timestamps, and is cleared by a reset.
+func TestMonitorFirstLastSeen(t *testing.T) {
+	m, err := New("", MonitorOpts{
+		AlertWindow: testAlertWindow,
+		Workers:     2,
+		Reader:      &logsReader{},
+		Output:      ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	if s := m.Snapshot(); !s.FirstSeen.IsZero() || !s.LastSeen.IsZero() {
+		t.Fatalf("Expected no span, got %s to %s", s.FirstSeen, s.LastSeen)
+	}
+	first := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	for _, offset := range []time.Duration{time.Hour, 0, 3 * time.Hour, 2 * time.Hour} {
+		m.Ingest(Log{Timestamp: first.Add(offset), Request: "GET /pages HTTP/1.1", Status: 200})
+	}
+	m.Ingest(Log{Request: "GET /pages HTTP/1.1", Status: 200})
+
+	s := m.Snapshot()
+	if !s.FirstSeen.Equal(first) || !s.LastSeen.Equal(first.Add(3*time.Hour)) {
+		t.Fatalf("Expected span from %s to %s, got %s to %s", first, first.Add(3*time.Hour), s.FirstSeen, s.LastSeen)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Error marshaling summary: %v", err)
+	}
+	if !bytes.Contains(data, []byte(`"first_seen":"2024-01-02T15:00:00Z","last_seen":"2024-01-02T18:00:00Z"`)) {
+		t.Fatalf("Expected span in JSON, got %s", data)
+	}
+
+	m.Reset()
+	if s := m.Snapshot(); !s.FirstSeen.IsZero() || !s.LastSeen.IsZero() {
+		t.Fatalf("Expected no span after reset, got %s to %s", s.FirstSeen, s.LastSeen)
+	}
+}
+
+// BenchmarkMonitorIngest measures the throughput of aggregating logs passed to
+// Ingest.
+func BenchmarkMonitorIngest(b *testing.B) {
+	m, err := New("", MonitorOpts{
+		AlertWindow:    time.Minute,
+		NumTopSections: 5,
+		NumTopIPs:      5,
+		Reader:         &logsReader{},
+		Output:         ioutil.Discard,
+	})
+	if err != nil {
+		b.Fatalf("Error creating Monitor: %v", err)
+	}
+	logs := make([]Log, 1000)
+	now := time.Now()
+	for i := range logs {
+		logs[i] = Log{
+			RemoteAddr: fmt.Sprintf("10.0.%d.%d", i/256, i%256),
+			Timestamp:  now,
+			Request:    fmt.Sprintf("GET /section%d/page%d HTTP/1.1", i%20, i),
+			Status:     200,
+			Size:       int64(i),
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Ingest(logs[i%len(logs)])
+	}
+}
+
+// TestMonitorSizeBuckets ensures responses are counted in the configured size
+// buckets, which may be given in any order, and merged across workers.
+func TestMonitorSizeBuckets(t *testing.T) {
+	for _, workers := range []int{1, 2} {
+		m, err := New("", MonitorOpts{
+			AlertWindow: testAlertWindow,
+			SizeBuckets: []int64{100, 10},
+			Workers:     workers,
+			Reader:      &logsReader{},
+			Output:      ioutil.Discard,
+		})
+		if err != nil {
+			t.Fatalf("Error creating Monitor: %v", err)
+		}
+		for _, size := range []int64{0, 9, 10, 99, 100, 5000} {
+			m.Ingest(Log{Timestamp: time.Now(), Request: "GET / HTTP/1.1", Status: 200, Size: size})
+		}
+		expected := []SizeBucket{{0, 10, 2}, {10, 100, 2}, {100, 0, 2}}
+		if buckets := m.Snapshot().SizeBuckets; !reflect.DeepEqual(buckets, expected) {
+			t.Fatalf("Expected size buckets %v, got %v", expected, buckets)
+		}
+
+		m.Reset()
+		if buckets := m.Snapshot().SizeBuckets; buckets[0].Count+buckets[1].Count+buckets[2].Count != 0 {
+			t.Fatalf("Expected empty size buckets after reset, got %v", buckets)
+		}
+	}
+}
+
+// TestNewInvalidOptions ensures New returns an error rather than panicking
+// when the options are invalid.
+func TestNewInvalidOptions(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	for name, opts := range map[string]MonitorOpts{
+		"zero alert window":              {},
+		"alert window less than quantum": {AlertWindow: time.Second, Quantum: 2 * time.Second},
+		"negative quantum":               {AlertWindow: time.Second, Quantum: -time.Second},
+		"negative alert threshold":       {AlertWindow: time.Second, AlertThreshold: -1},
+		"negative low traffic threshold": {AlertWindow: time.Second, LowTrafficThreshold: -1},
+		"unknown malformed line policy":  {AlertWindow: time.Second, MalformedLinePolicy: 3},
+		"non-positive size bucket":       {AlertWindow: time.Second, SizeBuckets: []int64{1000, 0}},
+		"duplicate size bucket":          {AlertWindow: time.Second, SizeBuckets: []int64{1000, 1000}},
+		"invalid alert rule":             {AlertWindow: time.Second, AlertRules: []AlertRule{{Name: "rule", Metric: "latency"}}},
+		"duplicate alert rule": {AlertWindow: time.Second, AlertRules: []AlertRule{
+			{Name: "rule", Metric: MetricHits}, {Name: "rule", Metric: MetricBytes},
+		}},
+		"negative alert eval interval":      {AlertWindow: time.Second, AlertEvalInterval: -time.Second},
+		"negative alert cooldown":           {AlertWindow: time.Second, AlertCooldown: -time.Second},
+		"negative reporting interval":       {AlertWindow: time.Second, ReportingInterval: -time.Second},
+		"negative sample rate":              {AlertWindow: time.Second, SampleRate: -1},
+		"sample rate above one":             {AlertWindow: time.Second, SampleRate: 1.5},
+		"negative section decay interval":   {AlertWindow: time.Second, SectionDecayInterval: -time.Second},
+		"section decay of one":              {AlertWindow: time.Second, SectionDecay: 1},
+		"invalid alert template":            {AlertWindow: time.Second, AlertTemplate: "{{.AvgHits"},
+		"unknown recovery template field":   {AlertWindow: time.Second, RecoveryTemplate: "{{.Unknown}}"},
+		"invalid watched status":            {AlertWindow: time.Second, WatchedStatuses: []StatusWatch{{Pattern: "x03"}}},
+		"negative watched status threshold": {AlertWindow: time.Second, WatchedStatuses: []StatusWatch{{Pattern: "429", Threshold: -1}}},
+		"negative file wait timeout":        {AlertWindow: time.Second, FileWaitTimeout: -time.Second},
+		"zero size quantile":                {AlertWindow: time.Second, SizeQuantiles: []float64{50, 0}},
+		"negative size quantile":            {AlertWindow: time.Second, SizeQuantiles: []float64{-1}},
+		"size quantile greater than 100":    {AlertWindow: time.Second, SizeQuantiles: []float64{100.1}},
+		"invalid ignore pattern":            {AlertWindow: time.Second, IgnorePatterns: []string{"/health("}},
+		"invalid Pushgateway URL":           {AlertWindow: time.Second, PushgatewayURL: "localhost"},
+		"anomaly factor of one":             {AlertWindow: time.Second, AnomalyFactor: 1},
+		"anomaly quantile above 100":        {AlertWindow: time.Second, AnomalyQuantile: 101},
+		"end time before start time":        {AlertWindow: time.Second, StartTime: time.Unix(10, 0), EndTime: time.Unix(5, 0)},
+		"reverse while following":           {AlertWindow: time.Second, Reverse: true},
+		"negative workers":                  {AlertWindow: time.Second, Workers: -1},
+		"unknown minimum level":             {AlertWindow: time.Second, MinLevel: "loud"},
+		"unknown section query mode":        {AlertWindow: time.Second, SectionQuery: 3},
+		"params mode without params":        {AlertWindow: time.Second, SectionQuery: SectionQueryParams},
+		"params without params mode":        {AlertWindow: time.Second, SectionQuery: MarkQuery, SectionQueryParams: []string{"q"}},
+		"invalid path ID pattern":           {AlertWindow: time.Second, NormalizePathIDs: true, PathIDPatterns: []string{"[0-9"}},
+		"ID patterns without normalizing":   {AlertWindow: time.Second, PathIDPatterns: []string{"[0-9]+"}},
+		"IP window without distinct IPs":    {AlertWindow: time.Second, DistinctIPWindow: time.Minute, DisableDistinctIPs: true},
+		"anomalies without size histogram":  {AlertWindow: time.Second, AnomalyFactor: 2, DisableSizeHistogram: true},
+	} {
+		opts.Output = ioutil.Discard
+		if _, err := New(file.Name(), opts); err == nil {
+			t.Errorf("Expected error for %s", name)
+		}
+	}
+
+	// Zero top sections and IPs disables tracking them rather than panicking.
+	file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow: time.Second,
+		Quantum:     100 * time.Millisecond,
+		NoFollow:    true,
+		Output:      ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("Error running Monitor: %v", err)
+	}
+	if s := m.Snapshot(); len(s.TopSections) != 0 || s.StatusFreq.Successful != 1 {
+		t.Fatalf("Expected 1 successful response and no top sections, got %d and %v",
+			s.StatusFreq.Successful, s.TopSections)
+	}
+}
+
+// TestNewMulti ensures a Monitor created for multiple files collects the
+// combined data from all of them.
+func TestNewMulti(t *testing.T) {
+	var files []string
+	for i := 1; i <= 3; i++ {
+		file, err := ioutil.TempFile("", "access_log")
+		if err != nil {
+			t.Fatalf("Error creating log file: %v", err)
+		}
+		defer os.Remove(file.Name())
+		for j := 0; j < i; j++ {
+			file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+		}
+		file.Close()
+		files = append(files, file.Name())
+	}
+
+	m, err := NewMulti(files, MonitorOpts{
+		AlertWindow:    testAlertWindow,
+		NumTopSections: 1,
+		NoFollow:       true,
+		Output:         ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("Error running Monitor: %v", err)
+	}
+	if s := m.Snapshot(); s.StatusFreq.Successful != 6 {
+		t.Fatalf("Expected 6 successful responses, got %d", s.StatusFreq.Successful)
+	}
+}
+
+// openFailReader is a Reader which fails to open.
+type openFailReader struct{}
+
+func (openFailReader) Open() (<-chan *Log, error) { return nil, errors.New("open failed") }
+
+func (openFailReader) Close() error { return nil }
+
+func (openFailReader) Err() error { return nil }
+
+// flushingReader is a Reader which sends the given log entries and then, like
+// a fileReader with a partial line, sends a final log entry once it's closed
+// and then closes its channel.
+type flushingReader struct {
+	initial []*log
+	logs    chan *log
+	close   chan struct{}
+	stopped chan struct{}
+}
+
+func newFlushingReader(initial ...*log) *flushingReader {
+	return &flushingReader{
+		initial: initial,
+		logs:    make(chan *log),
+		close:   make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (r *flushingReader) open() (<-chan *log, error) {
+	go func() {
+		defer close(r.stopped)
+		defer close(r.logs)
+		for _, l := range r.initial {
+			r.logs <- l
+		}
+		<-r.close
+		r.logs <- &log{}
+	}()
+	return r.logs, nil
+}
+
+func (r *flushingReader) Open() (<-chan *Log, error) { return exportLogs(r.open()) }
+
+func (r *flushingReader) Close() error {
+	close(r.close)
+	return nil
+}
+
+func (r *flushingReader) Err() error { return nil }
+
+// TestMultiReaderCloseDrains ensures the Readers' logs are received until
+// they stop after the multiReader is closed, even if nothing is receiving its
+// logs, so that they aren't left blocked.
+func TestMultiReaderCloseDrains(t *testing.T) {
+	child := newFlushingReader()
+	r := newMultiReader(child)
+	if _, err := r.open(); err != nil {
+		t.Fatalf("Error opening reader: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Error closing reader: %v", err)
+	}
+	select {
+	case <-child.stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected reader to stop")
+	}
+}
+
+// TestMultiReaderOpenFails ensures that if one of the Readers fails to open,
+// the error is returned and the Readers which were already started stop
+// forwarding their logs rather than blocking.
+func TestMultiReaderOpenFails(t *testing.T) {
+	r := newMultiReader(&logsReader{logs: []*log{{}, {}}}, openFailReader{})
+	if _, err := openReader(r); err == nil {
+		t.Fatal("Expected error opening reader")
+	}
+	stopped := make(chan struct{})
+	go func() {
+		r.running.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected readers to stop forwarding logs")
+	}
+}
+
 // generateLogs writes dummy logs to the given file for each of the
 // rateIntervals in sequential order.
 func generateLogs(file *os.File, stop <-chan struct{}, rateConfig []rateInterval) {
@@ -0,0 +1,200 @@
+package monitor
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// multiReader implements the Reader interface by fanning in the logs from
+// several Readers. If any of the Readers stops due to an error, all of them
+// are closed. Readers can also be added once it's open.
+type multiReader struct {
+	readers   []Reader
+	logs      chan *log
+	running   sync.WaitGroup
+	done      chan struct{}
+	mu        sync.Mutex
+	err       error
+	closed    bool
+	policy    MalformedLinePolicy
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// newMultiReader returns a new multiReader which fans in the logs from the
+// given Readers.
+func newMultiReader(readers ...Reader) *multiReader {
+	return &multiReader{
+		readers: readers,
+		logs:    make(chan *log),
+		done:    make(chan struct{}),
+	}
+}
+
+// open opens each of the Readers and places their logs on the channel. The
+// channel is closed once all of the Readers have stopped.
+func (m *multiReader) open() (<-chan *log, error) {
+	m.mu.Lock()
+	for _, r := range m.readers {
+		if err := m.start(r); err != nil {
+			m.mu.Unlock()
+			m.Close()
+			return nil, err
+		}
+	}
+	m.mu.Unlock()
+	go func() {
+		m.running.Wait()
+		close(m.logs)
+	}()
+	return m.logs, nil
+}
+
+// Open implements the Reader interface.
+func (m *multiReader) Open() (<-chan *Log, error) {
+	return exportLogs(m.open())
+}
+
+// add opens the given Reader and places its logs on the channel along with
+// those of the other Readers. It must only be called while the channel is
+// held open, i.e. by a caller which has added to running before Open. If the
+// multiReader has been closed, the Reader is closed instead.
+func (m *multiReader) add(r Reader) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return r.Close()
+	}
+	if h, ok := r.(malformedLineHandler); ok {
+		h.setMalformedLinePolicy(m.policy)
+	}
+	m.readers = append(m.readers, r)
+	return m.start(r)
+}
+
+// start opens the given Reader and forwards its logs in the background until
+// they end or the multiReader is closed, so forwarding doesn't block if Open
+// fails after some of the Readers were started. Once closed, the remaining
+// logs are discarded. The mutex must be held.
+func (m *multiReader) start(r Reader) error {
+	logs, err := openReader(r)
+	if err != nil {
+		return err
+	}
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		for l := range logs {
+			select {
+			case m.logs <- l:
+			case <-m.done:
+				// The Reader has been closed, but it may still be
+				// sending, e.g. a partial line, so receive until it
+				// stops rather than leaving it blocked.
+				for range logs {
+				}
+				return
+			}
+		}
+		if err := r.Err(); err != nil {
+			m.fail(err)
+		}
+	}()
+	return nil
+}
+
+// Close stops all of the Readers. Calling Close more than once has no effect.
+func (m *multiReader) Close() error {
+	m.closeOnce.Do(func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.closed = true
+		close(m.done)
+		for _, r := range m.readers {
+			if err := r.Close(); err != nil && m.closeErr == nil {
+				m.closeErr = err
+			}
+		}
+	})
+	return m.closeErr
+}
+
+// Err returns the first error, if any, which caused one of the Readers to
+// stop. It should be called once the channel returned by Open has been closed.
+func (m *multiReader) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// Skipped returns the total number of lines skipped by the Readers because
+// they could not be parsed.
+func (m *multiReader) Skipped() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var skipped uint64
+	for _, r := range m.readers {
+		if sc, ok := r.(skipCounter); ok {
+			skipped += sc.Skipped()
+		}
+	}
+	return skipped
+}
+
+// setMalformedLinePolicy sets how the Readers, including those added later,
+// handle malformed lines, if they're configurable.
+func (m *multiReader) setMalformedLinePolicy(policy MalformedLinePolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policy = policy
+	for _, r := range m.readers {
+		if h, ok := r.(malformedLineHandler); ok {
+			h.setMalformedLinePolicy(policy)
+		}
+	}
+}
+
+// MalformedLines returns the most recent malformed lines collected by each of
+// the Readers.
+func (m *multiReader) MalformedLines() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var lines []string
+	for _, r := range m.readers {
+		if h, ok := r.(malformedLineHandler); ok {
+			lines = append(lines, h.MalformedLines()...)
+		}
+	}
+	return lines
+}
+
+// fail records the error, if it's the first, and closes all of the Readers.
+func (m *multiReader) fail(err error) {
+	m.mu.Lock()
+	if m.err == nil {
+		m.err = err
+	}
+	m.mu.Unlock()
+	m.Close()
+}
+
+// NewMulti creates a new Monitor that collects the combined data from the
+// given HTTP log files in Common Log Format, any of which may be a URL or glob
+// pattern as with New. Closing the Monitor closes the readers for all of the
+// files. opts.Reader is ignored.
+func NewMulti(files []string, opts MonitorOpts) (*Monitor, error) {
+	readers := make([]Reader, 0, len(files))
+	for _, file := range files {
+		reader, err := newSourceReader(file, opts.fileReaderOpts())
+		if err != nil {
+			for _, r := range readers {
+				r.Close()
+			}
+			return nil, errors.Wrapf(err, "failed to create log file reader for %s", file)
+		}
+		readers = append(readers, reader)
+	}
+	opts.Reader = newMultiReader(readers...)
+	return New("", opts)
+}
@@ -0,0 +1,47 @@
+package monitor
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// defaultOutputBufferSize is the default size in bytes of the buffer used to
+// write to Output.
+const defaultOutputBufferSize = 4096
+
+// bufferedOutput buffers writes to the Monitor's output so that each message,
+// e.g. a summary, is written at once when it's flushed rather than line by
+// line. It's safe for concurrent use since summaries, alerts, and errors are
+// written by different goroutines.
+type bufferedOutput struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// newBufferedOutput returns a bufferedOutput which writes to w with a buffer
+// of the given size. It returns nil if w doesn't benefit from buffering, i.e.
+// it's ioutil.Discard or a terminal, where messages should appear as soon as
+// they're written.
+func newBufferedOutput(w io.Writer, size int) *bufferedOutput {
+	if w == ioutil.Discard || isTerminal(w) {
+		return nil
+	}
+	return &bufferedOutput{w: bufio.NewWriterSize(w, size)}
+}
+
+// Write writes p to the buffer, writing the buffer to the output first if p
+// doesn't fit.
+func (b *bufferedOutput) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.w.Write(p)
+}
+
+// Flush writes the buffered data to the output.
+func (b *bufferedOutput) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.w.Flush()
+}
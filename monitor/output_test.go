@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBufferedOutput ensures writes are held until the output is flushed and
+// that outputs which don't benefit from buffering aren't buffered.
+func TestBufferedOutput(t *testing.T) {
+	if b := newBufferedOutput(ioutil.Discard, 16); b != nil {
+		t.Fatal("Expected ioutil.Discard not to be buffered")
+	}
+
+	var buf bytes.Buffer
+	b := newBufferedOutput(&buf, 16)
+	if _, err := b.Write([]byte("summary\n")); err != nil {
+		t.Fatalf("Error writing: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Expected write to be buffered, got %q", buf.String())
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatalf("Error flushing: %v", err)
+	}
+	if buf.String() != "summary\n" {
+		t.Fatalf("Expected summary to be flushed, got %q", buf.String())
+	}
+
+	// Writes which don't fit are written through.
+	buf.Reset()
+	b.Write([]byte("a summary longer than the buffer\n"))
+	if buf.String() != "a summary longer than the buffer\n" {
+		t.Fatalf("Expected long write to be written through, got %q", buf.String())
+	}
+}
+
+// writesRecorder sends the data of each write to a channel.
+type writesRecorder chan string
+
+func (w writesRecorder) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+// TestMonitorBufferedOutput ensures each summary is flushed while the Monitor
+// is running and is written at once.
+func TestMonitorBufferedOutput(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	writes := make(writesRecorder, 100)
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:       testAlertWindow,
+		ReportingInterval: 10 * time.Millisecond,
+		Output:            writes,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	go m.Start()
+	defer m.Stop()
+	select {
+	case w := <-writes:
+		if !strings.HasPrefix(w, "===== SUMMARY") || !strings.HasSuffix(w, "-----\n\n") {
+			t.Fatalf("Expected a whole summary in one write, got %q", w)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected summary to be flushed")
+	}
+}
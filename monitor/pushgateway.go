@@ -0,0 +1,57 @@
+package monitor
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// pushgatewayTimeout is the timeout for pushing metrics to a Pushgateway.
+const pushgatewayTimeout = 10 * time.Second
+
+// pushgateway pushes metrics to a Prometheus Pushgateway.
+type pushgateway struct {
+	url    string
+	client *http.Client
+}
+
+// newPushgateway creates a pushgateway which pushes metrics to the group
+// identified by the given job and, if non-empty, instance at the Pushgateway
+// with the given base URL.
+func newPushgateway(baseURL, job, instance string) *pushgateway {
+	u := strings.TrimSuffix(baseURL, "/") + "/metrics/job/" + url.PathEscape(job)
+	if instance != "" {
+		u += "/instance/" + url.PathEscape(instance)
+	}
+	return &pushgateway{
+		url:    u,
+		client: &http.Client{Timeout: pushgatewayTimeout},
+	}
+}
+
+// push replaces the metrics in the group with the summary data in the
+// Prometheus text exposition format.
+func (p *pushgateway) push(s *Summary) error {
+	var body bytes.Buffer
+	if err := writeMetrics(&body, s); err != nil {
+		return errors.Wrap(err, "failed to write metrics")
+	}
+	req, err := http.NewRequest(http.MethodPut, p.url, &body)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to PUT to Pushgateway")
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("Pushgateway returned status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+)
+
+// TestMonitorPushgateway ensures the final metrics are pushed to the
+// Pushgateway group for the configured job and instance once a NoFollow run
+// completes.
+func TestMonitorPushgateway(t *testing.T) {
+	type push struct {
+		method, path, body string
+	}
+	pushes := make(chan push, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		pushes <- push{r.Method, r.URL.EscapedPath(), string(body)}
+	}))
+	defer server.Close()
+
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	for i := 0; i < 3; i++ {
+		file.WriteString(fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700")))
+	}
+
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:         testAlertWindow,
+		NoFollow:            true,
+		PushgatewayURL:      server.URL + "/",
+		PushgatewayInstance: "batch/1",
+		Output:              ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("Error running Monitor: %v", err)
+	}
+
+	select {
+	case p := <-pushes:
+		if p.method != http.MethodPut {
+			t.Errorf("Expected PUT, got %s", p.method)
+		}
+		if expected := "/metrics/job/httpmonitor/instance/batch%2F1"; p.path != expected {
+			t.Errorf("Expected path %s, got %s", expected, p.path)
+		}
+		if !strings.Contains(p.body, `httpmonitor_responses_total{class="2xx"} 3`) {
+			t.Errorf("Expected 3 2xx responses in metrics, got:\n%s", p.body)
+		}
+	default:
+		t.Fatal("Expected metrics to be pushed")
+	}
+}
+
+// TestPushgatewayError ensures an error is returned if the Pushgateway
+// responds with a non-2xx status.
+func TestPushgatewayError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	if err := newPushgateway(server.URL, "job", "").push(&Summary{SizeHist: hdrhistogram.New(1, maxRecordableSize, 5)}); err == nil {
+		t.Fatal("Expected error for 400 response")
+	}
+}
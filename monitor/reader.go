@@ -4,21 +4,16 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"os"
-	"regexp"
+	"net"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
 )
 
-// clfNumParts is the number of components in a Common Log Format entry.
-const clfNumParts = 7
-
-// clfRegexp matches a line in Common Log Format, i.e. "host ident authuser date request status bytes".
-var clfRegexp = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([\w:/]+\s[+\-]\d{4})\] "(.*)" (\d{3}|-) (\d+|-)( ".*" ".*")?`)
-
 // log is an HTTP log entry, e.g. as parsed from Common Log Format.
 type log struct {
 	// remoteAddr is the IP address of the remote client.
@@ -41,130 +36,489 @@ type log struct {
 
 	// size is the size of the response returned to the client in bytes.
 	size int64
+
+	// referer is the page the client reports having been referred from. This
+	// is only available in Combined Log Format.
+	referer string
+
+	// userAgent is the identifying information the client browser reports
+	// about itself. This is only available in Combined Log Format.
+	userAgent string
+
+	// responseTime is the time taken to serve the request. This is only
+	// available in extended formats and is zero otherwise.
+	responseTime time.Duration
+
+	// forwardedFor is the X-Forwarded-For header, i.e. a comma-separated list
+	// of addresses starting with the original client. This is only available
+	// if the format includes it.
+	forwardedFor string
+
+	// level is the lowercase severity of the entry, e.g. "error". It's set for
+	// error log entries, which aren't HTTP requests and have no request, and
+	// for access logs whose format includes a level.
+	level string
 }
 
-// reader reads log entries from an actively written to HTTP log file.
-type reader interface {
-	// Open begins reading log entries from the file starting at the beginning
-	// and places them on the channel. If the reader reaches the end of the
-	// file, it will wait for new log entries to be appended until Close is
-	// called.
-	Open() (<-chan *log, error)
+// Log is an HTTP log entry, e.g. as parsed from Common Log Format. Fields which
+// aren't available in the log's format are zero.
+type Log struct {
+	RemoteAddr   string
+	Identity     string
+	UserID       string
+	Timestamp    time.Time
+	Request      string
+	Status       int
+	Size         int64
+	Referer      string
+	UserAgent    string
+	ResponseTime time.Duration
+	ForwardedFor string
+	Level        string // only set for error log entries and formats with a level
+}
+
+// export returns the log entry as a Log.
+func (l *log) export() Log {
+	return Log{
+		RemoteAddr:   l.remoteAddr,
+		Identity:     l.identity,
+		UserID:       l.userID,
+		Timestamp:    l.timestamp,
+		Request:      l.request,
+		Status:       l.status,
+		Size:         l.size,
+		Referer:      l.referer,
+		UserAgent:    l.userAgent,
+		ResponseTime: l.responseTime,
+		ForwardedFor: l.forwardedFor,
+		Level:        l.level,
+	}
+}
+
+// importLog returns the Log as a log entry which can be processed. The remote
+// address is normalized as it is by the readers.
+func importLog(l Log) *log {
+	return &log{
+		remoteAddr:   normalizeAddr(l.RemoteAddr),
+		identity:     l.Identity,
+		userID:       l.UserID,
+		timestamp:    l.Timestamp,
+		request:      l.Request,
+		status:       l.Status,
+		size:         l.Size,
+		referer:      l.Referer,
+		userAgent:    l.UserAgent,
+		responseTime: l.ResponseTime,
+		forwardedFor: l.ForwardedFor,
+		level:        l.Level,
+	}
+}
+
+// logFieldSetters maps the names of log fields to functions which set the
+// field from its string representation. This allows readers for formats with
+// named fields to map them onto the log struct.
+var logFieldSetters = map[string]func(l *log, value string) error{
+	"remoteAddr": func(l *log, value string) error {
+		l.remoteAddr = normalizeAddr(value)
+		return nil
+	},
+	"identity": func(l *log, value string) error {
+		l.identity = value
+		return nil
+	},
+	"userID": func(l *log, value string) error {
+		l.userID = value
+		return nil
+	},
+	"timestamp": func(l *log, value string) (err error) {
+		l.timestamp, err = parseTimestamp(value)
+		return err
+	},
+	"request": func(l *log, value string) error {
+		l.request = value
+		return nil
+	},
+	"status": func(l *log, value string) (err error) {
+		if value == "-" {
+			return nil
+		}
+		l.status, err = strconv.Atoi(value)
+		return err
+	},
+	"size": func(l *log, value string) (err error) {
+		if value == "-" {
+			return nil
+		}
+		l.size, err = strconv.ParseInt(value, 10, 64)
+		return err
+	},
+	"referer": func(l *log, value string) error {
+		l.referer = value
+		return nil
+	},
+	"forwardedFor": func(l *log, value string) error {
+		l.forwardedFor = value
+		return nil
+	},
+	"userAgent": func(l *log, value string) error {
+		l.userAgent = value
+		return nil
+	},
+	"responseTime": func(l *log, value string) (err error) {
+		if value == "-" {
+			return nil
+		}
+		l.responseTime, err = parseResponseTime(value)
+		return err
+	},
+	"level": func(l *log, value string) error {
+		if value != "-" {
+			l.level = strings.ToLower(value)
+		}
+		return nil
+	},
+}
+
+// normalizeAddr normalizes a remote address so that the same client is
+// counted consistently regardless of how it was logged. Only the first address
+// of a comma-separated list, e.g. from X-Forwarded-For, is used, and any
+// brackets or port are removed, e.g. "[2001:db8::1]:443" becomes
+// "2001:db8::1".
+func normalizeAddr(addr string) string {
+	if i := strings.IndexByte(addr, ','); i >= 0 {
+		addr = addr[:i]
+	}
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
+
+// parseTimestamp parses a timestamp in either Common Log Format or RFC 3339
+// layout.
+func parseTimestamp(value string) (time.Time, error) {
+	t, err := time.Parse(clfTimeLayout, value)
+	if err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseResponseTime parses a response time given either in seconds, e.g. the
+// "0.123" of nginx's $request_time, or as a duration string, e.g. "123ms".
+func parseResponseTime(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+// Reader reads HTTP log entries from a source, such as an actively written to
+// log file. It can be implemented to read logs in formats this package doesn't
+// support and set as MonitorOpts.Reader.
+type Reader interface {
+	// Open begins reading log entries from the source starting at the
+	// beginning and places them on the channel. If the source is a file and
+	// the reader reaches the end of it, it will wait for new log entries to be
+	// appended until Close is called. The channel is closed when the reader
+	// stops, either because Close was called, the end of the source was
+	// reached, or an error occurred.
+	Open() (<-chan *Log, error)
 
 	// Close stops the reader.
 	Close() error
+
+	// Err returns the error, if any, which caused the reader to stop. It
+	// should be called once the channel returned by Open has been closed.
+	Err() error
 }
 
-// clfReader implements the reader interface for log files using Common Log
-// Format.
-type clfReader struct {
-	file    string
-	watcher *fsnotify.Watcher
-	logs    chan *log
-	close   chan struct{}
+// logReader is implemented by the Readers in this package, which place log
+// entries on the channel as they're processed rather than converting them to
+// Logs and back.
+type logReader interface {
+	open() (<-chan *log, error)
 }
 
-// NewCommonLogFormatReader returns a new reader for log files using Common Log
-// Format.
-func NewCommonLogFormatReader(file string) (reader, error) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create file watcher")
+// openReader opens the Reader and returns the channel of its log entries. The
+// Logs of Readers outside of this package are converted as they're received.
+func openReader(r Reader) (<-chan *log, error) {
+	if lr, ok := r.(logReader); ok {
+		return lr.open()
 	}
-	if err := watcher.Add(file); err != nil {
-		watcher.Close()
-		return nil, errors.Wrap(err, "failed to add file watch")
+	exported, err := r.Open()
+	if err != nil {
+		return nil, err
 	}
-	return &clfReader{
-		file:    file,
-		watcher: watcher,
-		logs:    make(chan *log),
-		close:   make(chan struct{}),
-	}, nil
+	logs := make(chan *log)
+	go func() {
+		defer close(logs)
+		for l := range exported {
+			if l != nil {
+				logs <- importLog(*l)
+			}
+		}
+	}()
+	return logs, nil
 }
 
-// Open begins reading log entries from the file starting at the beginning and
-// places them on the channel. If the reader reaches the end of the file, it
-// will wait for new log entries to be appended until Close is called.
-func (c *clfReader) Open() (<-chan *log, error) {
-	file, err := os.Open(c.file)
+// exportLogs returns a channel of the given log entries converted to Logs,
+// which is closed once the given channel is. If err isn't nil, it's returned
+// instead.
+func exportLogs(logs <-chan *log, err error) (<-chan *Log, error) {
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to open file")
+		return nil, err
 	}
-	go c.read(file)
-	return c.logs, nil
+	exported := make(chan *Log)
+	go func() {
+		defer close(exported)
+		for l := range logs {
+			if l != nil {
+				e := l.export()
+				exported <- &e
+			}
+		}
+	}()
+	return exported, nil
 }
 
-// Close stops the reader.
-func (c *clfReader) Close() error {
-	if err := c.watcher.Close(); err != nil {
-		return errors.Wrap(err, "failed to close file watcher")
+// skipCounter is implemented by Readers which count the lines they skip
+// because they could not be parsed.
+type skipCounter interface {
+	// Skipped returns the number of lines which were skipped because they
+	// could not be parsed.
+	Skipped() uint64
+}
+
+// maxMalformedLines is the maximum number of malformed lines kept by a reader
+// which collects them.
+const maxMalformedLines = 100
+
+// MalformedLinePolicy controls how readers handle lines which aren't in the
+// expected format.
+type MalformedLinePolicy int
+
+const (
+	// SkipMalformedLines skips malformed lines. They're still counted in the
+	// summary's skipped lines.
+	SkipMalformedLines MalformedLinePolicy = iota
+
+	// FailOnMalformedLines stops the reader at the first malformed line, which
+	// is reported as the reader's error.
+	FailOnMalformedLines
+
+	// CollectMalformedLines skips malformed lines like SkipMalformedLines but
+	// also keeps the most recent ones so they can be inspected with
+	// Monitor.MalformedLines.
+	CollectMalformedLines
+)
+
+// String returns the name of the policy, e.g. "skip".
+func (p MalformedLinePolicy) String() string {
+	switch p {
+	case SkipMalformedLines:
+		return "skip"
+	case FailOnMalformedLines:
+		return "fail"
+	case CollectMalformedLines:
+		return "collect"
+	default:
+		return fmt.Sprintf("MalformedLinePolicy(%d)", int(p))
 	}
-	close(c.close)
-	return nil
 }
 
-// read is a long-running loop that reads and parses log entries from the file
-// and places them on the channel. It starts by parsing the current contents of
-// the file, then once it reaches the end of the file, it waits for new logs to
-// be written. It runs until Close is called.
-func (c *clfReader) read(file *os.File) {
-	reader := bufio.NewReader(file)
-	defer file.Close()
-READLOOP:
+// malformedLineHandler is implemented by Readers whose handling of malformed
+// lines can be configured.
+type malformedLineHandler interface {
+	// setMalformedLinePolicy sets how malformed lines are handled. It must be
+	// called before the reader is opened.
+	setMalformedLinePolicy(policy MalformedLinePolicy)
+
+	// MalformedLines returns the most recent malformed lines, oldest first,
+	// if they're collected.
+	MalformedLines() []string
+}
+
+// lineParser parses lines of a log file into log entries.
+type lineParser interface {
+	// parse parses a single log line. It returns false if the line is not in
+	// the expected format. It returns a nil log entry and true if the line
+	// was consumed without producing an entry, such as a directive line.
+	parse(line string) (*log, bool)
+}
+
+// lineReader parses lines into log entries and places them on a channel. It's
+// embedded by Reader implementations which read lines from some source.
+type lineReader struct {
+	source  string
+	format  string
+	parser  lineParser
+	logs    chan *log
+	close   chan struct{}
+	err     error
+	skipped uint64
+	policy  MalformedLinePolicy
+
+	// malformedMu guards malformed, which holds the most recent malformed
+	// lines if they're collected.
+	malformedMu sync.Mutex
+	malformed   []string
+}
+
+// newLineReader returns a new lineReader which parses lines from the named
+// source in the given format using the given lineParser.
+func newLineReader(source, format string, parser lineParser) lineReader {
+	return lineReader{
+		source: source,
+		format: format,
+		parser: parser,
+		logs:   make(chan *log),
+		close:  make(chan struct{}),
+	}
+}
+
+// Err returns the error, if any, which caused the reader to stop. It should be
+// called once the channel returned by Open has been closed.
+func (r *lineReader) Err() error {
+	return r.err
+}
+
+// Skipped returns the number of lines which were skipped because they could
+// not be parsed.
+func (r *lineReader) Skipped() uint64 {
+	return atomic.LoadUint64(&r.skipped)
+}
+
+// setMalformedLinePolicy sets how malformed lines are handled. It must be
+// called before the reader is opened.
+func (r *lineReader) setMalformedLinePolicy(policy MalformedLinePolicy) {
+	r.policy = policy
+}
+
+// MalformedLines returns the most recent malformed lines, oldest first, if
+// they're collected.
+func (r *lineReader) MalformedLines() []string {
+	r.malformedMu.Lock()
+	defer r.malformedMu.Unlock()
+	lines := make([]string, len(r.malformed))
+	copy(lines, r.malformed)
+	return lines
+}
+
+// readToEOF reads and parses log entries from the given source and places them
+// on the channel until EOF is reached, Close is called, or an error occurs, at
+// which point the channel is closed.
+func (r *lineReader) readToEOF(src io.Reader) {
+	defer close(r.logs)
+	defer r.failOnPanic()
+	r.drain(bufio.NewReader(src), "")
+}
+
+// drain reads and parses the remaining log entries from the given reader and
+// places them on the channel. The given partial line is prepended to the first
+// line read. Any partial line at the end is considered complete. It returns
+// false if the reader was closed or an error occurred.
+func (r *lineReader) drain(reader *bufio.Reader, partial string) bool {
 	for {
 		line, err := reader.ReadString('\n')
-		if err == io.EOF {
-			// If we reach EOF, wait for new logs to be written.
-			if c.waitForLogs() {
-				// The file was written, so try reading again.
-				continue READLOOP
-			}
-			break
+		if err != nil && err != io.EOF {
+			r.err = errors.Wrapf(err, "failed to read from %s", r.source)
+			return false
 		}
-		if err != nil {
-			fmt.Printf("Error reading from file %s: %v\n", c.file, err)
-			os.Exit(1)
+		if !r.emit(partial + line) {
+			return false
 		}
-
-		parts := clfRegexp.FindStringSubmatch(string(line))
-		// Add 1 because the first part is the entire expression.
-		if len(parts) < clfNumParts+1 {
-			fmt.Printf("Skipping log not in Common Log Format: %s\n", line)
-			continue
+		partial = ""
+		if err == io.EOF {
+			return true
 		}
+	}
+}
 
-		l := &log{
-			remoteAddr: parts[1],
-			identity:   parts[2],
-			userID:     parts[3],
-			request:    parts[5],
-		}
+// emit parses the line and places the log entry on the channel. Lines which
+// are empty are skipped, as are lines which aren't in the reader's format
+// unless the reader fails on them. It returns false if the reader was closed or
+// failed.
+func (r *lineReader) emit(line string) bool {
+	l, err := r.parseLine(line)
+	if err != nil {
+		r.err = err
+		return false
+	}
+	return r.send(l)
+}
 
-		// Parse timestamp.
-		l.timestamp, _ = time.Parse("02/Jan/2006:15:04:05 -0700", parts[4])
+// parse parses the line with the reader's parser. A panic in the parser, e.g.
+// due to an edge case in untrusted input it doesn't handle, is recovered and
+// the line is considered to not be in the reader's format.
+func (r *lineReader) parse(line string) (l *log, ok bool) {
+	defer recoverPanic(nil, "parsing line", nil)
+	return r.parser.parse(line)
+}
 
-		// Parse status code and size (don't handle errors since we'll accept zero).
-		l.status, _ = strconv.Atoi(parts[6])
-		l.size, _ = strconv.ParseInt(parts[7], 10, 64)
+// failOnPanic is deferred by the goroutines which read lines to recover from a
+// panic, which is recorded as the reader's error, so that the reader stops and
+// the Monitor shuts down gracefully rather than crashing. It must be deferred
+// after closing the channel is deferred so that it runs first.
+func (r *lineReader) failOnPanic() {
+	if p := recover(); p != nil {
+		r.err = errors.Errorf("panic while reading from %s: %v", r.source, p)
+	}
+}
 
-		c.logs <- l
+// parseLine parses the line, handling it according to the malformed line
+// policy if it isn't in the reader's format. It returns a nil log entry if the
+// line was skipped or consumed without producing an entry, and an error if the
+// reader should fail.
+func (r *lineReader) parseLine(line string) (*log, error) {
+	if line == "" {
+		return nil, nil
 	}
+	l, ok := r.parse(line)
+	if ok {
+		return l, nil
+	}
+	atomic.AddUint64(&r.skipped, 1)
+	switch r.policy {
+	case FailOnMalformedLines:
+		return nil, errors.Errorf("line from %s not in %s: %q", r.source, r.format, strings.TrimRight(line, "\r\n"))
+	case CollectMalformedLines:
+		r.malformedMu.Lock()
+		if len(r.malformed) == maxMalformedLines {
+			r.malformed = append(r.malformed[:0], r.malformed[1:]...)
+		}
+		r.malformed = append(r.malformed, strings.TrimRight(line, "\r\n"))
+		r.malformedMu.Unlock()
+	}
+	return nil, nil
 }
 
-// waitForLogs blocks until the log file is updated or the reader is closed. It
-// returns true if the file was updated and false if the reader was closed.
-func (c *clfReader) waitForLogs() bool {
+// send places the log entry, if any, on the channel. It returns false if the
+// reader was closed.
+func (r *lineReader) send(l *log) bool {
+	if l == nil {
+		return true
+	}
 	select {
-	case <-c.watcher.Events:
+	case r.logs <- l:
 		return true
-	case err, ok := <-c.watcher.Errors:
-		if ok {
-			fmt.Printf("Watcher error on file %s: %v\n", c.file, err)
-			os.Exit(1)
-		}
-		return false
-	case <-c.close:
+	case <-r.close:
 		return false
 	}
 }
+
+// flush parses the buffered partial line, if any, and places the log entry on
+// the channel when the reader is closed. The line is handled according to the
+// malformed line policy like any other. Since the consumer reads until the
+// channel is closed, this blocks until the entry is received.
+func (r *lineReader) flush(partial string) {
+	l, err := r.parseLine(partial)
+	if err != nil {
+		r.err = err
+		return
+	}
+	if l != nil {
+		r.logs <- l
+	}
+}
@@ -0,0 +1,79 @@
+package monitor_test
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylertreat/httpmonitor/monitor"
+)
+
+// pipeReader is a Reader for a made-up format with one "ip|status|request"
+// entry per line, which shows a Reader can be implemented outside of the
+// package.
+type pipeReader struct {
+	src  io.Reader
+	done chan struct{}
+}
+
+func (r *pipeReader) Open() (<-chan *monitor.Log, error) {
+	logs := make(chan *monitor.Log)
+	go func() {
+		defer close(logs)
+		scanner := bufio.NewScanner(r.src)
+		for scanner.Scan() {
+			parts := strings.Split(scanner.Text(), "|")
+			if len(parts) != 3 {
+				continue
+			}
+			status, _ := strconv.Atoi(parts[1])
+			l := &monitor.Log{RemoteAddr: parts[0], Status: status, Request: parts[2], Timestamp: time.Now()}
+			select {
+			case logs <- l:
+			case <-r.done:
+				return
+			}
+		}
+	}()
+	return logs, nil
+}
+
+func (r *pipeReader) Close() error {
+	close(r.done)
+	return nil
+}
+
+func (r *pipeReader) Err() error { return nil }
+
+// TestCustomReader ensures a Monitor collects the logs of a Reader implemented
+// outside of the package.
+func TestCustomReader(t *testing.T) {
+	reader := &pipeReader{
+		src:  strings.NewReader("10.0.0.1|200|GET /a/b HTTP/1.1\n10.0.0.2|503|GET /a/c HTTP/1.1\ngarbage\n"),
+		done: make(chan struct{}),
+	}
+	m, err := monitor.New("", monitor.MonitorOpts{
+		AlertWindow:    2 * time.Second,
+		NumTopSections: 1,
+		Reader:         reader,
+		Output:         ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("Error running Monitor: %v", err)
+	}
+
+	s := m.Snapshot()
+	if s.TotalRequests != 2 || s.StatusFreq.Successful != 1 || s.StatusFreq.ServerError != 1 {
+		t.Fatalf("Expected 1 successful and 1 failed request, got %d requests with %+v", s.TotalRequests, s.StatusFreq)
+	}
+	if len(s.TopSections) != 1 || string(s.TopSections[0].Data) != "/a" {
+		t.Fatalf("Expected top section /a, got %v", s.TopSections)
+	}
+}
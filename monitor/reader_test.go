@@ -0,0 +1,168 @@
+package monitor
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNormalizeAddr ensures remote addresses are normalized regardless of
+// brackets, ports, or forwarded address lists.
+func TestNormalizeAddr(t *testing.T) {
+	for addr, expected := range map[string]string{
+		"10.0.0.1":                   "10.0.0.1",
+		"10.0.0.1:8080":              "10.0.0.1",
+		"2001:db8::1":                "2001:db8::1",
+		"[2001:db8::1]":              "2001:db8::1",
+		"[2001:db8::1]:443":          "2001:db8::1",
+		"::1":                        "::1",
+		"10.0.0.1,10.0.0.2":          "10.0.0.1",
+		"10.0.0.1, 10.0.0.2":         "10.0.0.1",
+		"[2001:db8::1]:443,10.0.0.2": "2001:db8::1",
+		"-":                          "-",
+	} {
+		if actual := normalizeAddr(addr); actual != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, addr, actual)
+		}
+	}
+}
+
+// TestReaderOpen ensures the log entries of the Readers in this package are
+// placed on the channel returned by Open as Logs.
+func TestReaderOpen(t *testing.T) {
+	now := time.Now().Format("02/Jan/2006:15:04:05 -0700")
+	r := NewReaderFromStream(strings.NewReader(fmt.Sprintf(dummyLog, now)))
+	logs, err := r.Open()
+	if err != nil {
+		t.Fatalf("Error opening reader: %v", err)
+	}
+	defer r.Close()
+	l, ok := <-logs
+	if !ok {
+		t.Fatal("Expected log")
+	}
+	if l.RemoteAddr != "::1" || l.Status != 200 || l.Request != "GET /customers/directory.html HTTP/1.1" {
+		t.Fatalf("Unexpected log %+v", l)
+	}
+	if l, ok := <-logs; ok {
+		t.Fatalf("Expected channel to be closed, got %+v", l)
+	}
+}
+
+// TestLineReaderMalformedLinePolicy ensures malformed lines are skipped,
+// collected, or stop the reader according to the policy.
+func TestLineReaderMalformedLinePolicy(t *testing.T) {
+	now := time.Now().Format("02/Jan/2006:15:04:05 -0700")
+	input := fmt.Sprintf(dummyLog, now) + "garbage\n" + fmt.Sprintf(dummyLog, now) + "more garbage\n"
+	read := func(policy MalformedLinePolicy) (*streamReader, int) {
+		r := newStreamReader(strings.NewReader(input), "test", "Common Log Format", commonLogFormatParser)
+		r.setMalformedLinePolicy(policy)
+		logs, err := openReader(r)
+		if err != nil {
+			t.Fatalf("Error opening reader: %v", err)
+		}
+		count := 0
+		for range logs {
+			count++
+		}
+		return r, count
+	}
+
+	r, count := read(SkipMalformedLines)
+	if count != 2 || r.Skipped() != 2 || r.Err() != nil {
+		t.Fatalf("Expected 2 logs and 2 skipped lines without error, got %d, %d, and %v", count, r.Skipped(), r.Err())
+	}
+	if lines := r.MalformedLines(); len(lines) != 0 {
+		t.Fatalf("Expected no malformed lines collected, got %v", lines)
+	}
+
+	r, count = read(CollectMalformedLines)
+	if count != 2 || r.Err() != nil {
+		t.Fatalf("Expected 2 logs without error, got %d and %v", count, r.Err())
+	}
+	if lines := r.MalformedLines(); !reflect.DeepEqual(lines, []string{"garbage", "more garbage"}) {
+		t.Fatalf("Expected malformed lines [garbage more garbage], got %q", lines)
+	}
+
+	r, count = read(FailOnMalformedLines)
+	if count != 1 {
+		t.Fatalf("Expected 1 log before the malformed line, got %d", count)
+	}
+	if err := r.Err(); err == nil || !strings.Contains(err.Error(), `"garbage"`) {
+		t.Fatalf("Expected error for malformed line, got %v", err)
+	}
+}
+
+// TestLineReaderMalformedLinesBounded ensures only the most recent malformed
+// lines are collected.
+func TestLineReaderMalformedLinesBounded(t *testing.T) {
+	r := newLineReader("test", "Common Log Format", commonLogFormatParser)
+	r.setMalformedLinePolicy(CollectMalformedLines)
+	for i := 0; i < maxMalformedLines+10; i++ {
+		if _, err := r.parseLine(fmt.Sprintf("garbage %d\n", i)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	lines := r.MalformedLines()
+	if len(lines) != maxMalformedLines {
+		t.Fatalf("Expected %d malformed lines, got %d", maxMalformedLines, len(lines))
+	}
+	if lines[0] != "garbage 10" || lines[len(lines)-1] != fmt.Sprintf("garbage %d", maxMalformedLines+9) {
+		t.Fatalf("Expected most recent malformed lines, got %s to %s", lines[0], lines[len(lines)-1])
+	}
+}
+
+// panickingParser is a lineParser which panics on lines containing "panic" and
+// otherwise parses Common Log Format.
+type panickingParser struct{}
+
+func (panickingParser) parse(line string) (*log, bool) {
+	if strings.Contains(line, "panic") {
+		panic("unexpected input")
+	}
+	return commonLogFormatParser.parse(line)
+}
+
+// panickingReader is an io.Reader which panics when read.
+type panickingReader struct{}
+
+func (panickingReader) Read(p []byte) (int, error) {
+	panic("unexpected read")
+}
+
+// TestLineReaderPanic ensures a panic while parsing a line causes the line to
+// be treated as malformed and a panic while reading stops the reader with an
+// error rather than crashing.
+func TestLineReaderPanic(t *testing.T) {
+	now := time.Now().Format("02/Jan/2006:15:04:05 -0700")
+	input := fmt.Sprintf(dummyLog, now) + "panic\n" + fmt.Sprintf(dummyLog, now)
+	r := newStreamReader(strings.NewReader(input), "test", "Common Log Format", panickingParser{})
+	r.setMalformedLinePolicy(CollectMalformedLines)
+	logs, err := openReader(r)
+	if err != nil {
+		t.Fatalf("Error opening reader: %v", err)
+	}
+	count := 0
+	for range logs {
+		count++
+	}
+	if count != 2 || r.Err() != nil {
+		t.Fatalf("Expected 2 logs without error, got %d and %v", count, r.Err())
+	}
+	if lines := r.MalformedLines(); !reflect.DeepEqual(lines, []string{"panic"}) {
+		t.Fatalf("Expected the panicking line to be malformed, got %q", lines)
+	}
+
+	r = newStreamReader(panickingReader{}, "test", "Common Log Format", commonLogFormatParser)
+	logs, err = openReader(r)
+	if err != nil {
+		t.Fatalf("Error opening reader: %v", err)
+	}
+	for range logs {
+	}
+	if err := r.Err(); err == nil || !strings.Contains(err.Error(), "unexpected read") {
+		t.Fatalf("Expected error for the panic, got %v", err)
+	}
+}
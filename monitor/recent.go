@@ -0,0 +1,52 @@
+package monitor
+
+import "sync"
+
+// recentLogs is a bounded ring buffer of the most recently collected logs. It's
+// safe for concurrent use so that it can be shared by the shards.
+type recentLogs struct {
+	mu   sync.Mutex
+	logs []Log // ring buffer, oldest at next once full
+	next int   // index of the next log to overwrite
+	full bool
+}
+
+// newRecentLogs returns a recentLogs which keeps the given number of logs.
+func newRecentLogs(size uint) *recentLogs {
+	return &recentLogs{logs: make([]Log, size)}
+}
+
+// add the log, overwriting the oldest log if the buffer is full.
+func (r *recentLogs) add(l Log) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logs[r.next] = l
+	r.next++
+	if r.next == len(r.logs) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// list returns a copy of the logs from oldest to newest.
+func (r *recentLogs) list() []Log {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]Log(nil), r.logs[:r.next]...)
+	}
+	logs := make([]Log, 0, len(r.logs))
+	logs = append(logs, r.logs[r.next:]...)
+	return append(logs, r.logs[:r.next]...)
+}
+
+// reset removes all of the logs.
+func (r *recentLogs) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.logs {
+		r.logs[i] = Log{}
+	}
+	r.next = 0
+	r.full = false
+}
@@ -0,0 +1,39 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestRecentLogs ensures only the most recent logs are kept, oldest first, and
+// that resetting removes them.
+func TestRecentLogs(t *testing.T) {
+	r := newRecentLogs(3)
+	if logs := r.list(); len(logs) != 0 {
+		t.Fatalf("Expected no logs, got %v", logs)
+	}
+	statuses := func() []int {
+		var s []int
+		for _, l := range r.list() {
+			s = append(s, l.Status)
+		}
+		return s
+	}
+	r.add(Log{Status: 200})
+	r.add(Log{Status: 201})
+	if s := statuses(); !reflect.DeepEqual(s, []int{200, 201}) {
+		t.Fatalf("Expected [200 201], got %v", s)
+	}
+	for _, status := range []int{202, 203, 204} {
+		r.add(Log{Status: status})
+	}
+	if s := statuses(); !reflect.DeepEqual(s, []int{202, 203, 204}) {
+		t.Fatalf("Expected [202 203 204], got %v", s)
+	}
+
+	r.reset()
+	r.add(Log{Status: 500})
+	if s := statuses(); !reflect.DeepEqual(s, []int{500}) {
+		t.Fatalf("Expected [500] after reset, got %v", s)
+	}
+}
@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// regexpGroupFields maps the short names of named capture groups to log
+// fields. Groups may also be named after the log fields themselves.
+var regexpGroupFields = map[string]string{
+	"ip":         "remoteAddr",
+	"user":       "userID",
+	"time":       "timestamp",
+	"bytes":      "size",
+	"user_agent": "userAgent",
+	"duration":   "responseTime",
+	"method":     logfmtMethod,
+	"path":       logfmtPath,
+	"protocol":   logfmtProtocol,
+}
+
+// regexpParser is a lineParser for logs in an arbitrary format described by a
+// regular expression with named capture groups.
+type regexpParser struct {
+	re *regexp.Regexp
+
+	// fields are the log fields of each of the regexp's groups, or empty if
+	// the group isn't named.
+	fields []string
+}
+
+// NewRegexpReader returns a new reader for log files in an arbitrary format
+// described by the given regular expression, whose named capture groups are
+// mapped onto log fields, e.g.:
+//
+//	^(?P<ip>\S+) \S+ \S+ \[(?P<time>[^\]]+)\] "(?P<request>[^"]*)" (?P<status>\d+) (?P<size>\d+|-)
+//
+// Groups may be named ip, user, time, request, status, size or bytes, referer,
+// user_agent, and duration, or after the fields accepted by NewJSONReader, e.g.
+// forwardedFor or level. Groups named method, path, and protocol are combined
+// into the request instead. Times are parsed in Common Log Format or RFC 3339
+// layout.
+// The pattern must have a status group and either a request group or method
+// and path groups. The pattern is matched against lines without their trailing
+// newline. Lines which don't match the pattern, or whose status or request
+// isn't captured, are malformed.
+func NewRegexpReader(file, pattern string) (Reader, error) {
+	parser, err := newRegexpParser(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return newFileReader(file, "custom format", parser, fileReaderOpts{})
+}
+
+// newRegexpParser returns a new regexpParser for the given pattern. An error
+// is returned if the pattern is invalid, has a group which isn't named after a
+// log field, or lacks the groups required for a request and status.
+func newRegexpParser(pattern string) (*regexpParser, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid log pattern")
+	}
+	var (
+		fields = make([]string, len(re.SubexpNames()))
+		mapped = make(map[string]bool, len(fields))
+	)
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		field, ok := regexpGroupFields[name]
+		if !ok {
+			if _, ok := logFieldSetters[name]; !ok {
+				return nil, errors.Errorf("unknown log field for group %q", name)
+			}
+			field = name
+		}
+		fields[i] = field
+		mapped[field] = true
+	}
+	switch {
+	case !mapped["status"]:
+		return nil, errors.New("log pattern has no status group")
+	case !mapped["request"] && !(mapped[logfmtMethod] && mapped[logfmtPath]):
+		return nil, errors.New("log pattern has no request group or method and path groups")
+	}
+	return &regexpParser{re: re, fields: fields}, nil
+}
+
+// parse parses a single log line. It returns false if the line doesn't match
+// the pattern, a captured value could not be parsed, or the status or request
+// wasn't captured.
+func (p *regexpParser) parse(line string) (*log, bool) {
+	groups := p.re.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+	if groups == nil {
+		return nil, false
+	}
+
+	var (
+		l                      = new(log)
+		method, path, protocol string
+	)
+	for i, value := range groups {
+		field := p.fields[i]
+		if field == "" || value == "" {
+			continue
+		}
+		switch field {
+		case logfmtMethod:
+			method = value
+		case logfmtPath:
+			path = value
+		case logfmtProtocol:
+			protocol = value
+		default:
+			if err := logFieldSetters[field](l, value); err != nil {
+				return nil, false
+			}
+		}
+	}
+
+	if l.request == "" {
+		l.request = joinRequest(method, path, protocol)
+	}
+	if l.request == "" || l.status == 0 {
+		return nil, false
+	}
+	return l, true
+}
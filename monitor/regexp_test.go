@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestRegexpParse ensures the named groups of the pattern are mapped onto log
+// fields and that lines which don't match or lack required fields are
+// rejected.
+func TestRegexpParse(t *testing.T) {
+	p, err := newRegexpParser(`^(?P<ip>\S+) \[(?P<time>[^\]]+)\] (?P<method>\S+) (?P<path>\S+) ` +
+		`(?P<status>\d+|-) (?P<bytes>\d+|-)(?: (?P<duration>\S+))?$`)
+	if err != nil {
+		t.Fatalf("Error creating parser: %v", err)
+	}
+	l, ok := p.parse("10.0.0.1:5123 [10/Oct/2000:13:55:36 -0700] GET /pages/create 404 512 0.250")
+	if !ok {
+		t.Fatal("Expected line to parse")
+	}
+	if l.remoteAddr != "10.0.0.1" {
+		t.Fatalf("Expected remote address 10.0.0.1, got %s", l.remoteAddr)
+	}
+	if l.request != "GET /pages/create HTTP/1.1" {
+		t.Fatalf("Expected request GET /pages/create HTTP/1.1, got %s", l.request)
+	}
+	if l.status != 404 || l.size != 512 {
+		t.Fatalf("Expected status 404 and size 512, got %d and %d", l.status, l.size)
+	}
+	if l.responseTime != 250*time.Millisecond {
+		t.Fatalf("Expected response time 250ms, got %s", l.responseTime)
+	}
+	expected := time.Date(2000, time.October, 10, 20, 55, 36, 0, time.UTC)
+	if !l.timestamp.Equal(expected) {
+		t.Fatalf("Expected timestamp %s, got %s", expected, l.timestamp)
+	}
+
+	// The optional duration group may not participate in the match.
+	if l, ok := p.parse("10.0.0.1 [10/Oct/2000:13:55:36 -0700] GET / 200 -"); !ok || l.responseTime != 0 {
+		t.Fatalf("Expected line without a duration to parse, got %+v", l)
+	}
+
+	for _, line := range []string{
+		"10.0.0.1 GET /x 200 12",                                // doesn't match
+		"10.0.0.1 [yesterday] GET /x 200 12",                    // invalid time
+		"10.0.0.1 [10/Oct/2000:13:55:36 -0700] GET /x - 12",     // missing status
+		"10.0.0.1 [10/Oct/2000:13:55:36 -0700] GET /x 200 12 x", // invalid duration
+	} {
+		if _, ok := p.parse(line); ok {
+			t.Fatalf("Expected line %q to be rejected", line)
+		}
+	}
+}
+
+// TestNewRegexpReader ensures patterns which are invalid, have groups not
+// named after log fields, or lack the required groups are rejected.
+func TestNewRegexpReader(t *testing.T) {
+	for _, pattern := range []string{
+		`(?P<status>\d+) (?P<request>.*`,
+		`(?P<status>\d+) (?P<request>.*) (?P<timelayout>\S+)`,
+		`(?P<request>.*)`,
+		`(?P<status>\d+) (?P<path>\S+)`,
+	} {
+		if _, err := NewRegexpReader("", pattern); err == nil {
+			t.Fatalf("Expected error for pattern %s", pattern)
+		}
+	}
+}
+
+// TestMonitorRegexp ensures a Monitor collects logs read with a pattern and
+// applies the malformed line policy to lines which don't match it.
+func TestMonitorRegexp(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	now := time.Now().Format(time.RFC3339)
+	fmt.Fprintf(file, "%s|10.0.0.1|GET /pages/a HTTP/1.1|200|10\n", now)
+	fmt.Fprintf(file, "%s|10.0.0.1|GET /pages/b HTTP/1.1\n", now)
+	fmt.Fprintf(file, "%s|10.0.0.2|POST /api HTTP/1.1|503|20\n", now)
+
+	reader, err := NewRegexpReader(file.Name(),
+		`^(?P<timestamp>[^|]+)\|(?P<ip>[^|]+)\|(?P<request>[^|]+)\|(?P<status>\d+)\|(?P<size>\d+)$`)
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	m, err := New("", MonitorOpts{
+		AlertWindow:         testAlertWindow,
+		NumTopSections:      2,
+		MalformedLinePolicy: CollectMalformedLines,
+		Reader:              reader,
+		Output:              ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	go func() {
+		time.Sleep(time.Second)
+		m.Stop()
+	}()
+	m.Start()
+
+	s := m.Snapshot()
+	if s.TotalRequests != 2 || s.StatusFreq.Successful != 1 || s.StatusFreq.ServerError != 1 {
+		t.Fatalf("Expected 1 successful and 1 failed request, got %d requests with %+v", s.TotalRequests, s.StatusFreq)
+	}
+	if lines := m.MalformedLines(); len(lines) != 1 {
+		t.Fatalf("Expected 1 malformed line, got %q", lines)
+	}
+}
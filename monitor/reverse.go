@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// reverseChunkSize is the number of bytes read at a time when reading a file
+// backward.
+const reverseChunkSize = 64 * 1024
+
+// reverseLineScanner returns the lines of a file from last to first by reading
+// it backward in chunks from the end.
+type reverseLineScanner struct {
+	src       io.ReaderAt
+	offset    int64  // start of the bytes which have been read
+	pending   []byte // bytes which have been read but not returned
+	chunkSize int
+}
+
+// newReverseLineScanner returns a reverseLineScanner which reads the given
+// number of bytes of src from the end.
+func newReverseLineScanner(src io.ReaderAt, size int64) *reverseLineScanner {
+	return &reverseLineScanner{src: src, offset: size, chunkSize: reverseChunkSize}
+}
+
+// next returns the line preceding those already returned, including its
+// trailing newline if it has one. It returns io.EOF once the first line of the
+// file has been returned.
+func (s *reverseLineScanner) next() (string, error) {
+	for {
+		// The last byte is the newline terminating the line, if any, rather
+		// than the end of the previous line.
+		if len(s.pending) > 0 {
+			if i := bytes.LastIndexByte(s.pending[:len(s.pending)-1], '\n'); i >= 0 {
+				line := string(s.pending[i+1:])
+				s.pending = s.pending[:i+1]
+				return line, nil
+			}
+		}
+		if s.offset == 0 {
+			if len(s.pending) == 0 {
+				return "", io.EOF
+			}
+			line := string(s.pending)
+			s.pending = nil
+			return line, nil
+		}
+
+		n := int64(s.chunkSize)
+		if n > s.offset {
+			n = s.offset
+		}
+		s.offset -= n
+		chunk := make([]byte, n, n+int64(len(s.pending)))
+		if _, err := s.src.ReadAt(chunk, s.offset); err != nil {
+			return "", err
+		}
+		s.pending = append(chunk, s.pending...)
+	}
+}
+
+// readReverse reads and parses the log entries in the given number of bytes of
+// src from the last to the first and places them on the channel until the
+// start is reached, Close is called, or an error occurs, at which point the
+// channel is closed.
+func (r *lineReader) readReverse(src io.ReaderAt, size int64) {
+	defer close(r.logs)
+	defer r.failOnPanic()
+	scanner := newReverseLineScanner(src, size)
+	for {
+		line, err := scanner.next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			r.err = errors.Wrapf(err, "failed to read from %s", r.source)
+			return
+		}
+		if !r.emit(line) {
+			return
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestReverseLineScanner ensures lines are returned from last to first with
+// their newlines, including lines spanning chunks and a final line without a
+// trailing newline.
+func TestReverseLineScanner(t *testing.T) {
+	for _, tc := range []struct {
+		contents string
+		expected []string
+	}{
+		{"", nil},
+		{"a\n", []string{"a\n"}},
+		{"a", []string{"a"}},
+		{"first\nsecond\nthird\n", []string{"third\n", "second\n", "first\n"}},
+		{"first\nsecond\nthird", []string{"third", "second\n", "first\n"}},
+		{"a long first line\n\nc\r\n", []string{"c\r\n", "\n", "a long first line\n"}},
+		{"\n\n", []string{"\n", "\n"}},
+	} {
+		for _, chunkSize := range []int{1, 3, reverseChunkSize} {
+			s := newReverseLineScanner(strings.NewReader(tc.contents), int64(len(tc.contents)))
+			s.chunkSize = chunkSize
+			var lines []string
+			for {
+				line, err := s.next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Error scanning %q: %v", tc.contents, err)
+				}
+				lines = append(lines, line)
+			}
+			if !reflect.DeepEqual(lines, tc.expected) {
+				t.Errorf("Expected %q from %q with %d-byte chunks, got %q", tc.expected, tc.contents, chunkSize, lines)
+			}
+		}
+	}
+}
+
+// TestFileReaderReverse ensures a file which isn't followed is read from the
+// last log to the first, with or without a trailing newline.
+func TestFileReaderReverse(t *testing.T) {
+	for _, trailingNewline := range []bool{true, false} {
+		file, err := ioutil.TempFile("", "access_log")
+		if err != nil {
+			t.Fatalf("Error creating log file: %v", err)
+		}
+		defer os.Remove(file.Name())
+		now := time.Now().Format(clfTimeLayout)
+		var contents string
+		for _, section := range []string{"/a", "/b", "/c"} {
+			contents += fmt.Sprintf("127.0.0.1 - - [%s] \"GET %s HTTP/1.1\" 200 10\n", now, section)
+		}
+		if !trailingNewline {
+			contents = strings.TrimSuffix(contents, "\n")
+		}
+		file.WriteString(contents)
+		file.Close()
+
+		r, err := newCommonLogFormatReader(file.Name(), fileReaderOpts{noFollow: true, reverse: true})
+		if err != nil {
+			t.Fatalf("Error creating reader: %v", err)
+		}
+		logs, err := openReader(r)
+		if err != nil {
+			t.Fatalf("Error opening reader: %v", err)
+		}
+		var requests []string
+		for l := range logs {
+			requests = append(requests, l.request)
+		}
+		expected := []string{"GET /c HTTP/1.1", "GET /b HTTP/1.1", "GET /a HTTP/1.1"}
+		if !reflect.DeepEqual(requests, expected) {
+			t.Errorf("Expected %v with trailing newline %t, got %v", expected, trailingNewline, requests)
+		}
+		if err := r.Err(); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		r.Close()
+	}
+}
+
+// TestFileReaderReverseGzip ensures compressed files can't be read in reverse.
+func TestFileReaderReverseGzip(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log.gz")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	gz := gzip.NewWriter(file)
+	fmt.Fprintf(gz, dummyLog, time.Now().Format(clfTimeLayout))
+	gz.Close()
+	file.Close()
+
+	r, err := newCommonLogFormatReader(file.Name(), fileReaderOpts{noFollow: true, reverse: true})
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	defer r.Close()
+	if _, err := openReader(r); err == nil {
+		t.Fatal("Expected error opening compressed file in reverse")
+	}
+}
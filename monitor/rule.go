@@ -0,0 +1,155 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Metrics which can be selected by an AlertRule. A status pattern can also be
+// selected with StatusMetric.
+const (
+	// MetricHits is the number of requests per second.
+	MetricHits = "hits"
+
+	// MetricBytes is the throughput in bytes per second.
+	MetricBytes = "bytes"
+
+	// MetricErrors is the number of error log entries per second at the
+	// error level or above.
+	MetricErrors = "errors"
+
+	// statusMetricPrefix prefixes the status pattern of a status metric.
+	statusMetricPrefix = "status:"
+)
+
+// StatusMetric returns the metric selecting the number of responses per
+// second whose status matches the given pattern, e.g. "5xx" or "429". See
+// StatusWatch for the pattern syntax.
+func StatusMetric(pattern string) string {
+	return statusMetricPrefix + pattern
+}
+
+// AlertRule is an alert on the average of a metric over its own window, which
+// is evaluated independently of the other alerts.
+type AlertRule struct {
+	// Name identifies the rule in the Alerts it emits. It must be unique.
+	Name string
+
+	// Metric selects the value which is averaged: MetricHits, MetricBytes,
+	// MetricErrors, or a status pattern returned by StatusMetric.
+	Metric string
+
+	// Below causes the rule to trigger when the average falls below the
+	// threshold rather than exceeds it. Like the LowTrafficThreshold alert,
+	// it only recovers once the average exceeds the threshold by 20%.
+	Below bool
+
+	// Threshold is the average value per second which triggers the rule.
+	Threshold float64
+
+	// Window is the span of time the metric is averaged over. Defaults to
+	// AlertWindow. It may not be less than Quantum.
+	Window time.Duration
+
+	// Cooldown is the minimum time between the rule's state changes.
+	// Defaults to zero, i.e. no cooldown.
+	Cooldown time.Duration
+}
+
+// validate returns an error describing why the rule is invalid, if it is. It
+// should be called once defaults have been applied.
+func (r AlertRule) validate(quantum time.Duration) error {
+	switch {
+	case r.Name == "":
+		return errors.New("name may not be empty")
+	case r.Threshold < 0:
+		return errors.Errorf("threshold %g may not be negative", r.Threshold)
+	case r.Window < quantum:
+		return errors.Errorf("window %s may not be less than quantum %s", r.Window, quantum)
+	case r.Cooldown < 0:
+		return errors.Errorf("cooldown %s may not be negative", r.Cooldown)
+	}
+	switch r.Metric {
+	case MetricHits, MetricBytes, MetricErrors:
+		return nil
+	}
+	if !strings.HasPrefix(r.Metric, statusMetricPrefix) {
+		return errors.Errorf("unknown metric %q", r.Metric)
+	}
+	_, _, err := parseStatusPattern(strings.TrimPrefix(r.Metric, statusMetricPrefix))
+	return err
+}
+
+// ruleMetric averages the metric selected by an AlertRule over the rule's
+// window.
+type ruleMetric struct {
+	AlertRule
+	status   *watchedStatus // nil unless the metric is a status pattern
+	averager *windowedAverager
+}
+
+// newRuleMetric returns a ruleMetric for the given rule, which must be valid,
+// with the given quantum.
+func newRuleMetric(rule AlertRule, quantum time.Duration) *ruleMetric {
+	r := &ruleMetric{AlertRule: rule, averager: newWindowedAverager(rule.Window, quantum)}
+	if strings.HasPrefix(rule.Metric, statusMetricPrefix) {
+		watch := StatusWatch{Pattern: strings.TrimPrefix(rule.Metric, statusMetricPrefix)}
+		r.status, _ = newWatchedStatus(watch, r.averager)
+	}
+	return r
+}
+
+// newAlertState returns the state of the rule's alert.
+func (r *ruleMetric) newAlertState() *alertState {
+	if r.Below {
+		return newLowAlertState(r.Threshold, r.Cooldown)
+	}
+	return &alertState{threshold: r.Threshold, cooldown: r.Cooldown}
+}
+
+// alert sets the value of the metric on the Alert emitted by the rule.
+func (r *ruleMetric) alert(a *Alert, avg float64) {
+	a.Rule = r.Name
+	switch {
+	case r.status != nil:
+		a.Status = r.status.Pattern
+		a.AvgStatus = avg
+	case r.Metric == MetricBytes:
+		a.Throughput = true
+		a.AvgBytes = avg
+	case r.Metric == MetricErrors:
+		a.Errors = true
+		a.AvgErrors = avg
+	default:
+		a.LowTraffic = r.Below
+		a.AvgHits = avg
+	}
+}
+
+// recordRules adds n to the averages of the rules selecting the given metric,
+// which isn't a status metric, for a value at the given time.
+func (c *collector) recordRules(metric string, timestamp time.Time, n uint64) {
+	for _, r := range c.rules {
+		if r.Metric == metric {
+			r.averager.record(timestamp, n)
+		}
+	}
+}
+
+// describeRuleValue returns a description of the value of the metric which
+// triggered or recovered a rule's alert, e.g. "bytes/s = 12.00".
+func describeRuleValue(a Alert) string {
+	switch {
+	case a.Status != "":
+		return fmt.Sprintf("status %s responses/s = %.2f", a.Status, a.AvgStatus)
+	case a.Throughput:
+		return fmt.Sprintf("bytes/s = %.2f", a.AvgBytes)
+	case a.Errors:
+		return fmt.Sprintf("errors/s = %.2f", a.AvgErrors)
+	default:
+		return fmt.Sprintf("hits = %.2f", a.AvgHits)
+	}
+}
@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+// TestAlertRuleValidate ensures invalid rules are rejected.
+func TestAlertRuleValidate(t *testing.T) {
+	valid := AlertRule{Name: "rule", Metric: MetricHits, Threshold: 10, Window: time.Minute}
+	if err := valid.validate(time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for name, modify := range map[string]func(r *AlertRule){
+		"empty name":         func(r *AlertRule) { r.Name = "" },
+		"unknown metric":     func(r *AlertRule) { r.Metric = "latency" },
+		"invalid status":     func(r *AlertRule) { r.Metric = StatusMetric("5x") },
+		"negative threshold": func(r *AlertRule) { r.Threshold = -1 },
+		"short window":       func(r *AlertRule) { r.Window = time.Millisecond },
+		"negative cooldown":  func(r *AlertRule) { r.Cooldown = -time.Second },
+	} {
+		rule := valid
+		modify(&rule)
+		if err := rule.validate(time.Second); err == nil {
+			t.Errorf("Expected error for %s", name)
+		}
+	}
+}
+
+// TestCollectorRecordRules ensures each rule averages only the metric it
+// selects.
+func TestCollectorRecordRules(t *testing.T) {
+	c := newCollector(MonitorOpts{
+		AlertWindow:  time.Minute,
+		Quantum:      time.Second,
+		SectionDepth: 1,
+		AlertRules: []AlertRule{
+			{Name: "hits", Metric: MetricHits, Window: time.Minute},
+			{Name: "bytes", Metric: MetricBytes, Window: time.Minute},
+			{Name: "errors", Metric: MetricErrors, Window: time.Minute},
+			{Name: "5xx", Metric: StatusMetric("5xx"), Window: 10 * time.Second},
+		},
+	})
+	hits := make(chan time.Time, 10)
+	now := time.Now()
+	c.process(&log{timestamp: now, request: "GET / HTTP/1.1", status: 200, size: 100}, hits)
+	c.process(&log{timestamp: now, request: "GET / HTTP/1.1", status: 503, size: 50}, hits)
+	c.process(&log{timestamp: now, level: "error"}, hits)
+
+	expected := map[string]uint64{"hits": 2, "bytes": 150, "errors": 1, "5xx": 1}
+	for _, r := range c.rules {
+		if n := r.averager.buckets[r.averager.idx]; n != expected[r.Name] {
+			t.Errorf("Expected %d for rule %s, got %d", expected[r.Name], r.Name, n)
+		}
+	}
+	if n, expected := len(c.rules[3].averager.buckets), len(newWindowedAverager(10*time.Second, time.Second).buckets); n != expected {
+		t.Fatalf("Expected %d buckets for a 10s window, got %d", expected, n)
+	}
+}
+
+// TestRuleMetricAlert ensures the rule's name and average are set on its
+// alerts in the field for the kind of metric.
+func TestRuleMetricAlert(t *testing.T) {
+	tests := []struct {
+		rule  AlertRule
+		check func(a Alert) bool
+		desc  string
+	}{
+		{AlertRule{Name: "low", Metric: MetricHits, Below: true},
+			func(a Alert) bool { return a.LowTraffic && a.AvgHits == 2 }, "hits = 2.00"},
+		{AlertRule{Name: "bytes", Metric: MetricBytes},
+			func(a Alert) bool { return a.Throughput && a.AvgBytes == 2 }, "bytes/s = 2.00"},
+		{AlertRule{Name: "errors", Metric: MetricErrors},
+			func(a Alert) bool { return a.Errors && a.AvgErrors == 2 }, "errors/s = 2.00"},
+		{AlertRule{Name: "5xx", Metric: StatusMetric("5xx")},
+			func(a Alert) bool { return a.Status == "5xx" && a.AvgStatus == 2 }, "status 5xx responses/s = 2.00"},
+	}
+	for _, tt := range tests {
+		tt.rule.Window = time.Minute
+		var a Alert
+		newRuleMetric(tt.rule, time.Second).alert(&a, 2)
+		if a.Rule != tt.rule.Name || !tt.check(a) {
+			t.Errorf("Unexpected alert for rule %s: %+v", tt.rule.Name, a)
+		}
+		if desc := describeRuleValue(a); desc != tt.desc {
+			t.Errorf("Expected description %q, got %q", tt.desc, desc)
+		}
+	}
+}
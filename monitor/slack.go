@@ -0,0 +1,102 @@
+package monitor
+
+import "fmt"
+
+const (
+	// slackColorTriggered is the Slack attachment color for triggered alerts.
+	slackColorTriggered = "danger"
+
+	// slackColorRecovered is the Slack attachment color for recovered alerts.
+	slackColorRecovered = "good"
+)
+
+// slackMessage is a Slack incoming webhook message payload.
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+// slackAttachment is an attachment of a Slack message.
+type slackAttachment struct {
+	Fallback string `json:"fallback"`
+	Color    string `json:"color"`
+	Title    string `json:"title"`
+	Text     string `json:"text"`
+	Ts       int64  `json:"ts"`
+}
+
+// newSlackMessage creates a Slack message for the given Alert. An empty
+// channel or username uses the webhook's defaults.
+func newSlackMessage(a Alert, channel, username string) *slackMessage {
+	attachment := slackAttachment{
+		Color: slackColorTriggered,
+		Title: "High traffic alert triggered",
+		Text:  fmt.Sprintf("Average hits = %.2f, triggered at %s", a.AvgHits, a.Time),
+		Ts:    a.Time.Unix(),
+	}
+	if a.MaxHits > 0 {
+		attachment.Text = fmt.Sprintf("Max hits/s = %.2f, triggered at %s", a.MaxHits, a.Time)
+	}
+	if a.LowTraffic {
+		attachment.Title = "Low traffic alert triggered"
+	}
+	if a.Throughput {
+		attachment.Title = "High throughput alert triggered"
+		attachment.Text = fmt.Sprintf("Average bytes/s = %.2f, triggered at %s", a.AvgBytes, a.Time)
+	}
+	if a.Errors {
+		attachment.Title = "High error rate alert triggered"
+		attachment.Text = fmt.Sprintf("Average errors/s = %.2f, triggered at %s", a.AvgErrors, a.Time)
+	}
+	if a.Status != "" {
+		attachment.Title = fmt.Sprintf("High rate of status %s alert triggered", a.Status)
+		attachment.Text = fmt.Sprintf("Average responses/s = %.2f, triggered at %s", a.AvgStatus, a.Time)
+	}
+	if a.Anomaly != "" {
+		attachment.Title = fmt.Sprintf("Response %s anomaly alert triggered", a.Anomaly)
+		attachment.Text = fmt.Sprintf("The %s, triggered at %s", describeAnomaly(a), a.Time)
+	}
+	if a.Rule != "" {
+		attachment.Title = fmt.Sprintf("Alert rule %s triggered", a.Rule)
+		attachment.Text = fmt.Sprintf("Average %s, triggered at %s", describeRuleValue(a), a.Time)
+	}
+	if a.Recovered {
+		attachment.Color = slackColorRecovered
+		attachment.Title = "Traffic recovered"
+		attachment.Text = fmt.Sprintf("Average hits = %.2f, recovered at %s", a.AvgHits, a.Time)
+		if a.MaxHits > 0 {
+			attachment.Text = fmt.Sprintf("Max hits/s = %.2f, recovered at %s", a.MaxHits, a.Time)
+		}
+		if a.LowTraffic {
+			attachment.Title = "Low traffic recovered"
+		}
+		if a.Throughput {
+			attachment.Title = "Throughput recovered"
+			attachment.Text = fmt.Sprintf("Average bytes/s = %.2f, recovered at %s", a.AvgBytes, a.Time)
+		}
+		if a.Errors {
+			attachment.Title = "Error rate recovered"
+			attachment.Text = fmt.Sprintf("Average errors/s = %.2f, recovered at %s", a.AvgErrors, a.Time)
+		}
+		if a.Status != "" {
+			attachment.Title = fmt.Sprintf("Status %s recovered", a.Status)
+			attachment.Text = fmt.Sprintf("Average responses/s = %.2f, recovered at %s", a.AvgStatus, a.Time)
+		}
+		if a.Anomaly != "" {
+			attachment.Title = fmt.Sprintf("Response %s anomaly recovered", a.Anomaly)
+			attachment.Text = fmt.Sprintf("The %s, recovered at %s", describeAnomaly(a), a.Time)
+		}
+		if a.Rule != "" {
+			attachment.Title = fmt.Sprintf("Alert rule %s recovered", a.Rule)
+			attachment.Text = fmt.Sprintf("Average %s, recovered at %s", describeRuleValue(a), a.Time)
+		}
+	}
+	attachment.Text = appendDrivers(attachment.Text, a)
+	attachment.Fallback = attachment.Title + ": " + attachment.Text
+	return &slackMessage{
+		Channel:     channel,
+		Username:    username,
+		Attachments: []slackAttachment{attachment},
+	}
+}
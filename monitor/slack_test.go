@@ -0,0 +1,43 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNewSlackMessage ensures triggered alerts are colored red and recovered
+// alerts green.
+func TestNewSlackMessage(t *testing.T) {
+	now := time.Now()
+	msg := newSlackMessage(Alert{AvgHits: 20, Time: now}, "#ops", "httpmonitor")
+	if msg.Channel != "#ops" || msg.Username != "httpmonitor" {
+		t.Fatalf("Expected channel #ops and username httpmonitor, got %s and %s", msg.Channel, msg.Username)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Color != slackColorTriggered {
+		t.Fatalf("Expected a single %s attachment, got %+v", slackColorTriggered, msg.Attachments)
+	}
+	if msg.Attachments[0].Ts != now.Unix() {
+		t.Fatalf("Expected timestamp %d, got %d", now.Unix(), msg.Attachments[0].Ts)
+	}
+
+	msg = newSlackMessage(Alert{Recovered: true, AvgHits: 2, Time: now}, "", "")
+	if msg.Attachments[0].Color != slackColorRecovered {
+		t.Fatalf("Expected %s attachment, got %s", slackColorRecovered, msg.Attachments[0].Color)
+	}
+
+	msg = newSlackMessage(Alert{LowTraffic: true, AvgHits: 0.5, Time: now}, "", "")
+	if msg.Attachments[0].Title != "Low traffic alert triggered" {
+		t.Fatalf("Expected low traffic title, got %s", msg.Attachments[0].Title)
+	}
+
+	msg = newSlackMessage(Alert{AvgHits: 5, MaxHits: 120, Time: now}, "", "")
+	if !strings.HasPrefix(msg.Attachments[0].Text, "Max hits/s = 120.00") {
+		t.Fatalf("Expected max hits text, got %s", msg.Attachments[0].Text)
+	}
+
+	msg = newSlackMessage(Alert{AvgHits: 20, Time: now, TopSections: []TopElement{{Value: "/search", Hits: 30}}}, "", "")
+	if !strings.HasSuffix(msg.Attachments[0].Text, ", driven by /search") {
+		t.Fatalf("Expected top section in text, got %s", msg.Attachments[0].Text)
+	}
+}
@@ -0,0 +1,56 @@
+package monitor
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// Stats describe the Monitor itself rather than the logs it collects, which
+// helps diagnose whether it's the bottleneck under high load.
+type Stats struct {
+	// Uptime is how long the Monitor has been running, or zero if it isn't.
+	Uptime time.Duration `json:"uptime"`
+
+	// LogsProcessed is the number of logs read or ingested, including those
+	// which were filtered out, since the Monitor was created or restarted.
+	LogsProcessed uint64 `json:"logs_processed"`
+
+	// Goroutines is the number of goroutines in the process, not only the
+	// Monitor's.
+	Goroutines int `json:"goroutines"`
+
+	// HeapAlloc is the number of bytes of allocated heap objects, Sys is the
+	// number of bytes obtained from the OS, and NumGC is the number of
+	// completed GC cycles, as reported by runtime.MemStats for the process.
+	HeapAlloc uint64 `json:"heap_alloc_bytes"`
+	Sys       uint64 `json:"sys_bytes"`
+	NumGC     uint32 `json:"num_gc"`
+
+	// GoVersion is the version of Go the Monitor was built with.
+	GoVersion string `json:"go_version"`
+}
+
+// Stats returns the Monitor's own runtime statistics. Reading the memory
+// statistics briefly stops the world, so this shouldn't be called frequently.
+func (m *Monitor) Stats() Stats {
+	m.mu.RLock()
+	started := atomic.LoadInt64(&m.started)
+	processed := atomic.LoadUint64(&m.processed)
+	m.mu.RUnlock()
+
+	s := Stats{
+		LogsProcessed: processed,
+		Goroutines:    runtime.NumGoroutine(),
+		GoVersion:     runtime.Version(),
+	}
+	if started != 0 {
+		s.Uptime = time.Since(time.Unix(0, started))
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	s.HeapAlloc = mem.HeapAlloc
+	s.Sys = mem.Sys
+	s.NumGC = mem.NumGC
+	return s
+}
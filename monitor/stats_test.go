@@ -0,0 +1,56 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestMonitorStats ensures the Monitor reports its uptime while running, the
+// logs it has processed, and its memory usage.
+func TestMonitorStats(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:    testAlertWindow,
+		NumTopSections: 1,
+		Output:         ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	if s := m.Stats(); s.Uptime != 0 || s.LogsProcessed != 0 {
+		t.Fatalf("Expected no uptime or logs before starting, got %+v", s)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.Start()
+		close(done)
+	}()
+	writeLogs(t, file.Name(), 3, os.O_APPEND|os.O_WRONLY)
+	m.Ingest(Log{RemoteAddr: "10.0.0.1", Timestamp: time.Now(), Request: "GET /a HTTP/1.1", Status: 200})
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Stats().LogsProcessed != 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 4 logs processed, got %d", m.Stats().LogsProcessed)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s := m.Stats()
+	if s.Uptime <= 0 || s.Goroutines == 0 || s.HeapAlloc == 0 || s.Sys == 0 {
+		t.Fatalf("Expected uptime, goroutines, and memory usage, got %+v", s)
+	}
+
+	m.Stop()
+	<-done
+	if s := m.Stats(); s.Uptime != 0 || s.LogsProcessed != 4 {
+		t.Fatalf("Expected no uptime and 4 logs once stopped, got %+v", s)
+	}
+}
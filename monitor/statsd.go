@@ -0,0 +1,100 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// statsdPrefix is the prefix of the names of metrics sent to statsd.
+const statsdPrefix = "httpmonitor."
+
+// statsdClient sends summary data to a statsd or DogStatsD server over UDP.
+// It's not safe for concurrent use, except that reset may be called while
+// sending.
+type statsdClient struct {
+	conn net.Conn
+	tags string
+
+	// mu guards last, the response counts as of the last send.
+	mu   sync.Mutex
+	last statusFreq
+}
+
+// newStatsdClient creates a statsdClient which sends metrics to the given
+// address. The tags, e.g. "file:access.log", are added to each metric in
+// DogStatsD format.
+func newStatsdClient(addr string, tags ...string) (*statsdClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &statsdClient{conn: conn}
+	if len(tags) > 0 {
+		s.tags = "|#" + strings.Join(tags, ",")
+	}
+	return s, nil
+}
+
+// send sends the summary data as gauges, except for response counts which
+// are sent as counters of the responses since the last send. Each metric is
+// sent in its own datagram. The first error is returned, but sending
+// continues so that a single failure doesn't drop all of the metrics.
+func (s *statsdClient) send(summary *Summary) error {
+	var firstErr error
+	write := func(name string, value interface{}, typ string) {
+		_, err := fmt.Fprintf(s.conn, "%s%s:%v|%s%s", statsdPrefix, name, value, typ, s.tags)
+		if err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "failed to send %s", name)
+		}
+	}
+
+	write("hits_per_second", summary.HitsPerSecond, "g")
+	write("hits_average", summary.AvgHits, "g")
+	write("bytes_per_second", summary.BytesPerSecond, "g")
+	if !summary.DistinctIPsDisabled {
+		write("distinct_ips", summary.DistinctIPs, "g")
+	}
+	if !summary.DistinctPathsDisabled {
+		write("distinct_paths", summary.DistinctPaths, "g")
+	}
+
+	freq := summary.StatusFreq
+	s.mu.Lock()
+	last := s.last
+	s.last = freq
+	s.mu.Unlock()
+	write("responses.1xx", freq.Informational-last.Informational, "c")
+	write("responses.2xx", freq.Successful-last.Successful, "c")
+	write("responses.3xx", freq.Redirection-last.Redirection, "c")
+	write("responses.4xx", freq.ClientError-last.ClientError, "c")
+	write("responses.5xx", freq.ServerError-last.ServerError, "c")
+
+	if summary.SizeHist != nil {
+		quantiles := summary.SizeQuantiles
+		if len(quantiles) == 0 {
+			quantiles = defaultSizeQuantiles
+		}
+		for _, q := range quantiles {
+			write(fmt.Sprintf("response_size.p%g", q), summary.SizeHist.ValueAtQuantile(q), "g")
+		}
+	}
+	return firstErr
+}
+
+// reset forgets the response counts as of the last send, so that the counts
+// sent next are all new. It's called when the counts are reset by
+// Monitor.Reset.
+func (s *statsdClient) reset() {
+	s.mu.Lock()
+	s.last = statusFreq{}
+	s.mu.Unlock()
+}
+
+// close closes the connection to the statsd server.
+func (s *statsdClient) close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+)
+
+// TestStatsdClientSend ensures summary data is sent as tagged statsd metrics
+// and that response counts are sent as deltas.
+func TestStatsdClientSend(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer conn.Close()
+
+	s, err := newStatsdClient(conn.LocalAddr().String(), "file:access_log")
+	if err != nil {
+		t.Fatalf("Error creating statsd client: %v", err)
+	}
+	defer s.close()
+
+	summary := &Summary{
+		HitsPerSecond: 3,
+		DistinctIPs:   7,
+		StatusFreq:    statusFreq{Successful: 10},
+		SizeHist:      hdrhistogram.New(1, maxRecordableSize, 5),
+	}
+	summary.SizeHist.RecordValue(100)
+	if err := s.send(summary); err != nil {
+		t.Fatalf("Error sending metrics: %v", err)
+	}
+	summary.StatusFreq.Successful = 15
+	if err := s.send(summary); err != nil {
+		t.Fatalf("Error sending metrics: %v", err)
+	}
+
+	received := make(map[string]int)
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		received[string(buf[:n])]++
+	}
+	for _, expected := range []string{
+		"httpmonitor.hits_per_second:3|g|#file:access_log",
+		"httpmonitor.distinct_ips:7|g|#file:access_log",
+		"httpmonitor.responses.2xx:10|c|#file:access_log",
+		"httpmonitor.responses.2xx:5|c|#file:access_log",
+		"httpmonitor.response_size.p99:100|g|#file:access_log",
+	} {
+		if received[expected] == 0 {
+			t.Fatalf("Expected metric %q, got %v", expected, received)
+		}
+	}
+}
+
+// TestMonitorResetStatsd ensures response counts sent to statsd after a Reset
+// are all of the responses since the reset, whether there are fewer or more
+// than were sent before it.
+func TestMonitorResetStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer conn.Close()
+
+	m, err := New("", MonitorOpts{
+		AlertWindow: testAlertWindow,
+		StatsdAddr:  conn.LocalAddr().String(),
+		Reader:      &logsReader{},
+		Output:      ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	defer m.statsd.close()
+	ingest := func(n int) {
+		for i := 0; i < n; i++ {
+			m.Ingest(Log{RemoteAddr: "10.0.0.1", Timestamp: time.Now(), Request: "GET /a HTTP/1.1", Status: 200})
+		}
+	}
+	ingest(5)
+	if err := m.statsd.send(m.Snapshot()); err != nil {
+		t.Fatalf("Error sending metrics: %v", err)
+	}
+	for _, n := range []int{7, 2} {
+		m.Reset()
+		ingest(n)
+		if err := m.statsd.send(m.Snapshot()); err != nil {
+			t.Fatalf("Error sending metrics: %v", err)
+		}
+	}
+
+	var responses []string
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		if metric := string(buf[:n]); strings.HasPrefix(metric, "httpmonitor.responses.2xx:") {
+			responses = append(responses, metric)
+		}
+	}
+	expected := []string{"httpmonitor.responses.2xx:5|c", "httpmonitor.responses.2xx:7|c", "httpmonitor.responses.2xx:2|c"}
+	if !reflect.DeepEqual(responses, expected) {
+		t.Fatalf("Expected 2xx counts %v, got %v", expected, responses)
+	}
+}
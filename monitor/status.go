@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// StatusWatch configures a status code, or pattern of codes, for which exact
+// counts are kept and alerts are triggered.
+type StatusWatch struct {
+	// Pattern is a status code, e.g. "503", or a pattern where trailing
+	// digits are replaced by "x", e.g. "4xx" or "50x".
+	Pattern string
+
+	// Threshold, if positive, is the average number of responses per second
+	// matching the pattern over the alert window above which an Alert is
+	// triggered for the pattern. If zero, matching responses are counted but
+	// never alerted on.
+	Threshold float64
+}
+
+// watchedStatus tracks the responses matching a StatusWatch.
+type watchedStatus struct {
+	StatusWatch
+	min, max int
+	count    uint64
+	averager *windowedAverager
+}
+
+// parseStatusPattern returns the range of status codes matched by the given
+// pattern, e.g. 400 to 499 for "4xx".
+func parseStatusPattern(pattern string) (int, int, error) {
+	if len(pattern) != 3 {
+		return 0, 0, errors.Errorf("status pattern %q must have three characters", pattern)
+	}
+	digits := strings.TrimRight(strings.ToLower(pattern), "x")
+	wildcards := len(pattern) - len(digits)
+	if wildcards == len(pattern) {
+		return 0, 0, errors.Errorf("status pattern %q must start with a digit", pattern)
+	}
+	prefix, err := strconv.Atoi(digits)
+	if err != nil || prefix < 0 {
+		return 0, 0, errors.Errorf("status pattern %q must be digits followed by x", pattern)
+	}
+	scale := 1
+	for i := 0; i < wildcards; i++ {
+		scale *= 10
+	}
+	min := prefix * scale
+	if min < 100 {
+		return 0, 0, errors.Errorf("status pattern %q doesn't match valid status codes", pattern)
+	}
+	return min, min + scale - 1, nil
+}
+
+// newWatchedStatus returns a watchedStatus for the given StatusWatch which
+// averages matching responses with the given averager.
+func newWatchedStatus(watch StatusWatch, averager *windowedAverager) (*watchedStatus, error) {
+	min, max, err := parseStatusPattern(watch.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &watchedStatus{StatusWatch: watch, min: min, max: max, averager: averager}, nil
+}
+
+// matches indicates if the given status code matches the pattern.
+func (w *watchedStatus) matches(status int) bool {
+	return status >= w.min && status <= w.max
+}
+
+// numStatusWindows is the number of intervals a windowedStatusFreq rotates
+// through. Like a windowedHLL, the counts span between (n-1)/n of the window
+// and the full window depending on when the last rotation was.
+const numStatusWindows = 6
+
+// windowedStatusFreq counts responses by status class within a moving window
+// of time. Statuses are recorded in the current interval, and the counts sum
+// all of them. Rotating resets the oldest interval and makes it the current
+// one, so it should be done every window / numStatusWindows.
+type windowedStatusFreq struct {
+	freqs []statusFreq
+	idx   int
+}
+
+// newWindowedStatusFreq creates a windowedStatusFreq with numStatusWindows
+// empty intervals.
+func newWindowedStatusFreq() *windowedStatusFreq {
+	return &windowedStatusFreq{freqs: make([]statusFreq, numStatusWindows)}
+}
+
+// record counts the status code in the current interval.
+func (w *windowedStatusFreq) record(status int) {
+	w.freqs[w.idx].record(status)
+}
+
+// sum returns the counts within the window.
+func (w *windowedStatusFreq) sum() statusFreq {
+	var s statusFreq
+	for _, f := range w.freqs {
+		s = s.add(f)
+	}
+	return s
+}
+
+// rotate resets the oldest interval and makes it the current one.
+func (w *windowedStatusFreq) rotate() {
+	w.idx = (w.idx + 1) % len(w.freqs)
+	w.freqs[w.idx] = statusFreq{}
+}
+
+// reset clears all of the intervals.
+func (w *windowedStatusFreq) reset() {
+	for i := range w.freqs {
+		w.freqs[i] = statusFreq{}
+	}
+}
@@ -0,0 +1,58 @@
+package monitor
+
+import "testing"
+
+// TestParseStatusPattern ensures status codes and patterns with trailing
+// wildcards are parsed into ranges and invalid patterns are rejected.
+func TestParseStatusPattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern  string
+		min, max int
+	}{
+		{"503", 503, 503},
+		{"4xx", 400, 499},
+		{"50x", 500, 509},
+		{"5XX", 500, 599},
+	} {
+		min, max, err := parseStatusPattern(tc.pattern)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", tc.pattern, err)
+			continue
+		}
+		if min != tc.min || max != tc.max {
+			t.Errorf("Expected %s to match %d-%d, got %d-%d", tc.pattern, tc.min, tc.max, min, max)
+		}
+	}
+
+	for _, pattern := range []string{"", "xxx", "x03", "5x3", "4000", "099", "abc", "-10"} {
+		if _, _, err := parseStatusPattern(pattern); err == nil {
+			t.Errorf("Expected error for %q", pattern)
+		}
+	}
+}
+
+// TestWindowedStatusFreq ensures statuses recorded in intervals which have
+// been rotated out of the window are no longer counted.
+func TestWindowedStatusFreq(t *testing.T) {
+	w := newWindowedStatusFreq()
+	w.record(200)
+	w.record(503)
+	for i := 0; i < numStatusWindows-1; i++ {
+		w.rotate()
+	}
+	w.record(404)
+	w.record(999)
+	if s := w.sum(); s != (statusFreq{Successful: 1, ClientError: 1, ServerError: 1}) {
+		t.Fatalf("Expected all statuses within the window, got %+v", s)
+	}
+
+	w.rotate()
+	if s := w.sum(); s != (statusFreq{ClientError: 1}) {
+		t.Fatalf("Expected only the latest interval's statuses, got %+v", s)
+	}
+
+	w.reset()
+	if s := w.sum(); s != (statusFreq{}) {
+		t.Fatalf("Expected no statuses after reset, got %+v", s)
+	}
+}
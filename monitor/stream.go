@@ -0,0 +1,104 @@
+package monitor
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// streamReader implements the Reader interface for streams of logs, such as
+// stdin, which are read until EOF without watching for appends.
+type streamReader struct {
+	lineReader
+	stream    io.Reader
+	closeOnce sync.Once
+}
+
+// NewStdinReader returns a new reader for logs in Common Log Format piped to
+// stdin. The reader stops once stdin is closed, e.g. when the writing end of
+// the pipe exits. Closing the reader doesn't close stdin, which belongs to the
+// process.
+func NewStdinReader() Reader {
+	return newStreamReader(newDetachedStream(os.Stdin), "stdin", "Common Log Format", commonLogFormatParser)
+}
+
+// NewReaderFromStream returns a new reader for logs in Common Log Format read
+// from the given stream, such as a socket or HTTP response body. The reader
+// stops once the end of the stream is reached. If the stream is an io.Closer,
+// it's closed when the reader is closed.
+func NewReaderFromStream(r io.Reader) Reader {
+	return newStreamReader(r, "stream", "Common Log Format", commonLogFormatParser)
+}
+
+// newStreamReader returns a new streamReader which parses lines from the named
+// stream in the given format using the given lineParser.
+func newStreamReader(stream io.Reader, source, format string, parser lineParser) *streamReader {
+	return &streamReader{
+		lineReader: newLineReader(source, format, parser),
+		stream:     stream,
+	}
+}
+
+// detachedStream reads from a stream it doesn't own, e.g. stdin, in the
+// background so that closing it stops reading without closing the stream. A
+// read from the stream which is pending when it's closed is abandoned.
+type detachedStream struct {
+	*io.PipeReader
+	w         *io.PipeWriter
+	stream    io.Reader
+	startOnce sync.Once
+}
+
+// newDetachedStream returns a new detachedStream which reads from the given
+// stream once it's started.
+func newDetachedStream(stream io.Reader) *detachedStream {
+	r, w := io.Pipe()
+	return &detachedStream{PipeReader: r, w: w, stream: stream}
+}
+
+// start begins reading from the stream in the background. It has no effect if
+// the detachedStream was already started or closed.
+func (d *detachedStream) start() {
+	d.startOnce.Do(func() {
+		go func() {
+			_, err := io.Copy(d.w, d.stream)
+			d.w.CloseWithError(err)
+		}()
+	})
+}
+
+// Close stops reading, after which reads return io.EOF. The underlying stream
+// isn't closed.
+func (d *detachedStream) Close() error {
+	d.startOnce.Do(func() {})
+	return d.w.Close()
+}
+
+// open begins reading log entries from the stream and places them on the
+// channel. The channel is closed once the end of the stream is reached. A
+// detached stream isn't read from until now.
+func (s *streamReader) open() (<-chan *log, error) {
+	if d, ok := s.stream.(*detachedStream); ok {
+		d.start()
+	}
+	go s.readToEOF(s.stream)
+	return s.logs, nil
+}
+
+// Open implements the Reader interface.
+func (s *streamReader) Open() (<-chan *Log, error) {
+	return exportLogs(s.open())
+}
+
+// Close stops the reader. If the stream is an io.Closer, it's closed in order
+// to unblock any pending read.
+func (s *streamReader) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.close)
+		if closer, ok := s.stream.(io.Closer); ok {
+			err = closer.Close()
+		}
+	})
+	return err
+}
@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStreamReader ensures a stream is read to the end and the channel is then
+// closed.
+func TestStreamReader(t *testing.T) {
+	var (
+		now    = time.Now().Format("02/Jan/2006:15:04:05 -0700")
+		stream = strings.NewReader(fmt.Sprintf(dummyLog, now) + "garbage\n" + fmt.Sprintf(dummyLog, now))
+		r      = newStreamReader(stream, "test", "Common Log Format", commonLogFormatParser)
+	)
+	logs, err := openReader(r)
+	if err != nil {
+		t.Fatalf("Error opening reader: %v", err)
+	}
+	defer r.Close()
+
+	count := 0
+	for range logs {
+		count++
+	}
+	if count != 2 {
+		t.Fatalf("Expected 2 logs, got %d", count)
+	}
+	if skipped := r.Skipped(); skipped != 1 {
+		t.Fatalf("Expected 1 skipped line, got %d", skipped)
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+// TestReaderFromStreamClose ensures closing a stream reader stops it before the
+// end of the stream is reached.
+func TestReaderFromStreamClose(t *testing.T) {
+	now := time.Now().Format("02/Jan/2006:15:04:05 -0700")
+	r := NewReaderFromStream(strings.NewReader(strings.Repeat(fmt.Sprintf(dummyLog, now), 10)))
+	logs, err := openReader(r)
+	if err != nil {
+		t.Fatalf("Error opening reader: %v", err)
+	}
+	<-logs
+	if err := r.Close(); err != nil {
+		t.Fatalf("Error closing reader: %v", err)
+	}
+
+	// At most one more log may be in flight when the reader is closed.
+	count := 1
+	done := make(chan struct{})
+	go func() {
+		for range logs {
+			count++
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected channel to be closed")
+	}
+	if count > 2 {
+		t.Fatalf("Expected reader to stop after close, got %d logs", count)
+	}
+}
+
+// TestDetachedStreamClose ensures closing a reader of a stream it doesn't own,
+// such as stdin, stops it while a read is pending without closing the stream.
+func TestDetachedStreamClose(t *testing.T) {
+	stream, w := io.Pipe()
+	defer w.Close()
+	r := newStreamReader(newDetachedStream(stream), "test", "Common Log Format", commonLogFormatParser)
+	logs, err := openReader(r)
+	if err != nil {
+		t.Fatalf("Error opening reader: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Error closing reader: %v", err)
+	}
+	select {
+	case _, ok := <-logs:
+		if ok {
+			t.Fatal("Expected no logs")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected channel to be closed")
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The pending read receives the write, so the stream is still open.
+	if _, err := w.Write([]byte("garbage\n")); err != nil {
+		t.Fatalf("Expected stream to be open, got %v", err)
+	}
+}
+
+// TestDetachedStreamNotOpened ensures a stream which isn't owned by the reader
+// isn't read from until the reader is opened, or at all if it's closed first.
+func TestDetachedStreamNotOpened(t *testing.T) {
+	stream, w := io.Pipe()
+	defer w.Close()
+	r := newStreamReader(newDetachedStream(stream), "test", "Common Log Format", commonLogFormatParser)
+
+	// A write to the pipe blocks until it's read.
+	written := make(chan struct{})
+	go func() {
+		w.Write([]byte("garbage\n"))
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("Expected stream not to be read before the reader is opened")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Error closing reader: %v", err)
+	}
+	select {
+	case <-written:
+		t.Fatal("Expected stream not to be read once the reader is closed")
+	case <-time.After(100 * time.Millisecond):
+	}
+	stream.Close()
+}
@@ -0,0 +1,58 @@
+package monitor
+
+import "sync"
+
+// summaryFeed publishes the summaries reported by the Monitor to the channels
+// returned by Monitor.Summaries. Each channel buffers only the latest summary,
+// so a slow consumer skips summaries rather than blocking reporting.
+type summaryFeed struct {
+	mu     sync.Mutex
+	subs   []chan *Summary
+	closed bool
+}
+
+// subscribe returns a new channel which receives the summaries published from
+// now on. The channel is already closed if the feed is.
+func (f *summaryFeed) subscribe() <-chan *Summary {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan *Summary, 1)
+	if f.closed {
+		close(ch)
+		return ch
+	}
+	f.subs = append(f.subs, ch)
+	return ch
+}
+
+// publish the summary to each channel, replacing the previous summary if it
+// hasn't been received yet. It's a no-op once the feed is closed.
+func (f *summaryFeed) publish(s *Summary) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	for _, ch := range f.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- s
+	}
+}
+
+// close the channels. A summary which hasn't been received yet can still be
+// received before the channel reports it's closed.
+func (f *summaryFeed) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	f.closed = true
+	for _, ch := range f.subs {
+		close(ch)
+	}
+	f.subs = nil
+}
@@ -0,0 +1,99 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestSummaryFeed ensures each subscriber receives the latest summary
+// published, that closing the feed closes their channels, and that
+// subscribing to a closed feed returns a closed channel.
+func TestSummaryFeed(t *testing.T) {
+	f := new(summaryFeed)
+	a, b := f.subscribe(), f.subscribe()
+	first, second := &Summary{TotalRequests: 1}, &Summary{TotalRequests: 2}
+	f.publish(first)
+	if s := <-a; s != first {
+		t.Fatalf("Expected first summary, got %+v", s)
+	}
+	f.publish(second)
+	if s := <-a; s != second {
+		t.Fatalf("Expected second summary, got %+v", s)
+	}
+	// b didn't receive the first summary before the second was published.
+	if s := <-b; s != second {
+		t.Fatalf("Expected only the latest summary, got %+v", s)
+	}
+
+	f.close()
+	f.publish(first)
+	for _, ch := range []<-chan *Summary{a, b, f.subscribe()} {
+		if s, ok := <-ch; ok {
+			t.Fatalf("Expected channel to be closed, got %+v", s)
+		}
+	}
+}
+
+// TestMonitorSummaries ensures summaries are received every reporting
+// interval while the Monitor runs and the channel is closed when it stops.
+func TestMonitorSummaries(t *testing.T) {
+	file, err := ioutil.TempFile("", "access_log")
+	if err != nil {
+		t.Fatalf("Error creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	m, err := New(file.Name(), MonitorOpts{
+		AlertWindow:       testAlertWindow,
+		NumTopSections:    1,
+		ReportingInterval: 50 * time.Millisecond,
+		Output:            ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	summaries := m.Summaries()
+	done := make(chan struct{})
+	go func() {
+		m.Start()
+		close(done)
+	}()
+	writeLogs(t, file.Name(), 3, os.O_APPEND|os.O_WRONLY)
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case s := <-summaries:
+			if s == nil {
+				t.Fatal("Expected summary, got nil")
+			}
+			if s.TotalRequests != 3 {
+				continue
+			}
+		case <-deadline:
+			t.Fatal("Expected summary with 3 requests")
+		}
+		break
+	}
+
+	m.Stop()
+	<-done
+	for {
+		select {
+		case _, ok := <-summaries:
+			if ok {
+				// A summary reported before stopping may still be buffered.
+				continue
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected channel to be closed")
+		}
+		break
+	}
+	if _, ok := <-m.Summaries(); ok {
+		t.Fatal("Expected closed channel once the Monitor has stopped")
+	}
+}
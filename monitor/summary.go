@@ -2,8 +2,11 @@ package monitor
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/codahale/hdrhistogram"
@@ -11,57 +14,588 @@ import (
 	"github.com/tylertreat/BoomFilters"
 )
 
-// Summary is a point-in-time snapshot of the traffic data.
+// defaultSizeQuantiles are the response size quantiles reported by default.
+var defaultSizeQuantiles = []float64{50, 99}
+
+// defaultSizeBuckets are the upper bounds in bytes of the response size
+// buckets counted by default, i.e. <1KB, 1-10KB, 10-100KB, and >=100KB.
+var defaultSizeBuckets = []int64{1000, 10000, 100000}
+
+// SizeBucket is the number of responses whose size is within a range.
+type SizeBucket struct {
+	Min   int64  `json:"min"` // inclusive, in bytes
+	Max   int64  `json:"max"` // exclusive, in bytes, or zero if unbounded
+	Count uint64 `json:"count"`
+}
+
+// newSizeBuckets returns empty buckets for the given ascending upper bounds,
+// including a final unbounded bucket.
+func newSizeBuckets(bounds []int64) []SizeBucket {
+	buckets := make([]SizeBucket, len(bounds)+1)
+	for i, bound := range bounds {
+		buckets[i].Max = bound
+		buckets[i+1].Min = bound
+	}
+	return buckets
+}
+
+// String returns the range of the bucket, e.g. "1KB-10KB".
+func (b SizeBucket) String() string {
+	switch {
+	case b.Max == 0:
+		return ">=" + byteString(b.Min)
+	case b.Min == 0:
+		return "<" + byteString(b.Max)
+	default:
+		return byteString(b.Min) + "-" + byteString(b.Max)
+	}
+}
+
+// byteString returns the number of bytes in decimal units, e.g. "1.5KB".
+func byteString(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(n)
+	i := 0
+	for ; value >= 1000 && i < len(units)-1; i++ {
+		value /= 1000
+	}
+	return strconv.FormatFloat(value, 'g', 4, 64) + units[i]
+}
+
+// RateStats are statistics of the per-second rates measured in each quantum
+// of a window.
+type RateStats struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	P95 float64 `json:"p95"`
+}
+
+// Summary is a point-in-time snapshot of the traffic data. The top-k lists,
+// e.g. TopSections, are ordered from lowest to highest frequency with ties in
+// reverse alphabetical order, so they're displayed from most to least frequent
+// with ties in alphabetical order.
 type Summary struct {
-	Timestamp     time.Time
-	TopSections   []*boom.Element
-	DistinctIPs   uint64
-	SizeHist      *hdrhistogram.Histogram
-	StatusFreq    statusFreq
-	HitsPerSecond uint64
-	AvgHits       float64
-	Window        time.Duration
+	Timestamp       time.Time
+	TopSections     []*boom.Element
+	TopIPs          []*boom.Element
+	TopUserAgents   []*boom.Element // logs without a user-agent are under "(none)"
+	TopCountries    []*boom.Element // ISO codes, or "(unknown)" if not located
+	DistinctIPs     uint64
+	DistinctPaths   uint64
+	SizeHist        *hdrhistogram.Histogram
+	SizeQuantiles   []float64
+	SizeBuckets     []SizeBucket            // responses by size since the Monitor started
+	LatencyHist     *hdrhistogram.Histogram // in microseconds
+	StatusFreq      statusFreq
+	WatchedStatuses map[string]uint64 // exact counts by watched status pattern
+	MethodFreq      map[string]uint64
+	ProtocolFreq    map[string]uint64
+	LevelFreq       map[string]uint64 // entries by level, e.g. of error logs
+	AvgErrors       float64           // error-level entries per second over the window
+	HitsPerSecond   uint64
+	AvgHits         float64
+	HitRate         RateStats // hits/s of the quanta within the window
+	BytesPerSecond  uint64
+	AvgBytes        float64 // bytes per second over the window
+	Window          time.Duration
+	TotalRequests   uint64 // all logs processed, regardless of sampling
+
+	// SuccessRate is the fraction of responses which weren't server errors
+	// or, if MonitorOpts.ClientErrorsAsFailures is set, client errors. It's 1
+	// if there were no responses.
+	SuccessRate float64
+
+	// TopSectionsByBytes are the sections which served the most response bytes
+	// since the Monitor started, with the bytes as their frequencies. This
+	// reveals sections whose few but large responses dominate bandwidth.
+	// Unlike TopSections, they aren't decayed.
+	TopSectionsByBytes []*boom.Element
+
+	// TotalDistinctIPs is the estimated number of distinct IP addresses since
+	// the Monitor started. DistinctIPs is the same unless DistinctIPWindow is
+	// set, in which case DistinctIPs only estimates the addresses seen within
+	// that window. See MonitorOpts.DistinctIPWindow.
+	TotalDistinctIPs uint64
+	DistinctIPWindow time.Duration
+
+	// RecentStatusFreq counts the responses by status class within the
+	// StatusWindow, if it's set, while StatusFreq counts them since the
+	// Monitor started. See MonitorOpts.StatusWindow.
+	RecentStatusFreq statusFreq
+	StatusWindow     time.Duration
+
+	// SkippedLines is the number of log lines skipped because they could not
+	// be parsed. It's only available if the Reader counts skipped lines, which
+	// the Readers in this package do.
+	SkippedLines uint64
+
+	// MalformedRequests is the number of logs whose request line could not be
+	// parsed. These logs still count towards hits and status frequencies but
+	// not towards sections or methods.
+	MalformedRequests uint64
+
+	// InvalidTimestamps is the number of logs whose timestamp was missing or
+	// could not be parsed. These are counted as if they occurred when they
+	// were read.
+	InvalidTimestamps uint64
+
+	// IgnoredRequests is the number of logs whose request path matched one of
+	// the ignore patterns. These count towards total requests and hits but no
+	// other aggregations. See MonitorOpts.IgnorePatterns.
+	IgnoredRequests uint64
+
+	// SampleRate is the fraction of logs sampled for the aggregations other
+	// than hits, skipped lines, and invalid timestamps. See
+	// MonitorOpts.SampleRate.
+	SampleRate float64
+
+	// FirstSeen and LastSeen are the earliest and latest timestamps of the
+	// logs collected, which is the span of time covered by an archived file
+	// rather than how long it took to read. Logs with invalid timestamps
+	// aren't included. Both are zero if no logs have been collected.
+	FirstSeen time.Time
+	LastSeen  time.Time
+
+	// DistinctIPsDisabled, DistinctPathsDisabled, SizeHistDisabled, and
+	// TopSectionsDisabled indicate the aggregations which were disabled, in
+	// which case their fields are zero or nil and omitted when formatted. See
+	// MonitorOpts.DisableDistinctIPs.
+	DistinctIPsDisabled   bool
+	DistinctPathsDisabled bool
+	SizeHistDisabled      bool
+	TopSectionsDisabled   bool
+
+	// color causes client and server error counts to be colored when
+	// formatted. See MonitorOpts.Color.
+	color bool
 }
 
 // String returns a string representation of the summary suitable for printing.
 func (s *Summary) String() string {
-	str := fmt.Sprintf("===== SUMMARY [%s] =================>\n", s.Timestamp.Format("01/02/06 15:04:05"))
-	str += s.topHitsString()
-	str += fmt.Sprintf("Unique visitors:\t%d\n", s.DistinctIPs)
+	return s.format(nil)
+}
+
+// DeltaString returns a string representation of the summary like String, but
+// with the counters, such as total requests, distinct counts, and status
+// frequencies, shown as signed differences from the given previous summary.
+// Rates, averages, top-k lists, and size and latency distributions are shown
+// as absolute values. If prev is nil, this is the same as String.
+func (s *Summary) DeltaString(prev *Summary) string {
+	return s.format(prev)
+}
+
+// format returns a string representation of the summary. If prev is non-nil,
+// counters are shown as differences from it.
+func (s *Summary) format(prev *Summary) string {
+	var (
+		old   Summary
+		count = func(cur, _ uint64) string { return strconv.FormatUint(cur, 10) }
+		freqs = func(cur, _ map[string]uint64) string { return freqString(cur) }
+		str   string
+	)
+	if prev != nil {
+		old = *prev
+		count = deltaString
+		freqs = freqDeltaString
+		str = fmt.Sprintf("===== SUMMARY [%s] (changes since %s) =====>\n",
+			s.Timestamp.Format("01/02/06 15:04:05"), prev.Timestamp.Format("15:04:05"))
+	} else {
+		str = fmt.Sprintf("===== SUMMARY [%s] =================>\n", s.Timestamp.Format("01/02/06 15:04:05"))
+	}
+	if !s.TopSectionsDisabled {
+		str += s.topHitsString()
+	}
+	if len(s.TopSectionsByBytes) > 0 {
+		str += s.topSectionBytesString()
+	}
+	if len(s.TopIPs) > 0 {
+		str += s.topIPsString()
+	}
+	if len(s.TopUserAgents) > 0 {
+		str += s.topUserAgentsString()
+	}
+	if len(s.TopCountries) > 0 {
+		str += s.topCountriesString()
+	}
+	str += fmt.Sprintf("Total requests:\t\t%s\n", count(s.TotalRequests, old.TotalRequests))
+	if !s.FirstSeen.IsZero() {
+		str += fmt.Sprintf("Time span:\t\t%s - %s (%s)\n", s.FirstSeen.Format("01/02/06 15:04:05"),
+			s.LastSeen.Format("01/02/06 15:04:05"), s.LastSeen.Sub(s.FirstSeen))
+	}
+	if s.StatusFreq.total() > 0 {
+		str += fmt.Sprintf("Success rate:\t\t%.2f%%\n", s.SuccessRate*100)
+	} else {
+		str += "Success rate:\t\tn/a\n"
+	}
+	switch {
+	case s.DistinctIPsDisabled:
+	case s.DistinctIPWindow > 0:
+		str += fmt.Sprintf("Unique visitors (%s):\t%s\n", s.DistinctIPWindow, count(s.DistinctIPs, old.DistinctIPs))
+		str += fmt.Sprintf("Total unique visitors:\t%s\n", count(s.TotalDistinctIPs, old.TotalDistinctIPs))
+	default:
+		str += fmt.Sprintf("Unique visitors:\t%s\n", count(s.DistinctIPs, old.DistinctIPs))
+	}
+	if !s.DistinctPathsDisabled {
+		str += fmt.Sprintf("Unique paths:\t\t%s\n", count(s.DistinctPaths, old.DistinctPaths))
+	}
 	str += fmt.Sprintf("Hits/s:\t\t\t%d\n", s.HitsPerSecond)
 	str += fmt.Sprintf("Mean hits (%s):\t%.2f\n", s.Window, s.AvgHits)
+	str += fmt.Sprintf("Hits/s min/p95/max:\t%.2f / %.2f / %.2f\n", s.HitRate.Min, s.HitRate.P95, s.HitRate.Max)
+	str += fmt.Sprintf("Bytes/s:\t\t%d\n", s.BytesPerSecond)
+	str += fmt.Sprintf("Mean bytes/s (%s):\t%.2f\n", s.Window, s.AvgBytes)
+	str += fmt.Sprintf("Methods:\t\t%s\n", freqs(s.MethodFreq, old.MethodFreq))
+	str += fmt.Sprintf("Protocols:\t\t%s\n", freqs(s.ProtocolFreq, old.ProtocolFreq))
+	if len(s.LevelFreq) > 0 {
+		str += fmt.Sprintf("Levels:\t\t\t%s\n", freqs(s.LevelFreq, old.LevelFreq))
+		str += fmt.Sprintf("Mean errors/s (%s):\t%.2f\n", s.Window, s.AvgErrors)
+	}
+	str += fmt.Sprintf("Skipped lines:\t\t%s\n", count(s.SkippedLines, old.SkippedLines))
+	str += fmt.Sprintf("Malformed requests:\t%s\n", count(s.MalformedRequests, old.MalformedRequests))
+	str += fmt.Sprintf("Invalid timestamps:\t%s\n", count(s.InvalidTimestamps, old.InvalidTimestamps))
+	if s.IgnoredRequests > 0 || old.IgnoredRequests > 0 {
+		str += fmt.Sprintf("Ignored requests:\t%s\n", count(s.IgnoredRequests, old.IgnoredRequests))
+	}
+	if s.SampleRate > 0 && s.SampleRate < 1 {
+		str += fmt.Sprintf("Sample rate:\t\t%g\n", s.SampleRate)
+	}
 	str += "------- Responses -----------------------\n"
-	str += fmt.Sprintf("1xx: %d, 2xx: %d, 3xx: %d, 4xx: %d, 5xx: %d\n",
-		s.StatusFreq.Informational,
-		s.StatusFreq.Successful,
-		s.StatusFreq.Redirection,
-		s.StatusFreq.ClientError,
-		s.StatusFreq.ServerError,
-	)
-	str += fmt.Sprintf("Min response size:\t%dB\n", s.SizeHist.Min())
-	str += fmt.Sprintf("Median response size:\t%dB\n", s.SizeHist.ValueAtQuantile(50))
-	str += fmt.Sprintf("Max response size:\t%dB\n", s.SizeHist.Max())
-	str += fmt.Sprintf("p99 response size:\t%dB\n", s.SizeHist.ValueAtQuantile(99))
-	str += fmt.Sprintf("Mean response size:\t%.2fB\n", s.SizeHist.Mean())
-	str += fmt.Sprintf("Response size std dev:\t%.2fB\n", s.SizeHist.StdDev())
+	statuses := func(cur, old statusFreq) string {
+		return fmt.Sprintf("1xx: %s, 2xx: %s, 3xx: %s, 4xx: %s, 5xx: %s",
+			count(cur.Informational, old.Informational),
+			count(cur.Successful, old.Successful),
+			count(cur.Redirection, old.Redirection),
+			colorize(count(cur.ClientError, old.ClientError), colorYellow, s.color && cur.ClientError > 0),
+			colorize(count(cur.ServerError, old.ServerError), colorRed, s.color && cur.ServerError > 0),
+		)
+	}
+	str += statuses(s.StatusFreq, old.StatusFreq) + "\n"
+	if s.StatusWindow > 0 {
+		str += fmt.Sprintf("Recent (%s): %s\n", s.StatusWindow, statuses(s.RecentStatusFreq, old.RecentStatusFreq))
+	}
+	if len(s.WatchedStatuses) > 0 {
+		str += fmt.Sprintf("Watched statuses:\t%s\n", freqs(s.WatchedStatuses, old.WatchedStatuses))
+	}
+	if s.SizeHist != nil {
+		str += fmt.Sprintf("Min response size:\t%dB\n", s.SizeHist.Min())
+		quantiles := s.SizeQuantiles
+		if len(quantiles) == 0 {
+			quantiles = defaultSizeQuantiles
+		}
+		for _, q := range quantiles {
+			str += fmt.Sprintf("p%g response size:\t%dB\n", q, s.SizeHist.ValueAtQuantile(q))
+		}
+		str += fmt.Sprintf("Max response size:\t%dB\n", s.SizeHist.Max())
+		str += fmt.Sprintf("Mean response size:\t%.2fB\n", s.SizeHist.Mean())
+		str += fmt.Sprintf("Response size std dev:\t%.2fB\n", s.SizeHist.StdDev())
+	}
+	str += sizeBucketsString(s.SizeBuckets)
+	if s.LatencyHist != nil && s.LatencyHist.TotalCount() > 0 {
+		str += fmt.Sprintf("Min latency:\t\t%s\n", microseconds(s.LatencyHist.Min()))
+		str += fmt.Sprintf("Median latency:\t\t%s\n", microseconds(s.LatencyHist.ValueAtQuantile(50)))
+		str += fmt.Sprintf("p99 latency:\t\t%s\n", microseconds(s.LatencyHist.ValueAtQuantile(99)))
+		str += fmt.Sprintf("Max latency:\t\t%s\n", microseconds(s.LatencyHist.Max()))
+	}
 	str += "-----------------------------------------\n"
 	return str
 }
 
+// microseconds returns the given number of microseconds as a time.Duration.
+func microseconds(us int64) time.Duration {
+	return time.Duration(us) * time.Microsecond
+}
+
+// freqString returns the given frequencies as a comma-separated list of
+// "key: freq" pairs ordered by key.
+func freqString(freqs map[string]uint64) string {
+	keys := make([]string, 0, len(freqs))
+	for key := range freqs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s: %d", key, freqs[key])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// deltaString returns the difference between the current and old values of a
+// counter with a sign, e.g. "+3". Counters may decrease, e.g. distinct counts
+// after a reset.
+func deltaString(cur, old uint64) string {
+	if cur < old {
+		return "-" + strconv.FormatUint(old-cur, 10)
+	}
+	return "+" + strconv.FormatUint(cur-old, 10)
+}
+
+// freqDeltaString returns the differences between the current and old
+// frequencies as a comma-separated list of "key: delta" pairs ordered by key.
+// Keys which are only in the old frequencies are included.
+func freqDeltaString(cur, old map[string]uint64) string {
+	keys := make([]string, 0, len(cur))
+	for key := range cur {
+		keys = append(keys, key)
+	}
+	for key := range old {
+		if _, ok := cur[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s: %s", key, deltaString(cur[key], old[key]))
+	}
+	return strings.Join(pairs, ", ")
+}
+
 // topHitsString returns a table containing the most frequently visited
 // sections in table form.
 func (s *Summary) topHitsString() string {
+	return topElementsString("Section", "Hits", s.TopSections)
+}
+
+// topSectionBytesString returns a table containing the sections which served
+// the most bytes in table form.
+func (s *Summary) topSectionBytesString() string {
+	return topElementsString("Section", "Bytes", s.TopSectionsByBytes)
+}
+
+// topIPsString returns a table containing the most frequent remote IP
+// addresses in table form.
+func (s *Summary) topIPsString() string {
+	return topElementsString("IP", "Hits", s.TopIPs)
+}
+
+// topUserAgentsString returns a table containing the most frequent
+// user-agents in table form.
+func (s *Summary) topUserAgentsString() string {
+	return topElementsString("User-Agent", "Hits", s.TopUserAgents)
+}
+
+// topCountriesString returns a table containing the most frequent countries
+// in table form.
+func (s *Summary) topCountriesString() string {
+	return topElementsString("Country", "Hits", s.TopCountries)
+}
+
+// topElementsString returns a table containing the given top-k elements, which
+// are ordered as by sortElements, and their frequencies from most to least
+// frequent. The name and unit are used as the column headers for the elements
+// and their frequencies.
+func topElementsString(name, unit string, elements []*boom.Element) string {
 	var buf bytes.Buffer
 	table := tablewriter.NewWriter(&buf)
-	table.SetHeader([]string{"Section", "Hits"})
+	table.SetHeader([]string{name, unit})
 	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
 	table.SetAlignment(tablewriter.ALIGN_LEFT)
 	data := [][]string{}
-	for i := len(s.TopSections) - 1; i >= 0; i-- {
-		element := s.TopSections[i]
+	for i := len(elements) - 1; i >= 0; i-- {
+		element := elements[i]
 		data = append(data, []string{string(element.Data), strconv.FormatInt(int64(element.Freq), 10)})
 	}
 	table.AppendBulk(data)
 	table.Render()
 	return buf.String()
 }
+
+// sizeBucketsString returns a table containing the number and share of
+// responses in each size bucket, or an empty string if there are no responses.
+func sizeBucketsString(buckets []SizeBucket) string {
+	var total uint64
+	for _, b := range buckets {
+		total += b.Count
+	}
+	if total == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	table := tablewriter.NewWriter(&buf)
+	table.SetHeader([]string{"Response size", "Requests", "Share"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	for _, b := range buckets {
+		table.Append([]string{
+			b.String(),
+			strconv.FormatUint(b.Count, 10),
+			fmt.Sprintf("%.1f%%", float64(b.Count)/float64(total)*100),
+		})
+	}
+	table.Render()
+	return buf.String()
+}
+
+// elementJSON is the JSON representation of a top-k element.
+type elementJSON struct {
+	Value string `json:"value"`
+	Hits  uint64 `json:"hits"`
+}
+
+// bytesJSON is the JSON representation of a top-k element weighted by bytes.
+type bytesJSON struct {
+	Value string `json:"value"`
+	Bytes uint64 `json:"bytes"`
+}
+
+// histogramJSON is the JSON representation of a histogram. Quantiles are keyed
+// by name, e.g. "p99".
+type histogramJSON struct {
+	Count     int64            `json:"count"`
+	Min       int64            `json:"min"`
+	Max       int64            `json:"max"`
+	Mean      float64          `json:"mean"`
+	StdDev    float64          `json:"std_dev"`
+	Quantiles map[string]int64 `json:"quantiles"`
+}
+
+// summaryJSON is the JSON representation of a Summary.
+type summaryJSON struct {
+	Timestamp         time.Time         `json:"timestamp"`
+	TopSections       []elementJSON     `json:"top_sections"`
+	TopSectionsBytes  []bytesJSON       `json:"top_sections_by_bytes,omitempty"`
+	TopIPs            []elementJSON     `json:"top_ips"`
+	TopUserAgents     []elementJSON     `json:"top_user_agents,omitempty"`
+	TopCountries      []elementJSON     `json:"top_countries,omitempty"`
+	DistinctIPs       *uint64           `json:"distinct_ips,omitempty"`
+	TotalDistinctIPs  *uint64           `json:"total_distinct_ips,omitempty"`
+	DistinctIPWindow  time.Duration     `json:"distinct_ip_window,omitempty"`
+	DistinctPaths     *uint64           `json:"distinct_paths,omitempty"`
+	Size              *histogramJSON    `json:"size,omitempty"`
+	SizeBuckets       []SizeBucket      `json:"size_buckets"`
+	Latency           *histogramJSON    `json:"latency_us,omitempty"`
+	StatusFreq        map[string]uint64 `json:"status_freq"`
+	RecentStatusFreq  map[string]uint64 `json:"recent_status_freq,omitempty"`
+	StatusWindow      time.Duration     `json:"status_window,omitempty"`
+	WatchedStatuses   map[string]uint64 `json:"watched_statuses,omitempty"`
+	MethodFreq        map[string]uint64 `json:"method_freq"`
+	ProtocolFreq      map[string]uint64 `json:"protocol_freq"`
+	LevelFreq         map[string]uint64 `json:"level_freq,omitempty"`
+	AvgErrors         float64           `json:"avg_errors"`
+	HitsPerSecond     uint64            `json:"hits_per_second"`
+	AvgHits           float64           `json:"avg_hits"`
+	HitRate           RateStats         `json:"hit_rate"`
+	BytesPerSecond    uint64            `json:"bytes_per_second"`
+	AvgBytes          float64           `json:"avg_bytes"`
+	Window            time.Duration     `json:"window"`
+	TotalRequests     uint64            `json:"total_requests"`
+	SuccessRate       float64           `json:"success_rate"`
+	SkippedLines      uint64            `json:"skipped_lines"`
+	MalformedRequests uint64            `json:"malformed_requests"`
+	InvalidTimestamps uint64            `json:"invalid_timestamps"`
+	IgnoredRequests   uint64            `json:"ignored_requests"`
+	SampleRate        float64           `json:"sample_rate"`
+	FirstSeen         *time.Time        `json:"first_seen,omitempty"`
+	LastSeen          *time.Time        `json:"last_seen,omitempty"`
+}
+
+// MarshalJSON returns the JSON encoding of the summary. Top-k elements are
+// listed from most to least frequent, histograms are summarized by their
+// count, extremes, mean, standard deviation, and quantiles, and durations are
+// in nanoseconds.
+func (s *Summary) MarshalJSON() ([]byte, error) {
+	quantiles := s.SizeQuantiles
+	if len(quantiles) == 0 {
+		quantiles = defaultSizeQuantiles
+	}
+	j := summaryJSON{
+		Timestamp:         s.Timestamp,
+		TopSections:       elementsJSON(s.TopSections),
+		TopSectionsBytes:  bytesElementsJSON(s.TopSectionsByBytes),
+		TopIPs:            elementsJSON(s.TopIPs),
+		TopUserAgents:     elementsJSON(s.TopUserAgents),
+		TopCountries:      elementsJSON(s.TopCountries),
+		DistinctIPWindow:  s.DistinctIPWindow,
+		Size:              newHistogramJSON(s.SizeHist, quantiles),
+		SizeBuckets:       s.SizeBuckets,
+		Latency:           newHistogramJSON(s.LatencyHist, []float64{50, 99}),
+		StatusFreq:        statusFreqJSON(s.StatusFreq),
+		WatchedStatuses:   s.WatchedStatuses,
+		MethodFreq:        s.MethodFreq,
+		ProtocolFreq:      s.ProtocolFreq,
+		LevelFreq:         s.LevelFreq,
+		AvgErrors:         s.AvgErrors,
+		HitsPerSecond:     s.HitsPerSecond,
+		AvgHits:           s.AvgHits,
+		HitRate:           s.HitRate,
+		BytesPerSecond:    s.BytesPerSecond,
+		AvgBytes:          s.AvgBytes,
+		Window:            s.Window,
+		TotalRequests:     s.TotalRequests,
+		SuccessRate:       s.SuccessRate,
+		SkippedLines:      s.SkippedLines,
+		MalformedRequests: s.MalformedRequests,
+		InvalidTimestamps: s.InvalidTimestamps,
+		IgnoredRequests:   s.IgnoredRequests,
+		SampleRate:        s.SampleRate,
+	}
+	if s.StatusWindow > 0 {
+		j.RecentStatusFreq = statusFreqJSON(s.RecentStatusFreq)
+		j.StatusWindow = s.StatusWindow
+	}
+	// Distinct counts are omitted, rather than zero, if they're disabled.
+	if !s.DistinctIPsDisabled {
+		j.DistinctIPs, j.TotalDistinctIPs = &s.DistinctIPs, &s.TotalDistinctIPs
+	}
+	if !s.DistinctPathsDisabled {
+		j.DistinctPaths = &s.DistinctPaths
+	}
+	if !s.FirstSeen.IsZero() {
+		j.FirstSeen, j.LastSeen = &s.FirstSeen, &s.LastSeen
+	}
+	return json.Marshal(j)
+}
+
+// statusFreqJSON returns the JSON representation of the status frequencies,
+// keyed by status class.
+func statusFreqJSON(s statusFreq) map[string]uint64 {
+	return map[string]uint64{
+		"1xx": s.Informational,
+		"2xx": s.Successful,
+		"3xx": s.Redirection,
+		"4xx": s.ClientError,
+		"5xx": s.ServerError,
+	}
+}
+
+// elementsJSON returns the JSON representations of the given top-k elements,
+// which are ordered from lowest to highest frequency, from most to least
+// frequent.
+func elementsJSON(elements []*boom.Element) []elementJSON {
+	j := make([]elementJSON, 0, len(elements))
+	for i := len(elements) - 1; i >= 0; i-- {
+		j = append(j, elementJSON{Value: string(elements[i].Data), Hits: elements[i].Freq})
+	}
+	return j
+}
+
+// bytesElementsJSON returns the JSON representations of the given top-k
+// elements weighted by bytes, which are ordered from lowest to highest weight,
+// from most to least bytes.
+func bytesElementsJSON(elements []*boom.Element) []bytesJSON {
+	j := make([]bytesJSON, 0, len(elements))
+	for i := len(elements) - 1; i >= 0; i-- {
+		j = append(j, bytesJSON{Value: string(elements[i].Data), Bytes: elements[i].Freq})
+	}
+	return j
+}
+
+// newHistogramJSON returns the JSON representation of the histogram with the
+// given quantiles, or nil if the histogram is nil or empty.
+func newHistogramJSON(hist *hdrhistogram.Histogram, quantiles []float64) *histogramJSON {
+	if hist == nil || hist.TotalCount() == 0 {
+		return nil
+	}
+	j := &histogramJSON{
+		Count:     hist.TotalCount(),
+		Min:       hist.Min(),
+		Max:       hist.Max(),
+		Mean:      hist.Mean(),
+		StdDev:    hist.StdDev(),
+		Quantiles: make(map[string]int64, len(quantiles)),
+	}
+	for _, q := range quantiles {
+		j.Quantiles["p"+strconv.FormatFloat(q, 'g', -1, 64)] = hist.ValueAtQuantile(q)
+	}
+	return j
+}
@@ -0,0 +1,237 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+	"github.com/tylertreat/BoomFilters"
+)
+
+// TestSummaryStringSizeQuantiles ensures the configured response size
+// quantiles are reported in order.
+func TestSummaryStringSizeQuantiles(t *testing.T) {
+	s := &Summary{
+		SizeHist:      hdrhistogram.New(1, maxRecordableSize, 5),
+		SizeQuantiles: []float64{95, 99.9},
+	}
+	for i := int64(1); i <= 1000; i++ {
+		s.SizeHist.RecordValue(i)
+	}
+
+	str := s.String()
+	p95 := strings.Index(str, "p95 response size:\t950B\n")
+	p999 := strings.Index(str, "p99.9 response size:\t999B\n")
+	if p95 < 0 || p999 < 0 || p95 > p999 {
+		t.Fatalf("Expected p95 and p99.9 response sizes in order, got:\n%s", str)
+	}
+	if strings.Contains(str, "p50 response size") {
+		t.Fatalf("Expected only configured quantiles, got:\n%s", str)
+	}
+}
+
+// TestSummaryDeltaString ensures counters are shown as signed differences from
+// the previous summary.
+func TestSummaryDeltaString(t *testing.T) {
+	prev := &Summary{
+		SizeHist:      hdrhistogram.New(1, maxRecordableSize, 5),
+		TotalRequests: 10,
+		DistinctIPs:   5,
+		StatusFreq:    statusFreq{Successful: 8, ServerError: 2},
+		MethodFreq:    map[string]uint64{"GET": 8, "DELETE": 2},
+	}
+	s := &Summary{
+		SizeHist:      hdrhistogram.New(1, maxRecordableSize, 5),
+		TotalRequests: 15,
+		DistinctIPs:   4,
+		StatusFreq:    statusFreq{Successful: 11, ServerError: 4},
+		MethodFreq:    map[string]uint64{"GET": 13},
+	}
+
+	str := s.DeltaString(prev)
+	for _, expected := range []string{
+		"Total requests:\t\t+5\n",
+		"Unique visitors:\t-1\n",
+		"Methods:\t\tDELETE: -2, GET: +5\n",
+		"1xx: +0, 2xx: +3, 3xx: +0, 4xx: +0, 5xx: +2\n",
+	} {
+		if !strings.Contains(str, expected) {
+			t.Fatalf("Expected %q in delta summary, got:\n%s", expected, str)
+		}
+	}
+	if s.DeltaString(nil) != s.String() {
+		t.Fatal("Expected delta summary without previous summary to match String")
+	}
+}
+
+// TestSummaryStringColor ensures client and server error counts are only
+// colored when enabled and nonzero.
+func TestSummaryStringColor(t *testing.T) {
+	s := &Summary{
+		SizeHist:   hdrhistogram.New(1, maxRecordableSize, 5),
+		StatusFreq: statusFreq{Successful: 8, ServerError: 2},
+	}
+	if str := s.String(); strings.Contains(str, "\x1b[") {
+		t.Fatalf("Expected no escape codes with color disabled, got:\n%s", str)
+	}
+
+	s.color = true
+	str := s.String()
+	if !strings.Contains(str, "5xx: "+colorRed+"2"+colorReset+"\n") {
+		t.Fatalf("Expected 5xx count in red, got:\n%s", str)
+	}
+	if !strings.Contains(str, "4xx: 0,") {
+		t.Fatalf("Expected zero 4xx count without color, got:\n%s", str)
+	}
+}
+
+// TestSummaryStringDistinctIPWindow ensures both the windowed and total
+// distinct IP counts are shown when distinct IPs are windowed.
+func TestSummaryStringDistinctIPWindow(t *testing.T) {
+	s := &Summary{
+		SizeHist:         hdrhistogram.New(1, maxRecordableSize, 5),
+		DistinctIPs:      3,
+		TotalDistinctIPs: 40,
+		DistinctIPWindow: time.Hour,
+	}
+	str := s.String()
+	if !strings.Contains(str, "Unique visitors (1h0m0s):\t3\n") || !strings.Contains(str, "Total unique visitors:\t40\n") {
+		t.Fatalf("Expected windowed and total unique visitors, got:\n%s", str)
+	}
+}
+
+// TestSummaryStringSizeBuckets ensures the size buckets are labeled with
+// their ranges and shown with their share of responses.
+func TestSummaryStringSizeBuckets(t *testing.T) {
+	s := &Summary{
+		SizeHist:    hdrhistogram.New(1, maxRecordableSize, 5),
+		SizeBuckets: newSizeBuckets([]int64{1000, 1500, 1000000}),
+	}
+	if str := s.String(); strings.Contains(str, "RESPONSE SIZE") {
+		t.Fatalf("Expected no size buckets without responses, got:\n%s", str)
+	}
+
+	for i, count := range []uint64{6, 0, 3, 1} {
+		s.SizeBuckets[i].Count = count
+	}
+	str := s.String()
+	for _, row := range []string{
+		"| <1KB          | 6        | 60.0% |",
+		"| 1KB-1.5KB     | 0        | 0.0%  |",
+		"| 1.5KB-1MB     | 3        | 30.0% |",
+		"| >=1MB         | 1        | 10.0% |",
+	} {
+		if !strings.Contains(str, row) {
+			t.Fatalf("Expected row %q, got:\n%s", row, str)
+		}
+	}
+}
+
+// TestSummaryStringTopSectionsOrder ensures top sections are displayed from
+// most to least frequent with ties in alphabetical order.
+func TestSummaryStringTopSectionsOrder(t *testing.T) {
+	topk := boom.NewTopK(0.001, 0.99, 5)
+	for section, hits := range map[string]int{"/b": 2, "/e": 1, "/a": 2, "/d": 3, "/c": 1} {
+		for i := 0; i < hits; i++ {
+			topk.Add([]byte(section))
+		}
+	}
+	s := &Summary{
+		SizeHist:    hdrhistogram.New(1, maxRecordableSize, 5),
+		TopSections: mergeElements(5, topk.Elements()),
+	}
+
+	str := s.String()
+	last := -1
+	for _, section := range []string{"/d", "/a", "/b", "/c", "/e"} {
+		i := strings.Index(str, "| "+section+" ")
+		if i < 0 || i < last {
+			t.Fatalf("Expected sections ordered /d, /a, /b, /c, /e, got:\n%s", str)
+		}
+		last = i
+	}
+}
+
+// TestSummaryStringTopSectionsByBytes ensures the sections which served the
+// most bytes are shown in their own table from most to least bytes.
+func TestSummaryStringTopSectionsByBytes(t *testing.T) {
+	w := newWeightedTopK(2)
+	w.Add("/pages", 300)
+	w.Add("/videos", 5000)
+	s := &Summary{
+		SizeHist:           hdrhistogram.New(1, maxRecordableSize, 5),
+		TopSectionsByBytes: w.Elements(),
+	}
+
+	str := s.String()
+	header := strings.Index(str, "| SECTION | BYTES |")
+	videos := strings.Index(str, "| /videos | 5000  |")
+	pages := strings.Index(str, "| /pages  | 300   |")
+	if header < 0 || videos < header || pages < videos {
+		t.Fatalf("Expected /videos then /pages by bytes, got:\n%s", str)
+	}
+}
+
+// TestSummaryStringHitRate ensures the hit rate statistics are shown.
+func TestSummaryStringHitRate(t *testing.T) {
+	s := &Summary{
+		SizeHist: hdrhistogram.New(1, maxRecordableSize, 5),
+		HitRate:  RateStats{Min: 1, P95: 12.5, Max: 20},
+	}
+	if str := s.String(); !strings.Contains(str, "Hits/s min/p95/max:\t1.00 / 12.50 / 20.00\n") {
+		t.Fatalf("Expected hit rate statistics, got:\n%s", str)
+	}
+}
+
+// TestSummaryStringSuccessRate ensures the success rate is shown as a
+// percentage, or n/a if there were no responses.
+func TestSummaryStringSuccessRate(t *testing.T) {
+	s := &Summary{SizeHist: hdrhistogram.New(1, maxRecordableSize, 5), SuccessRate: 1}
+	if str := s.String(); !strings.Contains(str, "Success rate:\t\tn/a\n") {
+		t.Fatalf("Expected n/a success rate, got:\n%s", str)
+	}
+
+	s.StatusFreq = statusFreq{Successful: 199, ServerError: 1}
+	s.SuccessRate = s.StatusFreq.successRate(false)
+	if str := s.String(); !strings.Contains(str, "Success rate:\t\t99.50%\n") {
+		t.Fatalf("Expected 99.50%% success rate, got:\n%s", str)
+	}
+}
+
+// TestSummaryStringRecentStatuses ensures the recent status frequencies are
+// shown alongside the totals only if they're windowed.
+func TestSummaryStringRecentStatuses(t *testing.T) {
+	s := &Summary{
+		SizeHist:         hdrhistogram.New(1, maxRecordableSize, 5),
+		StatusFreq:       statusFreq{Successful: 10, ServerError: 4},
+		RecentStatusFreq: statusFreq{Successful: 2, ServerError: 1},
+	}
+	if str := s.String(); strings.Contains(str, "Recent") {
+		t.Fatalf("Expected no recent statuses, got:\n%s", str)
+	}
+
+	s.StatusWindow = time.Minute
+	str := s.String()
+	if !strings.Contains(str, "1xx: 0, 2xx: 10, 3xx: 0, 4xx: 0, 5xx: 4\n") {
+		t.Fatalf("Expected total statuses, got:\n%s", str)
+	}
+	if !strings.Contains(str, "Recent (1m0s): 1xx: 0, 2xx: 2, 3xx: 0, 4xx: 0, 5xx: 1\n") {
+		t.Fatalf("Expected recent statuses, got:\n%s", str)
+	}
+}
+
+// TestSummaryStringTimeSpan ensures the span of the logs' timestamps is shown
+// with its duration only if logs have been collected.
+func TestSummaryStringTimeSpan(t *testing.T) {
+	s := &Summary{SizeHist: hdrhistogram.New(1, maxRecordableSize, 5)}
+	if str := s.String(); strings.Contains(str, "Time span") {
+		t.Fatalf("Expected no time span, got:\n%s", str)
+	}
+
+	s.FirstSeen = time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	s.LastSeen = s.FirstSeen.Add(2*time.Hour + 30*time.Minute)
+	if str := s.String(); !strings.Contains(str, "Time span:\t\t01/02/24 15:00:00 - 01/02/24 17:30:00 (2h30m0s)\n") {
+		t.Fatalf("Expected time span, got:\n%s", str)
+	}
+}
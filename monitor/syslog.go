@@ -0,0 +1,273 @@
+package monitor
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// maxSyslogMessageSize is the maximum size of a syslog message, which bounds
+// the size of octet-counted TCP frames and UDP datagrams.
+const maxSyslogMessageSize = 64 * 1024
+
+// maxSyslogLengthPrefix is the maximum size of the length prefix of an
+// octet-counted TCP frame, including the trailing space.
+var maxSyslogLengthPrefix = len(strconv.Itoa(maxSyslogMessageSize)) + 1
+
+// syslogRegexp matches an RFC 5424 syslog message, i.e. "<PRI>VERSION
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG". The structured
+// data is either "-" or one or more bracketed elements whose quoted parameter
+// values may contain escaped characters.
+var syslogRegexp = regexp.MustCompile(
+	`^<\d{1,3}>1 \S+ \S+ \S+ \S+ \S+ (?:-|(?:\[(?:[^"\]]|"(?:[^"\\]|\\.)*")*\])+)(?: (.*))?$`)
+
+// syslogParser is a lineParser for RFC 5424 syslog messages whose payload is
+// parsed by another lineParser, e.g. for Common Log Format.
+type syslogParser struct {
+	payload lineParser
+}
+
+// parse parses a single syslog message. It returns false if the message isn't
+// in RFC 5424 format or its payload isn't in the payload parser's format.
+func (s *syslogParser) parse(line string) (*log, bool) {
+	parts := syslogRegexp.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+	if parts == nil {
+		return nil, false
+	}
+	// The message may start with a byte order mark to indicate it's UTF-8.
+	return s.payload.parse(strings.TrimPrefix(parts[1], "\ufeff"))
+}
+
+// syslogReader implements the Reader interface for syslog messages received
+// over TCP and UDP. Each message's payload is a log line parsed by a
+// lineParser.
+type syslogReader struct {
+	lineReader
+	listener  net.Listener
+	packets   net.PacketConn
+	mu        sync.Mutex
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewSyslogReader returns a new reader which listens for RFC 5424 syslog
+// messages on the given address, e.g. ":5140", over both TCP and UDP. The
+// payload of each message is a log line in Common Log Format or Combined Log
+// Format. TCP messages may be framed by octet counting or by newlines as
+// described in RFC 6587, while each UDP datagram is a single message. The
+// reader runs until it's closed.
+func NewSyslogReader(addr string) (Reader, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen on TCP")
+	}
+	packets, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		listener.Close()
+		return nil, errors.Wrap(err, "failed to listen on UDP")
+	}
+	return &syslogReader{
+		lineReader: newLineReader("syslog "+addr, "syslog", &syslogParser{payload: commonLogFormatParser}),
+		listener:   listener,
+		packets:    packets,
+		conns:      make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// open begins receiving syslog messages and places the log entries on the
+// channel. The channel is closed once the reader is closed and all
+// connections have been shut down.
+func (s *syslogReader) open() (<-chan *log, error) {
+	s.wg.Add(2)
+	go s.accept()
+	go s.receive()
+	go func() {
+		s.wg.Wait()
+		close(s.logs)
+	}()
+	return s.logs, nil
+}
+
+// Open implements the Reader interface.
+func (s *syslogReader) Open() (<-chan *Log, error) {
+	return exportLogs(s.open())
+}
+
+// Close stops the reader, shutting down the listeners and any open
+// connections.
+func (s *syslogReader) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.close)
+		err = s.listener.Close()
+		if perr := s.packets.Close(); err == nil {
+			err = perr
+		}
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+	})
+	return err
+}
+
+// accept is a long-running loop that accepts TCP connections and reads
+// messages from each of them until the reader is closed. If accepting fails
+// for any other reason, the error is recorded and the reader is closed.
+func (s *syslogReader) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !s.closed() {
+				s.fail(errors.Wrap(err, "failed to accept connection"))
+			}
+			return
+		}
+		s.mu.Lock()
+		if s.closed() {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.read(conn)
+	}
+}
+
+// read reads and parses messages from the TCP connection until the peer
+// closes it, the reader is closed, or the framing is invalid.
+func (s *syslogReader) read(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	for {
+		msg, err := readSyslogFrame(reader)
+		if err != nil {
+			return
+		}
+		if strings.TrimSpace(msg) == "" {
+			continue
+		}
+		if !s.emit(msg) {
+			return
+		}
+	}
+}
+
+// receive is a long-running loop that reads and parses a message from each UDP
+// datagram until the reader is closed.
+func (s *syslogReader) receive() {
+	defer s.wg.Done()
+	buf := make([]byte, maxSyslogMessageSize)
+	for {
+		n, _, err := s.packets.ReadFrom(buf)
+		if err != nil {
+			if !s.closed() {
+				s.fail(errors.Wrap(err, "failed to read datagram"))
+			}
+			return
+		}
+		if !s.emit(string(buf[:n])) {
+			return
+		}
+	}
+}
+
+// emit parses the message and places the log entry on the channel. If the
+// reader fails on malformed lines and the message is malformed, the reader is
+// closed. It returns false if the reader was closed or failed.
+func (s *syslogReader) emit(msg string) bool {
+	l, err := s.parseLine(msg)
+	if err != nil {
+		s.fail(err)
+		return false
+	}
+	return s.send(l)
+}
+
+// fail records the error which caused the reader to stop, unless one was
+// already recorded, and closes the reader.
+func (s *syslogReader) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+	s.Close()
+}
+
+// closed indicates if Close has been called.
+func (s *syslogReader) closed() bool {
+	select {
+	case <-s.close:
+		return true
+	default:
+		return false
+	}
+}
+
+// readSyslogFrame reads a single syslog message from a TCP stream. A message
+// starting with a digit is octet counted, i.e. prefixed by its length and a
+// space. Otherwise, the message is terminated by a newline. Any partial message
+// at EOF is returned as complete. Messages larger than maxSyslogMessageSize are
+// rejected rather than buffered.
+func readSyslogFrame(reader *bufio.Reader) (string, error) {
+	b, err := reader.Peek(1)
+	if err != nil {
+		return "", err
+	}
+	if b[0] < '0' || b[0] > '9' {
+		msg, err := readSyslogDelimited(reader, '\n', maxSyslogMessageSize)
+		if err == io.EOF && msg != "" {
+			return msg, nil
+		}
+		return msg, err
+	}
+	prefix, err := readSyslogDelimited(reader, ' ', maxSyslogLengthPrefix)
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+	if err != nil || n > maxSyslogMessageSize {
+		return "", errors.Errorf("invalid message length %q", prefix)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(reader, msg); err != nil {
+		return "", err
+	}
+	return string(msg), nil
+}
+
+// readSyslogDelimited reads until the first occurrence of the delimiter and
+// returns the data read, including the delimiter. If the delimiter isn't found
+// within max bytes, an error is returned. At EOF, the data read is returned
+// along with io.EOF.
+func readSyslogDelimited(reader *bufio.Reader, delim byte, max int) (string, error) {
+	var buf []byte
+	for {
+		b, err := reader.ReadSlice(delim)
+		if len(buf)+len(b) > max {
+			return "", errors.Errorf("message exceeds %d bytes", max)
+		}
+		buf = append(buf, b...)
+		if err != bufio.ErrBufferFull {
+			return string(buf), err
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSyslogParser ensures the payload of RFC 5424 messages is parsed with and
+// without structured data and messages in other formats are rejected.
+func TestSyslogParser(t *testing.T) {
+	payload := `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /pages/create HTTP/1.1" 200 2326`
+	p := &syslogParser{payload: commonLogFormatParser}
+	for _, tc := range []struct {
+		msg string
+		ok  bool
+	}{
+		{"<134>1 2000-10-10T13:55:36Z web1 nginx 123 - - " + payload, true},
+		{"<134>1 2000-10-10T13:55:36Z web1 nginx - access [meta x=\"a\\]b\"][origin ip=\"10.0.0.2\"] " + payload + "\n", true},
+		{"<134>1 - - - - - - \ufeff" + payload, true},
+		{"<134>1 2000-10-10T13:55:36Z web1 nginx 123 - -", false},
+		{"<134>1 2000-10-10T13:55:36Z web1 nginx 123 - - not a log", false},
+		{"<134>Oct 10 13:55:36 web1 nginx: " + payload, false},
+		{payload, false},
+	} {
+		l, ok := p.parse(tc.msg)
+		if ok != tc.ok {
+			t.Errorf("Expected %t parsing %q, got %t", tc.ok, tc.msg, ok)
+			continue
+		}
+		if ok && (l.remoteAddr != "10.0.0.1" || l.request != "GET /pages/create HTTP/1.1" || l.status != 200) {
+			t.Errorf("Expected payload to be parsed from %q, got %+v", tc.msg, l)
+		}
+	}
+}
+
+// TestReadSyslogFrame ensures octet-counted and newline-terminated messages are
+// read from a TCP stream.
+func TestReadSyslogFrame(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("10 <1>1 - a\nb<2>1 - c\n<3>1 - d"))
+	for _, expected := range []string{"<1>1 - a\nb", "<2>1 - c\n", "<3>1 - d"} {
+		msg, err := readSyslogFrame(reader)
+		if err != nil {
+			t.Fatalf("Error reading frame: %v", err)
+		}
+		if msg != expected {
+			t.Fatalf("Expected %q, got %q", expected, msg)
+		}
+	}
+	if _, err := readSyslogFrame(reader); err == nil {
+		t.Fatal("Expected error at end of stream")
+	}
+	if _, err := readSyslogFrame(bufio.NewReader(strings.NewReader("9999999 <1>1"))); err == nil {
+		t.Fatal("Expected error for oversized frame")
+	}
+	if _, err := readSyslogFrame(bufio.NewReader(strings.NewReader(strings.Repeat("9", 100) + " <1>1"))); err == nil {
+		t.Fatal("Expected error for oversized length prefix")
+	}
+	if _, err := readSyslogFrame(bufio.NewReader(strings.NewReader(strings.Repeat("9", maxSyslogLengthPrefix)))); err == nil {
+		t.Fatal("Expected error for unterminated length prefix")
+	}
+
+	// A newline-terminated message may span several buffers but no more than
+	// the maximum message size.
+	msg := "<1>1 - " + strings.Repeat("a", maxSyslogMessageSize-8) + "\n"
+	if s, err := readSyslogFrame(bufio.NewReader(strings.NewReader(msg))); err != nil || s != msg {
+		t.Fatalf("Expected message of %d bytes, got %d bytes and %v", len(msg), len(s), err)
+	}
+	msg = "<1>1 - " + strings.Repeat("a", maxSyslogMessageSize) + "\n"
+	if _, err := readSyslogFrame(bufio.NewReader(strings.NewReader(msg))); err == nil {
+		t.Fatal("Expected error for oversized message")
+	}
+}
+
+// TestSyslogReader ensures logs are received over TCP and UDP and the channel
+// is closed once the reader is closed, even with connections open.
+func TestSyslogReader(t *testing.T) {
+	reader, err := NewSyslogReader("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	r := reader.(*syslogReader)
+	logs, err := openReader(r)
+	if err != nil {
+		t.Fatalf("Error opening reader: %v", err)
+	}
+
+	msg := "<134>1 - web1 nginx - - - " + fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700"))
+	tcp, err := net.Dial("tcp", r.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting over TCP: %v", err)
+	}
+	defer tcp.Close()
+	fmt.Fprintf(tcp, "%s%d %s", msg, len(msg), msg)
+
+	udp, err := net.Dial("udp", r.packets.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Error connecting over UDP: %v", err)
+	}
+	defer udp.Close()
+	udp.Write([]byte(msg))
+
+	for i := 0; i < 3; i++ {
+		select {
+		case l := <-logs:
+			if l.request != "GET /customers/directory.html HTTP/1.1" {
+				t.Fatalf("Expected request to be parsed, got %q", l.request)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected 3 logs, got %d", i)
+		}
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("Error closing reader: %v", err)
+	}
+	select {
+	case _, ok := <-logs:
+		if ok {
+			t.Fatal("Expected no more logs")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected channel to be closed")
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
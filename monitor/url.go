@@ -0,0 +1,173 @@
+package monitor
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// urlReader implements the Reader interface for logs fetched from an HTTP URL,
+// which are read until the end of the response body.
+type urlReader struct {
+	lineReader
+	url       string
+	client    *http.Client
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+// NewURLReader returns a new reader for logs in Common Log Format fetched from
+// the given http://, https://, or s3:// URL. The reader stops once the end of
+// the response body is reached. Bodies which are gzip-compressed, either with a
+// gzip Content-Encoding or as a .gz object, are decompressed transparently.
+//
+// S3 objects are fetched from the bucket's virtual-hosted endpoint in the
+// region given by the AWS_REGION environment variable, if set. Requests aren't
+// signed, so private objects should be read from a presigned https:// URL
+// instead.
+func NewURLReader(rawURL string) (Reader, error) {
+	return newURLReader(rawURL, commonLogFormatParser)
+}
+
+// newURLReader returns a new urlReader which parses lines fetched from the
+// given URL using the given lineParser.
+func newURLReader(rawURL string, parser lineParser) (*urlReader, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid URL %s", rawURL)
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "s3":
+		u, err = s3ObjectURL(u)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &urlReader{
+		lineReader: newLineReader(rawURL, "Common Log Format", parser),
+		url:        u.String(),
+		client:     http.DefaultClient,
+		ctx:        ctx,
+		cancel:     cancel,
+	}, nil
+}
+
+// s3ObjectURL returns the HTTPS URL of the object identified by the given
+// s3://bucket/key URL.
+func s3ObjectURL(u *url.URL) (*url.URL, error) {
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, errors.Errorf("S3 URL %s must be of the form s3://bucket/key", u)
+	}
+	host := u.Host + ".s3.amazonaws.com"
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		host = u.Host + ".s3." + region + ".amazonaws.com"
+	}
+	return &url.URL{Scheme: "https", Host: host, Path: "/" + key}, nil
+}
+
+// isURL indicates if the given log source is a URL supported by NewURLReader
+// rather than a file path.
+func isURL(source string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://"} {
+		if strings.HasPrefix(source, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// newSourceReader returns a reader for logs in Common Log Format from the given
+// source, which is either a URL supported by NewURLReader, a glob pattern, or a
+// file.
+func newSourceReader(source string, opts fileReaderOpts) (Reader, error) {
+	if isURL(source) {
+		return newURLReader(source, newCommonLogFormatParser(opts.timestampLayout))
+	}
+	if isGlob(source) {
+		return newGlobReader(source, opts)
+	}
+	return newCommonLogFormatReader(source, opts)
+}
+
+// open fetches the URL and begins reading log entries from the response body
+// and placing them on the channel. The channel is closed once the end of the
+// body is reached. An error is returned if the response isn't successful.
+func (u *urlReader) open() (<-chan *log, error) {
+	req, err := http.NewRequest(http.MethodGet, u.url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request for %s", u.source)
+	}
+	// Requesting gzip explicitly disables the transport's transparent
+	// decompression, so compressed bodies are handled the same regardless of
+	// whether the server was asked to compress them.
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := u.client.Do(req.WithContext(u.ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch %s", u.source)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, errors.Errorf("failed to fetch %s: %s", u.source, resp.Status)
+	}
+
+	body := bufio.NewReader(resp.Body)
+	var src io.Reader = body
+	if magic, _ := body.Peek(2); resp.Header.Get("Content-Encoding") == "gzip" ||
+		(len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b) {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, errors.Wrap(err, "failed to create gzip reader")
+		}
+		src = gz
+	}
+	go func() {
+		defer resp.Body.Close()
+		u.readToEOF(&abortableReader{Reader: src, ctx: u.ctx})
+	}()
+	return u.logs, nil
+}
+
+// Open implements the Reader interface.
+func (u *urlReader) Open() (<-chan *Log, error) {
+	return exportLogs(u.open())
+}
+
+// abortableReader reads from a response body which is aborted by canceling the
+// given context. The error caused by aborting the read is reported as EOF so
+// that closing the reader isn't considered a failure.
+type abortableReader struct {
+	io.Reader
+	ctx context.Context
+}
+
+func (a *abortableReader) Read(p []byte) (int, error) {
+	n, err := a.Reader.Read(p)
+	if err != nil && a.ctx.Err() != nil {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Close stops the reader, aborting the request if it's in progress.
+func (u *urlReader) Close() error {
+	u.closeOnce.Do(func() {
+		close(u.close)
+		u.cancel()
+	})
+	return nil
+}
@@ -0,0 +1,169 @@
+package monitor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestURLReader ensures logs are read from plain and gzip-compressed response
+// bodies, whether compression is indicated by Content-Encoding or not.
+func TestURLReader(t *testing.T) {
+	var (
+		now  = time.Now().Format("02/Jan/2006:15:04:05 -0700")
+		body = strings.Repeat(fmt.Sprintf(dummyLog, now), 3) + "garbage\n"
+		gz   bytes.Buffer
+	)
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(body))
+	w.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/access_log":
+			w.Write([]byte(body))
+		case "/encoded":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gz.Bytes())
+		case "/access_log.gz":
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Write(gz.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/access_log", "/encoded", "/access_log.gz"} {
+		r, err := NewURLReader(server.URL + path)
+		if err != nil {
+			t.Fatalf("Error creating reader for %s: %v", path, err)
+		}
+		logs, err := openReader(r)
+		if err != nil {
+			t.Fatalf("Error opening reader for %s: %v", path, err)
+		}
+		count := 0
+		for l := range logs {
+			if l.status != 200 || l.size != 17 {
+				t.Fatalf("Expected status 200 and size 17 from %s, got %+v", path, l)
+			}
+			count++
+		}
+		if count != 3 {
+			t.Fatalf("Expected 3 logs from %s, got %d", path, count)
+		}
+		if err := r.Err(); err != nil {
+			t.Fatalf("Expected no error from %s, got %v", path, err)
+		}
+		if skipped := r.(skipCounter).Skipped(); skipped != 1 {
+			t.Fatalf("Expected 1 skipped line from %s, got %d", path, skipped)
+		}
+		r.Close()
+	}
+
+	r, err := NewURLReader(server.URL + "/missing")
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	if _, err := openReader(r); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("Expected 404 error, got %v", err)
+	}
+}
+
+// TestURLReaderClose ensures closing the reader aborts a response which is
+// still being streamed without reporting an error.
+func TestURLReaderClose(t *testing.T) {
+	var (
+		line    = fmt.Sprintf(dummyLog, time.Now().Format("02/Jan/2006:15:04:05 -0700"))
+		release = make(chan struct{})
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(line))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	r, err := NewURLReader(server.URL)
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	logs, err := openReader(r)
+	if err != nil {
+		t.Fatalf("Error opening reader: %v", err)
+	}
+	<-logs
+	r.Close()
+	for range logs {
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+// TestNewURLReader ensures S3 URLs are mapped to their HTTPS endpoints and
+// unsupported URLs are rejected.
+func TestNewURLReader(t *testing.T) {
+	defer os.Setenv("AWS_REGION", os.Getenv("AWS_REGION"))
+	os.Setenv("AWS_REGION", "")
+	r, err := newURLReader("s3://logs/2024/access_log.gz", commonLogFormatParser)
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	if r.url != "https://logs.s3.amazonaws.com/2024/access_log.gz" {
+		t.Fatalf("Expected global S3 endpoint, got %s", r.url)
+	}
+
+	os.Setenv("AWS_REGION", "eu-west-1")
+	r, err = newURLReader("s3://logs/access_log", commonLogFormatParser)
+	if err != nil {
+		t.Fatalf("Error creating reader: %v", err)
+	}
+	if r.url != "https://logs.s3.eu-west-1.amazonaws.com/access_log" {
+		t.Fatalf("Expected regional S3 endpoint, got %s", r.url)
+	}
+
+	for _, u := range []string{"s3://logs", "ftp://example.com/access_log"} {
+		if _, err := newURLReader(u, commonLogFormatParser); err == nil {
+			t.Fatalf("Expected error for %s", u)
+		}
+	}
+}
+
+// TestMonitorURL ensures a Monitor reads logs from a URL passed as its file.
+func TestMonitorURL(t *testing.T) {
+	now := time.Now().Format("02/Jan/2006:15:04:05 -0700")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat(fmt.Sprintf(dummyLog, now), 5)))
+	}))
+	defer server.Close()
+
+	m, err := New(server.URL+"/access_log", MonitorOpts{
+		AlertWindow:    testAlertWindow,
+		NumTopSections: 1,
+		NumTopIPs:      1,
+		NoFollow:       true,
+		Output:         ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Monitor: %v", err)
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("Error running Monitor: %v", err)
+	}
+	if s := m.Snapshot(); s.TotalRequests != 5 {
+		t.Fatalf("Expected 5 requests, got %d", s.TotalRequests)
+	}
+}
@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// w3cFieldsDirective is the directive which defines the fields of the
+	// subsequent W3C Extended Log File Format entries.
+	w3cFieldsDirective = "#Fields:"
+
+	// w3cTimeLayout is the layout of the combined date and time fields used by
+	// W3C Extended Log File Format. Times are in UTC.
+	w3cTimeLayout = "2006-01-02 15:04:05"
+
+	// w3cDefaultVersion is the protocol version used for the request line if
+	// the cs-version field isn't logged, which is the case for IIS by default.
+	w3cDefaultVersion = "HTTP/1.1"
+)
+
+// w3cParser is a lineParser for W3C Extended Log File Format, e.g. as written
+// by IIS. The columns of each entry are defined by the most recent #Fields
+// directive.
+type w3cParser struct {
+	fields []string
+}
+
+// NewW3CReader returns a new reader for log files using W3C Extended Log File
+// Format, such as those written by IIS. Column positions are learned from the
+// #Fields directive, and a new #Fields directive mid-file redefines them for
+// subsequent entries. Other directives are ignored, as are entries which occur
+// before the first #Fields directive.
+func NewW3CReader(file string) (Reader, error) {
+	return newFileReader(file, "W3C Extended Log File Format", new(w3cParser), fileReaderOpts{})
+}
+
+// parse parses a single log line. Directive lines are consumed without
+// producing a log entry. It returns false if the line does not match the
+// current #Fields directive or a value could not be parsed.
+func (w *w3cParser) parse(line string) (*log, bool) {
+	if strings.HasPrefix(line, "#") {
+		if strings.HasPrefix(line, w3cFieldsDirective) {
+			w.fields = strings.Fields(strings.TrimPrefix(line, w3cFieldsDirective))
+		}
+		return nil, true
+	}
+
+	values := strings.Fields(line)
+	if len(w.fields) == 0 || len(values) != len(w.fields) {
+		return nil, false
+	}
+
+	var (
+		l                            = new(log)
+		date, clock                  string
+		method, stem, query, version string
+		err                          error
+	)
+	for i, field := range w.fields {
+		value := values[i]
+		if value == "-" {
+			continue
+		}
+		switch field {
+		case "date":
+			date = value
+		case "time":
+			clock = value
+		case "c-ip":
+			l.remoteAddr = normalizeAddr(value)
+		case "cs-username":
+			l.userID = value
+		case "cs-method":
+			method = value
+		case "cs-uri-stem":
+			stem = value
+		case "cs-uri-query":
+			query = value
+		case "cs-version":
+			version = value
+		case "sc-status":
+			l.status, err = strconv.Atoi(value)
+		case "sc-bytes":
+			l.size, err = strconv.ParseInt(value, 10, 64)
+		case "time-taken":
+			// IIS logs the time taken in milliseconds.
+			var ms int64
+			ms, err = strconv.ParseInt(value, 10, 64)
+			l.responseTime = time.Duration(ms) * time.Millisecond
+		case "cs(User-Agent)":
+			// Spaces are encoded as '+' since fields are space-delimited.
+			l.userAgent = strings.Replace(value, "+", " ", -1)
+		case "cs(Referer)":
+			l.referer = value
+		case "cs(X-Forwarded-For)":
+			l.forwardedFor = value
+		}
+		if err != nil {
+			return nil, false
+		}
+	}
+
+	if date != "" && clock != "" {
+		if l.timestamp, err = time.Parse(w3cTimeLayout, date+" "+clock); err != nil {
+			return nil, false
+		}
+	}
+	if method != "" && stem != "" {
+		if query != "" {
+			stem += "?" + query
+		}
+		if version == "" {
+			version = w3cDefaultVersion
+		}
+		l.request = method + " " + stem + " " + version
+	}
+	return l, true
+}
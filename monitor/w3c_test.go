@@ -0,0 +1,63 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+// TestW3CParse ensures W3C entries are mapped onto log fields using the most
+// recent #Fields directive and that other directives are ignored.
+func TestW3CParse(t *testing.T) {
+	p := new(w3cParser)
+
+	// Entries before the first #Fields directive can't be parsed.
+	if _, ok := p.parse("2017-03-01 12:00:00 GET /index.html 200\n"); ok {
+		t.Fatal("Expected entry before #Fields directive to be rejected")
+	}
+
+	for _, line := range []string{"#Software: Microsoft Internet Information Services 8.5\n",
+		"#Fields: date time s-ip cs-method cs-uri-stem cs-uri-query c-ip cs(User-Agent) sc-status sc-bytes time-taken\n"} {
+		if l, ok := p.parse(line); !ok || l != nil {
+			t.Fatalf("Expected directive %q to be consumed", line)
+		}
+	}
+
+	l, ok := p.parse("2017-03-01 12:00:00 10.0.0.2 GET /pages/create id=1 10.0.0.1 Mozilla/5.0+(Windows) 404 512 250\n")
+	if !ok || l == nil {
+		t.Fatal("Expected entry to parse")
+	}
+	if l.remoteAddr != "10.0.0.1" {
+		t.Fatalf("Expected remote address 10.0.0.1, got %s", l.remoteAddr)
+	}
+	if l.request != "GET /pages/create?id=1 HTTP/1.1" {
+		t.Fatalf("Expected request GET /pages/create?id=1 HTTP/1.1, got %s", l.request)
+	}
+	if l.userAgent != "Mozilla/5.0 (Windows)" {
+		t.Fatalf("Expected user agent Mozilla/5.0 (Windows), got %s", l.userAgent)
+	}
+	if l.status != 404 || l.size != 512 {
+		t.Fatalf("Expected status 404 and size 512, got %d and %d", l.status, l.size)
+	}
+	if l.responseTime != 250*time.Millisecond {
+		t.Fatalf("Expected response time 250ms, got %s", l.responseTime)
+	}
+	expected := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+	if !l.timestamp.Equal(expected) {
+		t.Fatalf("Expected timestamp %s, got %s", expected, l.timestamp)
+	}
+
+	// Entries with the wrong number of fields are rejected.
+	if _, ok := p.parse("2017-03-01 12:00:00 GET /index.html 200\n"); ok {
+		t.Fatal("Expected entry with missing fields to be rejected")
+	}
+
+	// A new #Fields directive redefines the columns.
+	p.parse("#Fields: sc-status cs-method cs-uri-stem cs-version\n")
+	l, ok = p.parse("500 POST /api/users HTTP/2.0\n")
+	if !ok || l == nil {
+		t.Fatal("Expected entry to parse")
+	}
+	if l.status != 500 || l.request != "POST /api/users HTTP/2.0" {
+		t.Fatalf("Expected status 500 and request POST /api/users HTTP/2.0, got %d and %s", l.status, l.request)
+	}
+}
@@ -0,0 +1,77 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// webhookTimeout is the timeout for a single webhook request.
+	webhookTimeout = 5 * time.Second
+
+	// webhookAttempts is the number of times a webhook request is attempted
+	// before giving up.
+	webhookAttempts = 4
+
+	// webhookBackoff is the initial delay between webhook attempts, which is
+	// doubled after each failed attempt.
+	webhookBackoff = 500 * time.Millisecond
+)
+
+// webhook delivers JSON payloads to a URL via HTTP POST.
+type webhook struct {
+	url      string
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+}
+
+// newWebhook creates a webhook which POSTs to the given URL.
+func newWebhook(url string) *webhook {
+	return &webhook{
+		url:      url,
+		client:   &http.Client{Timeout: webhookTimeout},
+		attempts: webhookAttempts,
+		backoff:  webhookBackoff,
+	}
+}
+
+// send POSTs the payload encoded as JSON. If the request fails or the response
+// status is not 2xx, it's retried with exponential backoff. Retries stop early
+// if the given channel is closed.
+func (w *webhook) send(payload interface{}, stop <-chan struct{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode payload")
+	}
+	backoff := w.backoff
+	for attempt := 1; ; attempt++ {
+		err = w.post(body)
+		if err == nil || attempt == w.attempts {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-stop:
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// post makes a single POST request with the given JSON body.
+func (w *webhook) post(body []byte) error {
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to POST to webhook")
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("webhook returned status %s", resp.Status)
+	}
+	return nil
+}
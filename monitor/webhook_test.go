@@ -0,0 +1,51 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestWebhookRetry ensures alerts are POSTed as JSON and retried when the
+// webhook responds with a non-2xx status.
+func TestWebhookRetry(t *testing.T) {
+	var (
+		requests = 0
+		alerts   = make(chan Alert, 2)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var a Alert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Errorf("Error decoding alert: %v", err)
+		}
+		alerts <- a
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	w := newWebhook(server.URL)
+	w.backoff = time.Millisecond
+	if err := w.send(Alert{AvgHits: 12.5, Time: time.Now()}, nil); err != nil {
+		t.Fatalf("Error sending alert: %v", err)
+	}
+	if requests != 2 {
+		t.Fatalf("Expected 2 requests, got %d", requests)
+	}
+	if a := <-alerts; a.AvgHits != 12.5 || a.Recovered {
+		t.Fatalf("Expected triggered alert with 12.5 avg hits, got %+v", a)
+	}
+
+	// Ensure it gives up after the configured number of attempts.
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	w.attempts = 2
+	if err := w.send(Alert{}, nil); err == nil {
+		t.Fatal("Expected error after failed attempts")
+	}
+}
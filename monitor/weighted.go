@@ -0,0 +1,66 @@
+package monitor
+
+import (
+	"github.com/tylertreat/BoomFilters"
+)
+
+// weightedTopKFactor is the number of elements a weightedTopK counts per
+// element it reports. Counting more than k elements makes it unlikely that a
+// heavy element is evicted before it accumulates enough weight to stay.
+const weightedTopKFactor = 10
+
+// weightedTopK tracks the top-k elements by total weight, e.g. sections by
+// bytes served, which a TopK can't since it only counts occurrences. It uses
+// the Space-Saving algorithm: a bounded number of elements are counted, and
+// once it's full, a new element replaces the one with the least weight and
+// inherits its weight. Weights are overestimated by at most the least weight
+// counted, and any element whose weight exceeds that is guaranteed to be
+// counted.
+type weightedTopK struct {
+	k       uint
+	weights map[string]uint64
+}
+
+// newWeightedTopK returns a weightedTopK which tracks the k heaviest elements.
+func newWeightedTopK(k uint) *weightedTopK {
+	return &weightedTopK{k: k, weights: make(map[string]uint64, k*weightedTopKFactor)}
+}
+
+// Add adds the given weight to the element.
+func (w *weightedTopK) Add(data string, weight uint64) {
+	if _, ok := w.weights[data]; ok || uint(len(w.weights)) < w.k*weightedTopKFactor {
+		w.weights[data] += weight
+		return
+	}
+	var (
+		lightest string
+		min      uint64
+		first    = true
+	)
+	for d, weight := range w.weights {
+		if first || weight < min {
+			lightest, min, first = d, weight, false
+		}
+	}
+	delete(w.weights, lightest)
+	w.weights[data] = min + weight
+}
+
+// Elements returns the top-k elements ordered as by sortElements, with their
+// weights as their frequencies.
+func (w *weightedTopK) Elements() []*boom.Element {
+	elements := make([]*boom.Element, 0, len(w.weights))
+	for data, weight := range w.weights {
+		elements = append(elements, &boom.Element{Data: []byte(data), Freq: weight})
+	}
+	sortElements(elements)
+	if uint(len(elements)) > w.k {
+		elements = elements[uint(len(elements))-w.k:]
+	}
+	return elements
+}
+
+// reset clears all of the weights.
+func (w *weightedTopK) reset() {
+	w.weights = make(map[string]uint64, w.k*weightedTopKFactor)
+}
@@ -0,0 +1,35 @@
+package monitor
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestWeightedTopK ensures elements are ranked by their total weight and that
+// a heavy element is still counted once many light elements have been added.
+func TestWeightedTopK(t *testing.T) {
+	w := newWeightedTopK(2)
+	w.Add("/a", 10)
+	w.Add("/b", 500)
+	w.Add("/a", 10)
+	w.Add("/c", 30)
+	elements := w.Elements()
+	if len(elements) != 2 || string(elements[0].Data) != "/c" || elements[0].Freq != 30 ||
+		string(elements[1].Data) != "/b" || elements[1].Freq != 500 {
+		t.Fatalf("Expected /c with 30 and /b with 500, got %v", elements)
+	}
+
+	w.reset()
+	w.Add("/heavy", 100000)
+	for i := 0; i < 1000; i++ {
+		w.Add(fmt.Sprintf("/light%d", i), 1)
+	}
+	w.Add("/heavy", 100000)
+	elements = w.Elements()
+	if len(elements) != 2 || string(elements[1].Data) != "/heavy" || elements[1].Freq < 200000 {
+		t.Fatalf("Expected /heavy to have the most weight, got %v", elements)
+	}
+	if len(w.weights) != 2*weightedTopKFactor {
+		t.Fatalf("Expected %d elements to be counted, got %d", 2*weightedTopKFactor, len(w.weights))
+	}
+}
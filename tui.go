@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tylertreat/httpmonitor/monitor"
+)
+
+const (
+	// dashboardRefreshInterval is the interval at which the dashboard is
+	// redrawn.
+	dashboardRefreshInterval = time.Second
+
+	// sparklineWidth is the number of hits/s samples shown in the sparkline.
+	sparklineWidth = 60
+
+	// ANSI escape sequences used to draw the dashboard.
+	enterAltScreen = "\x1b[?1049h"
+	exitAltScreen  = "\x1b[?1049l"
+	hideCursor     = "\x1b[?25l"
+	showCursor     = "\x1b[?25h"
+	clearScreen    = "\x1b[H\x1b[2J"
+	bold           = "\x1b[1m"
+	red            = "\x1b[31m"
+	green          = "\x1b[32m"
+	reset          = "\x1b[0m"
+)
+
+// sparks are the characters used to draw the sparkline, from lowest to
+// highest.
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// dashboard renders a live view of the Monitor's summary data which is redrawn
+// in place.
+type dashboard struct {
+	summary *monitor.Summary
+	hits    []uint64 // hits/s samples for the sparkline, oldest first
+
+	// alerts is the latest alert of each kind, so every triggered alert is
+	// shown until it recovers, and then its recovery is shown.
+	alerts map[string]monitor.Alert
+}
+
+// runDashboard starts the Monitor and renders a dashboard of its summary data
+// in the terminal until q is pressed, the process is interrupted, or the
+// Monitor stops. Alerts received on the given channel are displayed. The
+// Monitor is stopped and the terminal restored before returning.
+func runDashboard(m *monitor.Monitor, alerts <-chan monitor.Alert) error {
+	// Read keys from the terminal rather than stdin since logs may be piped
+	// to stdin.
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return errors.Wrap(err, "failed to open terminal")
+	}
+	defer tty.Close()
+	restore, err := rawTerminal(tty)
+	if err != nil {
+		return errors.Wrap(err, "failed to configure terminal")
+	}
+	defer restore()
+
+	fmt.Print(enterAltScreen + hideCursor)
+	defer fmt.Print(showCursor + exitAltScreen)
+
+	done := make(chan error, 1)
+	go func() { done <- m.Start() }()
+
+	keys := make(chan byte, 1)
+	go readKeys(tty, keys)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var (
+		d = newDashboard()
+		t = time.NewTicker(dashboardRefreshInterval)
+	)
+	defer t.Stop()
+	d.update(m.Snapshot())
+	d.draw(os.Stdout)
+	for {
+		select {
+		case <-t.C:
+			d.update(m.Snapshot())
+		case a := <-alerts:
+			d.alert(a)
+		case key := <-keys:
+			if key != 'q' && key != 'Q' {
+				continue
+			}
+			m.Stop()
+			return <-done
+		case <-signals:
+			m.Stop()
+			return <-done
+		case err := <-done:
+			return err
+		}
+		d.draw(os.Stdout)
+	}
+}
+
+// rawTerminal disables line buffering and echoing on the terminal so that key
+// presses can be read as they're typed. It returns a function which restores
+// the terminal's previous state.
+func rawTerminal(tty *os.File) (func(), error) {
+	stty := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = tty
+		return cmd.Output()
+	}
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("cbreak", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(strings.TrimSpace(string(state))) }, nil
+}
+
+// readKeys reads key presses from the terminal and places them on the channel
+// until reading fails. Key presses are dropped if the channel is full.
+func readKeys(tty io.Reader, keys chan<- byte) {
+	buf := make([]byte, 1)
+	for {
+		if _, err := tty.Read(buf); err != nil {
+			return
+		}
+		select {
+		case keys <- buf[0]:
+		default:
+		}
+	}
+}
+
+// newDashboard returns a new dashboard with no summary data or alerts.
+func newDashboard() *dashboard {
+	return &dashboard{alerts: make(map[string]monitor.Alert)}
+}
+
+// alert records the alert, replacing the previous alert of its kind.
+func (d *dashboard) alert(a monitor.Alert) {
+	d.alerts[a.Kind()] = a
+}
+
+// update records the latest summary data.
+func (d *dashboard) update(s *monitor.Summary) {
+	d.summary = s
+	d.hits = append(d.hits, s.HitsPerSecond)
+	if len(d.hits) > sparklineWidth {
+		d.hits = d.hits[len(d.hits)-sparklineWidth:]
+	}
+}
+
+// draw clears the screen and writes the dashboard to the given writer.
+func (d *dashboard) draw(w io.Writer) {
+	var (
+		buf bytes.Buffer
+		s   = d.summary
+	)
+	buf.WriteString(clearScreen)
+	fmt.Fprintf(&buf, "%shttpmonitor%s [%s] (press q to quit)\n\n", bold, reset, s.Timestamp.Format("01/02/06 15:04:05"))
+
+	fmt.Fprintf(&buf, "%sTraffic%s\n", bold, reset)
+	fmt.Fprintf(&buf, "  Hits/s: %d  Mean hits (%s): %.2f  Unique visitors: %d\n",
+		s.HitsPerSecond, s.Window, s.AvgHits, s.DistinctIPs)
+	fmt.Fprintf(&buf, "  %s\n\n", sparkline(d.hits))
+
+	fmt.Fprintf(&buf, "%sResponses%s\n", bold, reset)
+	fmt.Fprintf(&buf, "  1xx: %d  2xx: %d  3xx: %d  4xx: %d  5xx: %d\n\n",
+		s.StatusFreq.Informational,
+		s.StatusFreq.Successful,
+		s.StatusFreq.Redirection,
+		s.StatusFreq.ClientError,
+		s.StatusFreq.ServerError,
+	)
+
+	fmt.Fprintf(&buf, "%sTop sections%s\n", bold, reset)
+	if len(s.TopSections) == 0 {
+		buf.WriteString("  (none)\n")
+	}
+	for i := len(s.TopSections) - 1; i >= 0; i-- {
+		fmt.Fprintf(&buf, "  %-40s %d\n", s.TopSections[i].Data, s.TopSections[i].Freq)
+	}
+	buf.WriteString("\n")
+
+	fmt.Fprintf(&buf, "%sAlerts%s\n", bold, reset)
+	if len(d.alerts) == 0 {
+		buf.WriteString("  (none)\n")
+	}
+	kinds := make([]string, 0, len(d.alerts))
+	for kind := range d.alerts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		a := d.alerts[kind]
+		color := red
+		if a.Recovered {
+			color = green
+		}
+		fmt.Fprintf(&buf, "  %s%s%s\n", color, a, reset)
+	}
+	w.Write(buf.Bytes())
+}
+
+// sparkline returns the given samples drawn as a sparkline scaled to the
+// largest sample.
+func sparkline(samples []uint64) string {
+	var max uint64
+	for _, sample := range samples {
+		if sample > max {
+			max = sample
+		}
+	}
+	line := make([]rune, len(samples))
+	for i, sample := range samples {
+		idx := 0
+		if max > 0 {
+			idx = int(sample * uint64(len(sparks)-1) / max)
+		}
+		line[i] = sparks[idx]
+	}
+	return string(line)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylertreat/BoomFilters"
+	"github.com/tylertreat/httpmonitor/monitor"
+)
+
+// TestDashboardDraw ensures the dashboard shows the summary data and the
+// latest alert of each kind using the Monitor's alert messages.
+func TestDashboardDraw(t *testing.T) {
+	d := newDashboard()
+	d.update(&monitor.Summary{
+		Timestamp:     time.Now(),
+		HitsPerSecond: 4,
+		Window:        2 * time.Minute,
+		TopSections: []*boom.Element{
+			{Data: []byte("/api"), Freq: 3},
+			{Data: []byte("/search"), Freq: 7},
+		},
+	})
+
+	var buf bytes.Buffer
+	d.draw(&buf)
+	out := buf.String()
+	if !strings.Contains(out, "Hits/s: 4") {
+		t.Errorf("Expected hits/s in dashboard, got %q", out)
+	}
+	if i, j := strings.Index(out, "/search"), strings.Index(out, "/api"); i < 0 || j < i {
+		t.Errorf("Expected top sections from most to least frequent, got %q", out)
+	}
+	if !strings.Contains(out, "Alerts"+reset+"\n  (none)\n") {
+		t.Errorf("Expected no alerts, got %q", out)
+	}
+
+	now := time.Now()
+	traffic := monitor.Alert{AvgHits: 12, Time: now}
+	errs := monitor.Alert{Errors: true, AvgErrors: 3, Time: now}
+	status := monitor.Alert{Status: "429", AvgStatus: 5, Time: now}
+	rule := monitor.Alert{Rule: "slow-api", Time: now}
+	for _, a := range []monitor.Alert{traffic, errs, status, rule} {
+		d.alert(a)
+	}
+	recovered := errs
+	recovered.Recovered = true
+	d.alert(recovered)
+
+	buf.Reset()
+	d.draw(&buf)
+	out = buf.String()
+	for _, a := range []monitor.Alert{traffic, status, rule} {
+		if !strings.Contains(out, red+a.String()+reset) {
+			t.Errorf("Expected triggered alert %q, got %q", a, out)
+		}
+	}
+	if !strings.Contains(out, green+recovered.String()+reset) {
+		t.Errorf("Expected recovery %q, got %q", recovered, out)
+	}
+	if strings.Contains(out, errs.String()) {
+		t.Errorf("Expected recovered alert %q to be replaced, got %q", errs, out)
+	}
+}
+
+// TestSparkline ensures samples are scaled to the largest sample.
+func TestSparkline(t *testing.T) {
+	for _, tc := range []struct {
+		samples  []uint64
+		expected string
+	}{
+		{nil, ""},
+		{[]uint64{0, 0, 0}, "▁▁▁"},
+		{[]uint64{0, 1, 2, 3, 4, 5, 6, 7}, "▁▂▃▄▅▆▇█"},
+		{[]uint64{5, 10, 20}, "▂▄█"},
+	} {
+		if s := sparkline(tc.samples); s != tc.expected {
+			t.Errorf("Expected sparkline %q for %v, got %q", tc.expected, tc.samples, s)
+		}
+	}
+}